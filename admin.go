@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adminJob is a TTS job with the title of its book for the admin listing.
+type adminJob struct {
+	ID        uint      `json:"id"`
+	BookID    uint      `json:"book_id"`
+	BookTitle string    `json:"book_title"`
+	UserID    uint      `json:"user_id"`
+	ChunkIDs  string    `json:"chunk_ids"`
+	Status    string    `json:"status"`
+	Priority  int       `json:"priority"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// listJobsHandler lists TTS jobs across all users, newest first, filtered by ?status= and
+// ?book_id= and paged with ?limit= (default 50, max 200) and ?offset=. It also returns
+// the number of jobs per status for the same book filter.
+func listJobsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be between 1 and 200", nil)
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "offset must be a non-negative integer", nil)
+		return
+	}
+
+	base := db.Model(&TTSQueueJob{})
+	if raw := c.Query("book_id"); raw != "" {
+		bookID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "book_id must be a positive integer", nil)
+			return
+		}
+		base = base.Where("tts_queue_jobs.book_id = ?", bookID)
+	}
+
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := base.Session(&gorm.Session{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count jobs", err.Error())
+		return
+	}
+	counts := map[string]int64{}
+	for _, r := range rows {
+		counts[r.Status] = r.Count
+	}
+
+	query := base.Session(&gorm.Session{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("tts_queue_jobs.status = ?", status)
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count jobs", err.Error())
+		return
+	}
+
+	jobs := []adminJob{}
+	if err := query.
+		Select("tts_queue_jobs.id, tts_queue_jobs.book_id, books.title AS book_title, tts_queue_jobs.user_id, tts_queue_jobs.chunk_ids, tts_queue_jobs.status, tts_queue_jobs.priority, tts_queue_jobs.attempts, tts_queue_jobs.last_error, tts_queue_jobs.created_at, tts_queue_jobs.updated_at").
+		Joins("LEFT JOIN books ON books.id = tts_queue_jobs.book_id").
+		Order("tts_queue_jobs.created_at DESC").
+		Limit(limit).Offset(offset).
+		Scan(&jobs).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to list jobs", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "total": total, "counts": counts, "limit": limit, "offset": offset})
+}
+
+// requeueJobHandler puts a failed job back on the queue.
+func requeueJobHandler(c *gin.Context) {
+	jobID, err := strconv.ParseUint(c.Param("job_id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid job ID", nil)
+		return
+	}
+	res := db.Model(&TTSQueueJob{}).Where("id = ? AND status = ?", jobID, "failed").Updates(map[string]interface{}{"status": "queued", "attempts": 0, "next_attempt_at": nil})
+	if res.Error != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to requeue job", res.Error.Error())
+		return
+	}
+	if res.RowsAffected == 0 {
+		var job TTSQueueJob
+		if err := db.First(&job, jobID).Error; err != nil {
+			respondError(c, http.StatusNotFound, codeJobNotFound, "Job not found", nil)
+			return
+		}
+		respondError(c, http.StatusConflict, codeConflict, "Only failed jobs can be requeued", gin.H{"status": job.Status})
+		return
+	}
+	wake(jobQueued)
+	c.JSON(http.StatusOK, gin.H{"message": "Job requeued", "job_id": jobID, "status": "queued"})
+}
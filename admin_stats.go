@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminUserVolume is one user's share of the narration load, over all usage periods.
+type adminUserVolume struct {
+	UserID       uint    `json:"user_id"`
+	Books        int64   `json:"books"`
+	AudioSeconds float64 `json:"audio_seconds"`
+}
+
+// statusCount is one row of a GROUP BY status count.
+type statusCount struct {
+	Status string
+	Count  int64
+}
+
+// countByStatus counts the rows of model per status.
+func countByStatus(model interface{}) (map[string]int64, int64, error) {
+	var rows []statusCount
+	if err := db.Model(model).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	counts := map[string]int64{}
+	var total int64
+	for _, r := range rows {
+		counts[r.Status] = r.Count
+		total += r.Count
+	}
+	return counts, total, nil
+}
+
+// adminStatsHandler summarizes the service for the operator dashboard: books and jobs
+// per status, narrated audio, average processing time and the ?top= (default 10, max
+// 100) users with the most narrated audio. Everything is computed in the database.
+// Audio is summed from UserUsage, which is recorded as books are narrated; page
+// durations are only measured lazily, so summing them would undercount.
+func adminStatsHandler(c *gin.Context) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+	if err != nil || top < 1 || top > 100 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "top must be between 1 and 100", nil)
+		return
+	}
+
+	books, totalBooks, err := countByStatus(&Book{})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count books", err.Error())
+		return
+	}
+	jobs, totalJobs, err := countByStatus(&TTSQueueJob{})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count jobs", err.Error())
+		return
+	}
+
+	var audio struct {
+		Seconds float64
+		Pages   int64
+	}
+	if err := db.Model(&UserUsage{}).Select("COALESCE(SUM(audio_seconds), 0)").Scan(&audio.Seconds).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to sum audio", err.Error())
+		return
+	}
+	if err := db.Model(&BookChunk{}).Where("tts_status = ?", "completed").Count(&audio.Pages).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count narrated pages", err.Error())
+		return
+	}
+
+	var processing struct {
+		Average float64
+		Samples int64
+	}
+	if err := db.Model(&ProcessingSample{}).
+		Select("COALESCE(AVG(duration_seconds), 0) AS average, COUNT(*) AS samples").
+		Scan(&processing).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to average processing time", err.Error())
+		return
+	}
+
+	topUsers := []adminUserVolume{}
+	if err := db.Model(&UserUsage{}).
+		Select("user_id, SUM(books_processed) AS books, SUM(audio_seconds) AS audio_seconds").
+		Group("user_id").
+		Order("audio_seconds DESC, books DESC").
+		Limit(top).
+		Scan(&topUsers).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to rank users", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"books": gin.H{
+			"total":     totalBooks,
+			"by_status": books,
+		},
+		"jobs": gin.H{
+			"total":     totalJobs,
+			"by_status": jobs,
+		},
+		"audio": gin.H{
+			"total_seconds":  audio.Seconds,
+			"narrated_pages": audio.Pages,
+		},
+		"processing": gin.H{
+			"average_seconds": processing.Average,
+			"samples":         processing.Samples,
+		},
+		"top_users": topUsers,
+	})
+}
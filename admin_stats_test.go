@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestAdminStats(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT status, COUNT\(\*\) AS count FROM "books" .*GROUP BY "status"`).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("completed", 4).AddRow("processing", 1))
+	mock.ExpectQuery(`SELECT status, COUNT\(\*\) AS count FROM "tts_queue_jobs" GROUP BY "status"`).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("queued", 2))
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(audio_seconds\), 0\) FROM "user_usages"`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(3600.5))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "book_chunks" WHERE tts_status = \$1`).
+		WithArgs("completed").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(120))
+	mock.ExpectQuery(`SELECT COALESCE\(AVG\(duration_seconds\), 0\) AS average, COUNT\(\*\) AS samples FROM "processing_samples"`).
+		WillReturnRows(sqlmock.NewRows([]string{"average", "samples"}).AddRow(42.5, 8))
+	mock.ExpectQuery(`SELECT user_id, SUM\(books_processed\) AS books, SUM\(audio_seconds\) AS audio_seconds FROM "user_usages" GROUP BY "user_id" ORDER BY audio_seconds DESC, books DESC LIMIT \$1`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "books", "audio_seconds"}).AddRow(7, 3, 3000).AddRow(8, 1, 600.5))
+
+	w := adminGroupRequest(t, "/admin/stats?top=2", "a-real-secret", jwt.MapClaims{"user_id": 1.0, "role": "admin"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Books struct {
+			Total    int64            `json:"total"`
+			ByStatus map[string]int64 `json:"by_status"`
+		} `json:"books"`
+		Jobs struct {
+			Total    int64            `json:"total"`
+			ByStatus map[string]int64 `json:"by_status"`
+		} `json:"jobs"`
+		Audio struct {
+			TotalSeconds  float64 `json:"total_seconds"`
+			NarratedPages int64   `json:"narrated_pages"`
+		} `json:"audio"`
+		Processing struct {
+			AverageSeconds float64 `json:"average_seconds"`
+			Samples        int64   `json:"samples"`
+		} `json:"processing"`
+		TopUsers []adminUserVolume `json:"top_users"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Books.Total != 5 || body.Books.ByStatus["processing"] != 1 || body.Jobs.Total != 2 {
+		t.Errorf("counts = books %d %v, jobs %d; want books 5 with 1 processing, jobs 2", body.Books.Total, body.Books.ByStatus, body.Jobs.Total)
+	}
+	if body.Audio.TotalSeconds != 3600.5 || body.Audio.NarratedPages != 120 {
+		t.Errorf("audio = %+v, want 3600.5s over 120 pages", body.Audio)
+	}
+	if body.Processing.AverageSeconds != 42.5 || body.Processing.Samples != 8 {
+		t.Errorf("processing = %+v, want 42.5s average of 8", body.Processing)
+	}
+	if len(body.TopUsers) != 2 || body.TopUsers[0] != (adminUserVolume{UserID: 7, Books: 3, AudioSeconds: 3000}) {
+		t.Errorf("top users = %+v, want user 7 first of 2", body.TopUsers)
+	}
+}
+
+func TestAdminStatsRequiresAdmin(t *testing.T) {
+	mockDB(t)
+	w := adminGroupRequest(t, "/admin/stats", "a-real-secret", jwt.MapClaims{"user_id": 7.0})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestListJobsFiltersAndPages(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT status, COUNT\(\*\) AS count FROM "tts_queue_jobs" WHERE tts_queue_jobs.book_id = \$1 GROUP BY "status"`).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow("failed", 2).AddRow("complete", 5))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "tts_queue_jobs" WHERE tts_queue_jobs.book_id = \$1 AND tts_queue_jobs.status = \$2`).
+		WithArgs(uint64(3), "failed").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT tts_queue_jobs.id, .*books.title AS book_title.* FROM "tts_queue_jobs" LEFT JOIN books ON books.id = tts_queue_jobs.book_id WHERE tts_queue_jobs.book_id = \$1 AND tts_queue_jobs.status = \$2 ORDER BY tts_queue_jobs.created_at DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs(uint64(3), "failed", 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "book_title", "user_id", "chunk_ids", "status", "priority", "attempts", "last_error", "created_at", "updated_at"}).
+			AddRow(8, 3, "Moby Dick", 7, "10,11", "failed", 5, 3, "boom", time.Now(), time.Now()))
+
+	w := httptest.NewRecorder()
+	userRouter(1, http.MethodGet, "/admin/jobs", listJobsHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/jobs?book_id=3&status=failed&limit=1&offset=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Jobs   []adminJob       `json:"jobs"`
+		Total  int64            `json:"total"`
+		Counts map[string]int64 `json:"counts"`
+		Limit  int              `json:"limit"`
+		Offset int              `json:"offset"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Jobs) != 1 || body.Jobs[0].ID != 8 || body.Jobs[0].BookTitle != "Moby Dick" || body.Jobs[0].LastError != "boom" {
+		t.Fatalf("jobs = %+v, want job 8 of Moby Dick", body.Jobs)
+	}
+	// Counts cover every status of the book, not just the filtered one
+	if want := map[string]int64{"failed": 2, "complete": 5}; body.Total != 2 || !maps.Equal(body.Counts, want) {
+		t.Errorf("total = %d, counts = %v; want 2 and %v", body.Total, body.Counts, want)
+	}
+	if body.Limit != 1 || body.Offset != 1 {
+		t.Errorf("page = limit %d offset %d, want 1 and 1", body.Limit, body.Offset)
+	}
+}
+
+func TestListJobsRejectsBadPaging(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=201", "limit=x", "offset=-1", "book_id=abc"} {
+		mockDB(t)
+		w := httptest.NewRecorder()
+		userRouter(1, http.MethodGet, "/admin/jobs", listJobsHandler).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/jobs?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+// expectRequeue expects requeueJobHandler's update of failed job 8, affecting rows rows.
+func expectRequeue(mock sqlmock.Sqlmock, rows int64) {
+	expectWrite(mock, `UPDATE "tts_queue_jobs" SET "attempts"=\$1,"next_attempt_at"=\$2,"status"=\$3,"updated_at"=\$4 WHERE id = \$5 AND status = \$6`).
+		WithArgs(0, nil, "queued", sqlmock.AnyArg(), uint64(8), "failed").
+		WillReturnResult(sqlmock.NewResult(0, rows))
+}
+
+func requeueJob() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	userRouter(1, http.MethodPost, "/admin/jobs/:job_id/requeue", requeueJobHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/jobs/8/requeue", nil))
+	return w
+}
+
+func TestRequeueFailedJob(t *testing.T) {
+	drain(jobQueued)
+	t.Cleanup(func() { drain(jobQueued) })
+	mock := mockDB(t)
+	expectRequeue(mock, 1)
+
+	if w := requeueJob(); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if len(jobQueued) != 1 {
+		t.Error("requeued job did not wake the worker")
+	}
+}
+
+func TestRequeueJobNotFailed(t *testing.T) {
+	mock := mockDB(t)
+	expectRequeue(mock, 0)
+	mock.ExpectQuery(`SELECT \* FROM "tts_queue_jobs" WHERE "tts_queue_jobs"."id" = \$1`).
+		WithArgs(uint64(8), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(8, "processing"))
+
+	w := requeueJob()
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+	var body struct{ Error APIError }
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	details, _ := body.Error.Details.(map[string]any)
+	if body.Error.Code != codeConflict || details["status"] != "processing" {
+		t.Errorf("error = %+v, want %s naming the job's status", body.Error, codeConflict)
+	}
+}
+
+func TestRequeueMissingJob(t *testing.T) {
+	mock := mockDB(t)
+	expectRequeue(mock, 0)
+	mock.ExpectQuery(`SELECT \* FROM "tts_queue_jobs"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	if w := requeueJob(); w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// APIError is the body of every error response, wrapped as {"error": APIError}. Code is
+// stable for clients to switch on; Message is for humans and may change.
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Error codes returned in APIError.Code.
+const (
+	codeInvalidRequest      = "INVALID_REQUEST"
+	codeInvalidCategory     = "INVALID_CATEGORY"
+	codeInvalidTTSProvider  = "INVALID_TTS_PROVIDER"
+	codeInvalidLanguage     = "INVALID_LANGUAGE"
+	codeInvalidOutputFormat = "INVALID_OUTPUT_FORMAT"
+	codeInvalidVoice        = "INVALID_VOICE"
+	codeInvalidSort         = "INVALID_SORT"
+	codeInvalidFileType     = "INVALID_FILE_TYPE"
+	codeContentTooLong      = "CONTENT_TOO_LONG"
+	codeContentRejected     = "CONTENT_REJECTED"
+	codeUnauthorized        = "UNAUTHORIZED"
+	codeInvalidToken        = "INVALID_TOKEN"
+	codeForbidden           = "FORBIDDEN"
+	codeTrialLimitReached   = "TRIAL_LIMIT_REACHED"
+	codeBookNotFound        = "BOOK_NOT_FOUND"
+	codeChunkNotFound       = "CHUNK_NOT_FOUND"
+	codeJobNotFound         = "JOB_NOT_FOUND"
+	codeAudioNotFound       = "AUDIO_NOT_FOUND"
+	codeNotFound            = "NOT_FOUND"
+	codeBookProcessing      = "BOOK_PROCESSING"
+	codeConflict            = "CONFLICT"
+	codeQuotaExceeded       = "QUOTA_EXCEEDED"
+	codeRateLimited         = "RATE_LIMITED"
+	codeUpstreamError       = "UPSTREAM_ERROR"
+	codeInternalError       = "INTERNAL_ERROR"
+)
+
+// respondError writes an APIError with the given status. details is optional: an error
+// string, or extra fields such as the allowed values of a rejected parameter.
+func respondError(c *gin.Context, status int, code, msg string, details interface{}) {
+	c.JSON(status, gin.H{"error": APIError{Code: code, Message: msg, Details: details}})
+}
+
+// abortWithError is respondError for middleware: it also stops the handler chain.
+func abortWithError(c *gin.Context, status int, code, msg string, details interface{}) {
+	c.AbortWithStatusJSON(status, gin.H{"error": APIError{Code: code, Message: msg, Details: details}})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(*gin.Context)
+		status  int
+		want    map[string]interface{}
+	}{
+		{
+			"with details",
+			func(c *gin.Context) {
+				respondError(c, http.StatusBadRequest, codeInvalidOutputFormat, "Invalid output_format", gin.H{"allowed": []string{"mp3"}})
+			},
+			http.StatusBadRequest,
+			map[string]interface{}{"code": "INVALID_OUTPUT_FORMAT", "message": "Invalid output_format", "details": map[string]interface{}{"allowed": []interface{}{"mp3"}}},
+		},
+		{
+			"without details",
+			func(c *gin.Context) { respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil) },
+			http.StatusNotFound,
+			map[string]interface{}{"code": "BOOK_NOT_FOUND", "message": "Book not found"},
+		},
+		{
+			"from middleware",
+			func(c *gin.Context) {
+				abortWithError(c, http.StatusForbidden, codeForbidden, "Admin role required", nil)
+			},
+			http.StatusForbidden,
+			map[string]interface{}{"code": codeForbidden, "message": "Admin role required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			tt.respond(c)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != 1 {
+				t.Fatalf("body = %v, want only an \"error\" key", body)
+			}
+			if !reflect.DeepEqual(body["error"], tt.want) {
+				t.Fatalf("error = %v, want %v", body["error"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Kinds of AudioArtifact.
+const (
+	artifactMergedChunks = "merged_chunks" // a range of pages concatenated into one MP3
+	artifactPageFinal    = "page_final"    // one page after music, effects and encoding
+)
+
+// AudioArtifact records where a produced audio file was written, keyed by book, kind and
+// page range, so handlers look the file up instead of globbing for naming schemes.
+type AudioArtifact struct {
+	ID        uint   `gorm:"primaryKey"`
+	BookID    uint   `gorm:"not null;index:idx_audio_artifacts_lookup"`
+	Kind      string `gorm:"size:32;not null;index:idx_audio_artifacts_lookup"`
+	StartIdx  int    // First page index covered
+	EndIdx    int    // Last page index covered
+	Path      string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// recordAudioArtifact registers a file produced for pages start..end of a book.
+func recordAudioArtifact(bookID uint, kind string, start, end int, path string) error {
+	return db.Create(&AudioArtifact{BookID: bookID, Kind: kind, StartIdx: start, EndIdx: end, Path: path}).Error
+}
+
+// latestAudioArtifact returns the path of the most recently recorded artifact of a kind
+// for a book, skipping files that have since disappeared or are empty.
+func latestAudioArtifact(bookID uint, kind string) (string, bool) {
+	var artifacts []AudioArtifact
+	if err := db.Where("book_id = ? AND kind = ?", bookID, kind).Order("id DESC").Find(&artifacts).Error; err != nil {
+		log.Printf("⚠️ Failed to look up %s audio of book %d: %v", kind, bookID, err)
+		return "", false
+	}
+	for _, a := range artifacts {
+		if info, err := os.Stat(a.Path); err == nil && !info.IsDir() && info.Size() > 0 {
+			return a.Path, true
+		}
+	}
+	return "", false
+}
+
+// audioArtifactPaths lists every artifact file recorded for a book.
+func audioArtifactPaths(bookID uint) []string {
+	var paths []string
+	db.Model(&AudioArtifact{}).Where("book_id = ?", bookID).Order("id ASC").Pluck("path", &paths)
+	return paths
+}
+
+// backfillAudioArtifacts registers merged audio and finished pages produced before the
+// registry existed. Rows already present are left alone, so it is safe on every start.
+func backfillAudioArtifacts() {
+	stmts := []string{
+		`INSERT INTO audio_artifacts (book_id, kind, start_idx, end_idx, path, created_at)
+		SELECT g.book_id, '` + artifactMergedChunks + `', g.start_idx, g.end_idx, g.audio_path, g.created_at
+		FROM processed_chunk_groups g
+		WHERE g.deleted_at IS NULL AND g.audio_path <> '' AND NOT EXISTS (
+			SELECT 1 FROM audio_artifacts a WHERE a.book_id = g.book_id AND a.path = g.audio_path)`,
+		`INSERT INTO audio_artifacts (book_id, kind, start_idx, end_idx, path, created_at)
+		SELECT c.book_id, '` + artifactPageFinal + `', c."index", c."index", c.final_audio_path, NOW()
+		FROM book_chunks c
+		WHERE c.final_audio_path <> '' AND NOT EXISTS (
+			SELECT 1 FROM audio_artifacts a WHERE a.book_id = c.book_id AND a.path = c.final_audio_path)`,
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("⚠️ Failed to backfill audio artifacts: %v", err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMergedJobAudioIsRecorded(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pages := []string{filepath.Join("audio", "page_0.mp3"), filepath.Join("audio", "page_1.mp3")}
+	for _, p := range pages {
+		if err := os.WriteFile(p, []byte("audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeFFmpeg(t, `eval out=\${$#}
+echo merged > "$out"`)
+	merged := mergedChunkAudioPath(3, 0, 1)
+
+	mock := mockDB(t)
+	// Both pages are narrated already, so the job only merges them
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE id IN \(\$1,\$2\) AND book_id = \$3`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "audio_path", "tts_status"}).
+			AddRow(10, 3, 0, pages[0], "completed").
+			AddRow(11, 3, 1, pages[1], "completed"))
+	mock.ExpectQuery(`SELECT "id","tts_provider" FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tts_provider"}).AddRow(3, ""))
+	mock.ExpectQuery(`SELECT \* FROM "processed_chunk_groups"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	expectInsert(mock, `INSERT INTO "processed_chunk_groups"`, 1)
+	expectInsert(mock, `INSERT INTO "audio_artifacts" \("book_id","kind","start_idx","end_idx","path","created_at"\)`, 1).
+		WithArgs(uint(3), artifactMergedChunks, 0, 1, merged, sqlmock.AnyArg())
+	// Nothing was narrated, so there are no effects to mix; stop at the book lookup
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).WillReturnError(errors.New("stop"))
+
+	if err := processChunkIDsJob(context.Background(), TTSQueueJob{ID: 5, BookID: 3, ChunkIDs: "10,11"}); err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(merged) {
+		t.Fatalf("merged audio %s was not written", merged)
+	}
+}
+
+func TestLatestAudioArtifact(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	// Glob order and modification time would both pick _9; the artifact recorded last
+	// wins regardless
+	for name, content := range map[string]string{"book_3_chunks_0_9.mp3": "old", "book_3_chunks_0_10.mp3": "new", "empty.mp3": ""} {
+		if err := os.WriteFile(path(name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path("book_3_chunks_0_10.mp3"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		artifacts []string // newest first
+		want      string
+	}{
+		{"newest recorded", []string{path("book_3_chunks_0_10.mp3"), path("book_3_chunks_0_9.mp3")}, path("book_3_chunks_0_10.mp3")},
+		{"newest file deleted", []string{path("gone.mp3"), path("book_3_chunks_0_9.mp3")}, path("book_3_chunks_0_9.mp3")},
+		{"newest file empty", []string{path("empty.mp3"), path("book_3_chunks_0_10.mp3")}, path("book_3_chunks_0_10.mp3")},
+		{"only unusable files", []string{path("gone.mp3"), path("empty.mp3")}, ""},
+	}
+	for _, tt := range tests {
+		mock := mockDB(t)
+		expectArtifacts(mock, artifactMergedChunks, tt.artifacts...)
+		got, ok := latestAudioArtifact(3, artifactMergedChunks)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: latestAudioArtifact = %q, %v, want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loudnormEnabled reports whether final audio is loudness-normalised (LOUDNORM_ENABLED,
+// default true).
+func loudnormEnabled() bool {
+	return getEnv("LOUDNORM_ENABLED", "true") == "true"
+}
+
+// loudnormTarget is the integrated loudness target in LUFS (LOUDNORM_TARGET_LUFS, default -16).
+func loudnormTarget() float64 {
+	target, err := strconv.ParseFloat(getEnv("LOUDNORM_TARGET_LUFS", "-16"), 64)
+	if err != nil || target > 0 || target < -70 {
+		return -16
+	}
+	return target
+}
+
+// loudnormStats are the measurements printed by the first loudnorm pass.
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// loudnormFilter builds the loudnorm filter for target. With stats it is the second,
+// linear pass using the first pass's measurements; without, the measuring pass.
+func loudnormFilter(target float64, stats *loudnormStats) string {
+	f := fmt.Sprintf("loudnorm=I=%.1f:TP=-1.5:LRA=11", target)
+	if stats == nil {
+		return f + ":print_format=json"
+	}
+	return f + fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		stats.InputI, stats.InputTP, stats.InputLRA, stats.InputThresh, stats.TargetOffset)
+}
+
+// encoderArgs picks the encoder for an output file by extension.
+func encoderArgs(path string) []string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".ogg" {
+		return audioFormats["opus"].Encoder
+	}
+	for _, f := range audioFormats {
+		if f.Ext == ext {
+			return f.Encoder
+		}
+	}
+	return audioFormats[defaultOutputFormat].Encoder
+}
+
+// normalizeLoudness runs a two-pass loudnorm over path and writes the result next to
+// it with a "_norm" suffix and extension ext, returning the new path.
+func normalizeLoudness(ctx context.Context, path, ext string) (string, error) {
+	target := loudnormTarget()
+	out, err := runFFmpeg(ctx, "", "-hide_banner", "-nostats", "-i", path, "-af", loudnormFilter(target, nil), "-f", "null", "-")
+	if err != nil {
+		return "", fmt.Errorf("loudnorm measure: %v\n%s", err, out)
+	}
+	// The measurements are the last JSON object in the log
+	start := strings.LastIndex(string(out), "{")
+	end := strings.LastIndex(string(out), "}")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("loudnorm measure: no stats in output")
+	}
+	var stats loudnormStats
+	if err := json.Unmarshal(out[start:end+1], &stats); err != nil {
+		return "", fmt.Errorf("loudnorm measure: %w", err)
+	}
+
+	normalized := strings.TrimSuffix(path, filepath.Ext(path)) + "_norm" + ext
+	args := append([]string{"-y", "-i", path, "-af", loudnormFilter(target, &stats)}, encoderArgs(normalized)...)
+	args = append(args, normalized)
+	if o, err := runFFmpeg(ctx, normalized, args...); err != nil {
+		return "", fmt.Errorf("loudnorm apply: %v\n%s", err, o)
+	}
+	return normalized, nil
+}
+
+// silenceTrimEnabled reports whether dead air is trimmed from TTS output
+// (TRIM_SILENCE_ENABLED, default true).
+func silenceTrimEnabled() bool {
+	return getEnv("TRIM_SILENCE_ENABLED", "true") == "true"
+}
+
+// silenceRemoveFilter builds a filter that trims trailing silence and, when leading is
+// set, leading silence too. Audio quieter than thresholdDB counts as silence; keepSecs
+// of it is left at each trimmed end so speech onsets and tails are not clipped.
+func silenceRemoveFilter(leading bool, thresholdDB, keepSecs float64) string {
+	trim := fmt.Sprintf("silenceremove=start_periods=1:start_threshold=%.0fdB:start_silence=%.2f", thresholdDB, keepSecs)
+	// silenceremove only trims the start reliably, so the end is trimmed on the reversed stream
+	tail := "areverse," + trim + ",areverse"
+	if leading {
+		return trim + "," + tail
+	}
+	return tail
+}
+
+// trimSilence removes leading and trailing silence from path in place. Leading
+// silence is kept when leading is false, e.g. when word timings must stay aligned.
+// Thresholds come from SILENCE_THRESHOLD_DB (default -50) and SILENCE_KEEP_SECONDS
+// (default 0.1).
+func trimSilence(ctx context.Context, path string, leading bool) error {
+	threshold, err := strconv.ParseFloat(getEnv("SILENCE_THRESHOLD_DB", "-50"), 64)
+	if err != nil || threshold >= 0 {
+		threshold = -50
+	}
+	keep, err := strconv.ParseFloat(getEnv("SILENCE_KEEP_SECONDS", "0.1"), 64)
+	if err != nil || keep < 0 {
+		keep = 0.1
+	}
+
+	ext := filepath.Ext(path)
+	trimmed := strings.TrimSuffix(path, ext) + "_trimmed" + ext
+	args := append([]string{"-y", "-i", path, "-af", silenceRemoveFilter(leading, threshold, keep)}, encoderArgs(trimmed)...)
+	args = append(args, trimmed)
+	if o, err := runFFmpeg(ctx, trimmed, args...); err != nil {
+		os.Remove(trimmed)
+		return fmt.Errorf("silenceremove: %v\n%s", err, o)
+	}
+	// Never replace speech with an empty file if the threshold swallowed everything
+	if err := validateAudioFile(trimmed); err != nil {
+		return err
+	}
+	return os.Rename(trimmed, path)
+}
+
+// crossfadeFilter chains acrossfade over n inputs so each join overlaps by durMs
+// milliseconds. The result is labelled [aout].
+func crossfadeFilter(n int, durMs int) string {
+	if n < 2 {
+		return "[0:a]anull[aout]"
+	}
+	var parts []string
+	prev := "[0:a]"
+	for i := 1; i < n; i++ {
+		out := fmt.Sprintf("[x%d]", i)
+		if i == n-1 {
+			out = "[aout]"
+		}
+		parts = append(parts, fmt.Sprintf("%s[%d:a]acrossfade=d=%.3f:c1=tri:c2=tri%s", prev, i, float64(durMs)/1000, out))
+		prev = out
+	}
+	return strings.Join(parts, ";")
+}
+
+// crossfadeMsFor clamps a crossfade of durMs to half the shortest of the inputs, whose
+// lengths are in seconds, since acrossfade fails on an input shorter than the fade and a
+// page is faded at both ends. 0 means the inputs are too short to crossfade.
+func crossfadeMsFor(durMs int, durations []float64) int {
+	for _, d := range durations {
+		if limit := int(d * 1000 / 2); limit < durMs {
+			durMs = limit
+		}
+	}
+	return max(durMs, 0)
+}
+
+// crossfadeAudioFiles joins files in order into outFile, crossfading each join by durMs,
+// shortened to fit the shortest file. Files that can't be measured or are too short to
+// crossfade are joined with concatAudioFiles instead.
+func crossfadeAudioFiles(ctx context.Context, files []string, outFile string, durMs int) error {
+	durations := make([]float64, len(files))
+	for i, f := range files {
+		d, err := getTTSDuration(f)
+		if err != nil {
+			log.Printf("⚠️ Could not measure %s, merging without crossfade: %v", f, err)
+			return concatAudioFiles(ctx, files, outFile)
+		}
+		durations[i] = d
+	}
+	fadeMs := crossfadeMsFor(durMs, durations)
+	if fadeMs <= 0 {
+		return concatAudioFiles(ctx, files, outFile)
+	}
+	if fadeMs < durMs {
+		log.Printf("✂️ Shortened crossfade from %dms to %dms to fit the shortest page", durMs, fadeMs)
+	}
+
+	var args []string
+	args = append(args, "-y")
+	for _, f := range files {
+		args = append(args, "-i", f)
+	}
+	args = append(args, "-filter_complex", crossfadeFilter(len(files), fadeMs), "-map", "[aout]")
+	args = append(args, encoderArgs(outFile)...)
+	args = append(args, outFile)
+	if o, err := runFFmpeg(ctx, outFile, args...); err != nil {
+		return fmt.Errorf("%v\n%s", err, o)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCrossfadeFilter(t *testing.T) {
+	tests := []struct {
+		n, durMs int
+		want     string
+	}{
+		{0, 500, "[0:a]anull[aout]"},
+		{1, 500, "[0:a]anull[aout]"},
+		{2, 500, "[0:a][1:a]acrossfade=d=0.500:c1=tri:c2=tri[aout]"},
+		{3, 1500, "[0:a][1:a]acrossfade=d=1.500:c1=tri:c2=tri[x1];[x1][2:a]acrossfade=d=1.500:c1=tri:c2=tri[aout]"},
+	}
+	for _, tt := range tests {
+		if got := crossfadeFilter(tt.n, tt.durMs); got != tt.want {
+			t.Errorf("crossfadeFilter(%d, %d) = %q, want %q", tt.n, tt.durMs, got, tt.want)
+		}
+	}
+}
+
+func TestCrossfadeMsFor(t *testing.T) {
+	tests := []struct {
+		durMs     int
+		durations []float64
+		want      int
+	}{
+		{1000, nil, 1000},
+		{1000, []float64{10, 5}, 1000},
+		{1000, []float64{1.5, 10}, 750},
+		{500, []float64{30, 0.9, 2}, 450},
+		{1000, []float64{0}, 0},
+		{1000, []float64{-1}, 0},
+	}
+	for _, tt := range tests {
+		if got := crossfadeMsFor(tt.durMs, tt.durations); got != tt.want {
+			t.Errorf("crossfadeMsFor(%d, %v) = %d, want %d", tt.durMs, tt.durations, got, tt.want)
+		}
+	}
+}
+
+func TestSilenceRemoveFilter(t *testing.T) {
+	trim := "silenceremove=start_periods=1:start_threshold=-50dB:start_silence=0.10"
+	tests := []struct {
+		leading bool
+		want    string
+	}{
+		{false, "areverse," + trim + ",areverse"},
+		{true, trim + ",areverse," + trim + ",areverse"},
+	}
+	for _, tt := range tests {
+		if got := silenceRemoveFilter(tt.leading, -50, 0.1); got != tt.want {
+			t.Errorf("silenceRemoveFilter(%v, -50, 0.1) = %q, want %q", tt.leading, got, tt.want)
+		}
+	}
+}
+
+func TestLoudnormFilter(t *testing.T) {
+	stats := &loudnormStats{InputI: "-20.1", InputTP: "-3.0", InputLRA: "5.2", InputThresh: "-30.5", TargetOffset: "0.3"}
+	tests := []struct {
+		name   string
+		target float64
+		stats  *loudnormStats
+		want   string
+	}{
+		{"measure pass", -16, nil, "loudnorm=I=-16.0:TP=-1.5:LRA=11:print_format=json"},
+		{"apply pass", -19, stats, "loudnorm=I=-19.0:TP=-1.5:LRA=11:measured_I=-20.1:measured_TP=-3.0:measured_LRA=5.2:measured_thresh=-30.5:offset=0.3:linear=true"},
+	}
+	for _, tt := range tests {
+		if got := loudnormFilter(tt.target, tt.stats); got != tt.want {
+			t.Errorf("%s: loudnormFilter() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncoderArgs(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"page.mp3", []string{"-c:a", "libmp3lame", "-q:a", "2"}},
+		{"page.opus", []string{"-c:a", "libopus", "-b:a", "64k"}},
+		{"page.ogg", []string{"-c:a", "libopus", "-b:a", "64k"}},
+		{"page.m4a", []string{"-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart"}},
+		{"PAGE.M4A", []string{"-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart"}},
+		{"page.wav", []string{"-c:a", "libmp3lame", "-q:a", "2"}},
+	}
+	for _, tt := range tests {
+		if got := encoderArgs(tt.path); !slices.Equal(got, tt.want) {
+			t.Errorf("encoderArgs(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioFormat describes one delivery format for finished audio.
+type audioFormat struct {
+	Ext         string
+	ContentType string
+	Encoder     []string
+}
+
+// audioFormats are the values accepted for Book.OutputFormat. MP3 is the default and
+// what TTS, mixing and effects produce internally.
+var audioFormats = map[string]audioFormat{
+	"mp3":  {Ext: ".mp3", ContentType: "audio/mpeg", Encoder: []string{"-c:a", "libmp3lame", "-q:a", "2"}},
+	"opus": {Ext: ".opus", ContentType: "audio/ogg", Encoder: []string{"-c:a", "libopus", "-b:a", "64k"}},
+	"aac":  {Ext: ".m4a", ContentType: "audio/mp4", Encoder: []string{"-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart"}},
+}
+
+// defaultOutputFormat is used for books without an OutputFormat.
+const defaultOutputFormat = "mp3"
+
+// isValidOutputFormat reports whether f is a supported Book.OutputFormat.
+func isValidOutputFormat(f string) bool {
+	_, ok := audioFormats[f]
+	return ok
+}
+
+// outputFormatOrDefault returns the book's output format, falling back to MP3.
+func outputFormatOrDefault(f string) string {
+	if isValidOutputFormat(f) {
+		return f
+	}
+	return defaultOutputFormat
+}
+
+// bookAudioExt is the file extension of a book's final audio. Each mix step writes in
+// it, so whichever step runs last produces the delivered file.
+func bookAudioExt(book Book) string {
+	return audioFormats[outputFormatOrDefault(book.OutputFormat)].Ext
+}
+
+// audioContentType returns the Content-Type for an audio file by extension.
+func audioContentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".ogg" {
+		return "audio/ogg"
+	}
+	for _, f := range audioFormats {
+		if f.Ext == ext {
+			return f.ContentType
+		}
+	}
+	return "audio/mpeg"
+}
+
+// transcodeAudio re-encodes path into format next to the source and returns the new
+// path. MP3 sources asked for MP3 are returned unchanged.
+func transcodeAudio(ctx context.Context, path, format string) (string, error) {
+	f, ok := audioFormats[format]
+	if !ok {
+		return "", fmt.Errorf("unsupported output format %q", format)
+	}
+	ext := filepath.Ext(path)
+	if strings.EqualFold(ext, f.Ext) {
+		return path, nil
+	}
+	out := strings.TrimSuffix(path, ext) + f.Ext
+	args := append([]string{"-y", "-i", path, "-vn"}, f.Encoder...)
+	args = append(args, out)
+	if o, err := runFFmpeg(ctx, out, args...); err != nil {
+		return "", fmt.Errorf("transcode to %s: %v\n%s", format, err, o)
+	}
+	return out, nil
+}
+
+// multiFormatEnabled reports whether finished books also get an Opus copy for
+// bandwidth-constrained clients (MULTI_FORMAT_ENABLED, default false).
+func multiFormatEnabled() bool {
+	return getEnv("MULTI_FORMAT_ENABLED", "false") == "true"
+}
+
+// storeBookAudioVariants records the MP3 narration of a book and, when multi-format
+// delivery is on, encodes and records an Opus copy next to it.
+func storeBookAudioVariants(ctx context.Context, bookID uint, mp3Path string) {
+	updates := map[string]interface{}{"audio_path_mp3": mp3Path}
+	if multiFormatEnabled() {
+		opus, err := transcodeAudio(ctx, mp3Path, "opus")
+		if err != nil {
+			log.Printf("⚠️ Opus encode failed for book %d: %v", bookID, err)
+		} else {
+			updates["audio_path_opus"] = opus
+		}
+	}
+	if err := db.Model(&Book{}).Where("id = ?", bookID).Updates(updates).Error; err != nil {
+		log.Printf("⚠️ Failed to save audio variants for book %d: %v", bookID, err)
+	}
+}
+
+// negotiateBookAudio picks the variant of a book's audio to serve. ?format=mp3|opus wins;
+// otherwise the Accept header is honoured in q order, and anything else gets AudioPath.
+// Variants missing on disk are skipped.
+func negotiateBookAudio(c *gin.Context, book Book) string {
+	variants := map[string]string{"mp3": book.AudioPathMP3, "opus": book.AudioPathOpus}
+	usable := func(format string) string {
+		if p := variants[format]; p != "" && fileExists(p) {
+			return p
+		}
+		return ""
+	}
+	c.Header("Vary", "Accept")
+
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		if p := usable(format); p != "" {
+			return p
+		}
+		return book.AudioPath
+	}
+
+	type accepted struct {
+		format string
+		q      float64
+	}
+	var prefs []accepted
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		fields := strings.Split(part, ";")
+		format := ""
+		switch strings.ToLower(strings.TrimSpace(fields[0])) {
+		case "audio/ogg", "audio/opus":
+			format = "opus"
+		case "audio/mpeg", "audio/mp3":
+			format = "mp3"
+		default:
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, accepted{format, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	for _, pref := range prefs {
+		if p := usable(pref.format); p != "" {
+			return p
+		}
+	}
+	return book.AudioPath
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBookAudioExt(t *testing.T) {
+	tests := []struct {
+		format, want string
+	}{
+		{"", ".mp3"},
+		{"mp3", ".mp3"},
+		{"opus", ".opus"},
+		{"aac", ".m4a"},
+		{"flac", ".mp3"},
+	}
+	for _, tt := range tests {
+		if got := bookAudioExt(Book{OutputFormat: tt.format}); got != tt.want {
+			t.Errorf("bookAudioExt(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestAudioContentType(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"a.mp3", "audio/mpeg"},
+		{"a.opus", "audio/ogg"},
+		{"a.ogg", "audio/ogg"},
+		{"a.m4a", "audio/mp4"},
+		{"a", "audio/mpeg"},
+	}
+	for _, tt := range tests {
+		if got := audioContentType(tt.path); got != tt.want {
+			t.Errorf("audioContentType(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateBookAudio(t *testing.T) {
+	dir := t.TempDir()
+	mp3, opus := filepath.Join(dir, "book.mp3"), filepath.Join(dir, "book.opus")
+	for _, p := range []string{mp3, opus} {
+		if err := os.WriteFile(p, []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	book := Book{AudioPath: "book_audio.mp3", AudioPathMP3: mp3, AudioPathOpus: opus}
+	noOpus := Book{AudioPath: "book_audio.mp3", AudioPathMP3: mp3, AudioPathOpus: filepath.Join(dir, "missing.opus")}
+
+	tests := []struct {
+		name   string
+		book   Book
+		query  string
+		accept string
+		want   string
+	}{
+		{"no preference", book, "", "", book.AudioPath},
+		{"format query", book, "?format=OPUS", "", opus},
+		{"format query beats Accept", book, "?format=mp3", "audio/ogg", mp3},
+		{"missing variant", noOpus, "?format=opus", "", noOpus.AudioPath},
+		{"unknown format", book, "?format=aac", "", book.AudioPath},
+		{"Accept ogg", book, "", "audio/ogg", opus},
+		{"Accept q order", book, "", "audio/ogg;q=0.5, audio/mpeg", mp3},
+		{"Accept skips missing variant", noOpus, "", "audio/opus, audio/mpeg;q=0.1", mp3},
+		{"Accept q=0", book, "", "audio/ogg;q=0", book.AudioPath},
+		{"Accept other types", book, "", "text/html, */*", book.AudioPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/audio"+tt.query, nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+			if got := negotiateBookAudio(c, tt.book); got != tt.want {
+				t.Fatalf("negotiateBookAudio() = %q, want %q", got, tt.want)
+			}
+			if vary := w.Header().Get("Vary"); vary != "Accept" {
+				t.Fatalf("Vary = %q, want Accept", vary)
+			}
+		})
+	}
+}
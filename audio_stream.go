@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -15,22 +14,29 @@ func streamMergedChunkAudioHandler(c *gin.Context) {
 	bookIDStr := c.Param("book_id")
 	bookID, err := strconv.Atoi(bookIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid book ID", nil)
 		return
 	}
 
-	// Check for latest merged audio for this book
-	pattern := fmt.Sprintf("./audio/merged_chunk_audio_%d*.mp3", bookID)
-	matches, err := filepath.Glob(pattern)
-	if err != nil || len(matches) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Merged audio file not found for this book"})
+	// Serve the most recently merged audio for this book
+	audioPath, ok := latestAudioArtifact(uint(bookID), artifactMergedChunks)
+	if !ok {
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Merged audio file not found for this book", nil)
 		return
 	}
-
-	// Serve the latest merged audio (use first match)
-	audioPath := matches[len(matches)-1]
 	c.Header("Content-Type", "audio/mpeg")
-	c.File(audioPath)
+	serveAudioFile(c, audioPath)
+}
+
+// serveAudioFile sends an audio file with cache validators: an ETag from its size and
+// modification time, and Last-Modified. http.ServeFile answers a matching If-None-Match
+// or If-Modified-Since with 304 and still honours Range requests for seeking.
+func serveAudioFile(c *gin.Context, path string) {
+	if info, err := os.Stat(path); err == nil {
+		c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	c.File(path)
 }
 
 func streamSinglePageAudioHandler(c *gin.Context) {
@@ -41,7 +47,7 @@ func streamSinglePageAudioHandler(c *gin.Context) {
 	pageIndex, err2 := strconv.Atoi(pageStr)
 
 	if err1 != nil || err2 != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID or page number"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid book ID or page number", nil)
 		return
 	}
 
@@ -52,13 +58,13 @@ func streamSinglePageAudioHandler(c *gin.Context) {
 		Where("book_id = ? AND \"index\" = ?", bookID, pageIndex).
 		Take(&finalPath).Error
 	if err != nil || finalPath == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Final audio not available for this page"})
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Final audio not available for this page", nil)
 		return
 	}
 	if _, err := os.Stat(finalPath); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Audio file missing on disk"})
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Audio file missing on disk", nil)
 		return
 	}
-	c.Header("Content-Type", "audio/mpeg")
-	c.File(finalPath)
+	c.Header("Content-Type", audioContentType(finalPath))
+	serveAudioFile(c, finalPath)
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeAudioFileConditional(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.mp3")
+	if err := os.WriteFile(path, []byte("not really audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/audio", func(c *gin.Context) { serveAudioFile(c, path) })
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/audio", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("", "")
+	if first.Code != http.StatusOK || first.Body.String() != "not really audio" {
+		t.Fatalf("first request = %d %q, want 200 with the file", first.Code, first.Body)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on the first response")
+	}
+
+	if w := get("If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match with the ETag = %d with %d bytes, want 304 and no body", w.Code, w.Body.Len())
+	}
+	if w := get("If-None-Match", `"stale"`); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match with another ETag = %d, want 200", w.Code)
+	}
+}
+
+// expectArtifacts expects the lookup of book 3's artifacts of kind, newest first.
+func expectArtifacts(mock sqlmock.Sqlmock, kind string, paths ...string) {
+	rows := sqlmock.NewRows([]string{"id", "book_id", "kind", "path"})
+	for i, p := range paths {
+		rows.AddRow(len(paths)-i, 3, kind, p)
+	}
+	mock.ExpectQuery(`SELECT \* FROM "audio_artifacts" WHERE book_id = \$1 AND kind = \$2 ORDER BY id DESC`).
+		WithArgs(uint(3), kind).
+		WillReturnRows(rows)
+}
+
+func TestStreamMergedChunkAudioServesMergerOutput(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The merger wrote pages 0-1 first and pages 2-3 later
+	older, newer := mergedChunkAudioPath(3, 0, 1), mergedChunkAudioPath(3, 2, 3)
+	for path, content := range map[string]string{older: "pages 0-1", newer: "pages 2-3"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mock := mockDB(t)
+	expectArtifacts(mock, artifactMergedChunks, newer, older)
+	expectArtifacts(mock, artifactMergedChunks)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/chunks/tts/merged-audio/:book_id", streamMergedChunkAudioHandler)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/chunks/tts/merged-audio/3", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusOK || w.Body.String() != "pages 2-3" || w.Header().Get("Content-Type") != "audio/mpeg" {
+		t.Errorf("merged audio = %d %q (%s), want 200 with the newest merge as audio/mpeg", w.Code, w.Body, w.Header().Get("Content-Type"))
+	}
+	if w := get(); w.Code != http.StatusNotFound {
+		t.Errorf("book without merged audio = %d, want 404", w.Code)
+	}
+}
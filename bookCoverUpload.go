@@ -4,7 +4,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -19,14 +18,14 @@ func uploadBookCoverHandler(c *gin.Context) {
 	bookID := c.Param("book_id")
 	file, err := c.FormFile("cover")
 	if bookID == "" || err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "book_id and cover file are required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "book_id and cover file are required", nil)
 		return
 	}
 
 	// validate extensions
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only JPG, JPEG, PNG allowed"})
+		respondError(c, http.StatusBadRequest, codeInvalidFileType, "Only JPG, JPEG, PNG allowed", nil)
 		return
 	}
 
@@ -38,8 +37,7 @@ func uploadBookCoverHandler(c *gin.Context) {
 	c.SaveUploadedFile(file, dest)
 
 	// immediate response
-	host := getEnv("STREAM_HOST", "https://content-service-9ncuf.ondigitalocean.app:8083")
-	coverURL := fmt.Sprintf("%s/covers/%s", host, filename)
+	coverURL := fmt.Sprintf("%s/covers/%s", streamHost(), filename)
 	c.JSON(http.StatusAccepted, gin.H{"message": "upload in progress", "cover_url": coverURL})
 
 	// async DB + MQTT
@@ -53,10 +51,7 @@ func uploadBookCoverHandler(c *gin.Context) {
 		book.CoverURL = url
 		db.Save(&book)
 
-		// publish via MQTT
-		payload := map[string]interface{}{"book_id": book.ID, "cover_url": url, "timestamp": time.Now().UTC().Format(time.RFC3339)}
-		data, _ := json.Marshal(payload)
-		topic := fmt.Sprintf("users/%d/cover_uploaded", book.UserID)
-		PublishEvent(topic, data)
+		// publish via MQTT and webhook
+		publishUserEvent(book.UserID, eventCoverUploaded, map[string]interface{}{"book_id": book.ID, "cover_url": url})
 	}(bookID, dest, coverURL)
 }
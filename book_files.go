@@ -0,0 +1,290 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BookFile is one uploaded source file of a book. The book's text is its files in
+// Position order; every file starts on a new page, so chapter breaks between files
+// are never merged into one page.
+type BookFile struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	BookID           uint      `gorm:"index;uniqueIndex:idx_book_files_book_position" json:"book_id"`
+	Position         int       `gorm:"uniqueIndex:idx_book_files_book_position" json:"position"`
+	FilePath         string    `json:"-"`
+	OriginalFilename string    `json:"original_filename"`
+	FileSizeBytes    int64     `json:"file_size_bytes"`
+	ContentHash      string    `json:"content_hash"`
+	FirstChunkIndex  int       `json:"first_page_index"` // Index of the file's first page
+	ChunkCount       int       `json:"total_pages"`
+	Characters       int       `json:"characters"` // Text paginated from the file; 0 for files recorded before it was counted
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// bookSourceFiles returns the source files of a book in order, read through tx. Books
+// uploaded before BookFile existed have no rows; their single FilePath is returned as
+// position 0.
+func bookSourceFiles(tx *gorm.DB, book Book) ([]BookFile, error) {
+	var files []BookFile
+	if err := tx.Where("book_id = ?", book.ID).Order("position ASC").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if len(files) == 0 && book.FilePath != "" {
+		var pages int64
+		tx.Model(&BookChunk{}).Where("book_id = ?", book.ID).Count(&pages)
+		files = append(files, BookFile{
+			BookID:           book.ID,
+			FilePath:         book.FilePath,
+			OriginalFilename: book.OriginalFilename,
+			FileSizeBytes:    book.FileSizeBytes,
+			ContentHash:      book.ContentHash,
+			ChunkCount:       int(pages),
+		})
+	}
+	return files, nil
+}
+
+// chunkBookFiles paginates every source file of a book in order, starting at page 0,
+// and records where each file's pages begin. It returns the total page count and
+// whether MAX_CONTENT_CHARS cut the text short; files past the cut get no pages.
+func chunkBookFiles(bookID uint, files []BookFile) (int, bool, error) {
+	total, chars, truncated := 0, 0, false
+	max := maxContentChars()
+	for i := range files {
+		var res documentPages
+		if truncated || (max > 0 && chars >= max && truncateLongContent()) {
+			res.Truncated = true
+		} else {
+			var err error
+			if res, err = chunkDocumentFrom(db, bookID, files[i].FilePath, total, chars); err != nil {
+				return total, truncated, fmt.Errorf("paginate %s: %w", files[i].OriginalFilename, err)
+			}
+		}
+		files[i].FirstChunkIndex, files[i].ChunkCount, files[i].Characters = total, res.Pages, res.Chars
+		if files[i].ID != 0 {
+			if err := db.Model(&BookFile{}).Where("id = ?", files[i].ID).Updates(map[string]interface{}{
+				"first_chunk_index": total,
+				"chunk_count":       res.Pages,
+				"characters":        res.Chars,
+			}).Error; err != nil {
+				return total, truncated, err
+			}
+		}
+		total += res.Pages
+		chars += res.Chars
+		truncated = truncated || res.Truncated
+	}
+	return total, truncated, nil
+}
+
+// bookFilesHash is the content hash of a book made of files. A single file keeps its
+// own hash so it still matches books uploaded as one file.
+func bookFilesHash(files []BookFile) (string, error) {
+	if len(files) == 1 {
+		return computeFileHash(files[0].FilePath)
+	}
+	h := sha256.New()
+	for _, f := range files {
+		data, err := readContentFile(f.FilePath)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readBookText returns the plaintext of a book's source files in order, separated by
+// blank lines.
+func readBookText(files []BookFile) (string, error) {
+	parts := make([]string, 0, len(files))
+	for _, f := range files {
+		data, err := readContentFile(f.FilePath)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// recordFirstBookFile makes the book's uploaded file its only source file after a fresh
+// upload, through tx. Call it in the transaction that replaced the book's pages
+// (clearBookPages), so the pages of files appended before go together with their rows.
+func recordFirstBookFile(tx *gorm.DB, book Book, pages documentPages) error {
+	if err := tx.Where("book_id = ?", book.ID).Delete(&BookFile{}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&BookFile{
+		BookID:           book.ID,
+		FilePath:         book.FilePath,
+		OriginalFilename: book.OriginalFilename,
+		FileSizeBytes:    book.FileSizeBytes,
+		ContentHash:      book.ContentHash,
+		ChunkCount:       pages.Pages,
+		Characters:       pages.Chars,
+	}).Error
+}
+
+// appendBookFileHandler adds another source file to the end of a book. Its pages are
+// numbered after the existing ones; narrate them with the usual chunk endpoints. The
+// pages, the file record and the book update commit together, and appends to one book
+// are serialized by the book row claimed in the transaction. The book's whole-book
+// audio no longer covers its text, so it is dropped and the book goes back to pending.
+func appendBookFileHandler(c *gin.Context) {
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if book.UserID != userID {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to modify this book", nil)
+		return
+	}
+	if book.Status == bookStatusProcessing || book.Status == bookStatusTTSCompleted {
+		respondError(c, http.StatusConflict, codeBookProcessing, "Book is processing; add files once it finishes", nil)
+		return
+	}
+	if !enforceUserQuota(c, userID, book.ID) {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "File upload error", err.Error())
+		return
+	}
+	name := strings.ToLower(file.Filename)
+	if !strings.HasSuffix(name, ".pdf") && !strings.HasSuffix(name, ".txt") {
+		respondError(c, http.StatusBadRequest, codeInvalidFileType, "Invalid file type. Only PDF and TXT files are allowed.", nil)
+		return
+	}
+
+	uploadDir := "./uploads"
+	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to create upload directory", err.Error())
+		return
+	}
+	// The position is only known once the book is claimed, so the name must not use it
+	dest := filepath.Join(uploadDir, fmt.Sprintf("book_%d_part_%d_%s", book.ID, time.Now().UnixNano(), filepath.Base(file.Filename)))
+	if err := c.SaveUploadedFile(file, dest); err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save file", err.Error())
+		return
+	}
+	hash, err := computeFileHash(dest)
+	if err != nil {
+		os.Remove(dest)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to compute file hash", err.Error())
+		return
+	}
+	if err := encryptFileAtRest(dest); err != nil {
+		os.Remove(dest)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to encrypt uploaded file", err.Error())
+		return
+	}
+
+	var files []BookFile
+	var bookFile BookFile
+	var res documentPages
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := claimReorderableBook(tx, book.ID); err != nil {
+			return err
+		}
+		if err := tx.First(&book, book.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		if files, err = bookSourceFiles(tx, book); err != nil {
+			return err
+		}
+		// Persist the original upload of an older book so the order is kept from now on
+		if len(files) == 1 && files[0].ID == 0 {
+			if err := tx.Create(&files[0]).Error; err != nil {
+				return err
+			}
+		}
+
+		maxIndex := -1
+		if err := tx.Model(&BookChunk{}).Where("book_id = ?", book.ID).Select("COALESCE(MAX(\"index\"), -1)").Scan(&maxIndex).Error; err != nil {
+			return err
+		}
+		usedChars := 0
+		for _, f := range files {
+			usedChars += f.Characters
+		}
+		if res, err = chunkDocumentFrom(tx, book.ID, dest, maxIndex+1, usedChars); err != nil {
+			return err
+		}
+
+		bookFile = BookFile{
+			BookID:           book.ID,
+			Position:         len(files),
+			FilePath:         dest,
+			OriginalFilename: file.Filename,
+			FileSizeBytes:    file.Size,
+			ContentHash:      hash,
+			FirstChunkIndex:  maxIndex + 1,
+			ChunkCount:       res.Pages,
+			Characters:       res.Chars,
+		}
+		if err := tx.Create(&bookFile).Error; err != nil {
+			return err
+		}
+		files = append(files, bookFile)
+
+		updates := map[string]interface{}{
+			"file_size_bytes":     book.FileSizeBytes + file.Size,
+			"status":              bookStatusPending,
+			"reused_from_book_id": nil,
+			"summary":             "",
+		}
+		resetBookAudioColumns(updates)
+		if res.Truncated {
+			updates["content_truncated"] = true
+		}
+		bookHash, err := bookFilesHash(files)
+		if err != nil {
+			return fmt.Errorf("hash book files: %w", err)
+		}
+		updates["content_hash"] = bookHash
+		if book.FilePath == "" {
+			updates["file_path"] = dest
+			updates["original_filename"] = file.Filename
+		}
+		return tx.Model(&Book{}).Where("id = ?", book.ID).Updates(updates).Error
+	})
+	if err != nil {
+		os.Remove(dest)
+		var tooLong *contentTooLongError
+		if errors.As(err, &tooLong) {
+			respondContentTooLong(c, tooLong)
+			return
+		}
+		respondReorderError(c, "Failed to add file to book", err)
+		return
+	}
+	removeBookAudioFiles(book)
+
+	start, pages := bookFile.FirstChunkIndex, bookFile.ChunkCount
+	logWithRequestID(requestIDFromContext(c), "📎 Added file %q to book %d as part %d (pages %d-%d)", file.Filename, book.ID, bookFile.Position+1, start, start+pages-1)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":           "File added to book",
+		"book_id":           book.ID,
+		"file":              bookFile,
+		"files":             files,
+		"total_pages":       start + pages,
+		"content_truncated": book.ContentTruncated || res.Truncated,
+	})
+}
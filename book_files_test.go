@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestChunkBookFilesKeepsFileOrder(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "part1.txt")
+	second := filepath.Join(dir, "part2.txt")
+	// 1500 characters make two pages; the second file starts on a page of its own
+	if err := os.WriteFile(first, []byte(strings.Repeat("a", 1500)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte(strings.Repeat("b", 200)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := mockDB(t)
+	insert := `INSERT INTO "book_chunks" .*VALUES`
+	for _, file := range []struct {
+		id    uint
+		pages []int
+		chars int
+	}{{1, []int{0, 1}, 1500}, {2, []int{2}, 200}} {
+		for _, index := range file.pages {
+			mock.ExpectBegin()
+			mock.ExpectQuery(insert).
+				WithArgs(append([]driver.Value{uint(3), index}, anyArgs(13)...)...).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10 + index))
+			mock.ExpectCommit()
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "book_files" SET "characters"=\$1,"chunk_count"=\$2,"first_chunk_index"=\$3 WHERE id = \$4`).
+			WithArgs(file.chars, len(file.pages), file.pages[0], file.id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	files := []BookFile{
+		{ID: 1, BookID: 3, Position: 0, FilePath: first, OriginalFilename: "part1.txt"},
+		{ID: 2, BookID: 3, Position: 1, FilePath: second, OriginalFilename: "part2.txt"},
+	}
+	total, truncated, err := chunkBookFiles(3, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || truncated {
+		t.Fatalf("chunkBookFiles() = %d pages, truncated %v; want 3, false", total, truncated)
+	}
+	if files[0].FirstChunkIndex != 0 || files[0].ChunkCount != 2 || files[1].FirstChunkIndex != 2 || files[1].ChunkCount != 1 {
+		t.Fatalf("files start at %d (%d pages) and %d (%d pages), want 0 (2) and 2 (1)",
+			files[0].FirstChunkIndex, files[0].ChunkCount, files[1].FirstChunkIndex, files[1].ChunkCount)
+	}
+}
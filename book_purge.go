@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// restoreBookHandler undoes a soft delete of one of the caller's books.
+func restoreBookHandler(c *gin.Context) {
+	var book Book
+	if err := db.Unscoped().First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to restore this book", nil)
+		return
+	}
+	if !book.DeletedAt.Valid {
+		respondError(c, http.StatusConflict, codeConflict, "Book is not deleted", nil)
+		return
+	}
+
+	if err := db.Unscoped().Model(&Book{}).Where("id = ?", book.ID).Update("deleted_at", nil).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to restore book", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Book restored", "book_id": book.ID, "status": book.Status})
+}
+
+// softDeleteRetention is how long deleted books can still be restored
+// (SOFT_DELETE_RETENTION_DAYS, default 30).
+func softDeleteRetention() time.Duration {
+	days, err := strconv.Atoi(getEnv("SOFT_DELETE_RETENTION_DAYS", "30"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// startBookPurger hard-deletes books soft-deleted longer than softDeleteRetention,
+// checking every BOOK_PURGE_INTERVAL (default 24h) until background work is cancelled.
+func startBookPurger() {
+	interval, err := time.ParseDuration(getEnv("BOOK_PURGE_INTERVAL", "24h"))
+	if err != nil || interval < time.Minute {
+		interval = 24 * time.Hour
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purgeDeletedBooks(time.Now().Add(-softDeleteRetention()))
+			select {
+			case <-backgroundCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// bookOwnedRows are the tables holding rows of one book, deleted with it when it is purged.
+var bookOwnedRows = []struct {
+	name  string
+	model interface{}
+}{
+	{"chunk groups", &ProcessedChunkGroup{}},
+	{"audio artifacts", &AudioArtifact{}},
+	{"chunks", &BookChunk{}},
+	{"files", &BookFile{}},
+	{"playback positions", &PlaybackPosition{}},
+	{"favorites", &Favorite{}},
+	{"jobs", &TTSQueueJob{}},
+	{"dead-lettered jobs", &DeadLetterJob{}},
+	{"token usage", &TokenUsage{}},
+	{"moderation results", &ModerationResult{}},
+	{"processing samples", &ProcessingSample{}},
+}
+
+// purgeDeletedBooks permanently removes books deleted before cutoff together with their
+// rows in bookOwnedRows and their files.
+func purgeDeletedBooks(cutoff time.Time) {
+	var books []Book
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&books).Error; err != nil {
+		log.Printf("⚠️ Failed to list books to purge: %v", err)
+		return
+	}
+	for _, book := range books {
+		files := staleBookAudioFiles(book)
+		if book.FilePath != "" {
+			var shared int64
+			db.Unscoped().Model(&Book{}).Where("id <> ? AND file_path = ?", book.ID, book.FilePath).Count(&shared)
+			if shared == 0 {
+				files = append(files, book.FilePath)
+			}
+		}
+		if book.CoverPath != "" {
+			files = append(files, book.CoverPath)
+		}
+		var parts []BookFile
+		db.Where("book_id = ? AND file_path <> ?", book.ID, book.FilePath).Find(&parts)
+		for _, p := range parts {
+			files = append(files, p.FilePath)
+		}
+
+		purged := true
+		for _, rows := range bookOwnedRows {
+			// Unscoped, or soft-deleted chunk groups would outlive their book
+			if err := db.Unscoped().Where("book_id = ?", book.ID).Delete(rows.model).Error; err != nil {
+				log.Printf("⚠️ Failed to purge %s of book %d: %v", rows.name, book.ID, err)
+				purged = false
+				break
+			}
+		}
+		if !purged {
+			continue
+		}
+		if contentStore != nil {
+			if err := contentStore.DeleteBook(book.ID); err != nil {
+				log.Printf("⚠️ Failed to purge stored text of book %d: %v", book.ID, err)
+			}
+		}
+		if err := db.Unscoped().Delete(&Book{}, book.ID).Error; err != nil {
+			log.Printf("⚠️ Failed to purge book %d: %v", book.ID, err)
+			continue
+		}
+		for _, f := range files {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				log.Printf("⚠️ Failed to remove %s of purged book %d: %v", f, book.ID, err)
+			}
+		}
+		log.Printf("🗑️ Purged book %d deleted at %s", book.ID, book.DeletedAt.Time.Format(time.RFC3339))
+	}
+}
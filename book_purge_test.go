@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteBookIsSoft(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1 AND "books"."deleted_at" IS NULL`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+	expectWrite(mock, `UPDATE "books" SET "deleted_at"=\$1 WHERE "books"."id" = \$2 AND "books"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), uint(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodDelete, "/user/books/:book_id", deleteBookHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/user/books/3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+func TestListBooksHidesDeleted(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE user_id = \$1 AND "books"."deleted_at" IS NULL$`).
+		WithArgs(uint(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books", listBooksHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+func TestRestoreBook(t *testing.T) {
+	tests := []struct {
+		name      string
+		deletedAt interface{}
+		want      int
+	}{
+		{"deleted", time.Now().Add(-time.Hour), http.StatusOK},
+		{"not deleted", nil, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			// Restore has to find the book although it is soft-deleted
+			mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1 ORDER BY`).
+				WithArgs("3", 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "deleted_at"}).AddRow(3, 7, bookStatusCompleted, tt.deletedAt))
+			if tt.want == http.StatusOK {
+				expectWrite(mock, `UPDATE "books" SET "deleted_at"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+					WithArgs(nil, sqlmock.AnyArg(), uint(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			w := httptest.NewRecorder()
+			userRouter(7, http.MethodPost, "/user/books/:book_id/restore", restoreBookHandler).
+				ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/restore", nil))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestPurgeDeletedBooks(t *testing.T) {
+	dir := t.TempDir()
+	upload := filepath.Join(dir, "book.pdf")
+	cover := filepath.Join(dir, "cover.jpg")
+	for _, f := range []string{upload, cover} {
+		if err := os.WriteFile(f, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mock := mockDB(t)
+	cutoff := time.Now().Add(-softDeleteRetention())
+	// Only books deleted before the cutoff are listed; newer ones can still be restored
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE deleted_at IS NOT NULL AND deleted_at < \$1$`).
+		WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "file_path", "cover_path", "deleted_at"}).
+			AddRow(3, 7, upload, cover, cutoff.Add(-time.Hour)))
+	mock.ExpectQuery(`SELECT "audio_path","final_audio_path" FROM "book_chunks"`).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "audio_path" FROM "processed_chunk_groups"`).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "path" FROM "audio_artifacts"`).WillReturnRows(sqlmock.NewRows([]string{"path"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" WHERE id <> \$1 AND file_path = \$2`).
+		WithArgs(uint(3), upload).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT \* FROM "book_files" WHERE book_id = \$1 AND file_path <> \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	for _, table := range []string{
+		"processed_chunk_groups", "audio_artifacts", "book_chunks", "book_files", "playback_positions", "favorites",
+		"tts_queue_jobs", "dead_letter_jobs", "token_usages", "moderation_results", "processing_samples",
+	} {
+		// Rows are removed for good, including soft-deleted chunk groups
+		expectWrite(mock, `DELETE FROM "`+table+`" WHERE book_id = \$1`).
+			WithArgs(uint(3)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectWrite(mock, `DELETE FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs(uint(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	purgeDeletedBooks(cutoff)
+	for _, f := range []string{upload, cover} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s of the purged book still exists (stat err = %v)", filepath.Base(f), err)
+		}
+	}
+}
+
+func TestSoftDeleteRetention(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 30 * 24 * time.Hour},
+		{"7", 7 * 24 * time.Hour},
+		{"0", 30 * 24 * time.Hour},
+		{"soon", 30 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Setenv("SOFT_DELETE_RETENTION_DAYS", tt.env)
+		if got := softDeleteRetention(); got != tt.want {
+			t.Errorf("SOFT_DELETE_RETENTION_DAYS=%q: retention = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ensureSearchIndexes creates the trigram GIN indexes used by the title/author search.
+// pg_trgm may require elevated privileges, so failures are logged instead of fatal.
+func ensureSearchIndexes() {
+	stmts := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_books_title_trgm ON books USING gin (title gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_books_author_trgm ON books USING gin (author gin_trgm_ops)",
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("⚠️ Search index migration failed (%s): %v", stmt, err)
+			return
+		}
+	}
+}
+
+// escapeLikePattern escapes the LIKE wildcards in user input so they match literally.
+func escapeLikePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// bookSortOrders whitelists the sort values accepted by listBooksHandler.
+// The map values are the only strings ever passed to ORDER BY.
+var bookSortOrders = map[string]string{
+	"created_at":  "created_at ASC",
+	"-created_at": "created_at DESC",
+	"title":       "title ASC",
+}
+
+// allowedBookSorts returns the accepted sort values for error responses.
+func allowedBookSorts() []string {
+	return []string{"created_at", "-created_at", "title"}
+}
+
+// applyBookSearch filters books whose title or author contains q (case-insensitive)
+// and ranks exact matches first, then prefix matches, then everything else.
+// orderBy is a whitelisted order from bookSortOrders used as the tie-breaker.
+func applyBookSearch(query *gorm.DB, q string, orderBy string) *gorm.DB {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return query.Order(orderBy)
+	}
+	if orderBy == "" {
+		orderBy = "title ASC"
+	}
+	escaped := escapeLikePattern(q)
+	contains := "%" + escaped + "%"
+	prefix := escaped + "%"
+
+	query = query.Where("(title ILIKE ? OR author ILIKE ?)", contains, contains)
+	return query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL: `CASE
+			WHEN LOWER(title) = LOWER(?) OR LOWER(author) = LOWER(?) THEN 0
+			WHEN title ILIKE ? OR author ILIKE ? THEN 1
+			ELSE 2
+		END, ` + orderBy,
+		Vars:               []interface{}{q, q, prefix, prefix},
+		WithoutParentheses: true,
+	}})
+}
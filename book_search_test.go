@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEscapeLikePattern(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain title", "plain title"},
+		{"50%", `50\%`},
+		{"snake_case", `snake\_case`},
+		{`back\slash`, `back\\slash`},
+		{`%_\`, `\%\_\\`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := escapeLikePattern(tt.in); got != tt.want {
+			t.Errorf("escapeLikePattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyBookSearch(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       string
+		args    []driver.Value
+		matches []string
+	}{
+		{
+			"partial title match",
+			"  ring ",
+			[]driver.Value{"%ring%", "%ring%", "ring", "ring", "ring%", "ring%"},
+			[]string{"The Lord of the Rings"},
+		},
+		{
+			"no match",
+			"zzz",
+			[]driver.Value{"%zzz%", "%zzz%", "zzz", "zzz", "zzz%", "zzz%"},
+			nil,
+		},
+		{
+			"wildcards match literally",
+			"50%_off",
+			[]driver.Value{`%50\%\_off%`, `%50\%\_off%`, "50%_off", "50%_off", `50\%\_off%`, `50\%\_off%`},
+			[]string{"50%_off sale"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			rows := sqlmock.NewRows([]string{"id", "title"})
+			for i, title := range tt.matches {
+				rows.AddRow(i+1, title)
+			}
+			mock.ExpectQuery(`WHERE user_id = \$1 AND \(\(title ILIKE \$2 OR author ILIKE \$3\)\).*ORDER BY CASE`).
+				WithArgs(append([]driver.Value{7}, tt.args...)...).
+				WillReturnRows(rows)
+
+			var books []Book
+			if err := applyBookSearch(db.Where("user_id = ?", 7), tt.q, "").Find(&books).Error; err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, b := range books {
+				titles = append(titles, b.Title)
+			}
+			if !slices.Equal(titles, tt.matches) {
+				t.Fatalf("found %q, want %q", titles, tt.matches)
+			}
+		})
+	}
+}
+
+func TestApplyBookSearchEmptyQuery(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE user_id = \$1 AND "books"."deleted_at" IS NULL ORDER BY title ASC$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	var books []Book
+	if err := applyBookSearch(db.Where("user_id = ?", 7), " ", "title ASC").Find(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListBooksStatusFilter(t *testing.T) {
+	tests := []struct {
+		status string
+		args   []driver.Value
+	}{
+		{"failed", []driver.Value{uint(7), bookStatusFailed}},
+		// Reused books are finished too, so "completed" includes them
+		{"completed", []driver.Value{uint(7), bookStatusCompleted, bookStatusReused}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			mock := mockDB(t)
+			placeholders := `\$2`
+			if len(tt.args) == 3 {
+				placeholders = `\$2,\$3`
+			}
+			mock.ExpectQuery(`SELECT \* FROM "books" WHERE user_id = \$1 AND status IN \(` + placeholders + `\) AND "books"."deleted_at" IS NULL$`).
+				WithArgs(tt.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			w := httptest.NewRecorder()
+			userRouter(7, http.MethodGet, "/user/books", listBooksHandler).
+				ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books?status="+tt.status, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestListBooksRejectsUnknownStatus(t *testing.T) {
+	mockDB(t)
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books", listBooksHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books?status=done", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestListBooksSort(t *testing.T) {
+	tests := []struct {
+		sort, order string
+	}{
+		{"created_at", "created_at ASC"},
+		{"-created_at", "created_at DESC"},
+		{"title", "title ASC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectQuery(`SELECT \* FROM "books" WHERE user_id = \$1 AND "books"."deleted_at" IS NULL ORDER BY ` + tt.order + `$`).
+				WithArgs(uint(7)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+			w := httptest.NewRecorder()
+			userRouter(7, http.MethodGet, "/user/books", listBooksHandler).
+				ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books?sort="+tt.sort, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestListBooksRejectsUnknownSort(t *testing.T) {
+	// Anything outside bookSortOrders is refused before it can reach ORDER BY
+	for _, sort := range []string{"id", "title DESC", "created_at; DROP TABLE books"} {
+		mockDB(t)
+		w := httptest.NewRecorder()
+		userRouter(7, http.MethodGet, "/user/books", listBooksHandler).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books?sort="+url.QueryEscape(sort), nil))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), codeInvalidSort) {
+			t.Errorf("sort %q: status = %d, want 400 %s: %s", sort, w.Code, codeInvalidSort, w.Body)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// BookStatus is where a book is in its lifecycle. The values are stable API values
+// clients can switch on; never store free text in Book.Status.
+type BookStatus string
+
+const (
+	bookStatusPending      BookStatus = "pending"       // Uploaded, narration not started
+	bookStatusProcessing   BookStatus = "processing"    // Whole-book narration running
+	bookStatusTTSCompleted BookStatus = "tts_completed" // Narrated; music and effects still being mixed
+	bookStatusCompleted    BookStatus = "completed"
+	bookStatusReused       BookStatus = "reused" // Audio taken from the book in ReusedFromBookID
+	bookStatusFailed       BookStatus = "failed"
+	bookStatusRejected     BookStatus = "rejected" // Blocked by moderation
+)
+
+// bookStatuses lists every valid BookStatus.
+var bookStatuses = []BookStatus{
+	bookStatusPending, bookStatusProcessing, bookStatusTTSCompleted, bookStatusCompleted,
+	bookStatusReused, bookStatusFailed, bookStatusRejected,
+}
+
+// finishedBookStatuses are the statuses of a book whose audio is ready: narrated here
+// or reused from a book with the same content.
+var finishedBookStatuses = []BookStatus{bookStatusCompleted, bookStatusReused}
+
+// isBookFinished reports whether a book's audio is ready. Check this rather than
+// comparing with bookStatusCompleted, which misses reused books.
+func isBookFinished(status BookStatus) bool {
+	return slices.Contains(finishedBookStatuses, status)
+}
+
+// bookStatusFilter returns the statuses a ?status= filter matches. "completed" covers
+// reused books too, since their audio is just as finished.
+func bookStatusFilter(status BookStatus) []BookStatus {
+	if status == bookStatusCompleted {
+		return finishedBookStatuses
+	}
+	return []BookStatus{status}
+}
+
+// bookStatusTransitions lists the statuses a book may move to from each status. Any
+// book can be re-uploaded (pending); finished books can be narrated again (processing).
+var bookStatusTransitions = map[BookStatus][]BookStatus{
+	bookStatusPending:      {bookStatusProcessing, bookStatusCompleted, bookStatusFailed, bookStatusRejected},
+	bookStatusProcessing:   {bookStatusPending, bookStatusTTSCompleted, bookStatusReused, bookStatusCompleted, bookStatusFailed, bookStatusRejected},
+	bookStatusTTSCompleted: {bookStatusPending, bookStatusProcessing, bookStatusCompleted, bookStatusFailed},
+	bookStatusCompleted:    {bookStatusPending, bookStatusProcessing, bookStatusRejected},
+	bookStatusReused:       {bookStatusPending, bookStatusProcessing, bookStatusTTSCompleted, bookStatusCompleted, bookStatusRejected},
+	bookStatusFailed:       {bookStatusPending, bookStatusProcessing, bookStatusRejected},
+	bookStatusRejected:     {bookStatusPending, bookStatusProcessing},
+}
+
+// legacyBookStatuses maps the free-text statuses stored by earlier versions to their
+// stable values.
+var legacyBookStatuses = map[string]BookStatus{
+	"TTS completed":      bookStatusTTSCompleted,
+	"TTS reused":         bookStatusReused,
+	"completed (reused)": bookStatusReused,
+}
+
+// parseBookStatus returns the BookStatus for s, accepting legacy spellings. ok is false
+// for anything else.
+func parseBookStatus(s string) (BookStatus, bool) {
+	if status, ok := legacyBookStatuses[s]; ok {
+		return status, true
+	}
+	for _, status := range bookStatuses {
+		if string(status) == s {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// canTransitionBook reports whether a book may move from one status to another.
+// Staying in the same status is always allowed.
+func canTransitionBook(from, to BookStatus) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range bookStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// bookStatusPredecessors lists the statuses a book may move to status from, status
+// itself included.
+func bookStatusPredecessors(status BookStatus) []BookStatus {
+	var from []BookStatus
+	for _, s := range bookStatuses {
+		if canTransitionBook(s, status) {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
+// transitionBooks moves the books matched by query to status, skipping those whose
+// current status may not move there. The check is part of the UPDATE, so a status
+// written concurrently cannot slip past it.
+func transitionBooks(query *gorm.DB, status BookStatus) *gorm.DB {
+	return query.Model(&Book{}).Where("status IN ?", bookStatusPredecessors(status)).Update("status", status)
+}
+
+// migrateLegacyBookStatuses rewrites stored legacy statuses to their stable values.
+func migrateLegacyBookStatuses() {
+	for legacy, status := range legacyBookStatuses {
+		res := db.Model(&Book{}).Unscoped().Where("status = ?", legacy).Update("status", status)
+		if res.Error != nil {
+			log.Printf("⚠️ Failed to migrate book status %q: %v", legacy, res.Error)
+		} else if res.RowsAffected > 0 {
+			log.Printf("🔁 Migrated %d books from status %q to %q", res.RowsAffected, legacy, status)
+		}
+	}
+}
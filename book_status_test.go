@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCanTransitionBook(t *testing.T) {
+	tests := []struct {
+		from, to BookStatus
+		want     bool
+	}{
+		{bookStatusPending, bookStatusProcessing, true},
+		{bookStatusProcessing, bookStatusTTSCompleted, true},
+		{bookStatusTTSCompleted, bookStatusCompleted, true},
+		{bookStatusCompleted, bookStatusProcessing, true},
+		{bookStatusFailed, bookStatusFailed, true},
+		{bookStatusCompleted, bookStatusFailed, false},
+		{bookStatusCompleted, bookStatusTTSCompleted, false},
+		{bookStatusPending, bookStatusTTSCompleted, false},
+		{bookStatusPending, bookStatusReused, false},
+		{bookStatusRejected, bookStatusCompleted, false},
+		{bookStatusReused, bookStatusCompleted, true},
+		{bookStatusReused, bookStatusTTSCompleted, true},
+		{bookStatusReused, bookStatusFailed, false},
+	}
+	for _, tt := range tests {
+		if got := canTransitionBook(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransitionBook(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestBookStatusPredecessors(t *testing.T) {
+	tests := []struct {
+		to       BookStatus
+		allowed  []BookStatus
+		rejected []BookStatus
+	}{
+		{
+			to:       bookStatusTTSCompleted,
+			allowed:  []BookStatus{bookStatusProcessing, bookStatusTTSCompleted, bookStatusReused},
+			rejected: []BookStatus{bookStatusPending, bookStatusCompleted, bookStatusFailed, bookStatusRejected},
+		},
+		{
+			to:       bookStatusCompleted,
+			allowed:  []BookStatus{bookStatusPending, bookStatusProcessing, bookStatusTTSCompleted, bookStatusCompleted, bookStatusReused},
+			rejected: []BookStatus{bookStatusFailed, bookStatusRejected},
+		},
+		{
+			to:       bookStatusReused,
+			allowed:  []BookStatus{bookStatusProcessing, bookStatusReused},
+			rejected: []BookStatus{bookStatusPending, bookStatusTTSCompleted, bookStatusCompleted, bookStatusFailed, bookStatusRejected},
+		},
+	}
+	for _, tt := range tests {
+		from := bookStatusPredecessors(tt.to)
+		for _, s := range tt.allowed {
+			if !slices.Contains(from, s) {
+				t.Errorf("bookStatusPredecessors(%q) = %v, missing %q", tt.to, from, s)
+			}
+		}
+		for _, s := range tt.rejected {
+			if slices.Contains(from, s) {
+				t.Errorf("bookStatusPredecessors(%q) = %v, must not contain %q", tt.to, from, s)
+			}
+		}
+	}
+}
+
+func TestBookStatusFilter(t *testing.T) {
+	tests := []struct {
+		status BookStatus
+		want   []BookStatus
+	}{
+		{bookStatusCompleted, []BookStatus{bookStatusCompleted, bookStatusReused}},
+		{bookStatusReused, []BookStatus{bookStatusReused}},
+		{bookStatusFailed, []BookStatus{bookStatusFailed}},
+	}
+	for _, tt := range tests {
+		if got := bookStatusFilter(tt.status); !slices.Equal(got, tt.want) {
+			t.Errorf("bookStatusFilter(%s) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestIsBookFinished(t *testing.T) {
+	for _, status := range bookStatuses {
+		want := status == bookStatusCompleted || status == bookStatusReused
+		if got := isBookFinished(status); got != want {
+			t.Errorf("isBookFinished(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BookChapter is a chapter of a book's assembled audio. Chapters are the book's source
+// files, so a book uploaded as a single file has none.
+type BookChapter struct {
+	Chapter        int      `json:"chapter"` // 1-based
+	Title          string   `json:"title"`
+	FirstPageIndex int      `json:"first_page_index"`
+	StartSeconds   *float64 `json:"start_seconds"` // nil until the audio exists
+	EndSeconds     *float64 `json:"end_seconds"`
+}
+
+// chapterPage is one page of assembled audio, in playback order. Duration is nil when
+// the page was not narrated on its own.
+type chapterPage struct {
+	Index    int
+	Duration *float64
+}
+
+// bookChapterFiles returns the source files of a book that mark chapters, or nil when
+// the book has fewer than two.
+func bookChapterFiles(bookID uint) ([]BookFile, error) {
+	var files []BookFile
+	if err := db.Where("book_id = ?", bookID).Order("position ASC").Find(&files).Error; err != nil {
+		return nil, err
+	}
+	if len(files) < 2 {
+		return nil, nil
+	}
+	return files, nil
+}
+
+// chapterTitle names a chapter after its source file.
+func chapterTitle(f BookFile, n int) string {
+	title := strings.TrimSpace(strings.TrimSuffix(f.OriginalFilename, filepath.Ext(f.OriginalFilename)))
+	if title == "" {
+		return fmt.Sprintf("Chapter %d", n)
+	}
+	return title
+}
+
+// pageWeights estimates each page's share of the narration from the characters of the
+// file it came from, split evenly over that file's pages. When a file predates character
+// counts every page weighs the same.
+func pageWeights(files []BookFile, pages []chapterPage) []float64 {
+	weights := make([]float64, len(pages))
+	for i := range weights {
+		weights[i] = 1
+	}
+	for _, f := range files {
+		if f.Characters == 0 {
+			return weights
+		}
+	}
+	for i, p := range pages {
+		for _, f := range files {
+			if p.Index >= f.FirstChunkIndex && p.Index < f.FirstChunkIndex+f.ChunkCount {
+				weights[i] = float64(f.Characters) / float64(f.ChunkCount)
+				break
+			}
+		}
+	}
+	return weights
+}
+
+// layoutChapters places the chapters of files in audio made of pages. Page offsets add
+// up the page durations, less crossfadeSec at every join. When a duration is unknown
+// totalSeconds is shared out by pageWeights instead, or the pages are left untimed if
+// that is 0.
+func layoutChapters(files []BookFile, pages []chapterPage, crossfadeSec, totalSeconds float64) []BookChapter {
+	offsets := make([]float64, len(pages))
+	timed := len(pages) > 0
+	sum := 0.0
+	for i, p := range pages {
+		if p.Duration == nil {
+			timed = false
+			break
+		}
+		offsets[i] = sum
+		sum += *p.Duration - crossfadeSec
+	}
+	total := sum + crossfadeSec
+	if !timed && totalSeconds > 0 && len(pages) > 0 {
+		timed, total = true, totalSeconds
+		weights := pageWeights(files, pages)
+		all := 0.0
+		for _, w := range weights {
+			all += w
+		}
+		done := 0.0
+		for i, w := range weights {
+			offsets[i] = totalSeconds * done / all
+			done += w
+		}
+	}
+
+	var chapters []BookChapter
+	for _, f := range files {
+		for i, p := range pages {
+			if p.Index < f.FirstChunkIndex || p.Index >= f.FirstChunkIndex+f.ChunkCount {
+				continue
+			}
+			ch := BookChapter{Chapter: len(chapters) + 1, Title: chapterTitle(f, len(chapters)+1), FirstPageIndex: p.Index}
+			if timed {
+				start := math.Round(offsets[i]*1000) / 1000
+				ch.StartSeconds = &start
+			}
+			chapters = append(chapters, ch)
+			break
+		}
+	}
+	if timed {
+		for i := range chapters {
+			end := math.Round(total*1000) / 1000
+			if i+1 < len(chapters) {
+				end = *chapters[i+1].StartSeconds
+			}
+			chapters[i].EndSeconds = &end
+		}
+	}
+	return chapters
+}
+
+// bookChapters returns the chapters of a book timed against its audio: the whole-book
+// narration when there is one, where chapter starts are estimated from the characters
+// of each file, otherwise its pages played in order.
+func bookChapters(book Book) ([]BookChapter, error) {
+	files, err := bookChapterFiles(book.ID)
+	if err != nil || files == nil {
+		return nil, err
+	}
+	var chunks []BookChunk
+	if err := db.Select("index", "duration_seconds").Where("book_id = ?", book.ID).Order("\"index\" ASC").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	wholeBook := book.AudioPath != "" && fileExists(book.AudioPath)
+	pages := make([]chapterPage, len(chunks))
+	for i, ch := range chunks {
+		pages[i].Index = ch.Index
+		if !wholeBook {
+			pages[i].Duration = ch.DurationSeconds
+		}
+	}
+	if !wholeBook {
+		return layoutChapters(files, pages, float64(book.CrossfadeMs)/1000, 0), nil
+	}
+	total, err := getTTSDuration(book.AudioPath)
+	if err != nil {
+		log.Printf("⚠️ Could not measure audio of book %d for chapters: %v", book.ID, err)
+	}
+	return layoutChapters(files, pages, 0, total), nil
+}
+
+// ffmetadataEscaper escapes the characters FFMETADATA1 treats as special.
+var ffmetadataEscaper = strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n")
+
+// chapterMetadata renders timed chapters as an FFMETADATA1 file.
+func chapterMetadata(chapters []BookChapter) string {
+	var sb strings.Builder
+	sb.WriteString(";FFMETADATA1\n")
+	for _, ch := range chapters {
+		fmt.Fprintf(&sb, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(math.Round(*ch.StartSeconds*1000)), int64(math.Round(*ch.EndSeconds*1000)), ffmetadataEscaper.Replace(ch.Title))
+	}
+	return sb.String()
+}
+
+// embedChapters writes chapters into an MP3 as ID3 chapter frames so players can list
+// and jump between them. Untimed chapters, single chapters and other formats are skipped.
+func embedChapters(ctx context.Context, audioPath string, chapters []BookChapter) error {
+	if len(chapters) < 2 || chapters[0].StartSeconds == nil || !strings.HasSuffix(strings.ToLower(audioPath), ".mp3") {
+		return nil
+	}
+	metaPath := audioPath + ".chapters.txt"
+	if err := os.WriteFile(metaPath, []byte(chapterMetadata(chapters)), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(metaPath)
+
+	tmp := strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ".chapters.tmp.mp3"
+	if out, err := runFFmpeg(ctx, tmp, "-y", "-i", audioPath, "-i", metaPath,
+		"-map", "0:a", "-map_metadata", "0", "-map_chapters", "1", "-c", "copy", "-id3v2_version", "3", tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg chapters: %v\n%s", err, out)
+	}
+	return os.Rename(tmp, audioPath)
+}
+
+// getBookChaptersHandler lists the chapters of a book with their start times in its audio.
+func getBookChaptersHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "audio_path", "crossfade_ms").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	chapters, err := bookChapters(book)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load chapters", err.Error())
+		return
+	}
+	if chapters == nil {
+		chapters = []BookChapter{}
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "chapters": chapters})
+}
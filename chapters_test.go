@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayoutChapters(t *testing.T) {
+	sec := func(f float64) *float64 { return &f }
+	files := []BookFile{
+		{OriginalFilename: "Part One.txt", FirstChunkIndex: 0, ChunkCount: 2, Characters: 300},
+		{OriginalFilename: " .pdf", FirstChunkIndex: 2, ChunkCount: 1, Characters: 100},
+	}
+	uncounted := []BookFile{
+		{OriginalFilename: "Part One.txt", FirstChunkIndex: 0, ChunkCount: 2},
+		{OriginalFilename: " .pdf", FirstChunkIndex: 2, ChunkCount: 1},
+	}
+	untimed := []chapterPage{{Index: 0}, {Index: 1}, {Index: 2}}
+
+	tests := []struct {
+		name         string
+		files        []BookFile
+		pages        []chapterPage
+		crossfadeSec float64
+		totalSeconds float64
+		want         []BookChapter
+	}{
+		{
+			"page durations less crossfades",
+			files,
+			[]chapterPage{{0, sec(10)}, {1, sec(10)}, {2, sec(5)}},
+			1, 0,
+			[]BookChapter{
+				{Chapter: 1, Title: "Part One", FirstPageIndex: 0, StartSeconds: sec(0), EndSeconds: sec(18)},
+				{Chapter: 2, Title: "Chapter 2", FirstPageIndex: 2, StartSeconds: sec(18), EndSeconds: sec(23)},
+			},
+		},
+		{
+			"estimated by characters",
+			files, untimed, 0, 100,
+			[]BookChapter{
+				{Chapter: 1, Title: "Part One", FirstPageIndex: 0, StartSeconds: sec(0), EndSeconds: sec(75)},
+				{Chapter: 2, Title: "Chapter 2", FirstPageIndex: 2, StartSeconds: sec(75), EndSeconds: sec(100)},
+			},
+		},
+		{
+			"estimated by pages without character counts",
+			uncounted, untimed, 0, 100,
+			[]BookChapter{
+				{Chapter: 1, Title: "Part One", FirstPageIndex: 0, StartSeconds: sec(0), EndSeconds: sec(66.667)},
+				{Chapter: 2, Title: "Chapter 2", FirstPageIndex: 2, StartSeconds: sec(66.667), EndSeconds: sec(100)},
+			},
+		},
+		{
+			"untimed",
+			files, untimed, 0, 0,
+			[]BookChapter{
+				{Chapter: 1, Title: "Part One", FirstPageIndex: 0},
+				{Chapter: 2, Title: "Chapter 2", FirstPageIndex: 2},
+			},
+		},
+		{
+			"file without pages skipped",
+			files,
+			[]chapterPage{{2, sec(5)}},
+			0, 0,
+			[]BookChapter{
+				{Chapter: 1, Title: "Chapter 1", FirstPageIndex: 2, StartSeconds: sec(0), EndSeconds: sec(5)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := layoutChapters(tt.files, tt.pages, tt.crossfadeSec, tt.totalSeconds)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("layoutChapters() = %s, want %s", chapterList(got), chapterList(tt.want))
+			}
+		})
+	}
+}
+
+// chapterList formats chapters with their times for failure messages.
+func chapterList(chapters []BookChapter) string {
+	var sb strings.Builder
+	for _, ch := range chapters {
+		fmt.Fprintf(&sb, "{%d %q page %d", ch.Chapter, ch.Title, ch.FirstPageIndex)
+		for _, t := range []*float64{ch.StartSeconds, ch.EndSeconds} {
+			if t == nil {
+				sb.WriteString(" -")
+			} else {
+				fmt.Fprintf(&sb, " %g", *t)
+			}
+		}
+		sb.WriteString("}")
+	}
+	return sb.String()
+}
@@ -8,8 +8,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // ChatMessage represents one message for the ChatGPT chat/completions API.
@@ -31,20 +33,79 @@ type ChatResponse struct {
 	Choices []struct {
 		Message ChatMessage `json:"message"`
 	} `json:"choices"`
+	Usage ChatUsage `json:"usage"`
 }
 
-// summarizeBookText truncates or passes through up to 500 chars for context.
+// openAIModelConfig holds the OpenAI model names, read once from the environment so
+// operators can switch models without a code change.
+type openAIModelConfig struct {
+	Chat    string // OPENAI_CHAT_MODEL: SSML, dialogue, translation and music prompts
+	Light   string // OPENAI_LIGHT_MODEL: cheap classification and summaries
+	Segment string // OPENAI_SEGMENT_MODEL: mood segmentation and sound event extraction
+	TTS     string // OPENAI_TTS_MODEL: narration
+}
+
+var openAIModels = loadOpenAIModels()
+
+// loadOpenAIModels reads the model configuration, keeping the historical defaults.
+func loadOpenAIModels() openAIModelConfig {
+	return openAIModelConfig{
+		Chat:    getEnv("OPENAI_CHAT_MODEL", "gpt-4o"),
+		Light:   getEnv("OPENAI_LIGHT_MODEL", "gpt-4o-mini"),
+		Segment: getEnv("OPENAI_SEGMENT_MODEL", "gpt-4o"),
+		TTS:     getEnv("OPENAI_TTS_MODEL", "gpt-4o-mini-tts"),
+	}
+}
+
+// summarizeBookText returns the excerpt of a book given to the music prompt
+// (MUSIC_EXCERPT_CHARS, default 500).
 func summarizeBookText(bookText string) string {
-	if len(bookText) > 500 {
-		return bookText[:500]
+	return bookExcerpt(bookText, excerptChars("MUSIC_EXCERPT_CHARS", 500))
+}
+
+// excerptChars reads a positive excerpt length from env, falling back to def.
+func excerptChars(env string, def int) int {
+	n, err := strconv.Atoi(getEnv(env, strconv.Itoa(def)))
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
+
+// truncateRunes cuts s to at most n characters without splitting a UTF-8 sequence.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
 	}
-	return bookText
+	return string([]rune(s)[:n])
+}
+
+// bookExcerpt returns at most size characters of text for a GPT prompt. Text that is too
+// long is sampled from EXCERPT_SAMPLES (default 3) evenly spaced points, starting with
+// the opening, so the model sees more than the first paragraph of a long book.
+func bookExcerpt(text string, size int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= size {
+		return string(runes)
+	}
+	const sep = " … "
+	samples := excerptChars("EXCERPT_SAMPLES", 3)
+	width := (size - (samples-1)*len([]rune(sep))) / samples
+	if width < 1 {
+		samples, width = 1, size
+	}
+	parts := make([]string, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := i * (len(runes) - width) / max(samples-1, 1)
+		parts = append(parts, strings.TrimSpace(string(runes[start:start+width])))
+	}
+	return strings.Join(parts, sep)
 }
 
 // generateOverallSoundPrompt reads the book file, summarizes it, and asks GPT to generate
-// a concise (<=300 chars) background music prompt.
-func generateOverallSoundPrompt(bookFilePath string) (string, error) {
-	data, err := os.ReadFile(bookFilePath)
+// a concise (<=300 chars) background music prompt. Token usage is recorded against bookID.
+func generateOverallSoundPrompt(bookFilePath string, bookID uint) (string, error) {
+	data, err := readContentFile(bookFilePath)
 	if err != nil {
 		return "", fmt.Errorf("read book file: %w", err)
 	}
@@ -56,7 +117,7 @@ func generateOverallSoundPrompt(bookFilePath string) (string, error) {
 	)
 
 	reqPayload := ChatRequest{
-		Model:       "gpt-4o",
+		Model:       openAIModels.Chat,
 		Messages:    []ChatMessage{{Role: "system", Content: "You are an audio production assistant."}, {Role: "user", Content: userContent}},
 		MaxTokens:   100,
 		Temperature: 0.7,
@@ -93,14 +154,53 @@ func generateOverallSoundPrompt(bookFilePath string) (string, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
 		return "", fmt.Errorf("decode GPT response: %w", err)
 	}
+	recordChatUsage(bookID, reqPayload.Model, "music_prompt", chatResp.Usage)
 	if len(chatResp.Choices) == 0 {
 		return "", errors.New("no GPT choices returned")
 	}
 
 	output := strings.TrimSpace(chatResp.Choices[0].Message.Content)
 	// enforce 300-char limit
-	if len(output) > 300 {
-		output = output[:300]
-	}
+	output = truncateRunes(output, 300)
 	return output, nil
 }
+
+// chatCompletion sends req to the chat/completions API, records its token usage against
+// bookID under purpose and returns the trimmed text of the first choice.
+func chatCompletion(req ChatRequest, bookID uint, purpose string) (string, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return "", errors.New("OPENAI_API_KEY not set")
+	}
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequest("POST", openAIChatURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return "", fmt.Errorf("build HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("GPT %s call failed: %w", purpose, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("GPT %s returned %d: %s", purpose, resp.StatusCode, respBody)
+	}
+
+	var chatResp ChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return "", fmt.Errorf("decode GPT %s response: %w", purpose, err)
+	}
+	recordChatUsage(bookID, req.Model, purpose, chatResp.Usage)
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("no GPT %s choices returned", purpose)
+	}
+	return strings.TrimSpace(chatResp.Choices[0].Message.Content), nil
+}
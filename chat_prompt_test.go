@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"abc", 5, "abc"},
+		{"abc", 3, "abc"},
+		{"abcdef", 2, "ab"},
+		{"héllo", 2, "hé"},
+		{"日本語", 1, "日"},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateRunes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBookExcerpt(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples string
+		text    string
+		size    int
+		want    string
+	}{
+		{"short text is trimmed", "3", "  whole text  ", 50, "whole text"},
+		{"one sample is the opening", "1", "abcdefghij", 5, "abcde"},
+		{"samples spread to the end", "2", "abcdefghij", 5, "a … j"},
+		{"too small for the samples", "3", "abcdefghij", 5, "abcde"},
+		{"three samples", "3", "aaaaXbbbbXcccc", 13, "aa … bb … cc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EXCERPT_SAMPLES", tt.samples)
+			if got := bookExcerpt(tt.text, tt.size); got != tt.want {
+				t.Fatalf("bookExcerpt(%q, %d) = %q, want %q", tt.text, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadOpenAIModels(t *testing.T) {
+	for _, key := range []string{"OPENAI_CHAT_MODEL", "OPENAI_LIGHT_MODEL", "OPENAI_SEGMENT_MODEL", "OPENAI_TTS_MODEL"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	want := openAIModelConfig{Chat: "gpt-4o", Light: "gpt-4o-mini", Segment: "gpt-4o", TTS: "gpt-4o-mini-tts"}
+	if got := loadOpenAIModels(); got != want {
+		t.Fatalf("defaults = %+v, want %+v", got, want)
+	}
+
+	t.Setenv("OPENAI_LIGHT_MODEL", "gpt-4.1-mini")
+	t.Setenv("OPENAI_TTS_MODEL", "tts-1-hd")
+	want.Light, want.TTS = "gpt-4.1-mini", "tts-1-hd"
+	if got := loadOpenAIModels(); got != want {
+		t.Fatalf("with overrides = %+v, want %+v", got, want)
+	}
+}
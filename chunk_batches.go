@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ttsMaxInputBytes is the largest text payload sent to the TTS provider in one call.
+const ttsMaxInputBytes = 2000
+
+// splitTextIntoBatches splits text into pieces of at most limit bytes, breaking on
+// whitespace where possible and never inside a multi-byte rune.
+func splitTextIntoBatches(text string, limit int) []string {
+	var batches []string
+	var cur strings.Builder
+
+	flush := func() {
+		if cur.Len() > 0 {
+			batches = append(batches, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, word := range strings.Fields(text) {
+		// A single word longer than the limit is cut on rune boundaries.
+		for len(word) > limit {
+			flush()
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(word[cut]) {
+				cut--
+			}
+			batches = append(batches, word[:cut])
+			word = word[cut:]
+		}
+
+		sep := 0
+		if cur.Len() > 0 {
+			sep = 1
+		}
+		if cur.Len()+sep+len(word) > limit {
+			flush()
+			sep = 0
+		}
+		if sep == 1 {
+			cur.WriteByte(' ')
+		}
+		cur.WriteString(word)
+	}
+	flush()
+	return batches
+}
+
+// processChunkIDsJob narrates the chunks referenced by a queued job. Each page is
+// narrated on its own (split into batches under ttsMaxInputBytes when its text is
+// longer) and marked completed with its audio, then the pages are concatenated into one
+// file recorded as a ProcessedChunkGroup. Pages already completed are not narrated
+// again. Cancelling ctx aborts the narration and concatenation.
+func processChunkIDsJob(ctx context.Context, job TTSQueueJob) error {
+	ids := parseChunkIDs(job.ChunkIDs)
+	var chunks []BookChunk
+	if err := db.Where("id IN ? AND book_id = ?", ids, job.BookID).Find(&chunks).Error; err != nil {
+		return fmt.Errorf("failed to fetch chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("no chunks found for job %d", job.ID)
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	startIdx := chunks[0].Index
+	endIdx := chunks[len(chunks)-1].Index
+
+	provider := bookTTSProvider(job.BookID)
+	started := time.Now()
+	var narrated strings.Builder
+	var narratedPages []int
+	narratedSeconds := 0.0
+	files := make([]string, len(chunks))
+	for i := range chunks {
+		ch := &chunks[i]
+		if ch.TTSStatus == "completed" && fileExists(ch.AudioPath) {
+			files[i] = ch.AudioPath
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		db.Model(&BookChunk{}).Where("id = ?", ch.ID).Update("tts_status", "processing")
+		narration, text, err := narrateJobChunk(ctx, job, ch, provider)
+		if err != nil {
+			status := "failed"
+			if ctx.Err() != nil {
+				status = "pending" // Shutdown; the job is requeued
+			}
+			db.Model(&BookChunk{}).Where("id = ?", ch.ID).Update("tts_status", status)
+			return fmt.Errorf("chunk %d: %w", ch.ID, err)
+		}
+		duration := measureDuration(narration.Path)
+		if err := db.Model(&BookChunk{}).Where("id = ?", ch.ID).Updates(map[string]interface{}{
+			"audio_path":       narration.Path,
+			"narrated_by":      narration.Provider,
+			"word_timings":     encodeWordTimings(narration.Timings),
+			"tts_status":       "completed",
+			"duration_seconds": duration,
+		}).Error; err != nil {
+			return fmt.Errorf("save chunk %d audio: %w", ch.ID, err)
+		}
+		if duration != nil {
+			narratedSeconds += *duration
+		}
+		files[i] = narration.Path
+		narrated.WriteString(text)
+		narratedPages = append(narratedPages, ch.Index)
+	}
+	if len(narratedPages) > 0 {
+		recordProcessingSample(job.BookID, narrated.String(), len(narratedPages), time.Since(started))
+	}
+
+	if _, found := checkIfChunkGroupProcessed(job.BookID, startIdx, endIdx); !found || len(narratedPages) > 0 {
+		// Written aside and renamed into place, so the worker never waits on the book's
+		// merge lock and a concurrent merge of the same range never sees half a file
+		mergedAudio := mergedChunkAudioPath(job.BookID, startIdx, endIdx)
+		partial := partialPath(mergedAudio)
+		err := concatAudioFiles(ctx, files, partial)
+		if err == nil {
+			err = os.Rename(partial, mergedAudio)
+		}
+		if err != nil {
+			os.Remove(partial)
+		} else if err = saveProcessedChunkGroup(job.BookID, startIdx, endIdx, mergedAudio); err == nil {
+			err = recordAudioArtifact(job.BookID, artifactMergedChunks, startIdx, endIdx, mergedAudio)
+		}
+		if err != nil {
+			return fmt.Errorf("merge job %d audio: %w", job.ID, err)
+		}
+		log.Printf("✅ Job #%d narrated %d pages and merged [%d-%d] into %s", job.ID, len(narratedPages), startIdx, endIdx, mergedAudio)
+	}
+
+	var book Book
+	if err := db.First(&book, job.BookID).Error; err != nil {
+		log.Printf("⚠️ Skipping effects for job #%d: book %d not found: %v", job.ID, job.BookID, err)
+		return nil
+	}
+	if len(narratedPages) > 0 {
+		// Pages narrated again in a book already counted are charged on their own
+		recordPageUsage(book.ID, book.UserID, narratedSeconds)
+		// Mix music and effects into the newly narrated pages
+		go processSoundEffectsAndMerge(book, book.ContentHash, narratedPages)
+	}
+
+	var remaining int64
+	db.Model(&BookChunk{}).Where("book_id = ? AND (tts_status IS NULL OR tts_status <> ?)", book.ID, "completed").Count(&remaining)
+	if remaining == 0 && !isBookFinished(book.Status) {
+		updateBookStatus(book.ID, bookStatusCompleted)
+		recordBookUsage(book.ID, book.UserID, bookAudioSeconds(book.ID))
+	}
+	return nil
+}
+
+// narrateJobChunk narrates one page of a job into the page's own narration file and
+// returns the narration and the text it read. Text over ttsMaxInputBytes is narrated in
+// job-scoped batches that are then joined; word timings are only kept for a single call.
+func narrateJobChunk(ctx context.Context, job TTSQueueJob, ch *BookChunk, provider string) (Narration, string, error) {
+	text, err := prepareChunkText(ch)
+	if err != nil {
+		return Narration{}, "", fmt.Errorf("translate: %w", err)
+	}
+	batches := splitTextIntoBatches(text, ttsMaxInputBytes)
+	switch len(batches) {
+	case 0:
+		return Narration{}, "", fmt.Errorf("page %d has no text", ch.Index)
+	case 1:
+		narration, err := narrateWithFallback(provider, text, chunkNarrationName(ch.ID), job.BookID)
+		return narration, text, err
+	}
+
+	var batchFiles []string
+	defer func() {
+		for _, f := range batchFiles {
+			os.Remove(f)
+		}
+	}()
+	var narration Narration
+	for i, batch := range batches {
+		// Job-scoped names keep batches clear of the chunks' own narration files
+		narration, err = narrateWithFallback(provider, batch, fmt.Sprintf("job_%d_chunk_%d_batch_%d", job.ID, ch.ID, i), job.BookID)
+		if err != nil {
+			return Narration{}, "", fmt.Errorf("TTS batch %d/%d: %w", i+1, len(batches), err)
+		}
+		batchFiles = append(batchFiles, narration.Path)
+	}
+	out := narrationPath(chunkNarrationName(ch.ID))
+	if err := concatAudioFiles(ctx, batchFiles, out); err != nil {
+		return Narration{}, "", err
+	}
+	return Narration{Path: out, Provider: narration.Provider}, text, nil
+}
+
+// partialPath is a temporary name next to out with the same extension, so ffmpeg picks
+// the same format. Output written there is renamed to out once complete.
+func partialPath(out string) string {
+	ext := filepath.Ext(out)
+	return fmt.Sprintf("%s.partial-%d%s", strings.TrimSuffix(out, ext), time.Now().UnixNano(), ext)
+}
+
+// concatAudioFiles joins MP3 files in order using the FFmpeg concat demuxer.
+func concatAudioFiles(ctx context.Context, files []string, outFile string) error {
+	listFile := outFile + ".list.txt"
+	listHandle, err := os.Create(listFile)
+	if err != nil {
+		return fmt.Errorf("failed to create audio list: %w", err)
+	}
+	defer os.Remove(listFile)
+	for _, f := range files {
+		absPath, _ := filepath.Abs(f)
+		fmt.Fprintf(listHandle, "file '%s'\n", absPath)
+	}
+	listHandle.Close()
+
+	if output, err := runFFmpeg(ctx, outFile, "-y", "-f", "concat", "-safe", "0", "-i", listFile, "-c", "copy", outFile); err != nil {
+		return fmt.Errorf("ffmpeg concat fail: %v\n%s", err, output)
+	}
+	return nil
+}
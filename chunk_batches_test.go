@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitTextIntoBatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"empty", "", 10, nil},
+		{"fits", "hello world", 20, []string{"hello world"}},
+		{"breaks on whitespace", "hello world", 5, []string{"hello", "world"}},
+		{"collapses whitespace", "  a   b\n c  ", 10, []string{"a b c"}},
+		{"fills each batch", "aa bb cc dd", 5, []string{"aa bb", "cc dd"}},
+		{"cuts long words", "aaaaaaaaaa", 4, []string{"aaaa", "aaaa", "aa"}},
+		{"long word after text", "hi aaaaaa", 4, []string{"hi", "aaaa", "aa"}},
+		{"never splits a rune", "ééé", 3, []string{"é", "é", "é"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitTextIntoBatches(tt.text, tt.limit)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("splitTextIntoBatches(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+			}
+			for _, b := range got {
+				if len(b) > tt.limit || !utf8.ValidString(b) {
+					t.Errorf("batch %q is over %d bytes or not valid UTF-8", b, tt.limit)
+				}
+			}
+		})
+	}
+}
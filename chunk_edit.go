@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// updateChunkContentHandler corrects the text of one page. The page's audio, any merged
+// chunk groups covering it and the book-level audio are invalidated, and the book's
+// content hash is recomputed from the edited pages.
+func updateChunkContentHandler(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid chunk index", nil)
+		return
+	}
+	var req struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Content is required", nil)
+		return
+	}
+
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to edit this book", nil)
+		return
+	}
+
+	var chunk BookChunk
+	if err := db.Where("book_id = ? AND \"index\" = ?", book.ID, index).First(&chunk).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeChunkNotFound, "Chunk not found", nil)
+		return
+	}
+	if chunk.TTSStatus == "processing" {
+		respondError(c, http.StatusConflict, codeConflict, "Chunk is being processed; try again when it finishes", nil)
+		return
+	}
+
+	updates, err := chunkContentColumns(chunk.BookID, chunk.Index, req.Content)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to store page text", err.Error())
+		return
+	}
+	resetChunkAudioColumns(updates)
+	// Updates writes the cleared columns back into chunk, so keep what it pointed at
+	oldKey, oldAudio := chunk.ContentKey, []string{chunk.AudioPath, chunk.FinalAudioPath}
+	if err := db.Model(&chunk).Updates(updates).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update chunk", err.Error())
+		return
+	}
+	// A page moved by a split or renumber kept its text under another key until now
+	dropUnusedContent(oldKey)
+	for _, f := range oldAudio {
+		if f != "" {
+			os.Remove(f)
+		}
+	}
+
+	invalidated, err := invalidateChunkGroups(book.ID, index)
+	if err != nil {
+		log.Printf("⚠️ Failed to invalidate chunk groups for book %d index %d: %v", book.ID, index, err)
+	}
+
+	hash, err := resetBookAudio(book)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update book", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Chunk updated",
+		"book_id":            book.ID,
+		"index":              index,
+		"tts_status":         "pending",
+		"content_hash":       hash,
+		"invalidated_groups": invalidated,
+	})
+}
+
+// resetChunkAudioColumns adds to updates the columns that send a page back to pending
+// with no audio.
+func resetChunkAudioColumns(updates map[string]interface{}) {
+	for column, value := range map[string]interface{}{
+		"tts_status":       "pending",
+		"audio_path":       "",
+		"final_audio_path": "",
+		"narrated_by":      "",
+		"duration_seconds": nil,
+		"word_timings":     "",
+	} {
+		updates[column] = value
+	}
+}
+
+// resetBookAudio drops a book's whole-book audio and cached summary after its pages
+// changed and stores the content hash recomputed from the pages, which it returns.
+// Audio files still used by another book (reuse) are kept.
+func resetBookAudio(book Book) (string, error) {
+	hash, err := computeChunksHash(book.ID)
+	if err != nil {
+		return "", err
+	}
+	updates := map[string]interface{}{"content_hash": hash, "summary": ""}
+	resetBookAudioColumns(updates)
+	if err := db.Model(&Book{}).Where("id = ?", book.ID).Updates(updates).Error; err != nil {
+		return "", err
+	}
+	removeBookAudioFiles(book)
+	return hash, nil
+}
+
+// resetBookAudioColumns adds to updates the columns that clear a book's whole-book audio.
+func resetBookAudioColumns(updates map[string]interface{}) {
+	for column, value := range map[string]interface{}{
+		"audio_path":        "",
+		"audio_path_mp3":    "",
+		"audio_path_opus":   "",
+		"hls_playlist_path": "",
+		"narrated_by":       "",
+	} {
+		updates[column] = value
+	}
+}
+
+// removeBookAudioFiles deletes the whole-book audio files book pointed at once its
+// columns are cleared, keeping files another book still uses.
+func removeBookAudioFiles(book Book) {
+	for column, path := range map[string]string{"audio_path": book.AudioPath, "audio_path_mp3": book.AudioPathMP3, "audio_path_opus": book.AudioPathOpus} {
+		if path == "" {
+			continue
+		}
+		var shared int64
+		db.Unscoped().Model(&Book{}).Where("id <> ? AND "+column+" = ?", book.ID, path).Count(&shared)
+		if shared == 0 {
+			os.Remove(path)
+		}
+	}
+	os.RemoveAll(hlsDir(book.ID))
+}
+
+// computeChunksHash hashes a book's page texts in index order, standing in for the
+// file hash once pages have been edited.
+func computeChunksHash(bookID uint) (string, error) {
+	contents, err := loadChunkTexts(db.Where("book_id = ?", bookID).Order("\"index\" ASC"))
+	if err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	for _, content := range contents {
+		hasher.Write([]byte(content))
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// editChunk sends a page edit of book 3, page 1 as user 7.
+func editChunk(content string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/user/books/3/chunks/1", strings.NewReader(`{"content": `+content+`}`))
+	req.Header.Set("Content-Type", "application/json")
+	userRouter(7, http.MethodPatch, "/user/books/:book_id/chunks/:index", updateChunkContentHandler).ServeHTTP(w, req)
+	return w
+}
+
+func TestEditChunkInvalidatesDownstreamAudio(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	pageAudio, pageFinal, groupAudio, bookAudio := "audio/audio_10.mp3", "audio/book_3_page_1_final.mp3", mergedChunkAudioPath(3, 0, 2), "audio/book_3.mp3"
+	for _, p := range []string{pageAudio, pageFinal, groupAudio, bookAudio} {
+		if err := os.WriteFile(p, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "audio_path", "content_hash"}).AddRow(3, 7, bookStatusCompleted, bookAudio, "old"))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WithArgs(uint(3), 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "content", "audio_path", "final_audio_path", "tts_status"}).
+			AddRow(10, 3, 1, "Pgae two.", pageAudio, pageFinal, "completed"))
+	// The page goes back to pending with its audio cleared
+	expectWrite(mock, `UPDATE "book_chunks" SET "audio_path"=\$1,"content"=\$2,"content_key"=\$3,"duration_seconds"=\$4,"final_audio_path"=\$5,"narrated_by"=\$6,"original_content"=\$7,"tts_status"=\$8,"word_timings"=\$9,"updated_at"=\$10 WHERE "id" = \$11`).
+		WithArgs("", "Page two.", "", nil, "", "", "", "pending", "", sqlmock.AnyArg(), uint(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The merged group covering the page is dropped
+	mock.ExpectQuery(`SELECT \* FROM "processed_chunk_groups" WHERE \(book_id = \$1 AND start_idx <= \$2 AND end_idx >= \$3\)`).
+		WithArgs(uint(3), 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "start_idx", "end_idx", "audio_path"}).AddRow(4, 3, 0, 2, groupAudio))
+	expectWrite(mock, `UPDATE "processed_chunk_groups" SET "deleted_at"=\$1 WHERE "processed_chunk_groups"."id" = \$2`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectWrite(mock, `DELETE FROM "audio_artifacts" WHERE book_id = \$1 AND path = \$2`).
+		WithArgs(uint(3), groupAudio).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The book's hash is recomputed from its pages and its whole-book audio cleared
+	mock.ExpectQuery(`SELECT "id","content","content_key" FROM "book_chunks" WHERE book_id = \$1 ORDER BY "index" ASC`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "content_key"}).AddRow(9, "Page one.", "").AddRow(10, "Page two.", ""))
+	sum := sha256.Sum256([]byte("Page one.\x00Page two.\x00"))
+	hash := hex.EncodeToString(sum[:])
+	expectWrite(mock, `UPDATE "books" SET "audio_path"=\$1,"audio_path_mp3"=\$2,"audio_path_opus"=\$3,"content_hash"=\$4,"hls_playlist_path"=\$5,"narrated_by"=\$6,"summary"=\$7,"updated_at"=\$8 WHERE id = \$9`).
+		WithArgs("", "", "", hash, "", "", "", sqlmock.AnyArg(), uint(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" WHERE id <> \$1 AND audio_path = \$2`).
+		WithArgs(uint(3), bookAudio).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	w := editChunk(`"Page two."`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		TTSStatus   string `json:"tts_status"`
+		ContentHash string `json:"content_hash"`
+		Invalidated int    `json:"invalidated_groups"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.TTSStatus != "pending" || body.ContentHash != hash || body.Invalidated != 1 {
+		t.Errorf("response = %s, want pending with the new hash and 1 dropped group", w.Body)
+	}
+	for _, p := range []string{pageAudio, pageFinal, groupAudio, bookAudio} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after the edit (stat err = %v)", p, err)
+		}
+	}
+}
+
+func TestEditChunkRefusedWhileProcessing(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "tts_status"}).AddRow(10, 3, 1, "processing"))
+
+	if w := editChunk(`"Page two."`); w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+}
+
+func TestEditChunkRequiresContent(t *testing.T) {
+	mockDB(t)
+	if w := editChunk(`"   "`); w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+	}
+}
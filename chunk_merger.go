@@ -1,23 +1,60 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
-	"time"
 )
 
+// mergedChunkAudioPath is the one naming convention for merged chunk-group audio. Each
+// file is recorded as an AudioArtifact, which is how streamMergedChunkAudioHandler finds it.
+func mergedChunkAudioPath(bookID uint, startIdx, endIdx int) string {
+	return fmt.Sprintf("./audio/book_%d_chunks_%d_%d.mp3", bookID, startIdx, endIdx)
+}
+
+// unusableChunkAudioError is returned by processMergedChunks when completed chunks have
+// no audio file to merge, so callers can report which pages need narrating again.
+type unusableChunkAudioError struct {
+	BookID   uint
+	ChunkIDs []uint
+}
+
+func (e *unusableChunkAudioError) Error() string {
+	ids := make([]string, len(e.ChunkIDs))
+	for i, id := range e.ChunkIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	return fmt.Sprintf("book %d chunks [%s] have no usable audio; refusing to build an incomplete merge",
+		e.BookID, strings.Join(ids, ", "))
+}
+
+// hasAudioFile reports whether path names a non-empty regular file. Whether ffmpeg can
+// decode it is left to the merge itself, which fails loudly.
+func hasAudioFile(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
 // processMergedChunks combines TTS audio and text from selected chunks
-// then runs the sound effects pipeline.
-func processMergedChunks(bookID uint) error {
+// then runs the sound effects pipeline. Cancelling ctx aborts the audio concatenation.
+func processMergedChunks(ctx context.Context, bookID uint) error {
+	unlock, err := lockBookMerge(ctx, bookID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// 1. Fetch all completed chunks for the book, ordered by index
 	var chunks []BookChunk
 	if err := db.Where("book_id = ? AND tts_status = ?", bookID, "completed").
-		Order("index").
+		Order("\"index\" ASC").
 		Find(&chunks).Error; err != nil {
 		return fmt.Errorf("failed to fetch chunks: %w", err)
 	}
@@ -39,48 +76,79 @@ func processMergedChunks(bookID uint) error {
 		return nil
 	}
 
-	// 3. Combine text into a single .txt file
-	mergedText := ""
+	// 3. Every chunk must have usable audio, otherwise the merged file would silently miss pages
+	var unusable []uint
 	for _, ch := range chunks {
-		mergedText += ch.Content + "\n"
+		if !hasAudioFile(ch.AudioPath) {
+			unusable = append(unusable, ch.ID)
+		}
+	}
+	if len(unusable) > 0 {
+		return &unusableChunkAudioError{BookID: bookID, ChunkIDs: unusable}
+	}
+
+	// 4. Combine text into a single .txt file
+	mergedText := ""
+	for i := range chunks {
+		if err := loadChunkContent(&chunks[i]); err != nil {
+			return err
+		}
+		mergedText += chunks[i].Content + "\n"
 	}
 	textFile := fmt.Sprintf("./audio/book_%d_chunks_%d_%d.txt", bookID, startIdx, endIdx)
-	if err := os.WriteFile(textFile, []byte(mergedText), 0644); err != nil {
+	if err := writeContentFile(textFile, []byte(mergedText)); err != nil {
 		return fmt.Errorf("failed to write merged text: %w", err)
 	}
 
-	// 4. Compute content hash of merged text
+	// 5. Compute content hash of merged text
 	h := sha256.New()
 	h.Write([]byte(mergedText))
 	contentHash := hex.EncodeToString(h.Sum(nil))
 
-	// 5. Save hash in book record
+	// 6. Save hash in book record
 	if err := db.Model(&Book{}).Where("id = ?", bookID).Update("content_hash", contentHash).Error; err != nil {
 		return fmt.Errorf("failed to save content hash: %w", err)
 	}
 
-	// 6. Combine audio into a single MP3 using FFmpeg concat
-	listFile := fmt.Sprintf("./audio/audio_list_%d.txt", time.Now().Unix())
-	listHandle, err := os.Create(listFile)
-	if err != nil {
-		return fmt.Errorf("failed to create audio list: %w", err)
+	// 7. Combine audio into a single MP3, crossfading the joins if the book opted in
+	files := make([]string, len(chunks))
+	for i, ch := range chunks {
+		files[i] = ch.AudioPath
 	}
-	for _, ch := range chunks {
-		if !strings.HasSuffix(ch.AudioPath, ".mp3") {
-			continue
+	var crossfadeMs int
+	db.Model(&Book{}).Select("crossfade_ms").Where("id = ?", bookID).Scan(&crossfadeMs)
+	mergedAudio := mergedChunkAudioPath(bookID, startIdx, endIdx)
+	partial := partialPath(mergedAudio)
+	defer os.Remove(partial)
+	if crossfadeMs > 0 && len(files) > 1 {
+		if err := crossfadeAudioFiles(ctx, files, partial, crossfadeMs); err != nil {
+			return fmt.Errorf("ffmpeg crossfade merge fail: %w", err)
 		}
-		absPath, _ := filepath.Abs(ch.AudioPath)
-		fmt.Fprintf(listHandle, "file '%s'\n", absPath)
+	} else if err := concatAudioFiles(ctx, files, partial); err != nil {
+		return fmt.Errorf("ffmpeg merge fail: %w", err)
 	}
-	listHandle.Close()
 
-	mergedAudio := fmt.Sprintf("./audio/book_%d_chunks_%d_%d.mp3", bookID, startIdx, endIdx)
-	cmd := exec.Command("ffmpeg", "-y", "-f", "concat", "-safe", "0", "-i", listFile, "-c", "copy", mergedAudio)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("ffmpeg merge fail: %v\n%s", err, output)
+	// 7b) Mark where each source file starts so players can jump between chapters
+	if sources, err := bookChapterFiles(bookID); err != nil {
+		log.Printf("⚠️ Failed to load chapters for book %d: %v", bookID, err)
+	} else if sources != nil {
+		pages := make([]chapterPage, len(chunks))
+		for i, ch := range chunks {
+			pages[i] = chapterPage{Index: ch.Index, Duration: ch.DurationSeconds}
+		}
+		crossfadeSec := 0.0
+		if crossfadeMs > 0 && len(files) > 1 {
+			crossfadeSec = float64(crossfadeMs) / 1000
+		}
+		if err := embedChapters(ctx, partial, layoutChapters(sources, pages, crossfadeSec, 0)); err != nil {
+			log.Printf("⚠️ Failed to embed chapters in %s: %v", mergedAudio, err)
+		}
+	}
+	if err := os.Rename(partial, mergedAudio); err != nil {
+		return fmt.Errorf("failed to move merged audio into place: %w", err)
 	}
 
-	// 7. Call sound effects pipeline with temporary Book struct
+	// 8. Call sound effects pipeline with temporary Book struct
 	book := Book{
 		ID:          bookID,
 		FilePath:    textFile,
@@ -90,10 +158,13 @@ func processMergedChunks(bookID uint) error {
 
 	go processSoundEffectsAndMerge(book, contentHash, pageIndexes) // Page index is not used in this context
 
-	// 8. Save to processed chunk group table
+	// 9. Save to processed chunk group table
 	if err := saveProcessedChunkGroup(bookID, startIdx, endIdx, mergedAudio); err != nil {
 		return fmt.Errorf("failed to save chunk group metadata: %w", err)
 	}
+	if err := recordAudioArtifact(bookID, artifactMergedChunks, startIdx, endIdx, mergedAudio); err != nil {
+		return fmt.Errorf("failed to record merged audio: %w", err)
+	}
 
 	return nil
 }
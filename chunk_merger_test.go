@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMergeRefusesChunksWithoutAudio(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"page_0.mp3": "audio", "page_2.mp3": "", "page_3.opus": "audio"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mock := mockDB(t)
+	// Page 1's file is gone and page 2's is empty. Page 3 is usable whatever its format.
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND tts_status = \$2 ORDER BY "index" ASC`).
+		WithArgs(uint(3), "completed").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "audio_path"}).
+			AddRow(10, 3, 0, filepath.Join(dir, "page_0.mp3")).
+			AddRow(11, 3, 1, filepath.Join(dir, "page_1.mp3")).
+			AddRow(12, 3, 2, filepath.Join(dir, "page_2.mp3")).
+			AddRow(13, 3, 3, filepath.Join(dir, "page_3.opus")))
+	mock.ExpectQuery(`SELECT \* FROM "processed_chunk_groups"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	err := processMergedChunks(context.Background(), 3)
+	var unusable *unusableChunkAudioError
+	if !errors.As(err, &unusable) {
+		t.Fatalf("err = %v, want an unusableChunkAudioError", err)
+	}
+	if !slices.Equal(unusable.ChunkIDs, []uint{11, 12}) {
+		t.Fatalf("unusable chunks = %v, want [11 12]", unusable.ChunkIDs)
+	}
+	if !strings.Contains(err.Error(), "[11, 12]") {
+		t.Fatalf("error %q should name chunks 11 and 12", err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// chunkMove is a page changing index.
+type chunkMove struct {
+	chunk BookChunk
+	to    int
+}
+
+// chunkMoveColumns are the columns needed to move a page.
+var chunkMoveColumns = []string{"id", "book_id", "index", "content_key", "final_audio_path"}
+
+// splitChunkMoves moves each of the pages after a split page up by one.
+func splitChunkMoves(later []BookChunk) []chunkMove {
+	moves := make([]chunkMove, len(later))
+	for i, ch := range later {
+		moves[i] = chunkMove{chunk: ch, to: ch.Index + 1}
+	}
+	return moves
+}
+
+// renumberChunkMoves moves the pages of a book, given in index order, that are not at
+// their position in that order.
+func renumberChunkMoves(chunks []BookChunk) []chunkMove {
+	var moves []chunkMove
+	for i, ch := range chunks {
+		if ch.Index != i {
+			moves = append(moves, chunkMove{chunk: ch, to: i})
+		}
+	}
+	return moves
+}
+
+// relocateChunkTexts copies the stored text of moving pages to keys for their new index
+// and returns the new content_key of each chunk ID. Nothing points at the copies until
+// the move commits, so a failed move only leaves unused files.
+func relocateChunkTexts(moves []chunkMove) (map[uint]string, error) {
+	keys := map[uint]string{}
+	for _, m := range moves {
+		if m.chunk.ContentKey == "" {
+			continue
+		}
+		if err := loadChunkContent(&m.chunk); err != nil {
+			return nil, err
+		}
+		key := relocatedChunkKey(m.chunk.BookID, m.chunk.ID, m.to)
+		if err := contentStore.Put(key, m.chunk.Content); err != nil {
+			return nil, err
+		}
+		keys[m.chunk.ID] = key
+	}
+	return keys, nil
+}
+
+// movedContentKeys lists the store keys moving pages pointed at before a move and the
+// relocated copies made for them.
+func movedContentKeys(moves []chunkMove, keys map[uint]string) (old, relocated []string) {
+	for _, m := range moves {
+		if key, ok := keys[m.chunk.ID]; ok {
+			old = append(old, m.chunk.ContentKey)
+			relocated = append(relocated, key)
+		}
+	}
+	return old, relocated
+}
+
+// moveChunks gives pages their new index inside tx. Moving rows are first parked at
+// negative indexes so (book_id, index) stays unique at every step.
+func moveChunks(tx *gorm.DB, moves []chunkMove, keys map[uint]string) error {
+	for i, m := range moves {
+		if err := tx.Model(&BookChunk{}).Where("id = ?", m.chunk.ID).Update("index", -1-i).Error; err != nil {
+			return err
+		}
+	}
+	for _, m := range moves {
+		updates := map[string]interface{}{"index": m.to}
+		if key, ok := keys[m.chunk.ID]; ok {
+			updates["content_key"] = key
+		}
+		if err := tx.Model(&BookChunk{}).Where("id = ?", m.chunk.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if m.chunk.FinalAudioPath == "" {
+			continue
+		}
+		if err := tx.Model(&AudioArtifact{}).
+			Where("book_id = ? AND kind = ? AND path = ?", m.chunk.BookID, artifactPageFinal, m.chunk.FinalAudioPath).
+			Updates(map[string]interface{}{"start_idx": m.to, "end_idx": m.to}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidateChunkGroupsFrom drops every merged chunk group reaching index or beyond.
+// Their files are named after the range, so moved groups are dropped, not shifted.
+func invalidateChunkGroupsFrom(bookID uint, index int) (int, error) {
+	var groups []ProcessedChunkGroup
+	if err := db.Where("book_id = ? AND end_idx >= ?", bookID, index).Find(&groups).Error; err != nil {
+		return 0, err
+	}
+	return dropChunkGroups(bookID, groups)
+}
+
+// errBookBusy aborts a split or renumber transaction when narration of the book started.
+var errBookBusy = errors.New("book is processing")
+
+// loadReorderableBook loads the book of a split or renumber request and responds with
+// an error unless the caller owns it and nothing is being narrated.
+func loadReorderableBook(c *gin.Context) (Book, bool) {
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return book, false
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to edit this book", nil)
+		return book, false
+	}
+	if err := claimReorderableBook(db, book.ID); err != nil {
+		respondReorderError(c, "Failed to load book", err)
+		return book, false
+	}
+	return book, true
+}
+
+// claimReorderableBook returns errBookBusy while the book or any of its pages is being
+// narrated. Inside a transaction it also locks the book row until commit, so whole-book
+// processing, which claims the same row, cannot start halfway through a reorder.
+func claimReorderableBook(tx *gorm.DB, bookID uint) error {
+	res := tx.Model(&Book{}).
+		Where("id = ? AND status NOT IN ?", bookID, []BookStatus{bookStatusProcessing, bookStatusTTSCompleted}).
+		Update("updated_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errBookBusy
+	}
+	var busy int64
+	if err := tx.Model(&BookChunk{}).Where("book_id = ? AND tts_status = ?", bookID, "processing").Count(&busy).Error; err != nil {
+		return err
+	}
+	if busy > 0 {
+		return errBookBusy
+	}
+	return nil
+}
+
+// respondReorderError responds to a failed split or renumber: 409 when narration got in
+// the way, 500 with msg otherwise.
+func respondReorderError(c *gin.Context, msg string, err error) {
+	if errors.Is(err, errBookBusy) {
+		respondError(c, http.StatusConflict, codeBookProcessing, "Book is processing; try again when it finishes", nil)
+		return
+	}
+	respondError(c, http.StatusInternalServerError, codeInternalError, msg, err.Error())
+}
+
+// lockReorder takes the book's merge lock for a split or renumber, so no page mix or
+// group merge writes outputs the reorder is about to invalidate. It responds with an
+// error when the request ends while waiting.
+func lockReorder(c *gin.Context, bookID uint) (func(), bool) {
+	unlock, err := lockBookMerge(c.Request.Context(), bookID)
+	if err != nil {
+		respondError(c, http.StatusServiceUnavailable, codeBookProcessing, "Book audio is being merged; try again shortly", err.Error())
+		return nil, false
+	}
+	return unlock, true
+}
+
+// splitChunkHandler splits a page in two at a character offset. The text after the
+// offset becomes a new page right after it and later pages move up by one. The split
+// page goes back to pending, and merged groups from it onwards and the book-level audio
+// are invalidated.
+func splitChunkHandler(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid chunk index", nil)
+		return
+	}
+	var req struct {
+		At int `json:"at" binding:"required,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "at (character offset) is required", nil)
+		return
+	}
+
+	book, ok := loadReorderableBook(c)
+	if !ok {
+		return
+	}
+	unlock, ok := lockReorder(c, book.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	var chunk BookChunk
+	if err := db.Where("book_id = ? AND \"index\" = ?", book.ID, index).First(&chunk).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeChunkNotFound, "Chunk not found", nil)
+		return
+	}
+	if err := loadChunkContent(&chunk); err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load page text", err.Error())
+		return
+	}
+	runes := []rune(chunk.Content)
+	first, second := string(runes[:min(req.At, len(runes))]), string(runes[min(req.At, len(runes)):])
+	if strings.TrimSpace(first) == "" || strings.TrimSpace(second) == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Both parts of the split must have text", gin.H{"characters": len(runes)})
+		return
+	}
+
+	var later []BookChunk
+	if err := db.Select(chunkMoveColumns).Where("book_id = ? AND \"index\" > ?", book.ID, index).
+		Order("\"index\" ASC").Find(&later).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load pages", err.Error())
+		return
+	}
+	moves := splitChunkMoves(later)
+	keys, err := relocateChunkTexts(moves)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to move page text", err.Error())
+		return
+	}
+	// Both halves go to fresh store keys: the split page's current key and the key of
+	// index+1 still hold text rows point at until the split commits
+	updates, err := freshChunkContentColumns(book.ID, index, first)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to store page text", err.Error())
+		return
+	}
+	resetChunkAudioColumns(updates)
+	created := BookChunk{BookID: book.ID, Index: index + 1, Content: second, TTSStatus: "pending"}
+	if contentStore != nil {
+		created.ContentKey, created.Content = freshChunkKey(book.ID, index+1), ""
+		if err := contentStore.Put(created.ContentKey, second); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to store page text", err.Error())
+			return
+		}
+	}
+
+	oldKeys, newKeys := movedContentKeys(moves, keys)
+	if key, ok := updates["content_key"].(string); ok {
+		oldKeys, newKeys = append(oldKeys, chunk.ContentKey), append(newKeys, key, created.ContentKey)
+	}
+	// Updates writes the cleared columns back into chunk, so keep what it pointed at
+	oldAudio := []string{chunk.AudioPath, chunk.FinalAudioPath}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := claimReorderableBook(tx, book.ID); err != nil {
+			return err
+		}
+		if err := moveChunks(tx, moves, keys); err != nil {
+			return err
+		}
+		if err := tx.Model(&chunk).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&created).Error
+	}); err != nil {
+		dropUnusedContent(newKeys...)
+		respondReorderError(c, "Failed to split chunk", err)
+		return
+	}
+	dropUnusedContent(oldKeys...)
+	for _, f := range oldAudio {
+		if f != "" {
+			os.Remove(f)
+		}
+	}
+
+	invalidated, err := invalidateChunkGroupsFrom(book.ID, index)
+	if err != nil {
+		log.Printf("⚠️ Failed to invalidate chunk groups for book %d from index %d: %v", book.ID, index, err)
+	}
+	hash, err := resetBookAudio(book)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update book", err.Error())
+		return
+	}
+	log.Printf("✂️ Split page %d of book %d at character %d; %d later pages moved", index, book.ID, req.At, len(moves))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Chunk split",
+		"book_id":            book.ID,
+		"index":              index,
+		"new_index":          created.Index,
+		"moved":              len(moves),
+		"content_hash":       hash,
+		"invalidated_groups": invalidated,
+	})
+}
+
+// renumberChunksHandler closes gaps in a book's page indexes so they run 0..n-1 in their
+// current order. Page text and audio are kept; merged groups from the first moved page
+// onwards are invalidated.
+func renumberChunksHandler(c *gin.Context) {
+	book, ok := loadReorderableBook(c)
+	if !ok {
+		return
+	}
+	unlock, ok := lockReorder(c, book.ID)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	var chunks []BookChunk
+	if err := db.Select(chunkMoveColumns).Where("book_id = ?", book.ID).
+		Order("\"index\" ASC").Find(&chunks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load pages", err.Error())
+		return
+	}
+	moves := renumberChunkMoves(chunks)
+
+	invalidated := 0
+	if len(moves) > 0 {
+		keys, err := relocateChunkTexts(moves)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to move page text", err.Error())
+			return
+		}
+		oldKeys, newKeys := movedContentKeys(moves, keys)
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := claimReorderableBook(tx, book.ID); err != nil {
+				return err
+			}
+			return moveChunks(tx, moves, keys)
+		}); err != nil {
+			dropUnusedContent(newKeys...)
+			respondReorderError(c, "Failed to renumber chunks", err)
+			return
+		}
+		dropUnusedContent(oldKeys...)
+		if invalidated, err = invalidateChunkGroupsFrom(book.ID, moves[0].to); err != nil {
+			log.Printf("⚠️ Failed to invalidate chunk groups for book %d from index %d: %v", book.ID, moves[0].to, err)
+		}
+		log.Printf("🔢 Renumbered %d of %d pages of book %d", len(moves), len(chunks), book.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Chunks renumbered",
+		"book_id":            book.ID,
+		"chunks":             len(chunks),
+		"moved":              len(moves),
+		"invalidated_groups": invalidated,
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+)
+
+// recordArg matches any argument and stores it, so a test can replay the statements
+// gorm sent.
+type recordArg struct{ dst *driver.Value }
+
+func (a recordArg) Match(v driver.Value) bool {
+	*a.dst = v
+	return true
+}
+
+// indexUpdate is one "index" update sent by moveChunks.
+type indexUpdate struct {
+	id, index driver.Value
+}
+
+// expectMoveChunks expects the statements moveChunks sends for moves and returns the
+// index updates in the order they reach the database.
+func expectMoveChunks(mock sqlmock.Sqlmock, moves []chunkMove) []*indexUpdate {
+	update := `UPDATE "book_chunks" SET "index"=\$1,"updated_at"=\$2 WHERE id = \$3`
+	var updates []*indexUpdate
+	expect := func() {
+		u := &indexUpdate{}
+		mock.ExpectExec(update).
+			WithArgs(recordArg{&u.index}, sqlmock.AnyArg(), recordArg{&u.id}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		updates = append(updates, u)
+	}
+	for range moves {
+		expect()
+	}
+	for _, m := range moves {
+		expect()
+		if m.chunk.FinalAudioPath != "" {
+			mock.ExpectExec(`UPDATE "audio_artifacts" SET "end_idx"=\$1,"start_idx"=\$2 WHERE book_id = \$3 AND kind = \$4 AND path = \$5`).
+				WithArgs(m.to, m.to, m.chunk.BookID, artifactPageFinal, m.chunk.FinalAudioPath).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+	return updates
+}
+
+// applyUniqueIndexes replays updates on pages (ID to index) as a unique (book_id, index)
+// index would see them, failing on the first statement that repeats an index.
+func applyUniqueIndexes(t *testing.T, pages map[int64]int64, updates []*indexUpdate) {
+	t.Helper()
+	for i, u := range updates {
+		id, index := u.id.(int64), u.index.(int64)
+		for other, at := range pages {
+			if other != id && at == index {
+				t.Fatalf("statement %d moves page %d to index %d, still held by page %d", i+1, id, index, other)
+			}
+		}
+		pages[id] = index
+	}
+}
+
+// runMoveChunks moves pages (ID to index) of book 3 by moves in one transaction and
+// returns the indexes the unique index saw at the end.
+func runMoveChunks(t *testing.T, pages map[int64]int64, moves []chunkMove) map[int64]int64 {
+	t.Helper()
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	updates := expectMoveChunks(mock, moves)
+	mock.ExpectCommit()
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return moveChunks(tx, moves, nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	applyUniqueIndexes(t, pages, updates)
+	return pages
+}
+
+func TestSplitShiftsLaterPages(t *testing.T) {
+	// Page 1 (ID 11) is split; pages 2 and 3 move up to make room for its second half.
+	// Moving page 2 straight to 3 would collide with page 3, so parking is required.
+	later := []BookChunk{
+		{ID: 12, BookID: 3, Index: 2, FinalAudioPath: "audio/page_2_final.mp3"},
+		{ID: 13, BookID: 3, Index: 3},
+	}
+	moves := splitChunkMoves(later)
+	pages := runMoveChunks(t, map[int64]int64{10: 0, 11: 1, 12: 2, 13: 3}, moves)
+
+	want := map[int64]int64{10: 0, 11: 1, 12: 3, 13: 4}
+	for id, index := range want {
+		if pages[id] != index {
+			t.Errorf("page %d at index %d, want %d", id, pages[id], index)
+		}
+	}
+}
+
+func TestRenumberClosesGaps(t *testing.T) {
+	chunks := []BookChunk{
+		{ID: 10, BookID: 3, Index: 0},
+		{ID: 11, BookID: 3, Index: 2},
+		{ID: 12, BookID: 3, Index: 3, FinalAudioPath: "audio/page_3_final.mp3"},
+		{ID: 13, BookID: 3, Index: 7},
+	}
+	moves := renumberChunkMoves(chunks)
+	if len(moves) != 3 {
+		t.Fatalf("%d moves, want 3 (page 0 stays)", len(moves))
+	}
+	pages := runMoveChunks(t, map[int64]int64{10: 0, 11: 2, 12: 3, 13: 7}, moves)
+
+	for i, ch := range chunks {
+		if got := pages[int64(ch.ID)]; got != int64(i) {
+			t.Errorf("page %d at index %d, want %d", ch.ID, got, i)
+		}
+	}
+}
+
+func TestRenumberNothingToMove(t *testing.T) {
+	if moves := renumberChunkMoves([]BookChunk{{ID: 1, Index: 0}, {ID: 2, Index: 1}}); len(moves) != 0 {
+		t.Fatalf("renumberChunkMoves of contiguous pages = %v, want none", moves)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// contentAEAD encrypts book text at rest when CONTENT_ENCRYPTION_KEY is set; nil leaves
+// text in plaintext. Values written before the key was set stay readable because
+// only values carrying the sealed prefix or header are decrypted.
+var contentAEAD cipher.AEAD
+
+const (
+	sealedTextPrefix = "enc:v1:"   // Prefix of encrypted database values
+	sealedFileHeader = "ENCv1\x00" // Header of encrypted files
+)
+
+// initContentEncryption loads CONTENT_ENCRYPTION_KEY, a 32-byte AES-256 key given as
+// base64 or hex. An invalid key stops startup rather than storing plaintext.
+func initContentEncryption() {
+	raw := strings.TrimSpace(getEnv("CONTENT_ENCRYPTION_KEY", ""))
+	if raw == "" {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		key, err = hex.DecodeString(raw)
+	}
+	if err != nil || len(key) != 32 {
+		log.Fatalf("CONTENT_ENCRYPTION_KEY must be 32 bytes, base64 or hex encoded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatalf("CONTENT_ENCRYPTION_KEY: %v", err)
+	}
+	if contentAEAD, err = cipher.NewGCM(block); err != nil {
+		log.Fatalf("CONTENT_ENCRYPTION_KEY: %v", err)
+	}
+	log.Println("🔐 Book content encryption at rest enabled")
+}
+
+// seal encrypts data with a fresh nonce, returning nonce||ciphertext.
+func seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, contentAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return contentAEAD.Seal(nonce, nonce, data, nil), nil
+}
+
+// unseal reverses seal.
+func unseal(sealed []byte) ([]byte, error) {
+	if contentAEAD == nil {
+		return nil, errors.New("content is encrypted but CONTENT_ENCRYPTION_KEY is not set")
+	}
+	n := contentAEAD.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("encrypted content is truncated")
+	}
+	return contentAEAD.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+// encryptContent returns s encrypted for storage in the database, or s unchanged when
+// encryption is off, s is empty or already encrypted.
+func encryptContent(s string) (string, error) {
+	if contentAEAD == nil || s == "" || strings.HasPrefix(s, sealedTextPrefix) {
+		return s, nil
+	}
+	sealed, err := seal([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	return sealedTextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptContent returns the plaintext of a database value; plaintext values pass through.
+func decryptContent(s string) (string, error) {
+	encoded, ok := strings.CutPrefix(s, sealedTextPrefix)
+	if !ok {
+		return s, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted content: %w", err)
+	}
+	plain, err := unseal(sealed)
+	if err != nil {
+		return "", fmt.Errorf("decrypt content: %w", err)
+	}
+	return string(plain), nil
+}
+
+// BeforeSave moves a chunk's text to the content store when it is on, and encrypts what
+// stays in the database. Column updates from a map don't write the model's fields, so
+// they are left to chunkContentColumns.
+func (ch *BookChunk) BeforeSave(tx *gorm.DB) (err error) {
+	if tx != nil {
+		if _, columns := tx.Statement.Dest.(map[string]interface{}); columns {
+			return nil
+		}
+	}
+	if contentStore != nil && ch.Content != "" {
+		key := chunkContentKey(ch.BookID, ch.Index)
+		if err := contentStore.Put(key, ch.Content); err != nil {
+			return err
+		}
+		ch.ContentKey, ch.storedContent, ch.Content = key, ch.Content, ""
+	}
+	if ch.Content, err = encryptContent(ch.Content); err != nil {
+		return err
+	}
+	ch.OriginalContent, err = encryptContent(ch.OriginalContent)
+	return err
+}
+
+// AfterSave restores the plaintext on the in-memory chunk after BeforeSave.
+func (ch *BookChunk) AfterSave(tx *gorm.DB) error {
+	if ch.storedContent != "" {
+		ch.Content, ch.storedContent = ch.storedContent, ""
+	}
+	return ch.AfterFind(tx)
+}
+
+// AfterFind decrypts a loaded chunk's text.
+func (ch *BookChunk) AfterFind(tx *gorm.DB) (err error) {
+	if ch.Content, err = decryptContent(ch.Content); err != nil {
+		return err
+	}
+	ch.OriginalContent, err = decryptContent(ch.OriginalContent)
+	return err
+}
+
+// writeContentFile writes book text to path, encrypted when encryption is on.
+func writeContentFile(path string, data []byte) error {
+	if contentAEAD != nil {
+		sealed, err := seal(data)
+		if err != nil {
+			return err
+		}
+		data = append([]byte(sealedFileHeader), sealed...)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// readContentFile reads a book file written by writeContentFile or encryptFileAtRest,
+// decrypting it if needed. Plaintext files are returned as is.
+func readContentFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(sealedFileHeader)) {
+		return data, nil
+	}
+	plain, err := unseal(data[len(sealedFileHeader):])
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return plain, nil
+}
+
+// encryptFileAtRest replaces an uploaded file with its encrypted form. It is a no-op
+// when encryption is off or the file is already encrypted.
+func encryptFileAtRest(path string) error {
+	if contentAEAD == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte(sealedFileHeader)) {
+		return nil
+	}
+	tmp := path + ".enc.tmp"
+	if err := writeContentFile(tmp, data); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// plaintextFile returns a path holding the plaintext of path, for parsers that need a
+// file (PDF, EPUB). Encrypted files are decrypted to a temp file with the same
+// extension, removed by the returned cleanup.
+func plaintextFile(path string) (string, func(), error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(sealedFileHeader)) {
+		return path, func() {}, nil
+	}
+	plain, err := unseal(data[len(sealedFileHeader):])
+	if err != nil {
+		return "", nil, fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp("", "book_*"+filepath.Ext(path))
+	if err != nil {
+		return "", nil, err
+	}
+	defer tmp.Close()
+	if _, err := tmp.Write(plain); err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+}
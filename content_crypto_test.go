@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+)
+
+// useTestContentKey turns content encryption on for the rest of the test.
+func useTestContentKey(t *testing.T) {
+	t.Helper()
+	block, err := aes.NewCipher([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := contentAEAD
+	contentAEAD = aead
+	t.Cleanup(func() { contentAEAD = saved })
+}
+
+func TestEncryptContent(t *testing.T) {
+	useTestContentKey(t)
+	sealed, err := encryptContent("Call me Ishmael.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		in     string
+		sealed bool
+	}{
+		{"plaintext", "Call me Ishmael.", true},
+		{"unicode", "Ça va — très bien", true},
+		{"empty", "", false},
+		{"already encrypted", sealed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encryptContent(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.sealed {
+				if got != tt.in {
+					t.Fatalf("encryptContent(%q) = %q, want it unchanged", tt.in, got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, sealedTextPrefix) || strings.Contains(got, tt.in) {
+				t.Fatalf("encryptContent(%q) = %q, want sealed text", tt.in, got)
+			}
+			plain, err := decryptContent(got)
+			if err != nil || plain != tt.in {
+				t.Fatalf("decryptContent(encryptContent(%q)) = %q, %v", tt.in, plain, err)
+			}
+		})
+	}
+
+	again, _ := encryptContent("Call me Ishmael.")
+	if again == sealed {
+		t.Error("encrypting the same text twice gave the same ciphertext")
+	}
+}
+
+func TestEncryptContentDisabled(t *testing.T) {
+	saved := contentAEAD
+	contentAEAD = nil
+	defer func() { contentAEAD = saved }()
+
+	if got, err := encryptContent("plain"); err != nil || got != "plain" {
+		t.Fatalf("encryptContent with encryption off = %q, %v, want plain", got, err)
+	}
+}
+
+func TestDecryptContent(t *testing.T) {
+	useTestContentKey(t)
+	sealed, err := encryptContent("secret page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.TrimPrefix(sealed, sealedTextPrefix)
+	tampered := sealedTextPrefix + body[:len(body)-4] + "AAA="
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"plaintext passes through", "just text", "just text", false},
+		{"empty", "", "", false},
+		{"sealed", sealed, "secret page", false},
+		{"bad base64", sealedTextPrefix + "not base64!", "", true},
+		{"truncated", sealedTextPrefix + "AAAA", "", true},
+		{"tampered", tampered, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptContent(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("decryptContent(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	contentAEAD = nil
+	if _, err := decryptContent(sealed); err == nil {
+		t.Error("decrypting without a key succeeded")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxContentChars is the most characters of extracted text a book may have
+// (MAX_CONTENT_CHARS, default 0 = unlimited). It bounds how long a book narrates and
+// what it costs.
+func maxContentChars() int {
+	n, err := strconv.Atoi(getEnv("MAX_CONTENT_CHARS", "0"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// truncateLongContent reports whether books over MAX_CONTENT_CHARS keep their first
+// characters and are flagged as truncated instead of being rejected
+// (CONTENT_LIMIT_MODE=truncate; the default is reject).
+func truncateLongContent() bool {
+	return getEnv("CONTENT_LIMIT_MODE", "reject") == "truncate"
+}
+
+// contentTooLongError is returned when a book's text exceeds MAX_CONTENT_CHARS and
+// truncation is off.
+type contentTooLongError struct {
+	Chars int
+	Max   int
+}
+
+func (e *contentTooLongError) Error() string {
+	return fmt.Sprintf("content has %d characters, more than the limit of %d", e.Chars, e.Max)
+}
+
+// limitContent applies MAX_CONTENT_CHARS to text, given the characters the book already
+// has before it. It returns the text to keep and whether it was cut short, or a
+// *contentTooLongError when truncation is off or the book has no room left.
+func limitContent(text string, used int) (string, bool, error) {
+	max := maxContentChars()
+	if max == 0 {
+		return text, false, nil
+	}
+	chars := utf8.RuneCountInString(text)
+	if used+chars <= max {
+		return text, false, nil
+	}
+	keep := max - used
+	if !truncateLongContent() || keep <= 0 {
+		return "", false, &contentTooLongError{Chars: used + chars, Max: max}
+	}
+	return string([]rune(text)[:keep]), true, nil
+}
+
+// respondContentTooLong writes the 413 for a book over MAX_CONTENT_CHARS.
+func respondContentTooLong(c *gin.Context, err *contentTooLongError) {
+	respondError(c, http.StatusRequestEntityTooLarge, codeContentTooLong,
+		fmt.Sprintf("Book text is too long: %d characters, the limit is %d", err.Chars, err.Max),
+		gin.H{"characters": err.Chars, "max_content_chars": err.Max})
+}
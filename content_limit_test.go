@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLimitContent(t *testing.T) {
+	tests := []struct {
+		name         string
+		max, mode    string
+		text         string
+		used         int
+		want         string
+		truncated    bool
+		tooLong      bool
+		tooLongChars int
+	}{
+		{"unlimited", "0", "reject", "anything at all", 1000, "anything at all", false, false, 0},
+		{"at the limit", "5", "reject", "héllo", 0, "héllo", false, false, 0},
+		{"over the limit rejected", "5", "reject", "héllo!", 0, "", false, true, 6},
+		{"earlier files count", "8", "reject", "héllo", 4, "", false, true, 9},
+		{"truncated on rune boundary", "4", "truncate", "héllo", 0, "héll", true, false, 0},
+		{"truncated after earlier files", "8", "truncate", "héllo", 6, "hé", true, false, 0},
+		{"no room left", "8", "truncate", "héllo", 8, "", false, true, 13},
+		{"invalid limit is unlimited", "-3", "reject", "héllo", 0, "héllo", false, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_CONTENT_CHARS", tt.max)
+			t.Setenv("CONTENT_LIMIT_MODE", tt.mode)
+			got, truncated, err := limitContent(tt.text, tt.used)
+			var tooLong *contentTooLongError
+			if errors.As(err, &tooLong) != tt.tooLong {
+				t.Fatalf("limitContent() error = %v, want too long %v", err, tt.tooLong)
+			}
+			if tt.tooLong {
+				if tooLong.Chars != tt.tooLongChars {
+					t.Errorf("error reports %d characters, want %d", tooLong.Chars, tt.tooLongChars)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("limitContent() = %q, %v; want %q, %v", got, truncated, tt.want, tt.truncated)
+			}
+		})
+	}
+}
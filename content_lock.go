@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// lockContentHash takes a Postgres session advisory lock for a content hash so only one
+// book with that content is narrated at a time; the others wait and then reuse its audio.
+// The lock lives on a dedicated connection and is released by calling the returned func.
+func lockContentHash(hash string) (func(), error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("get sql db: %w", err)
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtextextended($1, 0))", hash); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("advisory lock: %w", err)
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtextextended($1, 0))", hash); err != nil {
+			log.Printf("⚠️ Failed to release content lock %s: %v", hash, err)
+		}
+		conn.Close()
+	}, nil
+}
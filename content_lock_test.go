@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// releasedArg matches hash and closes released, standing in for the pg_advisory_unlock
+// that lets a waiting session through.
+type releasedArg struct {
+	hash     string
+	released chan struct{}
+}
+
+func (a releasedArg) Match(v driver.Value) bool {
+	if v != a.hash {
+		return false
+	}
+	// sqlmock may match an argument more than once
+	select {
+	case <-a.released:
+	default:
+		close(a.released)
+	}
+	return true
+}
+
+// heldArg matches hash once released is closed, so the pg_advisory_lock it matches
+// blocks like Postgres does while another session holds the lock.
+type heldArg struct {
+	hash     string
+	released chan struct{}
+}
+
+func (a heldArg) Match(v driver.Value) bool {
+	if v != a.hash {
+		return false
+	}
+	<-a.released
+	return true
+}
+
+func TestLockContentHashWaitsForRelease(t *testing.T) {
+	mock := mockDB(t)
+	// The second session blocks in pg_advisory_lock, so the statements may arrive out
+	// of order
+	mock.MatchExpectationsInOrder(false)
+	released := make(chan struct{})
+	lock := `SELECT pg_advisory_lock\(hashtextextended\(\$1, 0\)\)`
+	unlock := `SELECT pg_advisory_unlock\(hashtextextended\(\$1, 0\)\)`
+	mock.ExpectExec(lock).WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(unlock).WithArgs(releasedArg{"abc", released}).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(lock).WithArgs(heldArg{"abc", released}).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(unlock).WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	first, err := lockContentHash("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func())
+	go func() {
+		second, err := lockContentHash("abc")
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second narration of the same content got the lock while the first held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first()
+	select {
+	case second := <-acquired:
+		if second != nil {
+			second()
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second narration still waiting after the first released the lock")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ContentStore keeps page text outside the database. Keys are relative paths such as
+// "book_7/chunk_12.txt"; a BookChunk with a ContentKey has an empty Content column.
+type ContentStore interface {
+	Put(key, text string) error
+	Get(key string) (string, error)
+	Delete(key string) error
+	DeleteBook(bookID uint) error
+}
+
+// fileContentStore stores page text as files under dir, encrypted at rest like other
+// book files when CONTENT_ENCRYPTION_KEY is set.
+type fileContentStore struct {
+	dir string
+}
+
+func (s fileContentStore) Put(key, text string) error {
+	path := filepath.Join(s.dir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeContentFile(path, []byte(text))
+}
+
+func (s fileContentStore) Get(key string) (string, error) {
+	data, err := readContentFile(filepath.Join(s.dir, key))
+	return string(data), err
+}
+
+func (s fileContentStore) Delete(key string) error {
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s fileContentStore) DeleteBook(bookID uint) error {
+	return os.RemoveAll(filepath.Join(s.dir, fmt.Sprintf("book_%d", bookID)))
+}
+
+// contentStore is where new page text goes: nil keeps it in the database (the default,
+// CHUNK_CONTENT_STORE=db); "file" uses CONTENT_STORE_DIR (default ./content).
+var contentStore = newContentStore()
+
+func newContentStore() ContentStore {
+	if getEnv("CHUNK_CONTENT_STORE", "db") != "file" {
+		return nil
+	}
+	return fileContentStore{dir: getEnv("CONTENT_STORE_DIR", "./content")}
+}
+
+// chunkContentKey is the store key of a page; edits overwrite it in place.
+func chunkContentKey(bookID uint, index int) string {
+	return fmt.Sprintf("book_%d/chunk_%d.txt", bookID, index)
+}
+
+// relocatedChunkKey is the store key of a page's text after the page moved to index.
+// It includes the chunk ID, so it is never a key another page still points at.
+func relocatedChunkKey(bookID, chunkID uint, index int) string {
+	return fmt.Sprintf("book_%d/chunk_%d_%d.txt", bookID, index, chunkID)
+}
+
+// freshChunkKey is a new store key for a page's text at index. No page points at it
+// yet, so text can be written there before the change that uses it commits.
+func freshChunkKey(bookID uint, index int) string {
+	return fmt.Sprintf("book_%d/chunk_%d_v%d.txt", bookID, index, time.Now().UnixNano())
+}
+
+// dropUnusedContent deletes stored page texts that no chunk points at any more, such as
+// the old key of a page whose text moved to a relocated or fresh key. Call it once the
+// change that replaced the keys is committed (or failed); keys still in use are kept.
+func dropUnusedContent(keys ...string) {
+	if contentStore == nil {
+		return
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		var used int64
+		if err := db.Model(&BookChunk{}).Where("content_key = ?", key).Count(&used).Error; err != nil {
+			log.Printf("⚠️ Failed to check use of page text %s: %v", key, err)
+			continue
+		}
+		if used > 0 {
+			continue
+		}
+		if err := contentStore.Delete(key); err != nil {
+			log.Printf("⚠️ Failed to remove unused page text %s: %v", key, err)
+		}
+	}
+}
+
+// loadChunkContent fills in the text of a chunk kept in the content store. Chunks
+// stored in the database, or already loaded, are left alone.
+func loadChunkContent(ch *BookChunk) error {
+	if ch.ContentKey == "" || ch.Content != "" {
+		return nil
+	}
+	if contentStore == nil {
+		return fmt.Errorf("chunk %d text is in the content store but CHUNK_CONTENT_STORE is not \"file\"", ch.ID)
+	}
+	text, err := contentStore.Get(ch.ContentKey)
+	if err != nil {
+		return fmt.Errorf("load chunk %d text: %w", ch.ID, err)
+	}
+	ch.Content = text
+	return nil
+}
+
+// loadChunkTexts returns the text of every chunk matched by query, in query order.
+func loadChunkTexts(query *gorm.DB) ([]string, error) {
+	var chunks []BookChunk
+	if err := query.Select("id", "content", "content_key").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(chunks))
+	for i := range chunks {
+		if err := loadChunkContent(&chunks[i]); err != nil {
+			return nil, err
+		}
+		texts[i] = chunks[i].Content
+	}
+	return texts, nil
+}
+
+// chunkContentColumns returns the column updates that set a chunk's text to text: a
+// store key when the content store is on, the (encrypted) text otherwise. The text is
+// taken as new source text: original_content is cleared so a translated book translates
+// the page again. prepareChunkText sets original_content afterwards when saving a
+// translation.
+func chunkContentColumns(bookID uint, index int, text string) (map[string]interface{}, error) {
+	if contentStore != nil {
+		key := chunkContentKey(bookID, index)
+		if err := contentStore.Put(key, text); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"content": "", "content_key": key, "original_content": ""}, nil
+	}
+	sealed, err := encryptContent(text)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"content": sealed, "content_key": "", "original_content": ""}, nil
+}
+
+// freshChunkContentColumns is chunkContentColumns writing to a freshChunkKey, for
+// changes that must not touch text other rows point at before they commit.
+func freshChunkContentColumns(bookID uint, index int, text string) (map[string]interface{}, error) {
+	if contentStore == nil {
+		return chunkContentColumns(bookID, index, text)
+	}
+	key := freshChunkKey(bookID, index)
+	if err := contentStore.Put(key, text); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"content": "", "content_key": key, "original_content": ""}, nil
+}
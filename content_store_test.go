@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFileContentStoreRoundTrip(t *testing.T) {
+	for _, encrypted := range []bool{false, true} {
+		name := "plaintext"
+		if encrypted {
+			name = "encrypted"
+		}
+		t.Run(name, func(t *testing.T) {
+			if encrypted {
+				useTestContentKey(t)
+			}
+			store := fileContentStore{dir: t.TempDir()}
+			text := "It was a bright cold day in April."
+			key := chunkContentKey(7, 3)
+			if err := store.Put(key, text); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Put(chunkContentKey(8, 0), "another book"); err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := os.ReadFile(filepath.Join(store.dir, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(raw), text); got == encrypted {
+				t.Fatalf("file holds plaintext = %v, want %v", got, !encrypted)
+			}
+			if got, err := store.Get(key); err != nil || got != text {
+				t.Fatalf("Get(%q) = %q, %v; want %q", key, got, err, text)
+			}
+
+			if err := store.DeleteBook(7); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(key); !os.IsNotExist(err) {
+				t.Fatalf("Get after DeleteBook: err = %v, want not exist", err)
+			}
+			if got, err := store.Get(chunkContentKey(8, 0)); err != nil || got != "another book" {
+				t.Fatalf("DeleteBook(7) touched book 8: %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestDropUnusedContent(t *testing.T) {
+	store := fileContentStore{dir: t.TempDir()}
+	saved := contentStore
+	contentStore = store
+	t.Cleanup(func() { contentStore = saved })
+
+	stale, current := relocatedChunkKey(7, 12, 4), chunkContentKey(7, 4)
+	for _, key := range []string{stale, current} {
+		if err := store.Put(key, "page text"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mock := mockDB(t)
+	count := `SELECT count\(\*\) FROM "book_chunks" WHERE content_key = \$1`
+	mock.ExpectQuery(count).WithArgs(stale).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(count).WithArgs(current).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	dropUnusedContent(stale, "", current)
+
+	if _, err := store.Get(stale); !os.IsNotExist(err) {
+		t.Errorf("unused key %s kept (err = %v)", stale, err)
+	}
+	if _, err := store.Get(current); err != nil {
+		t.Errorf("key %s still in use was removed: %v", current, err)
+	}
+}
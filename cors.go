@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS defaults; CORS_METHODS and CORS_HEADERS override the allowed lists.
+const (
+	defaultCORSMethods = "GET,POST,PUT,PATCH,DELETE,OPTIONS"
+	defaultCORSHeaders = "Authorization,Content-Type,Range,Idempotency-Key,X-Request-ID"
+	corsExposedHeaders = "Content-Length,Content-Range,Accept-Ranges,ETag,Last-Modified,Retry-After,X-Request-ID"
+)
+
+// corsMiddleware adds CORS headers for origins listed in CORS_ORIGINS (comma-separated,
+// "*" for any) and answers preflight OPTIONS requests. Set CORS_ALLOW_CREDENTIALS=true to
+// let browsers send cookies and auth headers; it is ignored when CORS_ORIGINS is "*", since
+// any site could then make credentialed requests. With CORS_ORIGINS unset no headers are added.
+func corsMiddleware() gin.HandlerFunc {
+	origins := map[string]bool{}
+	for _, o := range strings.Split(getEnv("CORS_ORIGINS", ""), ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins[o] = true
+		}
+	}
+	methods := getEnv("CORS_METHODS", defaultCORSMethods)
+	headers := getEnv("CORS_HEADERS", defaultCORSHeaders)
+	credentials := getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true"
+	if credentials && origins["*"] {
+		log.Println("⚠️ CORS_ALLOW_CREDENTIALS ignored: CORS_ORIGINS allows any origin")
+		credentials = false
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || len(origins) == 0 {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		if !origins[origin] && !origins["*"] {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		allowOrigin := origin
+		if origins["*"] {
+			allowOrigin = "*"
+		}
+		c.Header("Access-Control-Allow-Origin", allowOrigin)
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+		if credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
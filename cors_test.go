@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsRouter serves GET /ping behind corsMiddleware built from the given env.
+func corsRouter(t *testing.T, origins, credentials string) *gin.Engine {
+	t.Helper()
+	t.Setenv("CORS_ORIGINS", origins)
+	t.Setenv("CORS_ALLOW_CREDENTIALS", credentials)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(corsMiddleware())
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	return r
+}
+
+func corsRequest(r *gin.Engine, method, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/ping", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	r := corsRouter(t, "https://app.example.com, https://admin.example.com/", "true")
+
+	w := corsRequest(r, http.MethodGet, "https://admin.example.com")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Errorf("Allow-Origin = %q, want the request origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Allow-Credentials = %q, want true", got)
+	}
+
+	w = corsRequest(r, http.MethodOptions, "https://app.example.com")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != defaultCORSMethods {
+		t.Errorf("Allow-Methods = %q, want %q", got, defaultCORSMethods)
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	r := corsRouter(t, "https://app.example.com", "true")
+
+	w := corsRequest(r, http.MethodGet, "https://evil.example.com")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	for _, h := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"} {
+		if got := w.Header().Get(h); got != "" {
+			t.Errorf("%s = %q, want unset", h, got)
+		}
+	}
+	if got := w.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+
+	if w := corsRequest(r, http.MethodOptions, "https://evil.example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("preflight status = %d, want 403", w.Code)
+	}
+}
+
+func TestCORSWildcardDropsCredentials(t *testing.T) {
+	r := corsRouter(t, "*", "true")
+
+	w := corsRequest(r, http.MethodGet, "https://anywhere.example.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Allow-Credentials = %q, want unset with a wildcard origin", got)
+	}
+}
+
+func TestCORSWithoutOrigin(t *testing.T) {
+	r := corsRouter(t, "https://app.example.com", "false")
+
+	w := corsRequest(r, http.MethodGet, "")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Allow-Origin = %q, want unset for same-origin requests", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// mockDB points db at a sqlmock connection speaking the postgres dialect for the rest of
+// the test and checks on cleanup that every expected statement ran.
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := db
+	db = gdb
+	t.Cleanup(func() {
+		db = saved
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return mock
+}
+
+// waitForExpectations waits until every expected statement ran, for statements run by a
+// goroutine a handler started, so the mock is not torn down under it.
+func waitForExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectWrite expects a statement gorm runs in a transaction of its own, such as an
+// update or delete outside db.Transaction.
+func expectWrite(mock sqlmock.Sqlmock, sql string) *sqlmock.ExpectedExec {
+	mock.ExpectBegin()
+	exec := mock.ExpectExec(sql)
+	mock.ExpectCommit()
+	return exec
+}
+
+// expectInsert expects a create gorm runs in a transaction of its own, returning id.
+func expectInsert(mock sqlmock.Sqlmock, sql string, id int) *sqlmock.ExpectedQuery {
+	mock.ExpectBegin()
+	query := mock.ExpectQuery(sql).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectCommit()
+	return query
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DeadLetterJob is a snapshot of a TTS job that failed JOB_MAX_ATTEMPTS times, kept so
+// operators can inspect the error and replay it.
+type DeadLetterJob struct {
+	ID         uint `gorm:"primaryKey"`
+	JobID      uint `gorm:"index"`
+	BookID     uint `gorm:"index"`
+	UserID     uint
+	ChunkIDs   string
+	Priority   int
+	Attempts   int
+	Error      string `gorm:"type:text"`
+	FailedAt   time.Time
+	ReplayedAt *time.Time // Set when an operator puts the job back in the queue
+	CreatedAt  time.Time
+}
+
+// jobMaxAttempts is how many times the worker runs a job before dead-lettering it
+// (JOB_MAX_ATTEMPTS, default 3).
+func jobMaxAttempts() int {
+	n, err := strconv.Atoi(getEnv("JOB_MAX_ATTEMPTS", "3"))
+	if err != nil || n < 1 {
+		return 3
+	}
+	return n
+}
+
+// jobRetryDelay is how long a job that failed its attempts-th run waits before the
+// worker claims it again: JOB_RETRY_BACKOFF (default 30s) doubled for every earlier
+// failure, capped at one hour.
+func jobRetryDelay(attempts int) time.Duration {
+	base, err := time.ParseDuration(getEnv("JOB_RETRY_BACKOFF", "30s"))
+	if err != nil || base <= 0 {
+		base = 30 * time.Second
+	}
+	const maxDelay = time.Hour
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// failJob records a failed run of job. The job goes back in the queue, to be claimed
+// again after jobRetryDelay, until it has been attempted jobMaxAttempts times; then it
+// is marked failed and copied to the dead-letter table.
+func failJob(job TTSQueueJob, runErr error) {
+	if job.Attempts < jobMaxAttempts() {
+		delay := jobRetryDelay(job.Attempts)
+		log.Printf("🔁 Job #%d failed (attempt %d/%d), retrying in %s: %v", job.ID, job.Attempts, jobMaxAttempts(), delay, runErr)
+		db.Model(&job).Updates(map[string]interface{}{
+			"status":          "queued",
+			"last_error":      runErr.Error(),
+			"next_attempt_at": time.Now().Add(delay),
+		})
+		return
+	}
+
+	log.Printf("☠️ Job #%d failed %d times, moving to dead letters: %v", job.ID, job.Attempts, runErr)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&job).Updates(map[string]interface{}{"status": "failed", "last_error": runErr.Error()}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&DeadLetterJob{
+			JobID:    job.ID,
+			BookID:   job.BookID,
+			UserID:   job.UserID,
+			ChunkIDs: job.ChunkIDs,
+			Priority: job.Priority,
+			Attempts: job.Attempts,
+			Error:    runErr.Error(),
+			FailedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("❌ Failed to dead-letter job #%d: %v", job.ID, err)
+	}
+}
+
+// listDeadLettersHandler lists dead-lettered jobs, newest first. ?replayed=false hides
+// the ones already replayed; ?limit= (default 50, max 200) and ?offset= page the list.
+func listDeadLettersHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be between 1 and 200", nil)
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "offset must be a non-negative integer", nil)
+		return
+	}
+
+	query := db.Model(&DeadLetterJob{})
+	if c.Query("replayed") == "false" {
+		query = query.Where("replayed_at IS NULL")
+	}
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count dead letters", err.Error())
+		return
+	}
+	letters := []DeadLetterJob{}
+	if err := query.Order("failed_at DESC").Limit(limit).Offset(offset).Find(&letters).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to list dead letters", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dead_letters": letters, "total": total, "limit": limit, "offset": offset})
+}
+
+// replayDeadLetterHandler puts a dead-lettered job back in the queue with a fresh set of
+// attempts.
+func replayDeadLetterHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("dead_letter_id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid dead letter ID", nil)
+		return
+	}
+	var letter DeadLetterJob
+	if err := db.First(&letter, id).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeJobNotFound, "Dead letter not found", nil)
+		return
+	}
+	if letter.ReplayedAt != nil {
+		respondError(c, http.StatusConflict, codeConflict, "Dead letter was already replayed", gin.H{"replayed_at": letter.ReplayedAt})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&TTSQueueJob{}).Where("id = ? AND status = ?", letter.JobID, "failed").
+			Updates(map[string]interface{}{"status": "queued", "attempts": 0, "next_attempt_at": nil})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&letter).Update("replayed_at", time.Now()).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusConflict, codeConflict, "The original job is no longer in the failed state", gin.H{"job_id": letter.JobID})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to replay job", err.Error())
+		return
+	}
+	wake(jobQueued)
+	c.JSON(http.StatusOK, gin.H{"message": "Job requeued", "job_id": letter.JobID, "status": "queued"})
+}
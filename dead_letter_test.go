@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestJobRetryDelay(t *testing.T) {
+	os.Unsetenv("JOB_RETRY_BACKOFF")
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := jobRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("jobRetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+	t.Setenv("JOB_RETRY_BACKOFF", "5s")
+	if got := jobRetryDelay(2); got != 10*time.Second {
+		t.Errorf("JOB_RETRY_BACKOFF=5s: jobRetryDelay(2) = %s, want 10s", got)
+	}
+}
+
+// afterDelay matches a time at least d from when the matcher was made.
+type afterDelay struct {
+	from time.Time
+	d    time.Duration
+}
+
+func (a afterDelay) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	return ok && !at.Before(a.from.Add(a.d))
+}
+
+func TestFailJobRetriesAfterDelay(t *testing.T) {
+	t.Setenv("JOB_MAX_ATTEMPTS", "3")
+	t.Setenv("JOB_RETRY_BACKOFF", "30s")
+	mock := mockDB(t)
+	expectWrite(mock, `UPDATE "tts_queue_jobs" SET "last_error"=\$1,"next_attempt_at"=\$2,"status"=\$3,"updated_at"=\$4 WHERE "id" = \$5`).
+		WithArgs("boom", afterDelay{time.Now(), time.Minute}, "queued", sqlmock.AnyArg(), uint(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	failJob(TTSQueueJob{ID: 4, Attempts: 2}, errors.New("boom"))
+}
+
+func TestFailJobDeadLettersExhaustedJob(t *testing.T) {
+	t.Setenv("JOB_MAX_ATTEMPTS", "3")
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "tts_queue_jobs" SET "last_error"=\$1,"status"=\$2,"updated_at"=\$3 WHERE "id" = \$4`).
+		WithArgs("boom", "failed", sqlmock.AnyArg(), uint(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "dead_letter_jobs" \("job_id","book_id","user_id","chunk_ids","priority","attempts","error","failed_at","replayed_at","created_at"\)`).
+		WithArgs(uint(4), uint(3), uint(7), "10,11", 5, 3, "boom", sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	failJob(TTSQueueJob{ID: 4, BookID: 3, UserID: 7, ChunkIDs: "10,11", Priority: 5, Attempts: 3}, errors.New("boom"))
+}
@@ -5,21 +5,45 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"log"
 	"os"
 	"strings"
 
+	"gorm.io/gorm"
 	"rsc.io/pdf"
 )
 
-func ChunkDocument(bookID uint, filePath string) (int, error) {
-	text, err := ExtractTextByType(filePath)
+// documentPages is what paginating one source file produced.
+type documentPages struct {
+	Pages     int  // Pages created
+	Chars     int  // Characters of text paginated
+	Truncated bool // Text past MAX_CONTENT_CHARS was dropped
+}
+
+// chunkDocumentFrom paginates filePath into pages numbered from start, so a further
+// file of a book continues after the pages already there. usedChars is the text the
+// book already has, which counts towards MAX_CONTENT_CHARS; over the limit it returns a
+// *contentTooLongError before creating any page, unless CONTENT_LIMIT_MODE=truncate.
+// Pages are created through tx.
+func chunkDocumentFrom(tx *gorm.DB, bookID uint, filePath string, start, usedChars int) (documentPages, error) {
+	var result documentPages
+	plainPath, cleanup, err := plaintextFile(filePath)
+	if err != nil {
+		return result, err
+	}
+	defer cleanup()
+	text, err := ExtractTextByType(plainPath)
 	if err != nil {
-		return 0, err
+		return result, err
+	}
+	if text, result.Truncated, err = limitContent(text, usedChars); err != nil {
+		return result, err
 	}
 
 	runes := []rune(text)
 	chunkSize := 1000
 	total := len(runes)
+	result.Chars = total
 	count := 0
 
 	for i := 0; i < total; i += chunkSize {
@@ -29,15 +53,45 @@ func ChunkDocument(bookID uint, filePath string) (int, error) {
 		}
 		chunk := BookChunk{
 			BookID:    bookID,
-			Index:     count,
+			Index:     start + count,
 			Content:   string(runes[i:end]),
 			AudioPath: "",
+			TTSStatus: "pending",
+		}
+		if err := tx.Create(&chunk).Error; err != nil {
+			result.Pages = count
+			return result, err
 		}
-		db.Create(&chunk)
 		count++
 	}
 
-	return count, nil
+	result.Pages = count
+	return result, nil
+}
+
+// dedupeBookChunks removes duplicate (book_id, index) chunks left by earlier double
+// uploads so the unique index on BookChunk can be created. Of each set it keeps a
+// completed row if there is one, otherwise the most recent, so narrated audio is not
+// thrown away for an older copy of the page.
+func dedupeBookChunks() error {
+	if !db.Migrator().HasTable(&BookChunk{}) {
+		return nil
+	}
+	res := db.Exec(`DELETE FROM book_chunks WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (
+				PARTITION BY book_id, "index"
+				ORDER BY COALESCE(tts_status = 'completed', false) DESC, updated_at DESC, id DESC
+			) AS rank
+			FROM book_chunks
+		) ranked WHERE rank > 1)`)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("🧹 Removed %d duplicate chunks before migrating", res.RowsAffected)
+	}
+	return nil
 }
 
 func ExtractTextByType(path string) (string, error) {
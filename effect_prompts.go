@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// SoundEffectPrompt is a user's own ElevenLabs prompt for a sound event type,
+// taking precedence over the built-in effectPrompts.
+type SoundEffectPrompt struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_effect_prompt_user_event"`
+	EventType string `gorm:"size:64;not null;uniqueIndex:idx_effect_prompt_user_event"`
+	Prompt    string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// resolveEffectPrompt returns the prompt for eventType: the user's override if any,
+// then the built-in default, then a generic prompt.
+func resolveEffectPrompt(userID uint, eventType string) string {
+	if userID != 0 {
+		var custom SoundEffectPrompt
+		err := db.Where("user_id = ? AND event_type = ?", userID, eventType).First(&custom).Error
+		if err == nil {
+			return custom.Prompt
+		}
+	}
+	if prompt, ok := effectPrompts[eventType]; ok {
+		return prompt
+	}
+	return "Sound effect for event: " + eventType + ", about 2 seconds."
+}
+
+// listSoundEffectPromptsHandler lists the caller's custom sound-effect prompts.
+func listSoundEffectPromptsHandler(c *gin.Context) {
+	var prompts []SoundEffectPrompt
+	if err := db.Where("user_id = ?", getUserIDFromContext(c)).Order("event_type").Find(&prompts).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch sound effect prompts", err.Error())
+		return
+	}
+
+	results := make([]gin.H, 0, len(prompts))
+	for _, p := range prompts {
+		results = append(results, gin.H{"event_type": p.EventType, "prompt": p.Prompt})
+	}
+	c.JSON(http.StatusOK, gin.H{"prompts": results, "defaults": effectPrompts})
+}
+
+// upsertSoundEffectPromptHandler creates or replaces the caller's prompt for an event type.
+func upsertSoundEffectPromptHandler(c *gin.Context) {
+	eventType := strings.ToLower(strings.TrimSpace(c.Param("event_type")))
+	var req struct {
+		Prompt string `json:"prompt" binding:"required,max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || eventType == "" || len(eventType) > 64 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "A prompt (max 500 chars) and event type (max 64 chars) are required", nil)
+		return
+	}
+
+	prompt := SoundEffectPrompt{UserID: getUserIDFromContext(c), EventType: eventType, Prompt: strings.TrimSpace(req.Prompt)}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "event_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"prompt", "updated_at"}),
+	}).Create(&prompt).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save sound effect prompt", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"event_type": prompt.EventType, "prompt": prompt.Prompt})
+}
+
+// deleteSoundEffectPromptHandler removes the caller's override so the default applies again.
+func deleteSoundEffectPromptHandler(c *gin.Context) {
+	eventType := strings.ToLower(strings.TrimSpace(c.Param("event_type")))
+	res := db.Where("user_id = ? AND event_type = ?", getUserIDFromContext(c), eventType).Delete(&SoundEffectPrompt{})
+	if res.Error != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to delete sound effect prompt", res.Error.Error())
+		return
+	}
+	if res.RowsAffected == 0 {
+		respondError(c, http.StatusNotFound, codeNotFound, "No custom prompt for this event type", nil)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sound effect prompt deleted"})
+}
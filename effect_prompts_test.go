@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+)
+
+// freshEffectCache gives the test an empty effect cache and restores the shared one
+// afterwards.
+func freshEffectCache(t *testing.T) {
+	t.Helper()
+	effectCacheMu.Lock()
+	cache, locks := effectCache, effectLocks
+	effectCache, effectLocks = map[string]string{}, map[string]*sync.Mutex{}
+	effectCacheMu.Unlock()
+	t.Cleanup(func() {
+		effectCacheMu.Lock()
+		effectCache, effectLocks = cache, locks
+		effectCacheMu.Unlock()
+	})
+}
+
+// soundEffectsAPI answers the ElevenLabs sound generation endpoint with the prompt it
+// was sent as the clip's content, counting the calls in *calls when calls is not nil.
+func soundEffectsAPI(t *testing.T, calls *atomic.Int32) {
+	t.Helper()
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host+r.URL.Path != "api.elevenlabs.io/v1/sound-generation" {
+			http.NotFound(w, r)
+			return
+		}
+		if calls != nil {
+			calls.Add(1)
+		}
+		var req SoundEffectRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte(req.Text))
+	})
+}
+
+// expectEffectPrompt expects the override lookup of userID for eventType, returning
+// prompt, or no row when prompt is empty.
+func expectEffectPrompt(mock sqlmock.Sqlmock, userID uint, eventType, prompt string) {
+	query := mock.ExpectQuery(`SELECT \* FROM "sound_effect_prompts" WHERE user_id = \$1 AND event_type = \$2`).
+		WithArgs(userID, eventType, 1)
+	if prompt == "" {
+		query.WillReturnError(gorm.ErrRecordNotFound)
+		return
+	}
+	query.WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "event_type", "prompt"}).AddRow(1, userID, eventType, prompt))
+}
+
+func TestResolveEffectPrompt(t *testing.T) {
+	mock := mockDB(t)
+	const override = "Two heavy broadswords clashing in a stone hall."
+	expectEffectPrompt(mock, 7, "sword_clash", override)
+	expectEffectPrompt(mock, 8, "sword_clash", "")
+	expectEffectPrompt(mock, 8, "dragon_roar", "")
+
+	if got := resolveEffectPrompt(7, "sword_clash"); got != override {
+		t.Errorf("user 7 prompt = %q, want the override", got)
+	}
+	if got := resolveEffectPrompt(8, "sword_clash"); got != effectPrompts["sword_clash"] {
+		t.Errorf("user 8 prompt = %q, want the built-in default", got)
+	}
+	if got := resolveEffectPrompt(8, "dragon_roar"); got != "Sound effect for event: dragon_roar, about 2 seconds." {
+		t.Errorf("unknown event prompt = %q, want the generic prompt", got)
+	}
+	// Without a user there is nothing to look up
+	if got := resolveEffectPrompt(0, "thunder"); got != effectPrompts["thunder"] {
+		t.Errorf("prompt without a user = %q, want the built-in default", got)
+	}
+}
+
+func TestUserOverrideGetsItsOwnEffect(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XI_API_KEY", "xi-test")
+	fakeValidAudio(t)
+	freshEffectCache(t)
+	soundEffectsAPI(t, nil)
+	mock := mockDB(t)
+	const override = "Two heavy broadswords clashing in a stone hall."
+	expectEffectPrompt(mock, 7, "sword_clash", override)
+	expectEffectPrompt(mock, 8, "sword_clash", "")
+
+	custom, err := getOrGenerateEffect(7, "sword_clash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard, err := getOrGenerateEffect(8, "sword_clash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom == standard {
+		t.Fatalf("both users got %s; the override must not share the default clip", custom)
+	}
+	for path, want := range map[string]string{custom: override, standard: effectPrompts["sword_clash"]} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("%s = %q (err %v), want a clip generated from %q", path, got, err, want)
+		}
+	}
+}
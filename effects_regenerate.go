@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegenerateEffectsRequest is the optional body of POST
+// /user/books/:book_id/effects/regenerate. Settings that are set are saved on the book
+// before mixing; unique_music=true generates new background music instead of the
+// genre's shared clip. Pages defaults to every narrated page.
+type RegenerateEffectsRequest struct {
+	Pages                 []int    `json:"pages"`
+	EnableSoundEffects    *bool    `json:"enable_sound_effects"`
+	EnableBackgroundMusic *bool    `json:"enable_background_music"`
+	UniqueMusic           *bool    `json:"unique_music"`
+	MusicVolume           *float64 `json:"music_volume" binding:"omitempty,gte=0,lte=1"`
+	EffectsVolume         *float64 `json:"effects_volume" binding:"omitempty,gte=0,lte=1"`
+}
+
+// regenerateEffectsHandler rebuilds the music and effects mix of a book's pages from
+// their existing narration. The TTS audio is reused as is; only final_audio_path changes.
+func regenerateEffectsHandler(c *gin.Context) {
+	var req RegenerateEffectsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid effects request", err.Error())
+		return
+	}
+
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to modify this book", nil)
+		return
+	}
+	if book.Status == bookStatusProcessing || book.Status == bookStatusTTSCompleted {
+		respondError(c, http.StatusConflict, codeBookProcessing, "Book is processing; regenerate effects once it finishes", nil)
+		return
+	}
+
+	query := db.Select("id", "index", "audio_path", "final_audio_path").
+		Where("book_id = ? AND tts_status = ? AND audio_path <> ''", book.ID, "completed")
+	if len(req.Pages) > 0 {
+		query = query.Where("\"index\" IN ?", req.Pages)
+	}
+	var chunks []BookChunk
+	if err := query.Order("\"index\" ASC").Find(&chunks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load pages", err.Error())
+		return
+	}
+	narrated := map[int]bool{}
+	for _, ch := range chunks {
+		narrated[ch.Index] = true
+	}
+	var missing []int
+	for _, p := range req.Pages {
+		if !narrated[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Some pages have no narration to mix", gin.H{"pages": missing})
+		return
+	}
+	if len(chunks) == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book has no narrated pages", nil)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.EnableSoundEffects != nil {
+		updates["enable_sound_effects"] = *req.EnableSoundEffects
+	}
+	if req.EnableBackgroundMusic != nil {
+		updates["enable_background_music"] = *req.EnableBackgroundMusic
+	}
+	if req.UniqueMusic != nil {
+		updates["unique_music"] = *req.UniqueMusic
+	}
+	if req.MusicVolume != nil {
+		updates["music_volume"] = *req.MusicVolume
+	}
+	if req.EffectsVolume != nil {
+		updates["effects_volume"] = *req.EffectsVolume
+	}
+	if len(updates) > 0 {
+		if err := db.Model(&Book{}).Where("id = ?", book.ID).Updates(updates).Error; err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save effect settings", err.Error())
+			return
+		}
+	}
+
+	pages := make([]int, len(chunks))
+	oldFinals := map[int]string{}
+	for i, ch := range chunks {
+		pages[i] = ch.Index
+		if ch.FinalAudioPath != "" && ch.FinalAudioPath != ch.AudioPath {
+			oldFinals[ch.Index] = ch.FinalAudioPath
+		}
+	}
+	logWithRequestID(requestIDFromContext(c), "🎚️ Regenerating effects for %d pages of book %d", len(pages), book.ID)
+	go func() {
+		processSoundEffectsAndMerge(book, book.ContentHash, pages)
+		removeReplacedFinals(book.ID, oldFinals)
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Effects regeneration started",
+		"book_id": book.ID,
+		"pages":   pages,
+	})
+}
+
+// removeReplacedFinals deletes the previous final mixes of pages whose final_audio_path
+// has since moved to another file. A page whose mix failed keeps its old file.
+func removeReplacedFinals(bookID uint, oldFinals map[int]string) {
+	for index, old := range oldFinals {
+		var current string
+		if err := db.Model(&BookChunk{}).Select("final_audio_path").
+			Where("book_id = ? AND \"index\" = ?", bookID, index).Scan(&current).Error; err != nil || current == old {
+			continue
+		}
+		if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to remove replaced mix %s of book %d: %v", old, bookID, err)
+		}
+	}
+}
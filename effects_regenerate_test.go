@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRegenerateEffectsReusesNarration(t *testing.T) {
+	t.Setenv("LOUDNORM_ENABLED", "false")
+	dir := t.TempDir()
+	narration := filepath.Join(dir, "page_0.mp3")
+	oldMix := filepath.Join(dir, "page_0_final.mp3")
+	for _, f := range []string{narration, oldMix} {
+		if err := os.WriteFile(f, []byte("audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "content_hash"}).AddRow(3, 7, bookStatusCompleted, "abc"))
+	mock.ExpectQuery(`SELECT "id","index","audio_path","final_audio_path" FROM "book_chunks" WHERE book_id = \$1 AND tts_status = \$2 AND audio_path <> ''`).
+		WithArgs(uint(3), "completed").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "index", "audio_path", "final_audio_path"}).AddRow(10, 0, narration, oldMix))
+	expectWrite(mock, `UPDATE "books" SET "enable_background_music"=\$1,"enable_sound_effects"=\$2`).
+		WithArgs(false, false, sqlmock.AnyArg(), uint(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The remix runs in the background with music and effects now off
+	mock.ExpectQuery(`SELECT "id","user_id","enable_background_music","enable_sound_effects"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "enable_background_music", "enable_sound_effects"}).AddRow(3, 7, false, false))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "audio_path", "final_audio_path", "tts_status"}).AddRow(10, 3, 0, narration, oldMix, "completed"))
+	// Only the mix changes; the narration is used as is and nothing is sent to TTS
+	expectWrite(mock, `UPDATE "book_chunks" SET "final_audio_path"=\$1`).
+		WithArgs(narration, sqlmock.AnyArg(), uint(3), 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectInsert(mock, `INSERT INTO "audio_artifacts"`, 1).
+		WithArgs(uint(3), artifactPageFinal, 0, 0, narration, sqlmock.AnyArg())
+	mock.ExpectQuery(`SELECT "final_audio_path" FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"final_audio_path"}).AddRow(narration))
+
+	w := httptest.NewRecorder()
+	body := `{"enable_sound_effects": false, "enable_background_music": false}`
+	userRouter(7, http.MethodPost, "/user/books/:book_id/effects/regenerate", regenerateEffectsHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/effects/regenerate", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	waitForExpectations(t, mock)
+	if !fileExists(narration) {
+		t.Error("narration was removed")
+	}
+	// The replaced mix is removed right after the check that the page moved off it
+	deadline := time.Now().Add(2 * time.Second)
+	for fileExists(oldMix) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if fileExists(oldMix) {
+		t.Error("replaced mix still exists")
+	}
+}
+
+func TestRegenerateEffectsRefusedWhileProcessing(t *testing.T) {
+	for _, status := range []BookStatus{bookStatusProcessing, bookStatusTTSCompleted} {
+		mock := mockDB(t)
+		mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, status))
+
+		w := httptest.NewRecorder()
+		userRouter(7, http.MethodPost, "/user/books/:book_id/effects/regenerate", regenerateEffectsHandler).
+			ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/effects/regenerate", nil))
+		if w.Code != http.StatusConflict {
+			t.Errorf("%s book: status = %d, want 409: %s", status, w.Code, w.Body)
+		}
+	}
+}
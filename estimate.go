@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProcessingSample records how long narrating some text actually took; estimates are
+// fitted to the most recent samples.
+type ProcessingSample struct {
+	ID              uint `gorm:"primaryKey"`
+	BookID          uint `gorm:"index"`
+	Characters      int
+	Chunks          int
+	DurationSeconds float64
+	CreatedAt       time.Time `gorm:"index"`
+}
+
+// Fallback rates until enough samples exist, and how many recent samples the fit uses.
+const (
+	defaultSecondsPerChar  = 0.015
+	defaultSecondsPerChunk = 2.0
+	estimateSampleWindow   = 200
+)
+
+// recordProcessingSample stores an observed processing time. Failures only cost
+// estimate accuracy, so they are logged.
+func recordProcessingSample(bookID uint, text string, chunks int, elapsed time.Duration) {
+	sample := ProcessingSample{
+		BookID:          bookID,
+		Characters:      utf8.RuneCountInString(text),
+		Chunks:          chunks,
+		DurationSeconds: elapsed.Seconds(),
+	}
+	if sample.Characters == 0 {
+		return
+	}
+	if err := db.Create(&sample).Error; err != nil {
+		log.Printf("⚠️ Failed to record processing sample for book %d: %v", bookID, err)
+	}
+}
+
+// processingRates fits duration ≈ perChar·characters + perChunk·chunks to the recent
+// samples by least squares. When the fit is degenerate or negative it falls back to a
+// plain per-character rate, and to the defaults without samples.
+func processingRates() (perChar, perChunk float64, samples int) {
+	var rows []ProcessingSample
+	db.Order("created_at DESC").Limit(estimateSampleWindow).Find(&rows)
+	if len(rows) == 0 {
+		return defaultSecondsPerChar, defaultSecondsPerChunk, 0
+	}
+
+	var cc, ck, kk, dc, dk, d, c float64
+	for _, r := range rows {
+		chars, chunks := float64(r.Characters), float64(r.Chunks)
+		cc += chars * chars
+		ck += chars * chunks
+		kk += chunks * chunks
+		dc += r.DurationSeconds * chars
+		dk += r.DurationSeconds * chunks
+		d += r.DurationSeconds
+		c += chars
+	}
+	if det := cc*kk - ck*ck; math.Abs(det) > 1e-9 {
+		perChar = (dc*kk - dk*ck) / det
+		perChunk = (dk*cc - dc*ck) / det
+		if perChar > 0 && perChunk >= 0 {
+			return perChar, perChunk, len(rows)
+		}
+	}
+	return d / c, 0, len(rows)
+}
+
+// getBookEstimateHandler predicts how long narrating the book's unfinished pages will take.
+func getBookEstimateHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "status").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	contents, err := loadChunkTexts(db.Where("book_id = ? AND (tts_status IS NULL OR tts_status <> ?)", book.ID, "completed"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch pages", err.Error())
+		return
+	}
+	characters := 0
+	for _, content := range contents {
+		characters += utf8.RuneCountInString(content)
+	}
+
+	perChar, perChunk, samples := processingRates()
+	estimate := perChar*float64(characters) + perChunk*float64(len(contents))
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":                book.ID,
+		"status":                 book.Status,
+		"remaining_chunks":       len(contents),
+		"remaining_characters":   characters,
+		"estimated_seconds":      math.Round(estimate),
+		"seconds_per_character":  perChar,
+		"seconds_per_chunk":      perChunk,
+		"based_on_samples_count": samples,
+	})
+}
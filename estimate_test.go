@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectSamples expects processingRates to load the recent samples, given as
+// (characters, chunks, seconds) triples.
+func expectSamples(mock sqlmock.Sqlmock, samples ...[3]float64) {
+	rows := sqlmock.NewRows([]string{"id", "characters", "chunks", "duration_seconds"})
+	for i, s := range samples {
+		rows.AddRow(i+1, int(s[0]), int(s[1]), s[2])
+	}
+	mock.ExpectQuery(`SELECT \* FROM "processing_samples" ORDER BY created_at DESC LIMIT \$1`).
+		WithArgs(estimateSampleWindow).
+		WillReturnRows(rows)
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestProcessingRatesWithoutSamples(t *testing.T) {
+	mock := mockDB(t)
+	expectSamples(mock)
+
+	perChar, perChunk, n := processingRates()
+	if perChar != defaultSecondsPerChar || perChunk != defaultSecondsPerChunk || n != 0 {
+		t.Fatalf("rates = %v/char %v/chunk from %d samples, want the defaults", perChar, perChunk, n)
+	}
+}
+
+func TestProcessingRatesFitSamples(t *testing.T) {
+	mock := mockDB(t)
+	// Exactly 0.01s per character plus 3s per chunk
+	expectSamples(mock, [3]float64{1000, 1, 13}, [3]float64{2000, 1, 23}, [3]float64{1000, 2, 16})
+
+	perChar, perChunk, n := processingRates()
+	if !near(perChar, 0.01) || !near(perChunk, 3) || n != 3 {
+		t.Fatalf("rates = %v/char %v/chunk from %d samples, want 0.01/char 3/chunk from 3", perChar, perChunk, n)
+	}
+}
+
+func TestProcessingRatesFallBackToPerCharacter(t *testing.T) {
+	mock := mockDB(t)
+	// Every sample is one chunk of the same size, so the two rates can't be told apart
+	expectSamples(mock, [3]float64{500, 1, 9}, [3]float64{500, 1, 11})
+
+	perChar, perChunk, _ := processingRates()
+	if !near(perChar, 0.02) || perChunk != 0 {
+		t.Fatalf("rates = %v/char %v/chunk, want 0.02/char and nothing per chunk", perChar, perChunk)
+	}
+}
+
+// expectEstimatedBook expects getBookEstimateHandler to load book 3 and its unfinished pages.
+func expectEstimatedBook(mock sqlmock.Sqlmock, pages ...string) {
+	mock.ExpectQuery(`SELECT "id","user_id","status" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusPending))
+	rows := sqlmock.NewRows([]string{"id", "content", "content_key"})
+	for i, p := range pages {
+		rows.AddRow(i+1, p, "")
+	}
+	mock.ExpectQuery(`SELECT "id","content","content_key" FROM "book_chunks" WHERE book_id = \$1 AND \(tts_status IS NULL OR tts_status <> \$2\)`).
+		WithArgs(uint(3), "completed").
+		WillReturnRows(rows)
+}
+
+type estimateResponse struct {
+	RemainingChunks     int     `json:"remaining_chunks"`
+	RemainingCharacters int     `json:"remaining_characters"`
+	EstimatedSeconds    float64 `json:"estimated_seconds"`
+	Samples             int     `json:"based_on_samples_count"`
+}
+
+func getEstimate(t *testing.T) estimateResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/estimate", getBookEstimateHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/estimate", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body estimateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestBookEstimateFromObservedRates(t *testing.T) {
+	mock := mockDB(t)
+	expectEstimatedBook(mock, strings.Repeat("a", 1000), strings.Repeat("é", 500))
+	expectSamples(mock, [3]float64{1000, 1, 13}, [3]float64{2000, 1, 23}, [3]float64{1000, 2, 16})
+
+	got := getEstimate(t)
+	// Characters, not bytes: 1500 characters at 0.01s plus 2 pages at 3s
+	want := estimateResponse{RemainingChunks: 2, RemainingCharacters: 1500, EstimatedSeconds: 21, Samples: 3}
+	if got != want {
+		t.Fatalf("estimate = %+v, want %+v", got, want)
+	}
+}
+
+func TestBookEstimateWithoutSamples(t *testing.T) {
+	mock := mockDB(t)
+	expectEstimatedBook(mock, strings.Repeat("a", 1000))
+	expectSamples(mock)
+
+	got := getEstimate(t)
+	// The defaults: 1000 characters at 0.015s plus one page at 2s
+	want := estimateResponse{RemainingChunks: 1, RemainingCharacters: 1000, EstimatedSeconds: 17, Samples: 0}
+	if got != want {
+		t.Fatalf("estimate = %+v, want %+v", got, want)
+	}
+}
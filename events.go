@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Events delivered to clients.
+const (
+	eventCoverUploaded  = "cover_uploaded"
+	eventChunkCompleted = "chunk_completed"
+)
+
+// publishUserEvent delivers an event about one of a user's books. It is published on the
+// MQTT topic users/<id>/<event> and, when WEBHOOK_URL is set, POSTed there as a signed
+// webhook. "event" and "timestamp" are added to the payload.
+func publishUserEvent(userID uint, event string, payload map[string]interface{}) {
+	payload["event"] = event
+	payload["timestamp"] = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("⚠️ Failed to encode %s event: %v", event, err)
+		return
+	}
+	PublishEvent(fmt.Sprintf("users/%d/%s", userID, event), data)
+	deliverWebhook(event, data)
+}
+
+// webhookSignature is the hex HMAC-SHA256 of body under secret, sent as
+// X-Webhook-Signature: sha256=<hex> so receivers can verify the sender.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook POSTs an event to WEBHOOK_URL, signed with WEBHOOK_SECRET. Failures are
+// logged; delivery is best effort.
+func deliverWebhook(event string, body []byte) {
+	url := getEnv("WEBHOOK_URL", "")
+	if url == "" {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️ Failed to build %s webhook: %v", event, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	if secret := getEnv("WEBHOOK_SECRET", ""); secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+webhookSignature(secret, body))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("⚠️ %s webhook to %s failed: %v", event, url, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("⚠️ %s webhook to %s returned %d", event, url, resp.StatusCode)
+	}
+}
+
+// chunkAudioURL is the URL a page's audio is streamed from.
+func chunkAudioURL(bookID uint, index int) string {
+	return fmt.Sprintf("%s/user/books/%d/pages/%d/audio", streamHost(), bookID, index)
+}
+
+// publishChunkCompleted announces, in the background, that a page's final audio is ready
+// to stream from chunkAudioURL. Call it once final_audio_path is saved.
+func publishChunkCompleted(userID uint, chunk BookChunk) {
+	go publishUserEvent(userID, eventChunkCompleted, chunkCompletedPayload(chunk))
+}
+
+// chunkCompletedPayload is the chunk_completed event of a page.
+func chunkCompletedPayload(chunk BookChunk) map[string]interface{} {
+	return map[string]interface{}{
+		"book_id":     chunk.BookID,
+		"chunk_index": chunk.Index,
+		"audio_url":   chunkAudioURL(chunk.BookID, chunk.Index),
+		"status":      "completed",
+	}
+}
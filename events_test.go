@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChunkCompletedWebhookDelivery(t *testing.T) {
+	type delivery struct {
+		event, signature string
+		body             []byte
+	}
+	got := make(chan delivery, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- delivery{r.Header.Get("X-Webhook-Event"), r.Header.Get("X-Webhook-Signature"), body}
+	}))
+	defer srv.Close()
+	t.Setenv("WEBHOOK_URL", srv.URL)
+	t.Setenv("WEBHOOK_SECRET", "s3cret")
+	t.Setenv("STREAM_HOST", "")
+
+	body, err := json.Marshal(chunkCompletedPayload(BookChunk{BookID: 3, Index: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverWebhook(eventChunkCompleted, body)
+
+	d := <-got
+	if d.event != eventChunkCompleted {
+		t.Errorf("X-Webhook-Event = %q, want %q", d.event, eventChunkCompleted)
+	}
+	if want := "sha256=" + webhookSignature("s3cret", d.body); d.signature != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", d.signature, want)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(d.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	// Consumers get the same routable host as the book list, not a bind address
+	if want := defaultStreamHost + "/user/books/3/pages/4/audio"; payload["audio_url"] != want {
+		t.Errorf("audio_url = %v, want %s", payload["audio_url"], want)
+	}
+	if payload["book_id"] != 3.0 || payload["chunk_index"] != 4.0 || payload["status"] != "completed" {
+		t.Errorf("payload = %s", d.body)
+	}
+}
+
+func TestStreamHost(t *testing.T) {
+	t.Setenv("STREAM_HOST", "")
+	if got := streamHost(); got != defaultStreamHost {
+		t.Errorf("empty STREAM_HOST: streamHost() = %q, want %q", got, defaultStreamHost)
+	}
+	t.Setenv("STREAM_HOST", "https://audio.example.com")
+	if got := streamHost(); got != "https://audio.example.com" {
+		t.Errorf("streamHost() = %q, want the STREAM_HOST value", got)
+	}
+}
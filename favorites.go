@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Favorite marks a book as starred by a user.
+type Favorite struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"not null;uniqueIndex:idx_favorite_user_book"`
+	BookID    uint `gorm:"not null;uniqueIndex:idx_favorite_user_book;index"`
+	CreatedAt time.Time
+}
+
+// addFavoriteHandler stars one of the caller's books or a public book. Starring twice is
+// a no-op.
+func addFavoriteHandler(c *gin.Context) {
+	book, ok := playbackBook(c)
+	if !ok {
+		return
+	}
+	favorite := Favorite{UserID: getUserIDFromContext(c), BookID: book.ID}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&favorite).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to add favorite", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "favorite": true})
+}
+
+// removeFavoriteHandler unstars a book. Unstarring a book that isn't starred is a no-op.
+func removeFavoriteHandler(c *gin.Context) {
+	bookID, err := strconv.ParseUint(c.Param("book_id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid book ID", nil)
+		return
+	}
+	if err := db.Where("user_id = ? AND book_id = ?", getUserIDFromContext(c), bookID).Delete(&Favorite{}).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to remove favorite", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": bookID, "favorite": false})
+}
+
+// favoriteBookIDs returns the subquery of books the user has starred, for filtering
+// book listings in a single query.
+func favoriteBookIDs(userID uint) *gorm.DB {
+	return db.Model(&Favorite{}).Select("book_id").Where("user_id = ?", userID)
+}
+
+// favoriteSet returns which of the given books the user has starred, in one query.
+func favoriteSet(userID uint, bookIDs []uint) map[uint]bool {
+	set := map[uint]bool{}
+	if len(bookIDs) == 0 {
+		return set
+	}
+	var ids []uint
+	favoriteBookIDs(userID).Where("book_id IN ?", bookIDs).Pluck("book_id", &ids)
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
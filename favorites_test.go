@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectStar expects user 7's favorite of book 3 to be inserted, ignoring an existing one.
+func expectStar(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "favorites" \("user_id","book_id","created_at"\) .* ON CONFLICT DO NOTHING`).
+		WithArgs(uint(7), uint(3), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+}
+
+func starBook() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/favorite", addFavoriteHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/favorite", nil))
+	return w
+}
+
+func TestStarBookTwice(t *testing.T) {
+	mock := mockDB(t)
+	// Other users' public books can be starred too
+	expectPlaybackBook(mock, 8, true)
+	expectStar(mock)
+	expectPlaybackBook(mock, 8, true)
+	expectStar(mock)
+
+	for i := range 2 {
+		if w := starBook(); w.Code != http.StatusOK {
+			t.Fatalf("star %d: status = %d, want 200: %s", i+1, w.Code, w.Body)
+		}
+	}
+}
+
+func TestStarAnotherUsersPrivateBook(t *testing.T) {
+	mock := mockDB(t)
+	expectPlaybackBook(mock, 8, false)
+
+	if w := starBook(); w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+func TestUnstarBook(t *testing.T) {
+	mock := mockDB(t)
+	// Unstarring only ever touches the caller's own favorite
+	expectWrite(mock, `DELETE FROM "favorites" WHERE user_id = \$1 AND book_id = \$2`).
+		WithArgs(uint(7), uint64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodDelete, "/user/books/:book_id/favorite", removeFavoriteHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/user/books/3/favorite", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Favorite bool `json:"favorite"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Favorite {
+		t.Fatalf("body = %s, want favorite false", w.Body)
+	}
+}
+
+func TestListFavoriteBooks(t *testing.T) {
+	mock := mockDB(t)
+	// A starred book must be the caller's own or public: a favorite row left behind after
+	// another user made their book private must not expose it
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE \(id IN \(SELECT "book_id" FROM "favorites" WHERE user_id = \$1\) AND \(user_id = \$2 OR public = \$3\)\) AND "books"."deleted_at" IS NULL$`).
+		WithArgs(uint(7), uint(7), true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "public"}).
+			AddRow(3, 7, "Own", false).
+			AddRow(4, 8, "Shared", true))
+	mock.ExpectQuery(`SELECT "book_id","position_seconds" FROM "playback_positions" WHERE user_id = \$1 AND book_id IN \(\$2,\$3\)`).
+		WithArgs(uint(7), uint(3), uint(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "position_seconds"}))
+	mock.ExpectQuery(`SELECT "book_id" FROM "favorites" WHERE user_id = \$1 AND book_id IN \(\$2,\$3\)`).
+		WithArgs(uint(7), uint(3), uint(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id"}).AddRow(3).AddRow(4))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books", listBooksHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books?favorites=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Books []BookResponse `json:"books"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Books) != 2 {
+		t.Fatalf("%d books, want 2: %s", len(body.Books), w.Body)
+	}
+	for _, b := range body.Books {
+		if !b.Favorite {
+			t.Errorf("book %d listed as a favorite without favorite set", b.ID)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// backgroundCtx is the context for audio work that outlives the request that started
+// it (background merges, the TTS worker). gracefulShutdown cancels it, which kills any
+// ffmpeg process still running.
+var backgroundCtx, cancelBackgroundWork = context.WithCancel(context.Background())
+
+// ffmpegSlots caps how many ffmpeg and ffprobe processes run at once
+// (FFMPEG_CONCURRENCY, default the number of CPUs).
+var ffmpegSlots = make(chan struct{}, ffmpegConcurrency())
+
+func ffmpegConcurrency() int {
+	n, err := strconv.Atoi(getEnv("FFMPEG_CONCURRENCY", ""))
+	if err != nil || n < 1 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// acquireFFmpegSlot blocks until a process slot is free or ctx is done. On success the
+// returned func must be called to release the slot.
+func acquireFFmpegSlot(ctx context.Context) (func(), error) {
+	select {
+	case ffmpegSlots <- struct{}{}:
+		return func() { <-ffmpegSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runFFmpeg runs ffmpeg with args and returns its combined output. The process is
+// killed when ctx is cancelled, in which case the partial outFile is removed.
+func runFFmpeg(ctx context.Context, outFile string, args ...string) ([]byte, error) {
+	release, err := acquireFFmpegSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		if outFile != "" {
+			os.Remove(outFile)
+		}
+		return out, fmt.Errorf("ffmpeg cancelled: %w", ctx.Err())
+	}
+	return out, err
+}
+
+// runFFmpegWithProgress is runFFmpeg for long encodes: it streams ffmpeg's -progress
+// output and reports the percentage of totalSeconds written so far to onProgress.
+// It returns ffmpeg's stderr.
+func runFFmpegWithProgress(ctx context.Context, outFile string, totalSeconds float64, onProgress func(float64), args ...string) ([]byte, error) {
+	release, err := acquireFFmpegSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	parseFFmpegProgress(stdout, totalSeconds, onProgress)
+	err = cmd.Wait()
+	if err != nil && ctx.Err() != nil {
+		if outFile != "" {
+			os.Remove(outFile)
+		}
+		return stderr.Bytes(), fmt.Errorf("ffmpeg cancelled: %w", ctx.Err())
+	}
+	return stderr.Bytes(), err
+}
+
+// runFFprobe runs ffprobe with args and returns its stdout, sharing the ffmpeg slots.
+func runFFprobe(ctx context.Context, args ...string) ([]byte, error) {
+	release, err := acquireFFmpegSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return exec.CommandContext(ctx, "ffprobe", args...).Output()
+}
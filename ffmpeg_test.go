@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg puts an ffmpeg shell script with the given body first on PATH for the rest
+// of the test and returns its directory.
+func fakeFFmpeg(t *testing.T, body string) string {
+	t.Helper()
+	return fakeCommand(t, "ffmpeg", body)
+}
+
+// fakeCommand puts a shell script named name with the given body first on PATH for the
+// rest of the test and returns its directory.
+func fakeCommand(t *testing.T, name, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake " + name + " is a shell script")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestRunFFmpegKilledOnCancel(t *testing.T) {
+	fakeFFmpeg(t, "exec sleep 30")
+	outFile := filepath.Join(t.TempDir(), "partial.mp3")
+	if err := os.WriteFile(outFile, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := runFFmpeg(ctx, outFile, "-i", "in.mp3", outFile)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("runFFmpeg returned after %v; the process was not killed", elapsed)
+	}
+	if _, err := os.Stat(outFile); !os.IsNotExist(err) {
+		t.Errorf("partial output still exists (stat err = %v)", err)
+	}
+}
+
+func TestRunFFmpegConcurrencyLimit(t *testing.T) {
+	// Each fake run marks itself running, logs how many runs it sees and unmarks itself
+	dir := fakeFFmpeg(t, `d="$(dirname "$0")"
+touch "$d/run.$$"
+sleep 0.2
+ls "$d" | grep -c '^run\.' >> "$d/seen"
+rm "$d/run.$$"`)
+	saved := ffmpegSlots
+	ffmpegSlots = make(chan struct{}, 2)
+	t.Cleanup(func() { ffmpegSlots = saved })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := runFFmpeg(context.Background(), ""); err != nil {
+				t.Errorf("runFFmpeg: %v: %s", err, out)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen, err := os.ReadFile(filepath.Join(dir, "seen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := strings.Fields(string(seen))
+	if len(counts) != 6 {
+		t.Fatalf("%d runs logged, want 6", len(counts))
+	}
+	for _, c := range counts {
+		if n, _ := strconv.Atoi(c); n < 1 || n > 2 {
+			t.Fatalf("a run saw %s ffmpeg processes at once, want at most 2", c)
+		}
+	}
+}
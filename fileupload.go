@@ -4,40 +4,57 @@ package main
 // It expects form-data with keys "book_id" and "file".
 // It saves the file to a specified directory and updates the book record in the database.
 // It also processes the uploaded file by chunking it into smaller parts for further processing.
+// Narration is not started: the book and its pages are left "pending" until processBookHandler.
+// A re-upload replaces the book's pages and the audio made from them; books being narrated
+// are refused with 409.
 
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"io"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
-	"errors"
-	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-
 func uploadBookFileHandler(c *gin.Context) {
 	bookID := c.PostForm("book_id")
 	if bookID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "book_id is required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "book_id is required", nil)
+		return
+	}
+
+	if !enforceUserQuota(c, getUserIDFromContext(c), 0) {
 		return
 	}
 
 	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File upload error", "details": err.Error()})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "File upload error", err.Error())
 		return
 	}
 
 	// Validate file type
 	if !strings.HasSuffix(strings.ToLower(file.Filename), ".pdf") &&
 		!strings.HasSuffix(strings.ToLower(file.Filename), ".txt") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only PDF and TXT files are allowed."})
+		respondError(c, http.StatusBadRequest, codeInvalidFileType, "Invalid file type. Only PDF and TXT files are allowed.", nil)
+		return
+	}
+
+	// Look up the book
+	var book Book
+	if err := db.First(&book, bookID).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", err.Error())
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to modify this book", nil)
 		return
 	}
 
@@ -45,89 +62,154 @@ func uploadBookFileHandler(c *gin.Context) {
 	uploadDir := "./uploads"
 	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory", "details": err.Error()})
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to create upload directory", err.Error())
 			return
 		}
 	}
 
-	// Save uploaded file
-	dest := filepath.Join(uploadDir, file.Filename)
+	// Save uploaded file under a name of its own, so books uploading the same filename
+	// never share (or delete) each other's source file
+	dest := filepath.Join(uploadDir, fmt.Sprintf("book_%d_%d_%s", book.ID, time.Now().UnixNano(), filepath.Base(file.Filename)))
 	if err := c.SaveUploadedFile(file, dest); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file", "details": err.Error()})
-		return
-	}
-
-	// Look up the book
-	var book Book
-	if err := db.First(&book, bookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save file", err.Error())
 		return
 	}
 
 	// Compute file hash
 	hash, err := computeFileHash(dest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute file hash", "details": err.Error()})
+		os.Remove(dest)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to compute file hash", err.Error())
 		return
 	}
 
-	// Update book record
-	book.FilePath = dest
-	book.Status = "processing"
-	book.ContentHash = hash
-	if err := db.Save(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book record", "details": err.Error()})
+	// Encrypt the upload at rest before paginating; the chunker decrypts it as it reads
+	if err := encryptFileAtRest(dest); err != nil {
+		os.Remove(dest)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to encrypt uploaded file", err.Error())
 		return
 	}
 
-	// Chunk (paginate) the document
-	numPages, err := ChunkDocument(book.ID, dest)
+	// A re-upload replaces the book's pages and everything produced from them. Their
+	// audio and stored text are removed only once the new pages have committed.
+	stale := staleBookAudioFiles(book)
+	oldKeys := bookContentKeys(book.ID)
+
+	book.FilePath = dest
+	book.OriginalFilename = file.Filename
+	book.FileSizeBytes = file.Size
+	book.ContentHash = hash
+
+	// Chunk (paginate) the document; text over MAX_CONTENT_CHARS is rejected before any page is saved
+	var pages documentPages
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := claimReorderableBook(tx, book.ID); err != nil {
+			return err
+		}
+		if err := clearBookPages(tx, book.ID); err != nil {
+			return err
+		}
+		// The new text is a new narration, counted once its pages are done
+		if err := resetBookUsage(tx, book.ID); err != nil {
+			return err
+		}
+		var err error
+		if pages, err = chunkDocumentFrom(tx, book.ID, dest, 0, 0); err != nil {
+			return err
+		}
+		book.ContentTruncated = pages.Truncated
+		// Files appended to the book before went with their pages
+		if err := recordFirstBookFile(tx, book, pages); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"file_path":           dest,
+			"original_filename":   file.Filename,
+			"file_size_bytes":     file.Size,
+			"content_truncated":   pages.Truncated,
+			"content_hash":        hash,
+			"status":              bookStatusPending,
+			"reused_from_book_id": nil,
+			"summary":             "",
+		}
+		resetBookAudioColumns(updates)
+		return tx.Model(&Book{}).Where("id = ?", book.ID).Updates(updates).Error
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to paginate document", "details": err.Error()})
+		os.Remove(dest)
+		var tooLong *contentTooLongError
+		if errors.As(err, &tooLong) {
+			respondContentTooLong(c, tooLong)
+			return
+		}
+		respondReorderError(c, "Failed to paginate document", err)
 		return
 	}
+	removeStaleFiles(book.ID, stale)
+	dropUnusedContent(oldKeys...)
+
+	numPages := pages.Pages
+	if pages.Truncated {
+		logWithRequestID(requestIDFromContext(c), "✂️ Book %d truncated to MAX_CONTENT_CHARS=%d", book.ID, maxContentChars())
+	}
+	book.Status = bookStatusPending
+
+	// Infer a missing genre and language in the background; uploads don't wait on GPT
+	if book.Genre == "" && autoGenreEnabled() {
+		go autoClassifyGenre(book.ID)
+	}
+	if book.Language == "" && autoLanguageEnabled() {
+		go autoDetectLanguage(book.ID)
+	}
 
 	// Query the chunk table to confirm all pages saved
 	var actualChunks []BookChunk
 	if err := db.Where("book_id = ?", book.ID).Find(&actualChunks).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify saved pages"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to verify saved pages", nil)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":      "File uploaded and split into pages successfully",
-		"book_id":      book.ID,
-		"total_pages":  numPages,
-		"file_path":    dest,
-		"content_hash": hash,
-		"page_indices": len(actualChunks),
+		"message":           "File uploaded and split into pages; start narration with POST /user/books/:book_id/process",
+		"book_id":           book.ID,
+		"status":            book.Status,
+		"total_pages":       numPages,
+		"file_path":         dest,
+		"content_hash":      hash,
+		"page_indices":      len(actualChunks),
+		"content_truncated": pages.Truncated,
 	})
-
-	// 🔍 Debugging: Check if page 11 (index 10) exists
-	var missingChunk BookChunk
-	err = db.Where("book_id = ? AND index = ?", book.ID, 10).First(&missingChunk).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		fmt.Println("⚠️ Page 11 (index 10) is missing for book", book.ID)
-	} else if err != nil {
-		fmt.Println("❌ Error querying page 11:", err)
-	} else {
-		fmt.Println("✅ Page 11 exists:", missingChunk.AudioPath)
-	}
 }
 
 // computeFileHash computes the SHA256 hash of the file at the given path and returns it as a hex string.
+// Encrypted files are hashed by their plaintext so the hash survives re-encryption.
 func computeFileHash(path string) (string, error) {
-	f, err := os.Open(path)
+	data, err := readContentFile(path)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
 
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, f); err != nil {
-		return "", err
+// clearBookPages deletes a book's pages along with the merged groups and audio
+// artifacts made from them, through tx.
+func clearBookPages(tx *gorm.DB, bookID uint) error {
+	if err := tx.Where("book_id = ?", bookID).Delete(&ProcessedChunkGroup{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("book_id = ?", bookID).Delete(&AudioArtifact{}).Error; err != nil {
+		return err
 	}
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+	return tx.Where("book_id = ?", bookID).Delete(&BookChunk{}).Error
 }
 
-
+// bookContentKeys lists the content store keys of a book's pages.
+func bookContentKeys(bookID uint) []string {
+	if contentStore == nil {
+		return nil
+	}
+	var keys []string
+	db.Model(&BookChunk{}).Where("book_id = ? AND content_key <> ?", bookID, "").Pluck("content_key", &keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// userRouter serves handler at method and path to a caller authenticated as userID.
+func userRouter(userID uint, method, path string, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, path, func(c *gin.Context) {
+		c.Set("claims", jwt.MapClaims{"user_id": float64(userID)})
+	}, handler)
+	return r
+}
+
+// uploadRequest builds a multipart upload of a text file to path with the given form fields.
+func uploadRequest(t *testing.T, path, filename, text string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(text))
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+// anyArgs matches n statement arguments of any value.
+func anyArgs(n int) []driver.Value {
+	args := make([]driver.Value, n)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	return args
+}
+
+// expectUpload expects an upload of a one-page file to book 3 of user 7 whose previous
+// pages are oldPages: the old pages, groups, artifacts and source files are deleted in
+// the same transaction, before the new page 0 is inserted. The book and its page are
+// left pending. The returned uploadRecord receives the file name and size the source
+// file row and the book were saved with.
+func expectUpload(mock sqlmock.Sqlmock, oldPages int) *uploadRecord {
+	rec := &uploadRecord{}
+	expectWithinQuota(mock, 7, 0)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "genre", "language"}).
+			AddRow(3, 7, bookStatusCompleted, "Fantasy", "en"))
+	chunks := sqlmock.NewRows([]string{"audio_path", "final_audio_path"})
+	for i := 0; i < oldPages; i++ {
+		chunks.AddRow("", "")
+	}
+	mock.ExpectQuery(`SELECT "audio_path","final_audio_path" FROM "book_chunks" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnRows(chunks)
+	mock.ExpectQuery(`SELECT "audio_path" FROM "processed_chunk_groups" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "path" FROM "audio_artifacts" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnRows(sqlmock.NewRows([]string{"path"}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "books" SET "updated_at"=\$1 WHERE \(id = \$2 AND status NOT IN \(\$3,\$4\)\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "book_chunks" WHERE book_id = \$1 AND tts_status = \$2`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE "processed_chunk_groups" SET "deleted_at"=\$1 WHERE book_id = \$2`).WithArgs(sqlmock.AnyArg(), uint(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "audio_artifacts" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "book_chunks" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnResult(sqlmock.NewResult(0, int64(oldPages)))
+	mock.ExpectExec(`DELETE FROM "book_usages" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "book_chunks" .*VALUES \(\$1,\$2,`).
+		WithArgs(append(append(append([]driver.Value{uint(3), 0}, anyArgs(5)...), "pending"), anyArgs(7)...)...).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10 + oldPages))
+	mock.ExpectExec(`DELETE FROM "book_files" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "book_files" \("book_id","position","file_path","original_filename","file_size_bytes",`).
+		WithArgs(uint(3), 0, sqlmock.AnyArg(), recordArg{&rec.fileName}, recordArg{&rec.fileSize}, sqlmock.AnyArg(), 0, 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	// Columns are sent in name order: file_size_bytes is the 7th of 14, original_filename
+	// the 10th and status the 12th, before the book ID
+	args := anyArgs(15)
+	args[6], args[9], args[11] = recordArg{&rec.bookSize}, recordArg{&rec.bookName}, bookStatusPending
+	mock.ExpectExec(`UPDATE "books" SET .*"file_size_bytes"=\$7,.*"original_filename"=\$10,.*"status"=\$12,`).
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1`).WithArgs(uint(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index"}).AddRow(10+oldPages, 3, 0))
+	return rec
+}
+
+// uploadRecord holds the file name and size an upload stored on the source file row
+// and on the book.
+type uploadRecord struct {
+	fileName, fileSize, bookName, bookSize driver.Value
+}
+
+func TestUploadTwiceReplacesPages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	mock := mockDB(t)
+	expectUpload(mock, 0)
+	expectUpload(mock, 1)
+
+	r := userRouter(7, http.MethodPost, "/user/books/upload", uploadBookFileHandler)
+	for i, text := range []string{"First draft.", "Second draft."} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, uploadRequest(t, "/user/books/upload", "book.txt", text, map[string]string{"book_id": "3"}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("upload %d: status = %d, want 200: %s", i+1, w.Code, w.Body)
+		}
+	}
+}
+
+func TestUploadLeavesBookPending(t *testing.T) {
+	t.Chdir(t.TempDir())
+	mock := mockDB(t)
+	// The book was narrated before; a new upload does not start narrating it again
+	expectUpload(mock, 0)
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/upload", uploadBookFileHandler).
+		ServeHTTP(w, uploadRequest(t, "/user/books/upload", "book.txt", "Chapter one.", map[string]string{"book_id": "3"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Status BookStatus `json:"status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != bookStatusPending {
+		t.Fatalf("status = %q, want %q", body.Status, bookStatusPending)
+	}
+}
+
+func TestUploadRecordsFilenameAndSize(t *testing.T) {
+	t.Chdir(t.TempDir())
+	mock := mockDB(t)
+	const name, text = "Tales of Old.txt", "Chapter one."
+	rec := expectUpload(mock, 0)
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/upload", uploadBookFileHandler).
+		ServeHTTP(w, uploadRequest(t, "/user/books/upload", name, text, map[string]string{"book_id": "3"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	// The source file row and the book both keep the uploaded name and size
+	want := uploadRecord{name, int64(len(text)), name, int64(len(text))}
+	if *rec != want {
+		t.Errorf("saved %+v, want %+v", *rec, want)
+	}
+}
+
+func TestUploadRefusedWhileProcessing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	mock := mockDB(t)
+	expectWithinQuota(mock, 7, 0)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusProcessing))
+	mock.ExpectQuery(`SELECT "audio_path","final_audio_path" FROM "book_chunks"`).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "audio_path" FROM "processed_chunk_groups"`).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "path" FROM "audio_artifacts"`).WillReturnRows(sqlmock.NewRows([]string{"path"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "books" SET "updated_at"=\$1 WHERE \(id = \$2 AND status NOT IN \(\$3,\$4\)\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/upload", uploadBookFileHandler).
+		ServeHTTP(w, uploadRequest(t, "/user/books/upload", "book.txt", "New text.", map[string]string{"book_id": "3"}))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+	if left, _ := filepath.Glob("uploads/*"); len(left) != 0 {
+		t.Fatalf("refused upload left %v behind", left)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// defaultGenres is the list genre classification chooses from unless GENRE_LIST overrides it.
+const defaultGenres = "Fantasy,Science Fiction,Mystery,Thriller,Romance,Horror,Historical Fiction,Literary Fiction,Biography,Self-Help,Business,History,Science,Children,Young Adult,Poetry,Religion,Other"
+
+// autoGenreEnabled reports whether blank genres are inferred with GPT on upload
+// (AUTO_GENRE_ENABLED, default false because every classification is a paid call).
+func autoGenreEnabled() bool {
+	return getEnv("AUTO_GENRE_ENABLED", "false") == "true"
+}
+
+// knownGenres returns the genres classification may answer with (GENRE_LIST, comma-separated).
+func knownGenres() []string {
+	var genres []string
+	for _, g := range strings.Split(getEnv("GENRE_LIST", defaultGenres), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
+
+// matchGenre maps a model answer onto one of genres, ignoring case and surrounding
+// punctuation. It returns "" when the answer is not in the list.
+func matchGenre(answer string, genres []string) string {
+	answer = strings.Trim(strings.TrimSpace(answer), ".\"'`")
+	for _, g := range genres {
+		if strings.EqualFold(answer, g) {
+			return g
+		}
+	}
+	return ""
+}
+
+// classifyGenre asks GPT for the genre of excerpt, constrained to knownGenres.
+func classifyGenre(excerpt string, bookID uint) (string, error) {
+	genres := knownGenres()
+	answer, err := chatCompletion(ChatRequest{
+		Model: openAIModels.Light,
+		Messages: []ChatMessage{
+			{Role: "system", Content: "You classify books by genre. Answer with exactly one genre from this list and nothing else: " + strings.Join(genres, ", ")},
+			{Role: "user", Content: excerpt},
+		},
+		MaxTokens:   10,
+		Temperature: 0,
+	}, bookID, "genre")
+	if err != nil {
+		return "", err
+	}
+	genre := matchGenre(answer, genres)
+	if genre == "" {
+		return "", fmt.Errorf("genre %q is not in the allowed list", answer)
+	}
+	return genre, nil
+}
+
+// autoClassifyGenre fills in a blank genre from the book's first pages. Failures leave
+// the genre empty.
+func autoClassifyGenre(bookID uint) {
+	contents, err := loadChunkTexts(db.Where("book_id = ?", bookID).Order("\"index\" ASC").Limit(3))
+	if err != nil {
+		log.Printf("⚠️ Could not read pages of book %d for genre classification: %v", bookID, err)
+		return
+	}
+	excerpt := strings.TrimSpace(strings.Join(contents, "\n"))
+	if excerpt == "" {
+		return
+	}
+	excerpt = truncateRunes(excerpt, 3000)
+
+	genre, err := classifyGenre(excerpt, bookID)
+	if err != nil {
+		log.Printf("⚠️ Genre classification failed for book %d: %v", bookID, err)
+		return
+	}
+	// Only fill the genre if the user has not set one in the meantime
+	if err := db.Model(&Book{}).Where("id = ? AND (genre IS NULL OR genre = '')", bookID).Update("genre", genre).Error; err != nil {
+		log.Printf("⚠️ Failed to save genre for book %d: %v", bookID, err)
+		return
+	}
+	log.Printf("🏷️ Book %d classified as %s", bookID, genre)
+}
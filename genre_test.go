@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestMatchGenre(t *testing.T) {
+	genres := []string{"Mystery", "Science Fiction", "Other"}
+	tests := []struct {
+		answer, want string
+	}{
+		{"Mystery", "Mystery"},
+		{"  mystery. ", "Mystery"},
+		{`"Science Fiction"`, "Science Fiction"},
+		{"`other`", "Other"},
+		{"Cooking", ""},
+		{"Science", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := matchGenre(tt.answer, genres); got != tt.want {
+			t.Errorf("matchGenre(%q) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
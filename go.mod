@@ -3,6 +3,7 @@ module github.com/parlo12/content-service.git
 go 1.24.2
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/gin-gonic/gin v1.10.0
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	gorm.io/driver/postgres v1.5.11
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hlsSegmentPattern matches the segment names written by generateBookHLS, which are
+// the only files served next to the playlist.
+var hlsSegmentPattern = regexp.MustCompile(`^seg_\d{5}\.ts$`)
+
+// hlsMinDuration returns the audio length from which books get an HLS playlist
+// (HLS_MIN_DURATION_SECONDS, default 1800), or 0 when HLS_ENABLED isn't "true".
+func hlsMinDuration() float64 {
+	if getEnv("HLS_ENABLED", "false") != "true" {
+		return 0
+	}
+	secs, err := strconv.ParseFloat(getEnv("HLS_MIN_DURATION_SECONDS", "1800"), 64)
+	if err != nil || secs < 0 {
+		return 1800
+	}
+	return secs
+}
+
+// hlsDir is where a book's playlist and segments live.
+func hlsDir(bookID uint) string {
+	return fmt.Sprintf("./audio/hls/book_%d", bookID)
+}
+
+// generateBookHLS segments a long book's audio into 10-second AAC transport-stream
+// segments with a VOD playlist and records the playlist path. Short books and
+// deployments without HLS_ENABLED are skipped.
+func generateBookHLS(ctx context.Context, bookID uint, source string) {
+	min := hlsMinDuration()
+	if min == 0 {
+		return
+	}
+	if dur, err := getTTSDuration(source); err != nil || dur < min {
+		return
+	}
+
+	dir := hlsDir(bookID)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("⚠️ Failed to create HLS directory for book %d: %v", bookID, err)
+		return
+	}
+	playlist := filepath.Join(dir, "index.m3u8")
+	if o, err := runFFmpeg(ctx, playlist, "-y", "-i", source, "-vn",
+		"-c:a", "aac", "-b:a", "128k",
+		"-f", "hls", "-hls_time", "10", "-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%05d.ts"),
+		playlist,
+	); err != nil {
+		log.Printf("⚠️ HLS segmenting failed for book %d: %v\n%s", bookID, err, o)
+		os.RemoveAll(dir)
+		return
+	}
+	if err := db.Model(&Book{}).Where("id = ?", bookID).Update("hls_playlist_path", playlist).Error; err != nil {
+		log.Printf("⚠️ Failed to save HLS playlist for book %d: %v", bookID, err)
+		return
+	}
+	log.Printf("📼 HLS playlist ready for book %d: %s", bookID, playlist)
+}
+
+// streamBookHLSHandler serves a book's HLS playlist (index.m3u8) and its segments to the
+// owner. Players request segments without the Authorization header, so when the
+// playlist was fetched with ?token= the token is appended to every segment URI.
+func streamBookHLSHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "hls_playlist_path").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+	if book.HLSPlaylistPath == "" || !fileExists(book.HLSPlaylistPath) {
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "No HLS playlist for this book", nil)
+		return
+	}
+
+	file := c.Param("file")
+	if file != "index.m3u8" {
+		if !hlsSegmentPattern.MatchString(file) {
+			respondError(c, http.StatusNotFound, codeAudioNotFound, "Segment not found", nil)
+			return
+		}
+		segment := filepath.Join(filepath.Dir(book.HLSPlaylistPath), file)
+		if !fileExists(segment) {
+			respondError(c, http.StatusNotFound, codeAudioNotFound, "Segment not found", nil)
+			return
+		}
+		c.Header("Content-Type", "video/mp2t")
+		serveAudioFile(c, segment)
+		return
+	}
+
+	playlist, err := os.ReadFile(book.HLSPlaylistPath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to read playlist", err.Error())
+		return
+	}
+	if token := c.Query("token"); token != "" {
+		var out bytes.Buffer
+		scanner := bufio.NewScanner(bytes.NewReader(playlist))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line != "" && !strings.HasPrefix(line, "#") {
+				line += "?token=" + url.QueryEscape(token)
+			}
+			out.WriteString(line + "\n")
+		}
+		playlist = out.Bytes()
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", playlist)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// hlsEnv runs the test in a scratch directory with HLS on and ffprobe reporting seconds
+// of audio. The fake ffmpeg records its arguments in ffmpeg.args and writes a
+// one-segment playlist to its last argument.
+func hlsEnv(t *testing.T, seconds string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("HLS_ENABLED", "true")
+	t.Setenv("HLS_MIN_DURATION_SECONDS", "1800")
+	fakeCommand(t, "ffprobe", "echo "+seconds)
+	fakeFFmpeg(t, `printf '%s\n' "$@" > ffmpeg.args
+for last; do :; done
+printf '#EXTM3U\n#EXTINF:10.0,\nseg_00000.ts\n#EXT-X-ENDLIST\n' > "$last"`)
+}
+
+func TestGenerateBookHLS(t *testing.T) {
+	hlsEnv(t, "3600.0")
+	mock := mockDB(t)
+	playlist := filepath.Join(hlsDir(3), "index.m3u8")
+	expectWrite(mock, `UPDATE "books" SET "hls_playlist_path"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+		WithArgs(playlist, sqlmock.AnyArg(), uint(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	generateBookHLS(context.Background(), 3, "audio/book_3.mp3")
+
+	raw, err := os.ReadFile("ffmpeg.args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	for _, want := range [][]string{
+		{"-i", "audio/book_3.mp3"},
+		{"-c:a", "aac"},
+		{"-f", "hls"},
+		{"-hls_time", "10"},
+		{"-hls_playlist_type", "vod"},
+		{"-hls_segment_filename", filepath.Join(hlsDir(3), "seg_%05d.ts")},
+	} {
+		i := slices.Index(args, want[0])
+		if i < 0 || i+1 >= len(args) || args[i+1] != want[1] {
+			t.Errorf("ffmpeg args %q lack %s %s", args, want[0], want[1])
+		}
+	}
+	if args[len(args)-1] != playlist {
+		t.Errorf("ffmpeg writes %s, want the playlist %s", args[len(args)-1], playlist)
+	}
+	if !fileExists(playlist) {
+		t.Fatal("playlist not written")
+	}
+}
+
+func TestGenerateBookHLSSkipsShortAudio(t *testing.T) {
+	hlsEnv(t, "1799.0")
+	mockDB(t)
+
+	generateBookHLS(context.Background(), 3, "audio/book_3.mp3")
+	if fileExists("ffmpeg.args") || fileExists(hlsDir(3)) {
+		t.Fatal("book under HLS_MIN_DURATION_SECONDS was segmented")
+	}
+}
+
+func TestGenerateBookHLSDisabled(t *testing.T) {
+	hlsEnv(t, "3600.0")
+	t.Setenv("HLS_ENABLED", "false")
+	mockDB(t)
+
+	generateBookHLS(context.Background(), 3, "audio/book_3.mp3")
+	if fileExists("ffmpeg.args") {
+		t.Fatal("book segmented with HLS_ENABLED=false")
+	}
+}
+
+// hlsRequest fetches target from book 3's HLS stream as user 7; the book points at the
+// playlist written by writeHLSPlaylist.
+func hlsRequest(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id","hls_playlist_path" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "hls_playlist_path"}).
+			AddRow(3, 7, filepath.Join(hlsDir(3), "index.m3u8")))
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/hls/:file", streamBookHLSHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+// writeHLSPlaylist writes a two-segment playlist for book 3 under the working directory.
+func writeHLSPlaylist(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	dir := hlsDir(3)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\nseg_00000.ts\n#EXTINF:4.5,\nseg_00001.ts\n#EXT-X-ENDLIST\n"
+	files := map[string]string{"index.m3u8": playlist, "seg_00000.ts": "segment 0", "seg_00001.ts": "segment 1"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamBookHLSPlaylistCarriesToken(t *testing.T) {
+	writeHLSPlaylist(t)
+
+	w := hlsRequest(t, "/user/books/3/hls/index.m3u8?token=a%2Bb.c")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+		t.Errorf("Content-Type = %q, want application/vnd.apple.mpegurl", ct)
+	}
+	want := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\nseg_00000.ts?token=a%2Bb.c\n#EXTINF:4.5,\nseg_00001.ts?token=a%2Bb.c\n#EXT-X-ENDLIST\n"
+	if w.Body.String() != want {
+		t.Fatalf("playlist =\n%s\nwant\n%s", w.Body, want)
+	}
+}
+
+func TestStreamBookHLSPlaylistWithoutToken(t *testing.T) {
+	writeHLSPlaylist(t)
+
+	w := hlsRequest(t, "/user/books/3/hls/index.m3u8")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "token") {
+		t.Fatalf("status = %d, body =\n%s\nwant the playlist unchanged", w.Code, w.Body)
+	}
+}
+
+func TestStreamBookHLSSegment(t *testing.T) {
+	writeHLSPlaylist(t)
+
+	w := hlsRequest(t, "/user/books/3/hls/seg_00001.ts")
+	if w.Code != http.StatusOK || w.Body.String() != "segment 1" {
+		t.Fatalf("status = %d, body = %q, want segment 1", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "video/mp2t" {
+		t.Errorf("Content-Type = %q, want video/mp2t", ct)
+	}
+}
+
+func TestStreamBookHLSOnlyServesSegments(t *testing.T) {
+	writeHLSPlaylist(t)
+	if err := os.WriteFile(filepath.Join(hlsDir(3), "notes.txt"), []byte("private"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"notes.txt", "seg_1.ts", "seg_00009.ts"} {
+		if w := hlsRequest(t, "/user/books/3/hls/"+file); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", file, w.Code)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// jwtAllowedAlgs returns the signing algorithms accepted in token headers, from the
+// comma-separated JWT_ALG (default: the HMAC variants). Tokens signed with anything else
+// are rejected, so a public RSA key can never be replayed as an HMAC secret.
+func jwtAllowedAlgs() map[string]bool {
+	allowed := map[string]bool{}
+	for _, alg := range strings.Split(getEnv("JWT_ALG", "HS256,HS384,HS512"), ",") {
+		if alg = strings.ToUpper(strings.TrimSpace(alg)); alg != "" {
+			allowed[alg] = true
+		}
+	}
+	return allowed
+}
+
+// jwtKeyFunc picks the verification key for a token from its header alg: the shared
+// JWT_SECRET for HMAC, or an RSA public key from JWT_PUBLIC_KEY / JWT_PUBLIC_KEY_FILE
+// or, when JWKS_URL is set, the JWKS entry matching the token's kid.
+func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if !jwtAllowedAlgs()[alg] {
+		return nil, fmt.Errorf("unexpected signing algorithm %q", alg)
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return jwtSecretKey, nil
+	case *jwt.SigningMethodRSA:
+		if getEnv("JWKS_URL", "") != "" {
+			kid, _ := token.Header["kid"].(string)
+			return jwks.key(kid)
+		}
+		return staticRSAPublicKey()
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+// checkIssuerAudience verifies the iss and aud claims against JWT_ISSUER and
+// JWT_AUDIENCE when those are set, returning the message for the 401.
+func checkIssuerAudience(claims jwt.MapClaims) string {
+	if issuer := getEnv("JWT_ISSUER", ""); issuer != "" && !claims.VerifyIssuer(issuer, true) {
+		return "Invalid token issuer"
+	}
+	if audience := getEnv("JWT_AUDIENCE", ""); audience != "" && !claims.VerifyAudience(audience, true) {
+		return "Invalid token audience"
+	}
+	return ""
+}
+
+var (
+	rsaKeyOnce sync.Once
+	rsaKey     *rsa.PublicKey
+	rsaKeyErr  error
+)
+
+// staticRSAPublicKey parses the PEM public key from JWT_PUBLIC_KEY or the file named by
+// JWT_PUBLIC_KEY_FILE, once.
+func staticRSAPublicKey() (*rsa.PublicKey, error) {
+	rsaKeyOnce.Do(func() {
+		pem := []byte(getEnv("JWT_PUBLIC_KEY", ""))
+		if path := getEnv("JWT_PUBLIC_KEY_FILE", ""); len(pem) == 0 && path != "" {
+			pem, rsaKeyErr = os.ReadFile(path)
+			if rsaKeyErr != nil {
+				return
+			}
+		}
+		if len(pem) == 0 {
+			rsaKeyErr = fmt.Errorf("RS256 tokens need JWT_PUBLIC_KEY, JWT_PUBLIC_KEY_FILE or JWKS_URL")
+			return
+		}
+		rsaKey, rsaKeyErr = jwt.ParseRSAPublicKeyFromPEM(pem)
+	})
+	return rsaKey, rsaKeyErr
+}
+
+// jwksCache holds the RSA keys published at JWKS_URL. Keys are refetched after
+// JWKS_CACHE_TTL (default 1h), or sooner when a token names an unknown kid, but never
+// more than once a minute so bogus kids can't hammer the identity provider.
+type jwksCache struct {
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+var jwks = &jwksCache{}
+
+func (j *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ttl, err := time.ParseDuration(getEnv("JWKS_CACHE_TTL", "1h"))
+	if err != nil || ttl < time.Minute {
+		ttl = time.Hour
+	}
+	_, known := j.keys[kid]
+	age := time.Since(j.fetchedAt)
+	if j.keys == nil || age > ttl || (!known && age > time.Minute) {
+		keys, err := fetchJWKS(getEnv("JWKS_URL", ""))
+		if err != nil && j.keys == nil {
+			return nil, err
+		}
+		if err == nil {
+			j.keys = keys
+		}
+		// On failure keep serving the previous keys until the next attempt
+		j.fetchedAt = time.Now()
+	}
+
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	// Providers with a single key often omit kid
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no JWKS key for kid %q", kid)
+}
+
+// fetchJWKS downloads a JSON Web Key Set and returns its RSA signing keys by kid.
+func fetchJWKS(url string) (map[string]*rsa.PublicKey, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS at %s has no RSA signing keys", url)
+	}
+	return keys, nil
+}
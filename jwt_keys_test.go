@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestJWTKeyFunc(t *testing.T) {
+	tests := []struct {
+		name    string
+		algs    string
+		method  jwt.SigningMethod
+		wantErr bool
+	}{
+		{"HMAC allowed by default", "", jwt.SigningMethodHS256, false},
+		{"HS512 allowed by default", "", jwt.SigningMethodHS512, false},
+		{"RSA refused by default", "", jwt.SigningMethodRS256, true},
+		{"HMAC refused when only RSA is allowed", "RS256", jwt.SigningMethodHS256, true},
+		{"none refused", "", jwt.SigningMethodNone, true},
+		{"allowed but unsupported", "ES256", jwt.SigningMethodES256, true},
+		{"lower-case list", " hs256 ", jwt.SigningMethodHS256, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_ALG", tt.algs)
+			if tt.algs == "" {
+				os.Unsetenv("JWT_ALG")
+			}
+			key, err := jwtKeyFunc(jwt.New(tt.method))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("jwtKeyFunc(%s) error = %v, want error %v", tt.method.Alg(), err, tt.wantErr)
+			}
+			if err == nil && string(key.([]byte)) != string(jwtSecretKey) {
+				t.Fatalf("jwtKeyFunc(%s) did not return JWT_SECRET", tt.method.Alg())
+			}
+		})
+	}
+}
+
+func TestCheckIssuerAudience(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuer   string
+		audience string
+		claims   jwt.MapClaims
+		want     string
+	}{
+		{"nothing configured", "", "", jwt.MapClaims{}, ""},
+		{"issuer matches", "https://auth.example", "", jwt.MapClaims{"iss": "https://auth.example"}, ""},
+		{"issuer differs", "https://auth.example", "", jwt.MapClaims{"iss": "https://evil.example"}, "Invalid token issuer"},
+		{"issuer missing", "https://auth.example", "", jwt.MapClaims{}, "Invalid token issuer"},
+		{"audience matches", "", "content", jwt.MapClaims{"aud": "content"}, ""},
+		{"audience in list", "", "content", jwt.MapClaims{"aud": []interface{}{"billing", "content"}}, ""},
+		{"audience differs", "", "content", jwt.MapClaims{"aud": "billing"}, "Invalid token audience"},
+		{"issuer checked first", "https://auth.example", "content", jwt.MapClaims{"aud": "billing"}, "Invalid token issuer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range map[string]string{"JWT_ISSUER": tt.issuer, "JWT_AUDIENCE": tt.audience} {
+				t.Setenv(key, value)
+				if value == "" {
+					os.Unsetenv(key)
+				}
+			}
+			if got := checkIssuerAudience(tt.claims); got != tt.want {
+				t.Fatalf("checkIssuerAudience(%v) = %q, want %q", tt.claims, got, tt.want)
+			}
+		})
+	}
+}
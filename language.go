@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// languageNames maps the ISO 639-1 codes we expect most often to names used in TTS
+// instructions. Other codes are passed through as-is.
+var languageNames = map[string]string{
+	"en": "English", "fr": "French", "es": "Spanish", "de": "German", "it": "Italian",
+	"pt": "Portuguese", "nl": "Dutch", "ru": "Russian", "zh": "Chinese", "ja": "Japanese",
+	"ko": "Korean", "ar": "Arabic", "hi": "Hindi", "pl": "Polish", "tr": "Turkish",
+	"sv": "Swedish", "ht": "Haitian Creole",
+}
+
+// normalizeLanguage lower-cases a language code and reports whether it looks like an
+// ISO 639-1 code.
+func normalizeLanguage(code string) (string, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) != 2 || strings.Trim(code, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return "", false
+	}
+	return code, true
+}
+
+// languageName returns the English name of a language code.
+func languageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// detectLanguage asks GPT for the ISO 639-1 code of excerpt's language.
+func detectLanguage(excerpt string, bookID uint) (string, error) {
+	answer, err := chatCompletion(ChatRequest{
+		Model: openAIModels.Light,
+		Messages: []ChatMessage{
+			{Role: "system", Content: "Identify the language of the text. Answer with only its two-letter ISO 639-1 code, e.g. en or fr."},
+			{Role: "user", Content: excerpt},
+		},
+		MaxTokens:   5,
+		Temperature: 0,
+	}, bookID, "language")
+	if err != nil {
+		return "", err
+	}
+	code, ok := normalizeLanguage(strings.Trim(answer, ".\"'` "))
+	if !ok {
+		return "", fmt.Errorf("unexpected language answer %q", answer)
+	}
+	return code, nil
+}
+
+// autoLanguageEnabled reports whether blank languages are detected with GPT on upload
+// (AUTO_LANGUAGE_ENABLED, default false because every detection is a paid call).
+func autoLanguageEnabled() bool {
+	return getEnv("AUTO_LANGUAGE_ENABLED", "false") == "true"
+}
+
+// autoDetectLanguage stores the detected language of a book's first pages unless the
+// user already chose one. Failures leave the language empty.
+func autoDetectLanguage(bookID uint) {
+	contents, err := loadChunkTexts(db.Where("book_id = ?", bookID).Order("\"index\" ASC").Limit(2))
+	if err != nil {
+		log.Printf("⚠️ Could not read pages of book %d for language detection: %v", bookID, err)
+		return
+	}
+	excerpt := strings.TrimSpace(strings.Join(contents, "\n"))
+	if excerpt == "" {
+		return
+	}
+	excerpt = truncateRunes(excerpt, 1500)
+
+	code, err := detectLanguage(excerpt, bookID)
+	if err != nil {
+		log.Printf("⚠️ Language detection failed for book %d: %v", bookID, err)
+		return
+	}
+	if err := db.Model(&Book{}).Where("id = ? AND (language IS NULL OR language = '')", bookID).Update("language", code).Error; err != nil {
+		log.Printf("⚠️ Failed to save language for book %d: %v", bookID, err)
+		return
+	}
+	log.Printf("🌐 Book %d detected as %s", bookID, languageName(code))
+}
+
+// languageInstruction is appended to TTS instructions so the voice uses the right
+// language and accent. English and unknown languages need no hint.
+func languageInstruction(code string) string {
+	if code == "" || code == "en" {
+		return ""
+	}
+	return fmt.Sprintf(" Speak in %s with a natural native accent.", languageName(code))
+}
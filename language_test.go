@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		ok   bool
+	}{
+		{"en", "en", true},
+		{" FR ", "fr", true},
+		{"ht", "ht", true},
+		{"eng", "", false},
+		{"e1", "", false},
+		{"e", "", false},
+		{"", "", false},
+		{"é", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeLanguage(tt.code)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeLanguage(%q) = %q, %v, want %q, %v", tt.code, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -12,13 +12,13 @@ func listProcessedChunkGroupsHandler(c *gin.Context) {
 	bookIDStr := c.Param("book_id")
 	bookID, err := strconv.Atoi(bookIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid book ID", nil)
 		return
 	}
 
 	var groups []ProcessedChunkGroup
 	if err := db.Where("book_id = ?", bookID).Order("start_idx").Find(&groups).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch processed chunk groups", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch processed chunk groups", err.Error())
 		return
 	}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
@@ -8,8 +9,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -23,78 +26,159 @@ import (
 // Global variables
 var db *gorm.DB
 
+// defaultJWTSecret is the development fallback for JWT_SECRET. Anyone can sign tokens
+// with it, so the admin routes stay disabled while it is in use; see adminAuthConfigured.
+const defaultJWTSecret = "defaultSecrete"
+
 // Use the JWT secret from an environment variable.
-var jwtSecretKey = []byte(getEnv("JWT_SECRET", "defaultSecrete"))
+var jwtSecretKey = []byte(getEnv("JWT_SECRET", defaultJWTSecret))
 
 // Allowed categories for validation
 var allowedCategories = []string{"Fiction", "Non-Fiction"}
 
 // Book represents the model for a book uploaded by a user.
 type Book struct {
-	ID          uint   `gorm:"primaryKey"`
-	Title       string `gorm:"not null"`
-	Author      string // Optional author field
-	Content     string `gorm:"type:text"` // Text content of the book
-	ContentHash string `gorm:"index"`
-	FilePath    string // Local storage file path.
-	AudioPath   string // Path/URL of the generated (merged) audio.
-	Status      string `gorm:"default:'pending'"`
-	Category    string `gorm:"not null;index"`
-	Genre       string `gorm:"index"`
-	UserID      uint   `gorm:"index"`
-	CoverPath   string // Optional cover image path
-	CoverURL    string // Optional cover image URL for public access
-	Index       int    // Index of the book in the list
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID                    uint           `gorm:"primaryKey"`
+	Title                 string         `gorm:"not null"`
+	Author                string         // Optional author field
+	Content               string         `gorm:"type:text"` // Text content of the book
+	ContentHash           string         `gorm:"index"`
+	FilePath              string         // Local storage file path.
+	OriginalFilename      string         // Name of the uploaded file as sent by the client
+	FileSizeBytes         int64          // Size of the uploaded file
+	ContentTruncated      bool           // Text past MAX_CONTENT_CHARS was dropped; see CONTENT_LIMIT_MODE
+	AudioPath             string         // Path/URL of the generated (merged) audio.
+	AudioPathMP3          string         // MP3 variant of AudioPath
+	AudioPathOpus         string         // Opus variant, produced when MULTI_FORMAT_ENABLED=true
+	HLSPlaylistPath       string         // HLS playlist for long books; see generateBookHLS
+	Status                BookStatus     `gorm:"default:'pending';index"`
+	Category              string         `gorm:"not null;index"`
+	Genre                 string         `gorm:"index"`
+	UserID                uint           `gorm:"index"`
+	CoverPath             string         // Optional cover image path
+	CoverURL              string         // Optional cover image URL for public access
+	Index                 int            // Index of the book in the list
+	Public                bool           `gorm:"default:false;index"` // Listed in the public feed when true
+	TTSProvider           string         `gorm:"default:'openai'"`    // Narration provider: openai or elevenlabs
+	NarratedBy            string         // Provider that actually produced AudioPath (may be a fallback)
+	ReusedFromBookID      *uint          // Book whose audio was reused for identical content; nil when narrated
+	MultiVoice            bool           // Narrate dialogue with per-character voices (OpenAI only)
+	Voice                 string         `gorm:"size:32"` // OpenAI narration voice; empty uses narratorVoice
+	Speed                 *float64       // OpenAI speech speed 0.25–4.0; nil is normal speed
+	VoiceMap              string         `gorm:"type:text"`    // JSON speaker→voice map, kept stable across re-runs
+	EnableSoundEffects    *bool          `gorm:"default:true"` // Pointer so an explicit false isn't replaced by the default
+	EnableBackgroundMusic *bool          `gorm:"default:true"`
+	UniqueMusic           bool           // Generate music for this book instead of sharing its genre's clip
+	PlainNarration        *bool          // Finish pages with plain narration when their mix fails; nil uses PLAIN_NARRATION_FALLBACK
+	MusicVolume           *float64       // 0.0–1.0; nil uses the default mix level
+	EffectsVolume         *float64       // 0.0–1.0; nil uses the default mix level
+	CrossfadeMs           int            // Crossfade between merged chunks in milliseconds; 0 disables it
+	Language              string         `gorm:"size:8"`               // ISO 639-1 code, detected on upload unless set by the user
+	TargetLanguage        string         `gorm:"size:8"`               // When set and different from Language, pages are translated before narration
+	Summary               string         `gorm:"type:text"`            // Cached GPT synopsis; see getBookSummaryHandler
+	OutputFormat          string         `gorm:"size:8;default:'mp3'"` // Final page audio format: mp3, opus or aac
+	ModeratedHash         string         // ContentHash last checked by moderation; see checkBookModeration
+	ModerationCategories  string         `gorm:"type:text"` // JSON list of the categories that rejected the text at ModeratedHash
+	DeletedAt             gorm.DeletedAt `gorm:"index"`     // Soft delete; purged after SOFT_DELETE_RETENTION_DAYS
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
 }
 
 // BookRequest defines the expected JSON structure for creating a book.
 type BookRequest struct {
-	Title    string `json:"title" binding:"required"`
-	Author   string `json:"author"`
-	Category string `json:"category" binding:"required"`
-	Genre    string `json:"genre"`
+	Title                 string   `json:"title" binding:"required"`
+	Author                string   `json:"author"`
+	Category              string   `json:"category" binding:"required"`
+	Genre                 string   `json:"genre"`
+	TTSProvider           string   `json:"tts_provider"` // openai or elevenlabs; empty means openai
+	MultiVoice            bool     `json:"multi_voice"`
+	Voice                 string   `json:"voice"` // OpenAI voice; empty uses the user's default
+	Speed                 *float64 `json:"speed" binding:"omitempty,gte=0.25,lte=4"`
+	EnableSoundEffects    *bool    `json:"enable_sound_effects"`     // Defaults to true when omitted
+	EnableBackgroundMusic *bool    `json:"enable_background_music"`  // Defaults to true when omitted
+	UniqueMusic           bool     `json:"unique_music"`             // Opt out of the shared genre music
+	PlainNarration        *bool    `json:"plain_narration_fallback"` // Defaults to PLAIN_NARRATION_FALLBACK when omitted
+	MusicVolume           *float64 `json:"music_volume" binding:"omitempty,gte=0,lte=1"`
+	EffectsVolume         *float64 `json:"effects_volume" binding:"omitempty,gte=0,lte=1"`
+	CrossfadeMs           int      `json:"crossfade_ms" binding:"gte=0,lte=2000"` // Opt-in; e.g. 150
+	Language              string   `json:"language"`                              // ISO 639-1 code; empty means detect
+	TargetLanguage        string   `json:"target_language"`                       // Narrate a translation into this language
+	OutputFormat          string   `json:"output_format"`                         // mp3 (default), opus or aac
 }
 
 // Chunk represents the model for chunks or segments of boook
 type BookChunk struct {
-	ID             uint   `gorm:"primaryKey"`
-	BookID         uint   `gorm:"index"`
-	Index          int    // Index of the chunk in the book
-	Content        string `gorm:"type:text"` // Text content of the chunk
-	AudioPath      string `gorm:"not null"`
-	FinalAudioPath string `json:"final_audio_path"` // 👈 New field
-	TTSStatus      string // values: "pending", "processing", "completed", "failed"
-	StartTime      int64  // Start time in seconds
-	EndTime        int64  // End time in seconds
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	ID              uint     `gorm:"primaryKey"`
+	BookID          uint     `gorm:"index;uniqueIndex:idx_book_chunks_book_index"`
+	Index           int      `gorm:"uniqueIndex:idx_book_chunks_book_index"` // Index of the chunk in the book
+	Content         string   `gorm:"type:text"`                              // Text content of the chunk
+	ContentKey      string   // Set when the text lives in the ContentStore instead of Content
+	OriginalContent string   `gorm:"type:text"` // Source text when Content holds a translation
+	AudioPath       string   `gorm:"not null"`
+	FinalAudioPath  string   `json:"final_audio_path"` // 👈 New field
+	TTSStatus       string   // values: "pending", "processing", "completed", "failed"
+	NarratedBy      string   // Provider that actually produced AudioPath (may be a fallback)
+	DurationSeconds *float64 // Length of the page audio; nil until measured
+	WordTimings     string   `gorm:"type:text"` // JSON []WordTiming when the TTS provider supplies them
+	StartTime       int64    // Start time in seconds
+	EndTime         int64    // End time in seconds
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+
+	storedContent string // Text moved to the ContentStore during a save, restored afterwards
 }
 
 type TTSQueueJob struct {
-	ID        uint   `gorm:"primaryKey"`
-	BookID    uint   `gorm:"index"`
-	ChunkIDs  string // Comma-separated chunk ID list
-	Status    string `gorm:"default:'queued'"` // queued, processing, complete, failed
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	UserID    uint `gorm:"index"`
+	ID             uint      `gorm:"primaryKey"`
+	BookID         uint      `gorm:"index"`
+	ChunkIDs       string    // Comma-separated chunk ID list
+	Status         string    `gorm:"default:'queued';index:idx_tts_jobs_claim,priority:1"`             // queued, processing, complete, failed
+	Priority       int       `gorm:"default:0;not null;index:idx_tts_jobs_claim,priority:2,sort:desc"` // Higher runs first; see jobPriorityInteractive
+	Attempts       int       `gorm:"default:0;not null"`                                               // Runs so far; see jobMaxAttempts
+	LastError      string    `gorm:"type:text"`                                                        // Error from the most recent failed run
+	CreatedAt      time.Time `gorm:"index:idx_tts_jobs_claim,priority:3"`                              // The worker claims the oldest queued job of the highest priority
+	UpdatedAt      time.Time
+	UserID         uint       `gorm:"index;uniqueIndex:idx_tts_jobs_user_idempotency"`
+	IdempotencyKey *string    `gorm:"size:255;uniqueIndex:idx_tts_jobs_user_idempotency"` // Optional client Idempotency-Key, unique per user
+	NextAttemptAt  *time.Time // A failed job is not claimed again before this; see jobRetryDelay
 }
 type BookResponse struct {
-	ID          uint   `json:"id"`
-	Title       string `json:"title"`
-	Author      string `json:"author"`
-	Category    string `json:"category"`
-	Content     string `json:"content,omitempty"` // Optional, can be omitted for public response
-	ContentHash string `json:"content_hash"`
-	Genre       string `json:"genre"`
-	FilePath    string `json:"file_path"`
-	AudioPath   string `json:"audio_path"`
-	Status      string `json:"status"`
-	StreamURL   string `json:"stream_url"`
-	CoverURL    string `json:"cover_url"`
-	CoverPath   string `json:"cover_path"`
+	ID                    uint     `json:"id"`
+	Title                 string   `json:"title"`
+	Author                string   `json:"author"`
+	Category              string   `json:"category"`
+	Content               string   `json:"content,omitempty"` // Optional, can be omitted for public response
+	ContentHash           string   `json:"content_hash"`
+	Genre                 string   `json:"genre"`
+	FilePath              string   `json:"file_path"`
+	OriginalFilename      string   `json:"original_filename"`
+	FileSizeBytes         int64    `json:"file_size_bytes"`
+	ContentTruncated      bool     `json:"content_truncated"`
+	AudioPath             string   `json:"audio_path"`
+	Status                string   `json:"status"`
+	StreamURL             string   `json:"stream_url"`
+	CoverURL              string   `json:"cover_url"`
+	CoverPath             string   `json:"cover_path"`
+	Public                bool     `json:"public"`
+	TTSProvider           string   `json:"tts_provider"`
+	NarratedBy            string   `json:"narrated_by,omitempty"`
+	ReusedFromBookID      *uint    `json:"reused_from_book_id,omitempty"`
+	MultiVoice            bool     `json:"multi_voice"`
+	Voice                 string   `json:"voice"`
+	Speed                 float64  `json:"speed"`
+	EnableSoundEffects    bool     `json:"enable_sound_effects"`
+	EnableBackgroundMusic bool     `json:"enable_background_music"`
+	UniqueMusic           bool     `json:"unique_music"`
+	PlainNarration        bool     `json:"plain_narration_fallback"`
+	MusicVolume           float64  `json:"music_volume"`
+	EffectsVolume         float64  `json:"effects_volume"`
+	CrossfadeMs           int      `json:"crossfade_ms"`
+	Language              string   `json:"language"`
+	TargetLanguage        string   `json:"target_language,omitempty"`
+	OutputFormat          string   `json:"output_format"`
+	ModerationCategories  []string `json:"moderation_categories,omitempty"` // Categories that got the book rejected
+	PositionSeconds       *float64 `json:"position_seconds,omitempty"`      // Caller's saved playback position
+	Favorite              bool     `json:"favorite"`                        // Starred by the caller
 }
 
 func main() {
@@ -104,14 +188,55 @@ func main() {
 	// 	log.Println("⚠️ Could not load .env file, using system env variables")
 	// }
 	// Set up the database connection and run migrations.
+	initContentEncryption()
 	setupDatabase()
 	// MQTT initialization
 	InitMQTT()
+	// Work orphaned by a crashed run resumes from the queue
+	recoverOrphanedWork()
 	//Initializaton for TTS worker
 	startTTSWorker()
+	startBookPurger()
+
+	router := newRouter()
+	checkOpenAPIRoutes(router.Routes())
 
-	// Initialize Gin router.
-	router := gin.Default()
+	// Use PORT env var if set; default to 8083.
+	port := os.Getenv("PORT")
+	if port == "" {
+
+		port = "8083"
+	}
+	log.Printf("📡 Content service listening on port %s", port)
+
+	srv := &http.Server{Addr: ":" + port, Handler: router}
+	srv.RegisterOnShutdown(func() { close(serverShutdown) })
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("❌ Failed to start server: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then drain requests and the TTS worker
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	timeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil {
+		timeout = 30 * time.Second
+	}
+	if err := gracefulShutdown(srv, timeout); err != nil {
+		log.Printf("⚠️ Shutdown incomplete: %v", err)
+	}
+	log.Println("👋 Content service stopped")
+}
+
+// newRouter registers every route on a gin engine with request-ID logging in place of
+// gin's default logger.
+func newRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(requestLoggerMiddleware(), gin.Recovery(), corsMiddleware())
 
 	// Health check/root response
 	router.GET("/health", func(c *gin.Context) {
@@ -124,62 +249,177 @@ func main() {
 	// static cover files
 	router.Static("/covers", "./uploads/covers")
 
+	// API description and interactive docs, no authentication required
+	router.GET("/openapi.json", openAPIHandler)
+	router.GET("/docs", swaggerUIHandler)
+
+	// Public feed of shared books, no authentication required
+	router.GET("/public/books", listPublicBooksHandler)
+	router.GET("/public/books/:book_id/stream", streamPublicBookAudioHandler)
+
 	// Calling Streaming Route outside of the authorized group
 	// router.GET("/user/books/stream/proxy/:id", proxyBookAudioHandler)
 
 	// Protected routes group.
 	authorized := router.Group("/user")
 	authorized.Use(authMiddleware())
+	// Per-user limit on routes that call OpenAI/ElevenLabs
+	rateLimited := rateLimitMiddleware(newRateLimiterFromEnv())
 	{ // handles book creation, listing, and file uploads
 		authorized.POST("/books/:book_id/cover", uploadBookCoverHandler)
 
 		// Create a new book
-		authorized.POST("/books", createBookHandler)
+		authorized.POST("/books", rateLimited, createBookHandler)
 		// List all books for the authenticated user
 		authorized.GET("/books", listBooksHandler)
 
 		// Upload a book file
-		authorized.POST("/books/upload", uploadBookFileHandler)
+		authorized.POST("/books/upload", rateLimited, uploadBookFileHandler)
+		// Append another source file (e.g. the next volume) to a book
+		authorized.POST("/books/:book_id/files", rateLimited, appendBookFileHandler)
 		// List all chunks for a book
 		authorized.GET("/books/:book_id/chunks/pages", listBookPagesHandler) // New handler for listing book pages
+		// Page counts per TTS status, without content
+		authorized.GET("/books/:book_id/chunks/stats", getChunkStatsHandler)
 		// authorized.GET("/books/stream/proxy/:id", proxyBookAudioHandler)
 
 		authorized.GET("/books/stream/proxy/:book_id", proxyBookAudioHandler)
 		authorized.POST("/chunks/tts", ProcessChunksTTSHandler)
 		authorized.GET("/chunks/tts/merged-audio/:book_id", streamMergedChunkAudioHandler)
-		authorized.GET("/books/:book_id/chunks/:start/:end/audio", streamChunkGroupAudioHandler)
+		authorized.GET("/books/:book_id/chunks/:index/:end/audio", streamChunkGroupAudioHandler)
 		//authorized.GET("/chunks/status", checkChunkQueueStatusHandler)
 
 		//Batch Transcribe Book Page-by-Page (Sequentially)
 		authorized.POST("/books/:book_id/tts/batch", BatchTranscribeBookHandler)
+		// queue every unfinished page as worker jobs
+		authorized.POST("/books/:book_id/process-all", rateLimited, processAllChunksHandler)
 		// processing old chunks
 		authorized.GET("/books/:book_id/chunks/processed", listProcessedChunkGroupsHandler)
 		// stream audio by chunk IDs
-		authorized.POST("/chunks/audio-by-id", streamAudioByChunkIDsHandler)
+		authorized.POST("/chunks/audio-by-id", rateLimited, streamAudioByChunkIDsHandler)
 
 		// adding a new route to delate a book by ID or title
 		authorized.DELETE("/books/:book_id", deleteBookHandler)
+		// undo a delete within the retention period
+		authorized.POST("/books/:book_id/restore", restoreBookHandler)
 
 		// adding a new route to pull one book by ID
 		authorized.GET("/books/:book_id", getSingleBookHandler)
 
 		// adding a route to pull audio and backgrond music for a book
 		authorized.GET("/books/:book_id/pages/:page/audio", streamSinglePageAudioHandler)
+		// HLS playlist (index.m3u8) and segments for long books
+		authorized.GET("/books/:book_id/hls/:file", streamBookHLSHandler)
+		// peak amplitudes for scrubber waveforms
+		authorized.GET("/books/:book_id/waveform", rateLimited, getBookWaveformHandler)
+		// ordered page audio for gapless client-side playback
+		authorized.GET("/books/:book_id/playlist", getBookPlaylistHandler)
+		// Chapters of a multi-file book with their start times
+		authorized.GET("/books/:book_id/chapters", getBookChaptersHandler)
+
+		// share or unshare a book in the public feed
+		authorized.POST("/books/:book_id/publish", publishBookHandler)
+		authorized.POST("/books/:book_id/unpublish", unpublishBookHandler)
+
+		// OpenAI token usage and estimated cost for a book
+		authorized.GET("/books/:book_id/usage", getBookUsageHandler)
+
+		// regenerate a book from its source file
+		authorized.POST("/books/:book_id/process", rateLimited, processBookHandler)
+		authorized.POST("/books/:book_id/reprocess", rateLimited, reprocessBookHandler)
+		authorized.POST("/books/:book_id/chunks/:index/reprocess", rateLimited, reprocessChunkHandler)
+		// remix music and effects over the existing narration
+		authorized.POST("/books/:book_id/effects/regenerate", rateLimited, regenerateEffectsHandler)
+		authorized.PATCH("/books/:book_id/chunks/:index", updateChunkContentHandler)
+		// split a page in two, or close gaps in the page indexes
+		authorized.POST("/books/:book_id/chunks/:index/split", splitChunkHandler)
+		authorized.POST("/books/:book_id/chunks/renumber", renumberChunksHandler)
+		authorized.GET("/books/:book_id/chunks/:index/timings", getChunkTimingsHandler)
+
+		// short narrated sample in the book's voice
+		authorized.POST("/books/:book_id/preview", rateLimited, previewBookHandler)
+
+		// GPT synopsis, cached on the book
+		authorized.GET("/books/:book_id/summary", rateLimited, getBookSummaryHandler)
+
+		// chunk-by-chunk processing progress
+		authorized.GET("/books/:book_id/progress", getBookProgressHandler)
+		authorized.GET("/books/:book_id/progress/stream", streamBookProgressHandler)
+		authorized.GET("/books/:book_id/estimate", getBookEstimateHandler)
+
+		// resume position per user
+		authorized.PUT("/books/:book_id/position", savePlaybackPositionHandler)
+		authorized.GET("/books/:book_id/position", getPlaybackPositionHandler)
+
+		// starred books; list them with GET /books?favorites=true
+		authorized.POST("/books/:book_id/favorite", addFavoriteHandler)
+		authorized.DELETE("/books/:book_id/favorite", removeFavoriteHandler)
+
+		// custom sound-effect prompts per event type
+		authorized.GET("/sound-effect-prompts", listSoundEffectPromptsHandler)
+		authorized.PUT("/sound-effect-prompts/:event_type", upsertSoundEffectPromptHandler)
+		authorized.DELETE("/sound-effect-prompts/:event_type", deleteSoundEffectPromptHandler)
+
+		// Account defaults for new books
+		authorized.GET("/preferences", getUserPreferencesHandler)
+		authorized.PUT("/preferences", updateUserPreferencesHandler)
 
 	}
 
-	// Use PORT env var if set; default to 8083.
-	port := os.Getenv("PORT")
-	if port == "" {
-
-		port = "8083"
+	// Operator endpoints. Every route in this group requires the admin role (a "role":
+	// "admin" claim or "admin" in "roles"); user tokens get 403. Routes under /user only
+	// need a valid token and are scoped to the caller's own books.
+	//   GET  /admin/jobs                  list and filter TTS jobs across all users
+	//   POST /admin/jobs/:job_id/requeue  requeue a failed job
+	//   GET  /admin/dead-letters          jobs that exhausted JOB_MAX_ATTEMPTS
+	//   POST /admin/dead-letters/:dead_letter_id/replay  requeue a dead-lettered job
+	//   GET  /admin/stats                 totals for the operator dashboard
+	//   GET  /admin/users/:user_id/quota  a user's quota limits and usage
+	//   PUT  /admin/users/:user_id/quota  set a user's quota override
+	if !adminAuthConfigured() {
+		log.Println("⚠️ JWT_SECRET is not set; /admin routes are disabled until it is (or HMAC tokens are turned off with JWT_ALG)")
 	}
-	log.Printf("📡 Content service listening on port %s", port)
+	admin := router.Group("/admin")
+	admin.Use(authMiddleware(), requireAdmin())
+	{
+		admin.GET("/jobs", listJobsHandler)
+		admin.POST("/jobs/:job_id/requeue", requeueJobHandler)
+		admin.GET("/dead-letters", listDeadLettersHandler)
+		admin.POST("/dead-letters/:dead_letter_id/replay", replayDeadLetterHandler)
+		admin.GET("/stats", adminStatsHandler)
+		admin.GET("/users/:user_id/quota", getUserQuotaHandler)
+		admin.PUT("/users/:user_id/quota", putUserQuotaHandler)
+	}
+	return router
+}
+
+// serverShutdown is closed when the server starts shutting down, so long-lived
+// responses such as progress streams end instead of holding up the drain.
+var serverShutdown = make(chan struct{})
+
+// gracefulShutdown stops accepting requests and waits up to timeout for in-flight
+// requests and the current TTS job to finish.
+func gracefulShutdown(srv *http.Server, timeout time.Duration) error {
+	log.Printf("🛑 Shutting down (timeout %s)", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	//router.Run(":" + port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("❌ Failed to start server: %v", err)
+	// Whatever is still running after the drain is cut off; ffmpeg children are killed
+	defer cancelBackgroundWork()
+
+	// Drain requests and the worker side by side, so a request that outlives the
+	// timeout can't keep the in-flight job from being requeued
+	workerErr := make(chan error, 1)
+	go func() { workerErr <- stopTTSWorker(ctx) }()
+
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http shutdown: %w", err))
+	}
+	if err := <-workerErr; err != nil {
+		errs = append(errs, fmt.Errorf("TTS worker drain: %w", err))
 	}
+	return errors.Join(errs...)
 }
 
 // setupDatabase connects to PostgreSQL and auto migrates the Book model.
@@ -204,53 +444,117 @@ func setupDatabase() {
 
 	log.Println("DNS", dsn)
 
-	if err := db.AutoMigrate(&Book{}, &BookChunk{}, &ProcessedChunkGroup{}, &TTSQueueJob{}); err != nil {
+	if err := dedupeBookChunks(); err != nil {
+		log.Fatalf("Failed to remove duplicate chunks before migrating: %v", err)
+	}
+
+	if err := db.AutoMigrate(&Book{}, &BookChunk{}, &ProcessedChunkGroup{}, &TTSQueueJob{}, &UserUsage{}, &BookUsage{}, &UserQuotaOverride{}, &TokenUsage{}, &SoundEffectPrompt{}, &ModerationResult{}, &PlaybackPosition{}, &Favorite{}, &ProcessingSample{}, &DeadLetterJob{}, &GenreMusicClip{}, &BookFile{}, &UserPreference{}, &AudioArtifact{}); err != nil {
 		log.Fatalf("AutoMigrate failed: %v", err)
 	}
+	migrateLegacyBookStatuses()
+	ensureSearchIndexes()
+	backfillAudioArtifacts()
+	ensureNotifyTriggers()
 	log.Println("Database connected and migrated successfully")
+
+	startNotificationListener(dsn)
 }
 
 func createBookHandler(c *gin.Context) {
 	var req BookRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("Error in book request binding: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book data", "details": err.Error()})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid book data", err.Error())
 		return
 	}
+	// Fields the request leaves out take the user's defaults, then the system defaults
+	applyUserPreferences(&req, loadUserPreference(getUserIDFromContext(c)))
 
 	if !isValidCategory(req.Category) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category", "allowed_categories": allowedCategories})
+		respondError(c, http.StatusBadRequest, codeInvalidCategory, "Invalid category", gin.H{"allowed_categories": allowedCategories})
+		return
+	}
+	if !isValidTTSProvider(req.TTSProvider) {
+		respondError(c, http.StatusBadRequest, codeInvalidTTSProvider, "Invalid tts_provider", gin.H{"allowed_tts_providers": allowedTTSProviders})
+		return
+	}
+	provider := narratorFor(req.TTSProvider).Name()
+	if !isValidVoice(req.Voice) {
+		respondError(c, http.StatusBadRequest, codeInvalidVoice, "Invalid voice", gin.H{"allowed_voices": allowedVoices})
+		return
+	}
+	language := ""
+	if req.Language != "" {
+		var ok bool
+		if language, ok = normalizeLanguage(req.Language); !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidLanguage, "Invalid language; use a two-letter ISO 639-1 code", nil)
+			return
+		}
+	}
+	targetLanguage := ""
+	if req.TargetLanguage != "" {
+		var ok bool
+		if targetLanguage, ok = normalizeLanguage(req.TargetLanguage); !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidLanguage, "Invalid target_language; use a two-letter ISO 639-1 code", nil)
+			return
+		}
+	}
+
+	outputFormat := strings.ToLower(req.OutputFormat)
+	if outputFormat == "" {
+		outputFormat = defaultOutputFormat
+	}
+	if !isValidOutputFormat(outputFormat) {
+		respondError(c, http.StatusBadRequest, codeInvalidOutputFormat, "Invalid output_format", gin.H{"allowed_output_formats": []string{"mp3", "opus", "aac"}})
 		return
 	}
 
 	claims, exists := c.Get("claims")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication claims missing"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Authentication claims missing", nil)
 		return
 	}
 	userClaims, ok := claims.(jwt.MapClaims)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token claims"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Invalid token claims", nil)
 		return
 	}
 	userIDFloat, ok := userClaims["user_id"].(float64)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in token"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "User ID not found in token", nil)
 		return
 	}
 	userID := uint(userIDFloat)
 
+	if !enforceUserQuota(c, userID, 0) {
+		return
+	}
+
 	book := Book{
-		Title:    req.Title,
-		Author:   req.Author,
-		Category: req.Category,
-		Genre:    req.Genre,
-		Status:   "pending",
-		UserID:   userID,
+		Title:                 req.Title,
+		Author:                req.Author,
+		Category:              req.Category,
+		Genre:                 req.Genre,
+		Status:                bookStatusPending,
+		UserID:                userID,
+		TTSProvider:           provider,
+		MultiVoice:            req.MultiVoice,
+		Voice:                 strings.ToLower(req.Voice),
+		Speed:                 req.Speed,
+		EnableSoundEffects:    req.EnableSoundEffects,
+		EnableBackgroundMusic: req.EnableBackgroundMusic,
+		UniqueMusic:           req.UniqueMusic,
+		PlainNarration:        req.PlainNarration,
+		MusicVolume:           req.MusicVolume,
+		EffectsVolume:         req.EffectsVolume,
+		CrossfadeMs:           req.CrossfadeMs,
+		Language:              language,
+		TargetLanguage:        targetLanguage,
+		OutputFormat:          outputFormat,
 	}
 	if err := db.Create(&book).Error; err != nil {
 		log.Printf("Error creating book record: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save book", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save book", err.Error())
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Book saved", "book": book})
@@ -261,18 +565,22 @@ func createBookHandler(c *gin.Context) {
 func deleteBookHandler(c *gin.Context) {
 	bookID := c.Param("book_id")
 	if bookID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book ID or title is required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book ID or title is required", nil)
 		return
 	}
 
 	var book Book
 	if err := db.First(&book, bookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to delete this book", nil)
 		return
 	}
 
 	if err := db.Delete(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to delete book", err.Error())
 		return
 	}
 
@@ -283,7 +591,7 @@ func deleteBookHandler(c *gin.Context) {
 func listBookPagesHandler(c *gin.Context) {
 	bookID := c.Param("book_id")
 	if bookID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book ID is required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book ID is required", nil)
 		return
 	}
 
@@ -305,41 +613,51 @@ func listBookPagesHandler(c *gin.Context) {
 	// Fetch the book itself for metadata
 	var book Book
 	if err := db.First(&book, bookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
 		return
 	}
 
 	// Fetch chunks for this book with pagination
 	var chunks []BookChunk
 	if err := db.Where("book_id = ?", bookID).
-		Order("index ASC").
+		Order("\"index\" ASC").
 		Limit(limit).
 		Offset(offset).
 		Find(&chunks).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve book chunks", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Could not retrieve book chunks", err.Error())
 		return
 	}
 
 	if len(chunks) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "No pages found for this range"})
+		respondError(c, http.StatusNotFound, codeChunkNotFound, "No pages found for this range", nil)
 		return
 	}
 
 	// Check processed status and prepare pages
 	pages := make([]map[string]interface{}, 0, len(chunks))
 	fullyProcessed := true
+	totalDuration := 0.0
 
 	for _, chunk := range chunks {
+		if err := loadChunkContent(&chunk); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load page text", err.Error())
+			return
+		}
 		if chunk.TTSStatus != "completed" {
 			fullyProcessed = false
 		}
+		duration := chunkDurationSeconds(&chunk)
+		if duration != nil {
+			totalDuration += *duration
+		}
 		pages = append(pages, map[string]interface{}{
-			"page":    chunk.Index + 1,
-			"content": chunk.Content,
-			"status":  chunk.TTSStatus,
+			"page":             chunk.Index + 1,
+			"content":          chunk.Content,
+			"original_content": chunk.OriginalContent,
+			"status":           chunk.TTSStatus,
+			"duration_seconds": duration,
 			// "audio_url": chunk.AudioPath,
-			"audio_url": fmt.Sprintf("%s/user/books/%d/pages/%d/audio",
-				getEnv("STREAM_HOST", "http://0.0.0.0:8083"), chunk.BookID, chunk.Index),
+			"audio_url": chunkAudioURL(chunk.BookID, chunk.Index),
 		})
 	}
 
@@ -356,6 +674,7 @@ func listBookPagesHandler(c *gin.Context) {
 		"limit":           limit,
 		"offset":          offset,
 		"fully_processed": fullyProcessed,
+		"total_duration":  totalDuration,
 		"pages":           pages,
 	})
 }
@@ -366,69 +685,109 @@ func listBookPagesHandler(c *gin.Context) {
 // The token should contain user_id in its claims.
 // If the user_id is not found in the token, it returns an error.
 // If the category or genre is provided, it filters the books accordingly.
+// If q is provided, it matches title and author case-insensitively, ranking exact and prefix matches first.
+// If status is provided, only books in that status are returned.
+// If sort is provided it must be one of created_at, -created_at or title; anything else returns an error.
 // If the category is invalid, it returns an error.
 // It also adds a public stream URL to each book in the response.
 // If the database query fails, it returns an error with details.
-// The stream URL is constructed using the STREAM_HOST environment variable, defaulting to "http://100.110.176.220:8083"
-// If the STREAM_HOST environment variable is not set, it uses the default value.
+// The stream URL is constructed from STREAM_HOST; see streamHost.
 // It returns a JSON response with the list of books, each containing its ID, title, author, category, genre, file path, audio path, status, stream URL, cover URL, and cover path.
 // It uses the Gin framework for handling HTTP requests and responses.
 func listBooksHandler(c *gin.Context) {
 	claims, exists := c.Get("claims")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication claims missing"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Authentication claims missing", nil)
 		return
 	}
 	userClaims, ok := claims.(jwt.MapClaims)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token claims"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Invalid token claims", nil)
 		return
 	}
 	userIDFloat, ok := userClaims["user_id"].(float64)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in token"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "User ID not found in token", nil)
 		return
 	}
 	userID := uint(userIDFloat)
 
 	category := c.Query("category")
 	genre := c.Query("genre")
+	search := c.Query("q")
+	status := c.Query("status")
+
+	orderBy := ""
+	if sort := c.Query("sort"); sort != "" {
+		var ok bool
+		if orderBy, ok = bookSortOrders[sort]; !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidSort, "Invalid sort", gin.H{"allowed_sorts": allowedBookSorts()})
+			return
+		}
+	}
 
 	var books []Book
 	query := db.Where("user_id = ?", userID)
+	if c.Query("favorites") == "true" {
+		// Starred public books from other users belong in the favorites view too
+		query = db.Where("id IN (?) AND (user_id = ? OR public = ?)", favoriteBookIDs(userID), userID, true)
+	}
 	if category != "" {
 		query = query.Where("category = ?", category)
 	}
 	if genre != "" {
 		query = query.Where("genre = ?", genre)
 	}
+	if status != "" {
+		parsed, ok := parseBookStatus(status)
+		if !ok {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid status", gin.H{"allowed_statuses": bookStatuses})
+			return
+		}
+		query = query.Where("status IN ?", bookStatusFilter(parsed))
+	}
+	query = applyBookSearch(query, search, orderBy)
 	if err := query.Find(&books).Error; err != nil {
 		log.Printf("Error retrieving books for user %d: %v", userID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch books", err.Error())
 		return
 	}
 
 	//🛡 Add public stream URL to each book
-	streamHost := getEnv("STREAM_HOST", "http://100.110.176.220:8083")
-	if streamHost == "" {
-		log.Println("STREAM_HOST environment variable not set, using default http://100.110.176.220:8083")
-		streamHost = "http://100.110.176.220:8083"
+	host := streamHost()
+	bookIDs := make([]uint, 0, len(books))
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID)
 	}
+	positions := playbackPositions(userID, bookIDs)
+	favorites := favoriteSet(userID, bookIDs)
+
 	var response []BookResponse
 	for _, book := range books {
-		streamURL := streamHost + "/user/books/stream/proxy/" + fmt.Sprintf("%d", book.ID)
+		var position *float64
+		if p, ok := positions[book.ID]; ok {
+			position = &p
+		}
+		streamURL := host + "/user/books/stream/proxy/" + fmt.Sprintf("%d", book.ID)
 		response = append(response, BookResponse{
-			ID:        book.ID,
-			Title:     book.Title,
-			Author:    book.Author,
-			Category:  book.Category,
-			Genre:     book.Genre,
-			FilePath:  book.FilePath,
-			AudioPath: book.AudioPath,
-			Status:    book.Status,
-			StreamURL: streamURL,
-			CoverURL:  book.CoverURL,
-			CoverPath: book.CoverPath,
+			ID:               book.ID,
+			Title:            book.Title,
+			Author:           book.Author,
+			Category:         book.Category,
+			Genre:            book.Genre,
+			FilePath:         book.FilePath,
+			OriginalFilename: book.OriginalFilename,
+			FileSizeBytes:    book.FileSizeBytes,
+			AudioPath:        book.AudioPath,
+			Status:           string(book.Status),
+			ReusedFromBookID: book.ReusedFromBookID,
+			StreamURL:        streamURL,
+			CoverURL:         book.CoverURL,
+			CoverPath:        book.CoverPath,
+			Public:           book.Public,
+			TTSProvider:      book.TTSProvider,
+			PositionSeconds:  position,
+			Favorite:         favorites[book.ID],
 		})
 	}
 	c.JSON(http.StatusOK, gin.H{"books": response})
@@ -459,27 +818,29 @@ func authMiddleware() gin.HandlerFunc {
 		}
 
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+			abortWithError(c, http.StatusUnauthorized, codeUnauthorized, "Missing token", nil)
 			return
 		}
 
 		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecretKey, nil
-		})
+		token, err := jwt.Parse(tokenString, jwtKeyFunc)
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			abortWithError(c, http.StatusUnauthorized, codeInvalidToken, "Invalid token", nil)
 			return
 		}
 
 		// Attach claims to context
 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if msg := checkIssuerAudience(claims); msg != "" {
+				abortWithError(c, http.StatusUnauthorized, codeInvalidToken, msg, nil)
+				return
+			}
 			c.Set("claims", claims)
 			c.Next()
 			return
 		}
 
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		abortWithError(c, http.StatusUnauthorized, codeInvalidToken, "Invalid token claims", nil)
 	}
 }
 
@@ -522,14 +883,14 @@ func BatchTranscribeBookHandler(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 	token, err := extractToken(authHeader)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Missing or invalid token", nil)
 		return
 	}
 
 	accountType, err := getUserAccountType(token)
 	if err != nil {
 		log.Printf("Error checking account type: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify account type"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to verify account type", nil)
 		return
 	}
 
@@ -541,14 +902,23 @@ func BatchTranscribeBookHandler(c *gin.Context) {
 			Count(&completedChunks)
 
 		if completedChunks >= 1 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Free trial limit reached. Upgrade your plan to continue transcribing."})
+			respondError(c, http.StatusForbidden, codeTrialLimitReached, "Free trial limit reached. Upgrade your plan to continue transcribing.", nil)
 			return
 		}
 	}
 
+	var book Book
+	if err := db.Select("id").First(&book, bookID).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if !enforceBookModeration(c, book.ID) {
+		return
+	}
+
 	var chunks []BookChunk
-	if err := db.Where("book_id = ? AND tts_status != ?", bookID, "completed").Order("index ASC").Find(&chunks).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch chunks"})
+	if err := db.Where("book_id = ? AND tts_status != ?", bookID, "completed").Order("\"index\" ASC").Find(&chunks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Could not fetch chunks", nil)
 		return
 	}
 
@@ -557,15 +927,23 @@ func BatchTranscribeBookHandler(c *gin.Context) {
 		return
 	}
 
+	requestID := requestIDFromContext(c)
 	go func() {
 		for _, chunk := range chunks {
 			db.Model(&chunk).Update("TTSStatus", "processing")
 
-			audioPath, err := convertTextToAudio(chunk.Content, chunk.ID)
+			text, err := prepareChunkText(&chunk)
+			if err != nil {
+				logWithRequestID(requestID, "Translation failed for chunk %d: %v", chunk.ID, err)
+				db.Model(&chunk).Update("TTSStatus", "failed")
+				continue
+			}
+			narration, err := narrateWithFallback(bookTTSProvider(chunk.BookID), text, chunkNarrationName(chunk.ID), chunk.BookID)
 			if err != nil {
 				db.Model(&chunk).Update("TTSStatus", "failed")
 				continue
 			}
+			audioPath, narratedBy := narration.Path, narration.Provider
 
 			// Compute hash of the chunk content
 			hash := fmt.Sprintf("%x", sha256.Sum256([]byte(chunk.Content)))
@@ -573,44 +951,66 @@ func BatchTranscribeBookHandler(c *gin.Context) {
 			// Load book info
 			var book Book
 			if err := db.First(&book, chunk.BookID).Error; err != nil {
-				log.Printf("Book not found for chunk %d: %v", chunk.ID, err)
+				logWithRequestID(requestID, "Book not found for chunk %d: %v", chunk.ID, err)
 				continue
 			}
 
 			// Update book's Index temporarily for naming
 			book.Index = chunk.Index
 
-			// Generate background music and merge it
-			bgPrompt, err := generateOverallSoundPrompt(book.FilePath)
+			// Generate (or reuse) background music and merge it
+			bgMusic, shared, err := backgroundMusicFor(book)
 			if err != nil {
-				log.Printf("Prompt generation failed: %v", err)
+				logWithRequestID(requestID, "Music generation failed: %v", err)
 				continue
 			}
 
-			bgMusic, err := generateSoundEffect(bgPrompt)
+			unlock, err := lockBookMerge(backgroundCtx, book.ID)
 			if err != nil {
-				log.Printf("Music generation failed: %v", err)
-				continue
+				logWithRequestID(requestID, "🛑 Batch transcription of book %s stopped: %v", bookID, err)
+				return
+			}
+			mergedAudio, err := mergeAudio(backgroundCtx, audioPath, bgMusic, book, chunk.Index, book.FilePath, hash)
+			unlock()
+			if !shared {
+				os.Remove(bgMusic)
 			}
-
-			mergedAudio, err := mergeAudio(audioPath, bgMusic, book, chunk.Index, book.FilePath, hash)
 			if err != nil {
-				log.Printf("Audio merge failed: %v", err)
+				logWithRequestID(requestID, "Audio merge failed: %v", err)
 				continue
 			}
 
-			// Update the chunk's audio path
-			chunk.AudioPath = mergedAudio
+			// AudioPath keeps the MP3 narration that chunk merges concatenate; the music
+			// mix, in the book's output format, is the page's final audio
+			chunk.AudioPath = audioPath
+			chunk.FinalAudioPath = mergedAudio
+			chunk.NarratedBy = narratedBy
+			chunk.WordTimings = encodeWordTimings(narration.Timings)
 			chunk.TTSStatus = "completed"
+			chunk.DurationSeconds = measureDuration(mergedAudio)
 			db.Save(&chunk)
+			if chunk.DurationSeconds != nil {
+				recordPageUsage(book.ID, book.UserID, *chunk.DurationSeconds)
+			}
+			if err := recordAudioArtifact(book.ID, artifactPageFinal, chunk.Index, chunk.Index, mergedAudio); err != nil {
+				logWithRequestID(requestID, "⚠️ Failed to record final audio of chunk %d: %v", chunk.ID, err)
+			}
+			publishChunkCompleted(book.UserID, chunk)
 		}
 
 		// Final status check
 		var remaining int64
 		db.Model(&BookChunk{}).Where("book_id = ? AND tts_status != ?", bookID, "completed").Count(&remaining)
 		if remaining == 0 {
-			db.Model(&Book{}).Where("id = ?", bookID).Update("status", "completed")
-			log.Printf("✅ Book %s fully transcribed", bookID)
+			logWithRequestID(requestID, "✅ Book %s fully transcribed", bookID)
+
+			var book Book
+			if err := db.First(&book, bookID).Error; err == nil {
+				if !isBookFinished(book.Status) {
+					updateBookStatus(book.ID, bookStatusCompleted)
+				}
+				recordBookUsage(book.ID, book.UserID, bookAudioSeconds(book.ID))
+			}
 		}
 	}()
 
@@ -646,34 +1046,54 @@ func getSingleBookHandler(c *gin.Context) {
 	bookID := c.Param("book_id")
 
 	if bookID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book ID is required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book ID is required", nil)
 		return
 	}
 
 	var book Book
 	if err := db.First(&book, bookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
 		return
 	}
 
 	// add full book data response
 	bookResponse := BookResponse{
-		ID:          book.ID,
-		Title:       book.Title,
-		Author:      book.Author,
-		Category:    book.Category,
-		Content:     book.Content,
-		ContentHash: book.ContentHash,
-		Genre:       book.Genre,
-		FilePath:    book.FilePath,
-		AudioPath:   book.AudioPath,
-		Status:      book.Status,
+		ID:                    book.ID,
+		Title:                 book.Title,
+		Author:                book.Author,
+		Category:              book.Category,
+		Content:               book.Content,
+		ContentHash:           book.ContentHash,
+		Genre:                 book.Genre,
+		FilePath:              book.FilePath,
+		OriginalFilename:      book.OriginalFilename,
+		FileSizeBytes:         book.FileSizeBytes,
+		ContentTruncated:      book.ContentTruncated,
+		AudioPath:             book.AudioPath,
+		Status:                string(book.Status),
+		Public:                book.Public,
+		TTSProvider:           book.TTSProvider,
+		NarratedBy:            book.NarratedBy,
+		ReusedFromBookID:      book.ReusedFromBookID,
+		MultiVoice:            book.MultiVoice,
+		Voice:                 voiceOrDefault(book.Voice),
+		Speed:                 floatOrDefault(book.Speed, defaultSpeechSpeed),
+		EnableSoundEffects:    boolOrDefault(book.EnableSoundEffects, true),
+		EnableBackgroundMusic: boolOrDefault(book.EnableBackgroundMusic, true),
+		UniqueMusic:           book.UniqueMusic,
+		PlainNarration:        boolOrDefault(book.PlainNarration, plainNarrationFallbackEnabled()),
+		MusicVolume:           floatOrDefault(book.MusicVolume, defaultMusicVolume),
+		EffectsVolume:         floatOrDefault(book.EffectsVolume, defaultEffectsVolume),
+		CrossfadeMs:           book.CrossfadeMs,
+		Language:              book.Language,
+		TargetLanguage:        book.TargetLanguage,
+		OutputFormat:          outputFormatOrDefault(book.OutputFormat),
+		ModerationCategories:  bookModerationCategories(book),
 	}
-
-	streamHost := getEnv("STREAM_HOST", "http://100.110.176.220:8083")
-	if streamHost == "" {
-		streamHost = "http://100.110.176.220:8083"
+	if p, ok := playbackPositions(getUserIDFromContext(c), []uint{book.ID})[book.ID]; ok {
+		bookResponse.PositionSeconds = &p
 	}
+	bookResponse.Favorite = favoriteSet(getUserIDFromContext(c), []uint{book.ID})[book.ID]
 
 	c.JSON(http.StatusOK, gin.H{
 		"book": bookResponse,
@@ -681,6 +1101,18 @@ func getSingleBookHandler(c *gin.Context) {
 
 }
 
+// defaultStreamHost is the base URL of audio and cover links when STREAM_HOST is unset.
+const defaultStreamHost = "http://100.110.176.220:8083"
+
+// streamHost returns the base URL clients stream audio and fetch covers from
+// (STREAM_HOST). Build every client-facing link with it so they all agree.
+func streamHost() string {
+	if host := getEnv("STREAM_HOST", ""); host != "" {
+		return host
+	}
+	return defaultStreamHost
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// freshShutdownState gives the test its own worker channels and background context, so
+// shutting down does not stop work for the tests that run after it.
+func freshShutdownState(t *testing.T) {
+	t.Helper()
+	savedStop, savedDone := workerStop, workerDone
+	savedCtx, savedCancel := backgroundCtx, cancelBackgroundWork
+	workerStop, workerDone = make(chan struct{}), make(chan struct{})
+	backgroundCtx, cancelBackgroundWork = context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancelBackgroundWork()
+		workerStop, workerDone = savedStop, savedDone
+		backgroundCtx, cancelBackgroundWork = savedCtx, savedCancel
+		inFlightJobID.Store(0)
+	})
+}
+
+func TestGracefulShutdownWaitsForJob(t *testing.T) {
+	freshShutdownState(t)
+	mockDB(t)
+	// The worker finishes its job once asked to stop
+	go func() {
+		<-workerStop
+		close(workerDone)
+	}()
+
+	if err := gracefulShutdown(&http.Server{}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if backgroundCtx.Err() == nil {
+		t.Error("background work was not cancelled")
+	}
+}
+
+func TestGracefulShutdownRequeuesInFlightJob(t *testing.T) {
+	freshShutdownState(t)
+	mock := mockDB(t)
+	// The worker is stuck in job 4 past the deadline, so the job goes back in the queue
+	inFlightJobID.Store(4)
+	expectWrite(mock, `UPDATE "tts_queue_jobs" SET "attempts"=attempts - 1,"status"=\$1,"updated_at"=\$2 WHERE id = \$3 AND status = \$4`).
+		WithArgs("queued", sqlmock.AnyArg(), uint(4), "processing").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := gracefulShutdown(&http.Server{}, 50*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the drain to time out", err)
+	}
+	if backgroundCtx.Err() == nil {
+		t.Error("background work was not cancelled, so the stuck job keeps running")
+	}
+}
+
+func TestListBookPagesDurations(t *testing.T) {
+	fakeValidAudio(t)
+	unmeasured := filepath.Join(t.TempDir(), "audio_11.mp3")
+	if err := os.WriteFile(unmeasured, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "status"}).AddRow(3, 7, "Tales", bookStatusProcessing))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 ORDER BY "index" ASC LIMIT \$2`).
+		WithArgs("3", 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "content", "tts_status", "audio_path", "duration_seconds"}).
+			AddRow(10, 3, 0, "One.", "completed", "", 12.5).
+			AddRow(11, 3, 1, "Two.", "completed", unmeasured, nil).
+			AddRow(12, 3, 2, "Three.", "pending", "", nil).
+			AddRow(13, 3, 3, "Four.", "failed", unmeasured, 3.0))
+	// A page narrated before durations were stored is measured once and saved
+	expectWrite(mock, `UPDATE "book_chunks" SET "duration_seconds"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+		WithArgs(4.5, sqlmock.AnyArg(), uint(11)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "book_chunks" WHERE book_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/chunks/pages", listBookPagesHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/chunks/pages", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		TotalDuration  float64 `json:"total_duration"`
+		FullyProcessed bool    `json:"fully_processed"`
+		Pages          []struct {
+			Page     int `json:"page"`
+			Duration any `json:"duration_seconds"`
+		} `json:"pages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	// Only completed pages have a duration
+	want := []any{12.5, 4.5, nil, nil}
+	if len(body.Pages) != len(want) {
+		t.Fatalf("%d pages, want %d", len(body.Pages), len(want))
+	}
+	for i, p := range body.Pages {
+		if p.Duration != want[i] {
+			t.Errorf("page %d duration = %v, want %v", p.Page, p.Duration, want[i])
+		}
+	}
+	if body.TotalDuration != 17 || body.FullyProcessed {
+		t.Errorf("total_duration = %v, fully_processed = %v, want 17 and false", body.TotalDuration, body.FullyProcessed)
+	}
+}
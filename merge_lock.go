@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// bookMergeLock serializes the merges of one book. sem holds one token while a merge
+// runs; refs counts holders and waiters so the entry can be dropped once nobody needs it.
+type bookMergeLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// bookMergeLocks keeps page mixes and chunk-group merges of the same book from writing
+// its outputs at the same time.
+var (
+	bookMergeLocks   = map[uint]*bookMergeLock{}
+	bookMergeLocksMu sync.Mutex
+)
+
+// lockBookMerge waits until no other merge of the book is running and returns the func
+// that releases it. Overlapping merges queue rather than fail; a waiter gives up with
+// ctx's error when ctx ends first. The lock is not reentrant: code holding it must start
+// further merges in a goroutine.
+func lockBookMerge(ctx context.Context, bookID uint) (func(), error) {
+	bookMergeLocksMu.Lock()
+	lock, ok := bookMergeLocks[bookID]
+	if !ok {
+		lock = &bookMergeLock{sem: make(chan struct{}, 1)}
+		bookMergeLocks[bookID] = lock
+	}
+	lock.refs++
+	bookMergeLocksMu.Unlock()
+
+	release := func() {
+		bookMergeLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(bookMergeLocks, bookID)
+		}
+		bookMergeLocksMu.Unlock()
+	}
+
+	select {
+	case lock.sem <- struct{}{}:
+	default:
+		log.Printf("⏳ Waiting for another merge of book %d to finish", bookID)
+		select {
+		case lock.sem <- struct{}{}:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		<-lock.sem
+		release()
+	}, nil
+}
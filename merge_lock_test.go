@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func mergeLockEntries() int {
+	bookMergeLocksMu.Lock()
+	defer bookMergeLocksMu.Unlock()
+	return len(bookMergeLocks)
+}
+
+func TestLockBookMergeSerializesOneBook(t *testing.T) {
+	var running, most atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := lockBookMerge(context.Background(), 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := running.Add(1)
+			for {
+				m := most.Load()
+				if n <= m || most.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			running.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if got := most.Load(); got != 1 {
+		t.Fatalf("%d merges of one book ran at once, want 1", got)
+	}
+	if n := mergeLockEntries(); n != 0 {
+		t.Fatalf("%d lock entries left after all merges finished", n)
+	}
+}
+
+func TestLockBookMergeOtherBooksDoNotWait(t *testing.T) {
+	unlock, err := lockBookMerge(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	other, err := lockBookMerge(ctx, 2)
+	if err != nil {
+		t.Fatalf("merge of another book waited: %v", err)
+	}
+	other()
+}
+
+func TestLockBookMergeGivesUpWhenContextEnds(t *testing.T) {
+	unlock, err := lockBookMerge(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := lockBookMerge(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waiting merge returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+	if n := mergeLockEntries(); n != 0 {
+		t.Fatalf("%d lock entries left after the waiter gave up", n)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// parseFFmpegProgress reads the key=value blocks ffmpeg writes with -progress and calls
+// onProgress with the percentage of totalSeconds encoded so far, and 100 at the end.
+// out_time_us and out_time_ms both carry microseconds.
+func parseFFmpegProgress(r io.Reader, totalSeconds float64, onProgress func(float64)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time_us", "out_time_ms":
+			us, err := strconv.ParseFloat(value, 64)
+			if err != nil || us < 0 || totalSeconds <= 0 {
+				continue
+			}
+			onProgress(math.Min(us/1e6/totalSeconds*100, 99.9))
+		case "progress":
+			if value == "end" {
+				onProgress(100)
+			}
+		}
+	}
+	// Drain so ffmpeg never blocks on a full pipe
+	io.Copy(io.Discard, r)
+}
+
+// PageMergeProgress is how far the mix of one page has got.
+type PageMergeProgress struct {
+	Stage   string  `json:"stage"` // music or effects
+	Percent float64 `json:"percent"`
+}
+
+// mergeProgress tracks pages being mixed, by book and page index. It lives in memory
+// because it only matters while this process is encoding.
+var (
+	mergeProgressMu sync.Mutex
+	mergeProgress   = map[uint]map[int]PageMergeProgress{}
+)
+
+// mergeProgressReporter returns an onProgress callback for one page and stage. Progress
+// streams are woken only when the whole percentage changes.
+func mergeProgressReporter(bookID uint, pageIndex int, stage string) func(float64) {
+	return func(pct float64) {
+		pct = math.Floor(pct)
+		mergeProgressMu.Lock()
+		if mergeProgress[bookID] == nil {
+			mergeProgress[bookID] = map[int]PageMergeProgress{}
+		}
+		prev, seen := mergeProgress[bookID][pageIndex]
+		changed := !seen || prev.Stage != stage || prev.Percent != pct
+		mergeProgress[bookID][pageIndex] = PageMergeProgress{Stage: stage, Percent: pct}
+		mergeProgressMu.Unlock()
+		if changed {
+			wakeBookSubscribers(bookID)
+		}
+	}
+}
+
+// clearMergeProgress forgets a page once its mix is finished or abandoned.
+func clearMergeProgress(bookID uint, pageIndex int) {
+	mergeProgressMu.Lock()
+	delete(mergeProgress[bookID], pageIndex)
+	if len(mergeProgress[bookID]) == 0 {
+		delete(mergeProgress, bookID)
+	}
+	mergeProgressMu.Unlock()
+	wakeBookSubscribers(bookID)
+}
+
+// mergeProgressFor returns the pages of a book being mixed, keyed by 1-based page number.
+func mergeProgressFor(bookID uint) map[int]PageMergeProgress {
+	mergeProgressMu.Lock()
+	defer mergeProgressMu.Unlock()
+	if len(mergeProgress[bookID]) == 0 {
+		return nil
+	}
+	pages := make(map[int]PageMergeProgress, len(mergeProgress[bookID]))
+	for idx, p := range mergeProgress[bookID] {
+		pages[idx+1] = p
+	}
+	return pages
+}
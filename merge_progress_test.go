@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFFmpegProgress(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   string
+		total float64
+		want  []float64
+	}{
+		{
+			"microsecond keys",
+			"out_time_us=5000000\nprogress=continue\nout_time_ms=10000000\nprogress=end\n",
+			20,
+			[]float64{25, 50, 100},
+		},
+		{
+			"capped below 100 until the end",
+			"out_time_us=30000000\nprogress=continue\n",
+			20,
+			[]float64{99.9},
+		},
+		{
+			"unknown length only reports the end",
+			"out_time_us=5000000\nprogress=end\n",
+			0,
+			[]float64{100},
+		},
+		{
+			"bad lines skipped",
+			"frame=1\nout_time_us=N/A\nout_time_us=-1\n  out_time_us=2000000  \nnoise\n",
+			4,
+			[]float64{50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			parseFFmpegProgress(strings.NewReader(tt.log), tt.total, func(p float64) { got = append(got, p) })
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("progress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAIModerationURL is the OpenAI moderation endpoint.
+const openAIModerationURL = "https://api.openai.com/v1/moderations"
+
+// moderationModel is the model used for content moderation.
+const moderationModel = "omni-moderation-latest"
+
+// moderationInputBytes and moderationInputsPerCall bound the size of one moderation request.
+const (
+	moderationInputBytes    = 8000
+	moderationInputsPerCall = 16
+)
+
+// ModerationResult records the outcome of a moderation check for audit.
+type ModerationResult struct {
+	ID         uint `gorm:"primaryKey"`
+	BookID     uint `gorm:"index"`
+	Model      string
+	Flagged    bool   // Flagged by the provider in any category
+	Rejected   bool   // Blocked under the configured policy
+	Categories string `gorm:"type:text"` // JSON list of flagged categories
+	CreatedAt  time.Time
+}
+
+// moderationEnabled reports whether book text is moderated before TTS (MODERATION_ENABLED,
+// default false).
+func moderationEnabled() bool {
+	return getEnv("MODERATION_ENABLED", "false") == "true"
+}
+
+// blockedModerationCategories is the policy: the categories that reject a book
+// (MODERATION_BLOCK_CATEGORIES, comma-separated). Empty means any flagged category rejects.
+func blockedModerationCategories() map[string]bool {
+	blocked := map[string]bool{}
+	for _, c := range strings.Split(getEnv("MODERATION_BLOCK_CATEGORIES", ""), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			blocked[c] = true
+		}
+	}
+	return blocked
+}
+
+// moderationResponse is the subset of the moderation API response we use.
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderateText checks text with the OpenAI moderation API and returns the sorted list of
+// categories flagged anywhere in it.
+func moderateText(text string) ([]string, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("OPENAI_API_KEY not set")
+	}
+
+	flagged := map[string]bool{}
+	pieces := splitTextIntoBatches(text, moderationInputBytes)
+	for start := 0; start < len(pieces); start += moderationInputsPerCall {
+		end := start + moderationInputsPerCall
+		if end > len(pieces) {
+			end = len(pieces)
+		}
+		body, _ := json.Marshal(map[string]interface{}{"model": moderationModel, "input": pieces[start:end]})
+		req, err := http.NewRequest("POST", openAIModerationURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("build moderation request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+
+		client := &http.Client{Timeout: 60 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("moderation request error: %w", err)
+		}
+		var modResp moderationResponse
+		if resp.StatusCode != http.StatusOK {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("moderation returned %d: %s", resp.StatusCode, b)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&modResp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode moderation response: %w", err)
+		}
+		for _, r := range modResp.Results {
+			for category, hit := range r.Categories {
+				if hit {
+					flagged[category] = true
+				}
+			}
+		}
+	}
+
+	categories := make([]string, 0, len(flagged))
+	for c := range flagged {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+// moderationRejects applies the policy to the flagged categories and returns the ones
+// that block the book.
+func moderationRejects(flagged []string, blocked map[string]bool) []string {
+	if len(blocked) == 0 {
+		return flagged
+	}
+	var hits []string
+	for _, c := range flagged {
+		if blocked[c] {
+			hits = append(hits, c)
+		}
+	}
+	return hits
+}
+
+// moderateBook checks a book's text, stores the result and reports whether the book is
+// rejected along with the blocking categories.
+func moderateBook(bookID uint, text string) (bool, []string, error) {
+	flagged, err := moderateText(text)
+	if err != nil {
+		return false, nil, err
+	}
+	rejects := moderationRejects(flagged, blockedModerationCategories())
+
+	encoded, _ := json.Marshal(flagged)
+	result := ModerationResult{
+		BookID:     bookID,
+		Model:      moderationModel,
+		Flagged:    len(flagged) > 0,
+		Rejected:   len(rejects) > 0,
+		Categories: string(encoded),
+	}
+	if err := db.Create(&result).Error; err != nil {
+		log.Printf("⚠️ Failed to store moderation result for book %d: %v", bookID, err)
+	}
+	return result.Rejected, rejects, nil
+}
+
+// saveBookModeration stores on a book the outcome of moderating its text at content hash
+// hash. A rejected book keeps the blocking categories and moves to "rejected"; a book
+// rejected for earlier text goes back to "pending" once its new text passes.
+func saveBookModeration(bookID uint, hash string, rejected bool, categories []string) {
+	updates := map[string]interface{}{"moderated_hash": hash, "moderation_categories": ""}
+	if rejected {
+		encoded, _ := json.Marshal(categories)
+		updates["moderation_categories"] = string(encoded)
+	}
+	if err := db.Model(&Book{}).Where("id = ?", bookID).Updates(updates).Error; err != nil {
+		log.Printf("⚠️ Failed to save moderation outcome for book %d: %v", bookID, err)
+	}
+	if rejected {
+		updateBookStatus(bookID, bookStatusRejected)
+	} else {
+		db.Model(&Book{}).Where("id = ? AND status = ?", bookID, bookStatusRejected).Update("status", bookStatusPending)
+	}
+}
+
+// bookModerationCategories returns the categories that got a book rejected, or nil.
+func bookModerationCategories(book Book) []string {
+	if book.ModerationCategories == "" {
+		return nil
+	}
+	var categories []string
+	if err := json.Unmarshal([]byte(book.ModerationCategories), &categories); err != nil {
+		log.Printf("⚠️ Bad moderation categories stored for book %d: %v", book.ID, err)
+	}
+	return categories
+}
+
+// checkBookModeration reports whether the moderation policy blocks a book's pages, with
+// the blocking categories. The pages are checked once per content hash, so an edit is
+// checked again; with moderation disabled nothing is blocked.
+func checkBookModeration(bookID uint) (bool, []string, error) {
+	if !moderationEnabled() {
+		return false, nil, nil
+	}
+	var book Book
+	if err := db.Select("id", "content_hash", "moderated_hash", "moderation_categories").First(&book, bookID).Error; err != nil {
+		return false, nil, err
+	}
+	hash := book.ContentHash
+	if hash == "" {
+		var err error
+		if hash, err = computeChunksHash(bookID); err != nil {
+			return false, nil, err
+		}
+	}
+	if book.ModeratedHash == hash {
+		categories := bookModerationCategories(book)
+		return len(categories) > 0, categories, nil
+	}
+
+	texts, err := loadChunkTexts(db.Where("book_id = ?", bookID).Order("\"index\" ASC"))
+	if err != nil {
+		return false, nil, err
+	}
+	rejected, categories, err := moderateBook(bookID, strings.Join(texts, "\n\n"))
+	if err != nil {
+		return false, nil, err
+	}
+	saveBookModeration(bookID, hash, rejected, categories)
+	if rejected {
+		log.Printf("🚫 Book ID %d rejected by moderation: %s", bookID, strings.Join(categories, ", "))
+	}
+	return rejected, categories, nil
+}
+
+// enforceBookModeration responds with an error and returns false when the book may not
+// be narrated under the moderation policy.
+func enforceBookModeration(c *gin.Context, bookID uint) bool {
+	rejected, categories, err := checkBookModeration(bookID)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, codeUpstreamError, "Content moderation failed", err.Error())
+		return false
+	}
+	if rejected {
+		respondError(c, http.StatusUnprocessableEntity, codeContentRejected, "Book was rejected by content moderation", gin.H{"categories": categories})
+		return false
+	}
+	return true
+}
@@ -35,8 +35,12 @@ func InitMQTT() {
 	log.Println("✅ MQTT connected to broker at", broker)
 }
 
-// PublishEvent publishes a JSON payload to the specified MQTT topic.
+// PublishEvent publishes a JSON payload to the specified MQTT topic. Events are dropped
+// until InitMQTT has run.
 func PublishEvent(topic string, payload []byte) {
+	if mqttClient == nil {
+		return
+	}
 	tok := mqttClient.Publish(topic, 1, false, payload)
 	tok.WaitTimeout(5 * time.Second)
 	if err := tok.Error(); err != nil {
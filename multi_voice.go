@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// narratorSpeaker is the speaker label GPT uses for non-dialogue text.
+const narratorSpeaker = "narrator"
+
+// SpeechSpan is one run of text attributed to a single speaker.
+type SpeechSpan struct {
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+// narratorVoice is the default OpenAI narration voice (NARRATOR_VOICE), also used for the
+// narrator in multi-voice books.
+func narratorVoice() string {
+	return getEnv("NARRATOR_VOICE", "alloy")
+}
+
+// characterVoices is the pool of OpenAI voices assigned to characters in order of
+// first appearance (CHARACTER_VOICES, comma-separated).
+func characterVoices() []string {
+	var voices []string
+	for _, v := range strings.Split(getEnv("CHARACTER_VOICES", "echo,fable,onyx,nova,shimmer"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			voices = append(voices, v)
+		}
+	}
+	return voices
+}
+
+// tagDialogue asks GPT to split text into narrator and character spans.
+func tagDialogue(text string, bookID uint) ([]SpeechSpan, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("OPENAI_API_KEY not set")
+	}
+
+	systemContent := `You label audiobook text by speaker.
+Split the text into consecutive spans in original order. Quoted dialogue gets the character's name
+as "speaker" (use a consistent short name); everything else uses "narrator".
+Do not change, drop or add any words.
+Output ONLY a JSON array of objects with keys "speaker" and "text".`
+
+	reqBody := ChatRequest{
+		Model: openAIModels.Chat,
+		Messages: []ChatMessage{
+			{Role: "system", Content: systemContent},
+			{Role: "user", Content: text},
+		},
+		Temperature: 0,
+		MaxTokens:   4000,
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", openAIChatURL, bytes.NewReader(bodyBytes))
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GPT dialogue call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GPT dialogue returned %d: %s", resp.StatusCode, b)
+	}
+
+	var chatResp ChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, fmt.Errorf("decode dialogue JSON: %w", err)
+	}
+	recordChatUsage(bookID, reqBody.Model, "dialogue", chatResp.Usage)
+	if len(chatResp.Choices) == 0 {
+		return nil, errors.New("no dialogue choices returned")
+	}
+
+	raw := strings.TrimSpace(chatResp.Choices[0].Message.Content)
+	if start := strings.Index(raw, "["); start >= 0 {
+		if end := strings.LastIndex(raw, "]"); end > start {
+			raw = raw[start : end+1]
+		}
+	}
+	var spans []SpeechSpan
+	if err := json.Unmarshal([]byte(raw), &spans); err != nil {
+		return nil, fmt.Errorf("invalid dialogue JSON: %w", err)
+	}
+
+	// Drop empty spans and normalise speaker labels
+	out := spans[:0]
+	for _, s := range spans {
+		s.Text = strings.TrimSpace(s.Text)
+		s.Speaker = strings.ToLower(strings.TrimSpace(s.Speaker))
+		if s.Speaker == "" {
+			s.Speaker = narratorSpeaker
+		}
+		if s.Text != "" {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("dialogue tagging returned no spans")
+	}
+	return out, nil
+}
+
+// assignVoices extends voiceMap with voices for any new speakers in spans and
+// reports whether the map changed. Existing assignments are never altered so re-runs
+// keep the same voices.
+func assignVoices(voiceMap map[string]string, spans []SpeechSpan) bool {
+	changed := false
+	if _, ok := voiceMap[narratorSpeaker]; !ok {
+		voiceMap[narratorSpeaker] = narratorVoice()
+		changed = true
+	}
+	pool := characterVoices()
+	for _, s := range spans {
+		if _, ok := voiceMap[s.Speaker]; ok {
+			continue
+		}
+		voice := voiceMap[narratorSpeaker]
+		if len(pool) > 0 {
+			// Characters are numbered by assignment order; the narrator entry is excluded
+			voice = pool[(len(voiceMap)-1)%len(pool)]
+		}
+		voiceMap[s.Speaker] = voice
+		changed = true
+	}
+	return changed
+}
+
+// convertTextToAudioMultiVoice narrates text with a different OpenAI voice per speaker
+// and concatenates the spans into narrationPath(name). The speaker→voice map is stored
+// on the book so later chunks and re-runs reuse it.
+func convertTextToAudioMultiVoice(text string, name string, book Book) (string, error) {
+	spans, err := tagDialogue(text, book.ID)
+	if err != nil {
+		return "", err
+	}
+
+	voiceMap := map[string]string{}
+	if book.VoiceMap != "" {
+		if err := json.Unmarshal([]byte(book.VoiceMap), &voiceMap); err != nil {
+			log.Printf("⚠️ Ignoring invalid voice map for book %d: %v", book.ID, err)
+			voiceMap = map[string]string{}
+		}
+	}
+	if assignVoices(voiceMap, spans) {
+		encoded, _ := json.Marshal(voiceMap)
+		if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("voice_map", string(encoded)).Error; err != nil {
+			log.Printf("⚠️ Failed to save voice map for book %d: %v", book.ID, err)
+		}
+	}
+
+	var spanFiles []string
+	defer func() {
+		for _, f := range spanFiles {
+			os.Remove(f)
+		}
+	}()
+	for i, span := range spans {
+		path := narrationPath(fmt.Sprintf("%s_span_%d", name, i))
+		instructions := "Read this as the audiobook narrator."
+		if span.Speaker != narratorSpeaker {
+			instructions = fmt.Sprintf("Read this line of dialogue in character as %s.", span.Speaker)
+		}
+		if err := synthesizeSpeech(span.Text, voiceMap[span.Speaker], instructions, path, floatOrDefault(book.Speed, defaultSpeechSpeed), book.ID); err != nil {
+			return "", fmt.Errorf("span %d (%s): %w", i, span.Speaker, err)
+		}
+		spanFiles = append(spanFiles, path)
+	}
+
+	out := narrationPath(name)
+	if err := concatAudioFiles(backgroundCtx, spanFiles, out); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// multiVoiceBook returns the book if multi-voice narration is enabled for it.
+func multiVoiceBook(bookID uint) (Book, bool) {
+	var book Book
+	if bookID == 0 {
+		return book, false
+	}
+	if err := db.Select("id", "multi_voice", "voice_map", "speed").First(&book, bookID).Error; err != nil {
+		return book, false
+	}
+	return book, book.MultiVoice
+}
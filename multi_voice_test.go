@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAssignVoices(t *testing.T) {
+	t.Setenv("NARRATOR_VOICE", "alloy")
+	t.Setenv("CHARACTER_VOICES", "echo, fable")
+	voiceMap := map[string]string{"tom": "onyx"}
+	spans := []SpeechSpan{{Speaker: "narrator"}, {Speaker: "mara"}, {Speaker: "tom"}, {Speaker: "ann"}, {Speaker: "mara"}}
+
+	if !assignVoices(voiceMap, spans) {
+		t.Fatal("assignVoices reported no change after adding speakers")
+	}
+	// Tom keeps his stored voice; new characters take the pool in order, wrapping around
+	want := map[string]string{"narrator": "alloy", "tom": "onyx", "mara": "fable", "ann": "echo"}
+	for speaker, voice := range want {
+		if voiceMap[speaker] != voice {
+			t.Errorf("%s voice = %q, want %q", speaker, voiceMap[speaker], voice)
+		}
+	}
+	if assignVoices(voiceMap, spans) {
+		t.Error("assignVoices reported a change for speakers that all have voices")
+	}
+}
+
+// dialogueExcerpt is a two-speaker excerpt and the spans GPT tags it with.
+const (
+	dialogueExcerpt = `"Run," said Mara. Tom laughed. "Why?"`
+	dialogueSpans   = `[{"speaker": "Mara ", "text": "Run,"}, {"speaker": "narrator", "text": "said Mara. Tom laughed."}, {"speaker": "tom", "text": "Why?"}, {"speaker": "tom", "text": " "}]`
+)
+
+// multiVoiceEnv stubs the OpenAI APIs for dialogue tagging and speech, and an ffmpeg that
+// concatenates the span files, so the narration reads back as one "voice: text" line per
+// span.
+func multiVoiceEnv(t *testing.T) {
+	t.Helper()
+	narrationEnv(t)
+	t.Setenv("NARRATOR_VOICE", "alloy")
+	t.Setenv("CHARACTER_VOICES", "echo,fable")
+	fakeFFmpeg(t, `eval out=\${$#}
+sed -n "s/^file '\(.*\)'\$/\1/p" "$out.list.txt" | while read -r f; do cat "$f"; echo; done > "$out"`)
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			json.NewEncoder(w).Encode(map[string]any{
+				"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "```json\n" + dialogueSpans + "\n```"}}},
+			})
+		case "/v1/audio/speech":
+			var payload TTSPayload
+			json.NewDecoder(r.Body).Decode(&payload)
+			fmt.Fprintf(w, "%s: %s", payload.Voice, payload.Input)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// expectSpanSpeech expects the language lookup and usage record of each of n spans
+// narrated for book 3.
+func expectSpanSpeech(mock sqlmock.Sqlmock, n int) {
+	for i := range n {
+		mock.ExpectQuery(`SELECT "id","language","target_language" FROM "books"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "language", "target_language"}).AddRow(3, "en", ""))
+		expectInsert(mock, `INSERT INTO "token_usages"`, i+1)
+	}
+}
+
+func TestMultiVoiceTwoSpeakers(t *testing.T) {
+	multiVoiceEnv(t)
+	mock := mockDB(t)
+	// The new speakers' voices are stored on the book
+	expectWrite(mock, `UPDATE "books" SET "voice_map"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+		WithArgs(`{"mara":"echo","narrator":"alloy","tom":"fable"}`, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectSpanSpeech(mock, 3)
+
+	path, err := convertTextToAudioMultiVoice(dialogueExcerpt, "audio_10", Book{ID: 3, MultiVoice: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "echo: Run,\nalloy: said Mara. Tom laughed.\nfable: Why?\n"; string(got) != want {
+		t.Errorf("narration = %q, want %q", got, want)
+	}
+	// Only the concatenated narration is left behind
+	for i := range 3 {
+		if _, err := os.Stat(narrationPath(fmt.Sprintf("audio_10_span_%d", i))); !os.IsNotExist(err) {
+			t.Errorf("span %d file still exists (err = %v)", i, err)
+		}
+	}
+}
+
+func TestMultiVoiceReusesStoredVoices(t *testing.T) {
+	multiVoiceEnv(t)
+	mock := mockDB(t)
+	// Every speaker already has a voice, so the map is not written again
+	expectSpanSpeech(mock, 3)
+
+	book := Book{ID: 3, MultiVoice: true, VoiceMap: `{"mara":"nova","narrator":"sage","tom":"onyx"}`}
+	path, err := convertTextToAudioMultiVoice(dialogueExcerpt, "audio_10", book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "nova: Run,\nsage: said Mara. Tom laughed.\nonyx: Why?\n"; string(got) != want {
+		t.Errorf("narration = %q, want %q", got, want)
+	}
+}
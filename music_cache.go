@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// GenreMusicClip is a background-music bed shared by every book of a genre. Rows are
+// keyed by genre and prompt hash, so changing genreMusicPrompt produces fresh clips.
+type GenreMusicClip struct {
+	ID         uint   `gorm:"primaryKey"`
+	Genre      string `gorm:"size:64;not null;uniqueIndex:idx_genre_music_key"`
+	PromptHash string `gorm:"size:64;not null;uniqueIndex:idx_genre_music_key"`
+	Prompt     string `gorm:"type:text"`
+	Path       string `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+const musicCacheDir = "./audio/music_cache"
+
+// genreMusicLocks serializes clip generation per cache key so concurrent pages of
+// same-genre books pay for one ElevenLabs call.
+var (
+	genreMusicLocks   = map[string]*sync.Mutex{}
+	genreMusicLocksMu sync.Mutex
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// genreMusicCacheEnabled reports whether books with a genre share background music
+// (GENRE_MUSIC_CACHE_ENABLED, default false).
+func genreMusicCacheEnabled() bool {
+	return getEnv("GENRE_MUSIC_CACHE_ENABLED", "false") == "true"
+}
+
+// genreMusicPrompt is the ElevenLabs prompt for a genre's shared music bed.
+func genreMusicPrompt(genre string) string {
+	return fmt.Sprintf("Instrumental background music for a %s audiobook, subtle and unobtrusive under narration, seamless loop, no vocals.", genre)
+}
+
+// backgroundMusicFor returns a background clip for book. Books with a genre share a
+// cached clip unless they set UniqueMusic or the cache is disabled; shared clips must
+// not be removed by the caller.
+func backgroundMusicFor(book Book) (path string, shared bool, err error) {
+	if genreMusicCacheEnabled() && strings.TrimSpace(book.Genre) != "" && !book.UniqueMusic {
+		path, err := cachedGenreMusic(book.Genre)
+		return path, err == nil, err
+	}
+	prompt, err := generateOverallSoundPrompt(book.FilePath, book.ID)
+	if err != nil {
+		return "", false, fmt.Errorf("music prompt: %w", err)
+	}
+	path, err = generateSoundEffect(prompt)
+	return path, false, err
+}
+
+// cachedGenreMusic returns the shared clip for genre, generating and recording it on
+// first use.
+func cachedGenreMusic(genre string) (string, error) {
+	genre = strings.ToLower(strings.TrimSpace(genre))
+	prompt := genreMusicPrompt(genre)
+	hash := effectPromptKey(prompt)
+	key := genre + ":" + hash
+
+	genreMusicLocksMu.Lock()
+	lock, ok := genreMusicLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		genreMusicLocks[key] = lock
+	}
+	genreMusicLocksMu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	var clip GenreMusicClip
+	if err := db.Where("genre = ? AND prompt_hash = ?", genre, hash).First(&clip).Error; err == nil && fileExists(clip.Path) {
+		log.Printf("🎼 Reusing %s background music: %s", genre, clip.Path)
+		return clip.Path, nil
+	}
+
+	generated, err := generateSoundEffect(prompt)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(musicCacheDir, 0755); err != nil {
+		os.Remove(generated)
+		return "", err
+	}
+	path := fmt.Sprintf("%s/%s_%s.mp3", musicCacheDir, strings.Trim(nonSlugChars.ReplaceAllString(genre, "_"), "_"), hash)
+	if err := os.Rename(generated, path); err != nil {
+		os.Remove(generated)
+		return "", fmt.Errorf("store genre music: %w", err)
+	}
+
+	clip = GenreMusicClip{Genre: genre, PromptHash: hash, Prompt: prompt, Path: path}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "genre"}, {Name: "prompt_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"path", "updated_at"}),
+	}).Create(&clip).Error
+	if err != nil {
+		log.Printf("⚠️ Failed to record %s background music: %v", genre, err)
+	}
+	log.Printf("🎼 Cached new %s background music: %s", genre, path)
+	return path, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql/driver"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectGenreClip expects the cache lookup for genre, returning the clip at path or no
+// row when path is empty.
+func expectGenreClip(mock sqlmock.Sqlmock, genre, path string) {
+	hash := effectPromptKey(genreMusicPrompt(genre))
+	rows := sqlmock.NewRows([]string{"id", "genre", "prompt_hash", "path"})
+	if path != "" {
+		rows.AddRow(1, genre, hash, path)
+	}
+	mock.ExpectQuery(`SELECT \* FROM "genre_music_clips" WHERE genre = \$1 AND prompt_hash = \$2`).
+		WithArgs(genre, hash, 1).
+		WillReturnRows(rows)
+}
+
+// expectGenreClipSaved expects a newly generated clip for genre to be recorded and
+// captures the path it was stored at.
+func expectGenreClipSaved(mock sqlmock.Sqlmock, genre string, path *driver.Value) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "genre_music_clips" \("genre","prompt_hash","prompt","path","created_at","updated_at"\) .* ON CONFLICT \("genre","prompt_hash"\) DO UPDATE SET "path"="excluded"."path"`).
+		WithArgs(genre, effectPromptKey(genreMusicPrompt(genre)), genreMusicPrompt(genre), recordArg{path}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+}
+
+func TestSameGenreBooksReuseCachedMusic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("GENRE_MUSIC_CACHE_ENABLED", "true")
+	t.Setenv("XI_API_KEY", "xi-test")
+	fakeValidAudio(t)
+	var calls atomic.Int32
+	soundEffectsAPI(t, &calls)
+	mock := mockDB(t)
+
+	var saved driver.Value
+	expectGenreClip(mock, "mystery", "")
+	expectGenreClipSaved(mock, "mystery", &saved)
+	first, shared, err := backgroundMusicFor(Book{ID: 3, Genre: "Mystery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !shared || first != saved || !strings.HasPrefix(first, musicCacheDir+"/mystery_") {
+		t.Fatalf("first book got %s (shared %v), want a shared clip under %s recorded as %v", first, shared, musicCacheDir, saved)
+	}
+
+	// Another book of the genre, spelled differently, finds the recorded clip
+	expectGenreClip(mock, "mystery", first)
+	second, shared, err := backgroundMusicFor(Book{ID: 4, Genre: " mystery "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first || !shared {
+		t.Fatalf("second book got %s (shared %v), want the cached %s", second, shared, first)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("%d music generations for two books of one genre, want 1", n)
+	}
+	if got, err := os.ReadFile(first); err != nil || string(got) != genreMusicPrompt("mystery") {
+		t.Fatalf("cached clip = %q (%v), want the generated music", got, err)
+	}
+}
+
+func TestGenreMusicRegeneratedWhenFileMissing(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XI_API_KEY", "xi-test")
+	fakeValidAudio(t)
+	var calls atomic.Int32
+	soundEffectsAPI(t, &calls)
+	mock := mockDB(t)
+
+	// The row outlived its file, so the clip is generated again and the row repointed
+	var saved driver.Value
+	expectGenreClip(mock, "horror", musicCacheDir+"/deleted.mp3")
+	expectGenreClipSaved(mock, "horror", &saved)
+	path, err := cachedGenreMusic("Horror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 1 || path != saved || !fileExists(path) {
+		t.Fatalf("got %s after %d generations, want a fresh clip recorded as %v", path, calls.Load(), saved)
+	}
+}
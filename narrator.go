@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values for Book.TTSProvider.
+const (
+	ttsProviderOpenAI     = "openai"
+	ttsProviderElevenLabs = "elevenlabs"
+)
+
+// allowedTTSProviders lists the narration providers a book may select.
+var allowedTTSProviders = []string{ttsProviderOpenAI, ttsProviderElevenLabs}
+
+// elevenLabsTTSURL is the ElevenLabs narration endpoint; %s is the voice ID. The
+// with-timestamps variant returns base64 audio plus character alignment.
+const elevenLabsTTSURL = "https://api.elevenlabs.io/v1/text-to-speech/%s/with-timestamps?output_format=mp3_44100_128"
+
+// elevenLabsTTSModel is the ElevenLabs model used for narration.
+const elevenLabsTTSModel = "eleven_multilingual_v2"
+
+// Narrator turns text into an MP3 file and returns its path.
+// name is the output file's base name (see narrationPath) and bookID attributes usage
+// to a book.
+type Narrator interface {
+	Name() string
+	Narrate(text string, name string, bookID uint) (string, error)
+}
+
+// timedNarrator is implemented by narrators that can also report word timings.
+type timedNarrator interface {
+	NarrateWithTimings(text string, name string, bookID uint) (string, []WordTiming, error)
+}
+
+// narrationPath is where narration named name is written.
+func narrationPath(name string) string {
+	return fmt.Sprintf("./audio/%s.mp3", name)
+}
+
+// chunkNarrationName names the narration of one page.
+func chunkNarrationName(chunkID uint) string {
+	return fmt.Sprintf("audio_%d", chunkID)
+}
+
+// bookNarrationName names the whole-book narration. It has its own prefix because book
+// and chunk IDs overlap.
+func bookNarrationName(bookID uint) string {
+	return fmt.Sprintf("book_%d_narration", bookID)
+}
+
+// Narration is the result of narrateWithFallback.
+type Narration struct {
+	Path     string
+	Provider string       // Provider that produced Path
+	Timings  []WordTiming // Word timings when the provider supplies them, otherwise nil
+}
+
+// openAINarrator narrates through GPT-generated SSML and OpenAI TTS.
+type openAINarrator struct{}
+
+func (openAINarrator) Name() string { return ttsProviderOpenAI }
+
+func (openAINarrator) Narrate(text string, name string, bookID uint) (string, error) {
+	if book, ok := multiVoiceBook(bookID); ok {
+		path, err := convertTextToAudioMultiVoice(text, name, book)
+		if err == nil {
+			return path, nil
+		}
+		log.Printf("⚠️ Multi-voice narration failed for book %d, using single voice: %v", bookID, err)
+	}
+	return convertTextToAudio(text, name, bookID)
+}
+
+// elevenLabsNarrator narrates plain text with an ElevenLabs voice.
+type elevenLabsNarrator struct{}
+
+func (elevenLabsNarrator) Name() string { return ttsProviderElevenLabs }
+
+func (elevenLabsNarrator) Narrate(text string, name string, bookID uint) (string, error) {
+	path, _, err := convertTextToAudioElevenLabs(text, name, bookID)
+	return path, err
+}
+
+func (elevenLabsNarrator) NarrateWithTimings(text string, name string, bookID uint) (string, []WordTiming, error) {
+	return convertTextToAudioElevenLabs(text, name, bookID)
+}
+
+// isValidTTSProvider reports whether p is a supported provider ("" means the default).
+func isValidTTSProvider(p string) bool {
+	if p == "" {
+		return true
+	}
+	for _, allowed := range allowedTTSProviders {
+		if strings.EqualFold(p, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// narratorFor returns the Narrator for a provider name, defaulting to OpenAI.
+func narratorFor(provider string) Narrator {
+	switch strings.ToLower(provider) {
+	case ttsProviderElevenLabs:
+		return elevenLabsNarrator{}
+	default:
+		return openAINarrator{}
+	}
+}
+
+// bookTTSProvider looks up the provider selected on a book.
+func bookTTSProvider(bookID uint) string {
+	var book Book
+	if err := db.Select("id", "tts_provider").First(&book, bookID).Error; err != nil {
+		log.Printf("⚠️ Could not load TTS provider for book %d, using default: %v", bookID, err)
+	}
+	return narratorFor(book.TTSProvider).Name()
+}
+
+// narrationChain returns the providers to try: the primary first, then the providers
+// listed in TTS_FALLBACK_ORDER (comma-separated). Without TTS_FALLBACK_ORDER there is no fallback.
+func narrationChain(primary string) []Narrator {
+	chain := []Narrator{narratorFor(primary)}
+	seen := map[string]bool{chain[0].Name(): true}
+	for _, name := range strings.Split(getEnv("TTS_FALLBACK_ORDER", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] || !isValidTTSProvider(name) {
+			continue
+		}
+		seen[name] = true
+		chain = append(chain, narratorFor(name))
+	}
+	return chain
+}
+
+// narrateWithFallback narrates text with the primary provider, retrying it up to
+// TTS_MAX_ATTEMPTS times, then moves down the fallback chain. The Narration names the
+// provider that produced the audio and carries word timings if that provider has them.
+func narrateWithFallback(primary string, text string, name string, bookID uint) (Narration, error) {
+	attempts, err := strconv.Atoi(getEnv("TTS_MAX_ATTEMPTS", "2"))
+	if err != nil || attempts < 1 {
+		attempts = 2
+	}
+
+	var errs []error
+	for _, narrator := range narrationChain(primary) {
+		for attempt := 1; attempt <= attempts; attempt++ {
+			var result Narration
+			var err error
+			if timed, ok := narrator.(timedNarrator); ok {
+				result.Path, result.Timings, err = timed.NarrateWithTimings(text, name, bookID)
+			} else {
+				result.Path, err = narrator.Narrate(text, name, bookID)
+			}
+			if err == nil {
+				if narrator.Name() != narratorFor(primary).Name() {
+					log.Printf("🔀 Book %d narrated by fallback provider %s", bookID, narrator.Name())
+				}
+				result.Provider = narrator.Name()
+				if silenceTrimEnabled() {
+					// Word timings are measured from the start, so keep leading silence when present
+					if err := trimSilence(backgroundCtx, result.Path, len(result.Timings) == 0); err != nil {
+						log.Printf("⚠️ Could not trim silence from %s: %v", result.Path, err)
+					}
+				}
+				return result, nil
+			}
+			log.Printf("⚠️ %s TTS attempt %d/%d failed for book %d: %v", narrator.Name(), attempt, attempts, bookID, err)
+			errs = append(errs, fmt.Errorf("%s attempt %d: %w", narrator.Name(), attempt, err))
+			if attempt < attempts {
+				time.Sleep(time.Duration(attempt) * 2 * time.Second)
+			}
+		}
+	}
+	return Narration{}, errors.Join(errs...)
+}
+
+// convertTextToAudioElevenLabs narrates text with the ElevenLabs voice in
+// ELEVENLABS_VOICE_ID into narrationPath(name) and returns the word timings derived
+// from the character alignment.
+func convertTextToAudioElevenLabs(text string, name string, bookID uint) (string, []WordTiming, error) {
+	path := narrationPath(name)
+	timings, err := synthesizeSpeechElevenLabs(text, path, bookID)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, timings, nil
+}
+
+// synthesizeSpeechElevenLabs narrates text with the ElevenLabs voice in ELEVENLABS_VOICE_ID,
+// writes the MP3 to path and returns word timings when ElevenLabs supplies an alignment.
+func synthesizeSpeechElevenLabs(text, path string, bookID uint) ([]WordTiming, error) {
+	voiceID := os.Getenv("ELEVENLABS_VOICE_ID")
+	if voiceID == "" {
+		return nil, errors.New("ELEVENLABS_VOICE_ID not set")
+	}
+	apiKey := os.Getenv("XI_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("XI_API_KEY not set")
+	}
+
+	payload := map[string]string{"text": text, "model_id": elevenLabsTTSModel}
+	reqBody, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf(elevenLabsTTSURL, voiceID), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create ElevenLabs TTS request: %w", err)
+	}
+	req.Header.Set("xi-api-key", apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: ttsTimeout(len([]rune(text)))}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ElevenLabs TTS request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ElevenLabs TTS returned %d: %s", resp.StatusCode, body)
+	}
+
+	var timed elevenLabsTimedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&timed); err != nil {
+		return nil, fmt.Errorf("decode ElevenLabs TTS response: %w", err)
+	}
+	audio, err := base64.StdEncoding.DecodeString(timed.AudioBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode ElevenLabs audio: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, audio, 0644); err != nil {
+		return nil, fmt.Errorf("write audio: %w", err)
+	}
+	if err := validateAudioFile(path); err != nil {
+		return nil, fmt.Errorf("ElevenLabs TTS returned unusable audio: %w", err)
+	}
+	recordTTSUsage(bookID, elevenLabsTTSModel, len([]rune(text)))
+
+	var timings []WordTiming
+	if timed.Alignment != nil {
+		timings = wordTimingsFromAlignment(*timed.Alignment)
+	}
+	return timings, nil
+}
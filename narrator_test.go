@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// stubTransport answers outgoing requests with a handler instead of the network.
+type stubTransport struct{ handler http.Handler }
+
+func (s stubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	resp := w.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+// stubAPIs sends every outgoing HTTP request to handler for the rest of the test. The
+// handler sees the real URL, so it can tell OpenAI from ElevenLabs by r.URL.Host.
+func stubAPIs(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	orig := http.DefaultTransport
+	http.DefaultTransport = stubTransport{handler}
+	t.Cleanup(func() { http.DefaultTransport = orig })
+}
+
+// fakeValidAudio makes ffprobe accept any file as a 4.5 second audio track.
+func fakeValidAudio(t *testing.T) {
+	t.Helper()
+	fakeCommand(t, "ffprobe", `case "$*" in *codec_type*) echo audio ;; esac
+echo 4.500000`)
+}
+
+// narrationEnv configures both narration providers for a test that stubs their APIs.
+func narrationEnv(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	fakeValidAudio(t)
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("XI_API_KEY", "xi-test")
+	t.Setenv("ELEVENLABS_VOICE_ID", "voice-1")
+	t.Setenv("TRIM_SILENCE_ENABLED", "false")
+	t.Setenv("TTS_FALLBACK_ORDER", "")
+	t.Setenv("TTS_MAX_ATTEMPTS", "1")
+}
+
+// narrationAPI answers the OpenAI chat and speech endpoints and the ElevenLabs
+// narration endpoint with usable responses.
+func narrationAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Host + r.URL.Path {
+	case "api.openai.com/v1/chat/completions":
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "<speak>Once upon a time.</speak>"}}},
+		})
+	case "api.openai.com/v1/audio/speech":
+		io.WriteString(w, "openai mp3")
+	case "api.elevenlabs.io/v1/text-to-speech/voice-1/with-timestamps":
+		json.NewEncoder(w).Encode(elevenLabsTimedResponse{AudioBase64: base64.StdEncoding.EncodeToString([]byte("elevenlabs mp3"))})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestNarratorCallsSelectedProvider(t *testing.T) {
+	narrationEnv(t)
+	openAI := []string{"api.openai.com/v1/chat/completions", "api.openai.com/v1/audio/speech"}
+	tests := []struct {
+		provider string
+		want     []string
+	}{
+		{"", openAI},
+		{"openai", openAI},
+		{"ElevenLabs", []string{"api.elevenlabs.io/v1/text-to-speech/voice-1/with-timestamps"}},
+	}
+	for _, tt := range tests {
+		mock := mockDB(t)
+		if narratorFor(tt.provider).Name() == ttsProviderOpenAI {
+			// OpenAI narrates with the book's voice
+			mock.ExpectQuery(`SELECT "id","voice","speed" FROM "books"`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "voice", "speed"}).AddRow(0, "nova", nil))
+		}
+		var calls []string
+		var voice string
+		stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, r.URL.Host+r.URL.Path)
+			if r.URL.Path == "/v1/audio/speech" {
+				var payload TTSPayload
+				json.NewDecoder(r.Body).Decode(&payload)
+				voice = payload.Voice
+			}
+			narrationAPI(w, r)
+		})
+
+		got, err := narrateWithFallback(tt.provider, "Once upon a time.", "audio_1", 0)
+		if err != nil {
+			t.Fatalf("provider %q: %v", tt.provider, err)
+		}
+		if got.Provider != narratorFor(tt.provider).Name() || got.Path != narrationPath("audio_1") {
+			t.Errorf("provider %q: narration = %+v", tt.provider, got)
+		}
+		if len(calls) != len(tt.want) {
+			t.Fatalf("provider %q: calls = %v, want %v", tt.provider, calls, tt.want)
+		}
+		for i := range calls {
+			if calls[i] != tt.want[i] {
+				t.Errorf("provider %q: call %d = %s, want %s", tt.provider, i, calls[i], tt.want[i])
+			}
+		}
+		if narratorFor(tt.provider).Name() == ttsProviderOpenAI && voice != "nova" {
+			t.Errorf("provider %q: voice = %q, want the book's voice nova", tt.provider, voice)
+		}
+	}
+}
+
+func TestBookTTSProvider(t *testing.T) {
+	mock := mockDB(t)
+	query := `SELECT "id","tts_provider" FROM "books" WHERE "books"."id" = \$1`
+	mock.ExpectQuery(query).WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tts_provider"}).AddRow(3, "elevenlabs"))
+	mock.ExpectQuery(query).WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tts_provider"}).AddRow(4, ""))
+	mock.ExpectQuery(query).WithArgs(5, 1).WillReturnError(errors.New("connection reset"))
+
+	if got := bookTTSProvider(3); got != ttsProviderElevenLabs {
+		t.Errorf("book 3 provider = %q, want elevenlabs", got)
+	}
+	if got := bookTTSProvider(4); got != ttsProviderOpenAI {
+		t.Errorf("book without a provider = %q, want the openai default", got)
+	}
+	if got := bookTTSProvider(5); got != ttsProviderOpenAI {
+		t.Errorf("book that failed to load = %q, want the openai default", got)
+	}
+}
+
+func TestNarrationChain(t *testing.T) {
+	t.Setenv("TTS_FALLBACK_ORDER", " ElevenLabs, openai, polly,elevenlabs")
+	var names []string
+	for _, n := range narrationChain("openai") {
+		names = append(names, n.Name())
+	}
+	// The primary comes first; repeats and unknown providers are dropped
+	if len(names) != 2 || names[0] != ttsProviderOpenAI || names[1] != ttsProviderElevenLabs {
+		t.Errorf("chain = %v, want [openai elevenlabs]", names)
+	}
+
+	t.Setenv("TTS_FALLBACK_ORDER", "")
+	if chain := narrationChain("elevenlabs"); len(chain) != 1 {
+		t.Errorf("chain without TTS_FALLBACK_ORDER has %d narrators, want only the primary", len(chain))
+	}
+}
+
+func TestNarrateWithFallbackAfterPrimaryFails(t *testing.T) {
+	narrationEnv(t)
+	t.Setenv("TTS_FALLBACK_ORDER", "elevenlabs")
+	t.Setenv("TTS_MAX_ATTEMPTS", "2")
+	mock := mockDB(t)
+	for range 2 {
+		mock.ExpectQuery(`SELECT "id","voice","speed" FROM "books"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "voice", "speed"}).AddRow(0, "", nil))
+	}
+	calls := map[string]int{}
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Host]++
+		if r.URL.Path == "/v1/audio/speech" {
+			http.Error(w, `{"error": "server_error"}`, http.StatusInternalServerError)
+			return
+		}
+		narrationAPI(w, r)
+	})
+
+	got, err := narrateWithFallback(ttsProviderOpenAI, "Once upon a time.", "audio_1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Provider != ttsProviderElevenLabs {
+		t.Errorf("provider = %q, want the elevenlabs fallback", got.Provider)
+	}
+	// Both OpenAI attempts make an SSML and a speech call before ElevenLabs is tried once
+	if calls["api.openai.com"] != 4 || calls["api.elevenlabs.io"] != 1 {
+		t.Errorf("calls = %v, want 4 to OpenAI and 1 to ElevenLabs", calls)
+	}
+}
+
+func TestNarrateWithFallbackAllProvidersFail(t *testing.T) {
+	narrationEnv(t)
+	t.Setenv("TTS_FALLBACK_ORDER", "openai")
+	mockDB(t)
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	_, err := narrateWithFallback(ttsProviderElevenLabs, "Once upon a time.", "audio_1", 0)
+	if err == nil {
+		t.Fatal("narration succeeded with every provider down")
+	}
+	// The error names each provider that was tried
+	for _, provider := range []string{"elevenlabs attempt 1", "openai attempt 1"} {
+		if !strings.Contains(err.Error(), provider) {
+			t.Errorf("error %q does not mention %s", err, provider)
+		}
+	}
+}
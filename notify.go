@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres NOTIFY channels. tts_jobs carries "<job id>:<status>" whenever a job is
+// queued or changes status; book_status carries the book ID whenever the book's status
+// or one of its chunks' TTS status changes. Both are raised by triggers, so every code
+// path that writes these columns notifies.
+const (
+	jobsChannel       = "tts_jobs"
+	bookStatusChannel = "book_status"
+)
+
+// notifyTriggersSQL installs the triggers behind jobsChannel and bookStatusChannel.
+var notifyTriggersSQL = []string{
+	`CREATE OR REPLACE FUNCTION notify_tts_job() RETURNS trigger AS $$
+	BEGIN
+		PERFORM pg_notify('` + jobsChannel + `', NEW.id::text || ':' || COALESCE(NEW.status, ''));
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS tts_queue_jobs_notify ON tts_queue_jobs`,
+	`CREATE TRIGGER tts_queue_jobs_notify AFTER INSERT OR UPDATE OF status ON tts_queue_jobs
+		FOR EACH ROW EXECUTE FUNCTION notify_tts_job()`,
+
+	`CREATE OR REPLACE FUNCTION notify_book_status() RETURNS trigger AS $$
+	BEGIN
+		IF TG_TABLE_NAME = 'books' THEN
+			IF NEW.status IS DISTINCT FROM OLD.status THEN
+				PERFORM pg_notify('` + bookStatusChannel + `', NEW.id::text);
+			END IF;
+		ELSIF NEW.tts_status IS DISTINCT FROM OLD.tts_status THEN
+			PERFORM pg_notify('` + bookStatusChannel + `', NEW.book_id::text);
+		END IF;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS books_status_notify ON books`,
+	`CREATE TRIGGER books_status_notify AFTER UPDATE OF status ON books
+		FOR EACH ROW EXECUTE FUNCTION notify_book_status()`,
+	`DROP TRIGGER IF EXISTS book_chunks_status_notify ON book_chunks`,
+	`CREATE TRIGGER book_chunks_status_notify AFTER UPDATE OF tts_status ON book_chunks
+		FOR EACH ROW EXECUTE FUNCTION notify_book_status()`,
+}
+
+// ensureNotifyTriggers creates or refreshes the NOTIFY triggers. Failures only cost
+// latency, since the worker and progress streams keep polling.
+func ensureNotifyTriggers() {
+	for _, stmt := range notifyTriggersSQL {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("⚠️ Failed to install NOTIFY trigger, falling back to polling: %v", err)
+			return
+		}
+	}
+}
+
+// jobQueued is signalled (without blocking) when a job is queued, waking the worker.
+var jobQueued = make(chan struct{}, 1)
+
+// bookStatusSubs holds the progress streams waiting on each book.
+var (
+	bookStatusMu   sync.Mutex
+	bookStatusSubs = map[uint]map[chan struct{}]bool{}
+)
+
+// subscribeBookStatus returns a channel signalled when the book's status or chunk
+// progress changes, and a func that unsubscribes it.
+func subscribeBookStatus(bookID uint) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	bookStatusMu.Lock()
+	if bookStatusSubs[bookID] == nil {
+		bookStatusSubs[bookID] = map[chan struct{}]bool{}
+	}
+	bookStatusSubs[bookID][ch] = true
+	bookStatusMu.Unlock()
+
+	return ch, func() {
+		bookStatusMu.Lock()
+		delete(bookStatusSubs[bookID], ch)
+		if len(bookStatusSubs[bookID]) == 0 {
+			delete(bookStatusSubs, bookID)
+		}
+		bookStatusMu.Unlock()
+	}
+}
+
+// wake signals a listener without blocking if it already has a pending wake-up.
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchNotification routes one NOTIFY payload to the worker or progress streams.
+func dispatchNotification(channel, payload string) {
+	switch channel {
+	case jobsChannel:
+		if strings.HasSuffix(payload, ":queued") {
+			wake(jobQueued)
+		}
+	case bookStatusChannel:
+		id, err := strconv.ParseUint(payload, 10, 64)
+		if err != nil {
+			return
+		}
+		wakeBookSubscribers(uint(id))
+	}
+}
+
+// wakeBookSubscribers wakes every progress stream watching bookID.
+func wakeBookSubscribers(bookID uint) {
+	bookStatusMu.Lock()
+	for ch := range bookStatusSubs[bookID] {
+		wake(ch)
+	}
+	bookStatusMu.Unlock()
+}
+
+// startNotificationListener LISTENs on both channels on a dedicated connection until
+// background work is cancelled. A nil Notify from pq means the connection was re-established
+// and events may have been missed, so everyone is woken to re-check.
+func startNotificationListener(dsn string) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("⚠️ Postgres listener: %v", err)
+		}
+	})
+	for _, channel := range []string{jobsChannel, bookStatusChannel} {
+		if err := listener.Listen(channel); err != nil {
+			log.Printf("⚠️ LISTEN %s failed, relying on polling: %v", channel, err)
+			listener.Close()
+			return
+		}
+	}
+
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-backgroundCtx.Done():
+				return
+			case n := <-listener.Notify:
+				if n == nil {
+					wake(jobQueued)
+					bookStatusMu.Lock()
+					for _, subs := range bookStatusSubs {
+						for ch := range subs {
+							wake(ch)
+						}
+					}
+					bookStatusMu.Unlock()
+					continue
+				}
+				dispatchNotification(n.Channel, n.Extra)
+			}
+		}
+	}()
+	log.Printf("👂 Listening for %s and %s notifications", jobsChannel, bookStatusChannel)
+}
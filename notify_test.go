@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// drain empties a wake-up channel left signalled by an earlier test.
+func drain(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+	}
+}
+
+func TestQueuedJobNotificationWakesWorker(t *testing.T) {
+	drain(jobQueued)
+	t.Cleanup(func() { drain(jobQueued) })
+
+	// Status changes other than queueing leave the worker asleep
+	dispatchNotification(jobsChannel, "12:completed")
+	if len(jobQueued) != 0 {
+		t.Fatal("a completed job woke the worker")
+	}
+
+	woke := make(chan bool)
+	go func() { woke <- sleepOrStop(time.Hour) }()
+	dispatchNotification(jobsChannel, "12:queued")
+	// A second notification before the worker wakes must not block the listener
+	dispatchNotification(jobsChannel, "13:queued")
+	select {
+	case ok := <-woke:
+		if !ok {
+			t.Fatal("sleepOrStop reported a stop, want a wake-up")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker still sleeping after a job was queued")
+	}
+}
+
+func TestBookStatusNotificationWakesSubscribers(t *testing.T) {
+	first, unsubFirst := subscribeBookStatus(3)
+	second, unsubSecond := subscribeBookStatus(3)
+	other, unsubOther := subscribeBookStatus(4)
+	defer unsubOther()
+
+	dispatchNotification(bookStatusChannel, "not-a-book")
+	dispatchNotification(bookStatusChannel, "3")
+	dispatchNotification(bookStatusChannel, "3")
+	for i, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		default:
+			t.Fatalf("subscriber %d of book 3 not woken", i+1)
+		}
+		select {
+		case <-ch:
+			t.Fatalf("subscriber %d of book 3 woken twice, want repeated notifications coalesced", i+1)
+		default:
+		}
+	}
+	select {
+	case <-other:
+		t.Fatal("subscriber of book 4 woken by a book 3 notification")
+	default:
+	}
+
+	unsubFirst()
+	unsubSecond()
+	bookStatusMu.Lock()
+	defer bookStatusMu.Unlock()
+	if _, ok := bookStatusSubs[3]; ok {
+		t.Fatal("book 3 still tracked after its last subscriber left")
+	}
+}
+
+// awaitWake fails the test unless ch is signalled within a few seconds.
+func awaitWake(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no wake-up for %s", what)
+	}
+}
+
+// TestNotificationsFromPostgres checks the NOTIFY triggers and the listener against a
+// real database. It runs only when NOTIFY_TEST_DSN points at a disposable Postgres
+// database, e.g. "host=localhost user=postgres dbname=content_test sslmode=disable".
+func TestNotificationsFromPostgres(t *testing.T) {
+	dsn := os.Getenv("NOTIFY_TEST_DSN")
+	if dsn == "" {
+		t.Skip("NOTIFY_TEST_DSN not set")
+	}
+	// The listener stops with the test's background context
+	freshShutdownState(t)
+	gdb, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := db
+	db = gdb
+	t.Cleanup(func() {
+		db = saved
+		if conn, err := gdb.DB(); err == nil {
+			conn.Close()
+		}
+	})
+	if err := db.AutoMigrate(&Book{}, &BookChunk{}, &TTSQueueJob{}); err != nil {
+		t.Fatal(err)
+	}
+	ensureNotifyTriggers()
+	var triggers int64
+	db.Raw(`SELECT COUNT(*) FROM pg_trigger WHERE tgname IN ?`,
+		[]string{"tts_queue_jobs_notify", "books_status_notify", "book_chunks_status_notify"}).Scan(&triggers)
+	if triggers != 3 {
+		t.Fatalf("%d NOTIFY triggers installed, want 3", triggers)
+	}
+
+	book := Book{UserID: 7, Title: "Notification test", Status: bookStatusPending}
+	if err := db.Create(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("book_id = ?", book.ID).Delete(&TTSQueueJob{})
+		db.Unscoped().Delete(&book)
+	})
+	changed, unsubscribe := subscribeBookStatus(book.ID)
+	defer unsubscribe()
+	drain(jobQueued)
+	t.Cleanup(func() { drain(jobQueued) })
+	startNotificationListener(dsn)
+
+	job := TTSQueueJob{BookID: book.ID, UserID: 7, ChunkIDs: "1", Status: "queued"}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	awaitWake(t, jobQueued, "a queued job ("+jobsChannel+")")
+
+	if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("status", bookStatusProcessing).Error; err != nil {
+		t.Fatal(err)
+	}
+	awaitWake(t, changed, "a book status change ("+bookStatusChannel+")")
+
+	// Writing the status it already has is not a change
+	if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("status", bookStatusProcessing).Error; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("unchanged status notified subscribers")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec is the hand-maintained OpenAPI 3 description of the routes in main.go.
+// checkOpenAPIRoutes warns at startup when a route is added without documenting it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUIPage renders openAPISpec with Swagger UI loaded from a CDN.
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Content Service API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>`
+
+// openAPIHandler serves the OpenAPI document.
+func openAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// swaggerUIHandler serves the interactive API docs.
+func swaggerUIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+var ginParamPattern = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// checkOpenAPIRoutes logs every registered route missing from openAPISpec and every
+// documented operation without a route.
+func checkOpenAPIRoutes(routes gin.RoutesInfo) {
+	undocumented, unrouted, err := openAPIRouteDiff(routes)
+	if err != nil {
+		log.Printf("⚠️ openapi.json is not valid JSON: %v", err)
+		return
+	}
+	for _, r := range undocumented {
+		log.Printf("⚠️ %s is not documented in openapi.json", r)
+	}
+	for _, r := range unrouted {
+		log.Printf("⚠️ %s is documented in openapi.json but has no route", r)
+	}
+}
+
+// openAPIRouteDiff compares the registered routes with openAPISpec and returns the
+// routes missing from the spec and the spec operations without a route, each as
+// "METHOD /path" with gin's :params written as {params}. Static file routes and the docs
+// routes themselves are not expected in the spec.
+func openAPIRouteDiff(routes gin.RoutesInfo) ([]string, []string, error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, nil, err
+	}
+	var undocumented, unrouted []string
+	routed := map[string]bool{}
+	for _, r := range routes {
+		if r.Method == http.MethodHead || strings.Contains(r.Path, "*") || r.Path == "/openapi.json" || r.Path == "/docs" {
+			continue
+		}
+		path := ginParamPattern.ReplaceAllString(r.Path, "{$1}")
+		routed[r.Method+" "+path] = true
+		if _, ok := spec.Paths[path][strings.ToLower(r.Method)]; !ok {
+			undocumented = append(undocumented, r.Method+" "+path)
+		}
+	}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if op := strings.ToUpper(method) + " " + path; !routed[op] {
+				unrouted = append(unrouted, op)
+			}
+		}
+	}
+	sort.Strings(unrouted)
+	return undocumented, unrouted, nil
+}
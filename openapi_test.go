@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	undocumented, unrouted, err := openAPIRouteDiff(newRouter().Routes())
+	if err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	for _, r := range undocumented {
+		t.Errorf("route %s is missing from openapi.json", r)
+	}
+	for _, r := range unrouted {
+		t.Errorf("openapi.json documents %s but no route serves it", r)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// PlaybackPosition is where a user stopped listening to a book, so playback can resume
+// on any device.
+type PlaybackPosition struct {
+	ID              uint    `gorm:"primaryKey"`
+	UserID          uint    `gorm:"not null;uniqueIndex:idx_playback_user_book"`
+	BookID          uint    `gorm:"not null;uniqueIndex:idx_playback_user_book;index"`
+	PositionSeconds float64 `gorm:"not null"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// playbackBook loads the book for per-user listening state (positions, favorites); users
+// may track their own books and public ones.
+func playbackBook(c *gin.Context) (Book, bool) {
+	var book Book
+	if err := db.Select("id", "user_id", "public").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return book, false
+	}
+	if book.UserID != getUserIDFromContext(c) && !book.Public {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return book, false
+	}
+	return book, true
+}
+
+// savePlaybackPositionHandler stores the caller's position in a book.
+func savePlaybackPositionHandler(c *gin.Context) {
+	var req struct {
+		PositionSeconds *float64 `json:"position_seconds" binding:"required,gte=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "position_seconds must be a non-negative number", err.Error())
+		return
+	}
+	book, ok := playbackBook(c)
+	if !ok {
+		return
+	}
+
+	position := PlaybackPosition{UserID: getUserIDFromContext(c), BookID: book.ID, PositionSeconds: *req.PositionSeconds}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "book_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"position_seconds", "updated_at"}),
+	}).Create(&position).Error
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save position", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "position_seconds": position.PositionSeconds, "updated_at": position.UpdatedAt})
+}
+
+// getPlaybackPositionHandler returns the caller's position in a book; 0 if never saved.
+func getPlaybackPositionHandler(c *gin.Context) {
+	book, ok := playbackBook(c)
+	if !ok {
+		return
+	}
+
+	var positions []PlaybackPosition
+	if err := db.Where("user_id = ? AND book_id = ?", getUserIDFromContext(c), book.ID).Limit(1).Find(&positions).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch position", err.Error())
+		return
+	}
+	if len(positions) == 0 {
+		c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "position_seconds": 0, "updated_at": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "position_seconds": positions[0].PositionSeconds, "updated_at": positions[0].UpdatedAt})
+}
+
+// playbackPositions returns the user's saved positions for the given books in one query.
+func playbackPositions(userID uint, bookIDs []uint) map[uint]float64 {
+	positions := map[uint]float64{}
+	if len(bookIDs) == 0 {
+		return positions
+	}
+	var rows []PlaybackPosition
+	db.Select("book_id", "position_seconds").Where("user_id = ? AND book_id IN ?", userID, bookIDs).Find(&rows)
+	for _, r := range rows {
+		positions[r.BookID] = r.PositionSeconds
+	}
+	return positions
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectPlaybackBook expects playbackBook to load book 3, owned by ownerID.
+func expectPlaybackBook(mock sqlmock.Sqlmock, ownerID uint, public bool) {
+	mock.ExpectQuery(`SELECT "id","user_id","public" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "public"}).AddRow(3, ownerID, public))
+}
+
+// savePosition sends user 7's position in book 3 as the JSON body.
+func savePosition(body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/user/books/3/position", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	userRouter(7, http.MethodPut, "/user/books/:book_id/position", savePlaybackPositionHandler).ServeHTTP(w, req)
+	return w
+}
+
+func getPosition() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/position", getPlaybackPositionHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/position", nil))
+	return w
+}
+
+// positionOf decodes the position_seconds of a position response.
+func positionOf(t *testing.T, w *httptest.ResponseRecorder) float64 {
+	t.Helper()
+	var body struct {
+		BookID          uint    `json:"book_id"`
+		PositionSeconds float64 `json:"position_seconds"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.BookID != 3 {
+		t.Fatalf("book_id = %d, want 3", body.BookID)
+	}
+	return body.PositionSeconds
+}
+
+func TestSavePlaybackPositionUpserts(t *testing.T) {
+	mock := mockDB(t)
+	expectPlaybackBook(mock, 7, false)
+	// Saving again overwrites the user's row for the book instead of adding one
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "playback_positions" \("user_id","book_id","position_seconds","created_at","updated_at"\) .* ON CONFLICT \("user_id","book_id"\) DO UPDATE SET "position_seconds"="excluded"."position_seconds","updated_at"="excluded"."updated_at"`).
+		WithArgs(uint(7), uint(3), 84.5, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	w := savePosition(`{"position_seconds": 84.5}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if got := positionOf(t, w); got != 84.5 {
+		t.Fatalf("position_seconds = %v, want 84.5", got)
+	}
+}
+
+func TestSavePlaybackPositionValidates(t *testing.T) {
+	for _, body := range []string{`{}`, `{"position_seconds": -1}`, `{"position_seconds": "soon"}`} {
+		mockDB(t)
+		if w := savePosition(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestGetPlaybackPosition(t *testing.T) {
+	mock := mockDB(t)
+	expectPlaybackBook(mock, 7, false)
+	mock.ExpectQuery(`SELECT \* FROM "playback_positions" WHERE user_id = \$1 AND book_id = \$2 LIMIT \$3`).
+		WithArgs(uint(7), uint(3), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "book_id", "position_seconds", "updated_at"}).
+			AddRow(1, 7, 3, 84.5, time.Now()))
+
+	w := getPosition()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if got := positionOf(t, w); got != 84.5 {
+		t.Fatalf("position_seconds = %v, want 84.5", got)
+	}
+}
+
+func TestGetPlaybackPositionNeverSaved(t *testing.T) {
+	mock := mockDB(t)
+	// Other users may track their place in a public book
+	expectPlaybackBook(mock, 8, true)
+	mock.ExpectQuery(`SELECT \* FROM "playback_positions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := getPosition()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if got := positionOf(t, w); got != 0 {
+		t.Fatalf("position_seconds = %v, want 0", got)
+	}
+}
+
+func TestPlaybackPositionOfAnotherUsersPrivateBook(t *testing.T) {
+	mock := mockDB(t)
+	expectPlaybackBook(mock, 8, false)
+
+	if w := getPosition(); w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playlistEntry is one page of a book playlist. StartOffset is where the page begins in
+// the whole book; it is nil once an earlier page's duration is unknown.
+type playlistEntry struct {
+	Page            int      `json:"page"`
+	AudioURL        string   `json:"audio_url"`
+	DurationSeconds *float64 `json:"duration_seconds"`
+	StartOffset     *float64 `json:"start_offset"`
+}
+
+// getBookPlaylistHandler lists the finished page audio of one of the caller's books in
+// page order, with durations and cumulative start offsets, so clients can play the
+// pages back to back and seek across the whole book.
+func getBookPlaylistHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "status").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	var chunks []BookChunk
+	if err := db.Where("book_id = ?", book.ID).Order("\"index\" ASC").Find(&chunks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Could not retrieve book chunks", err.Error())
+		return
+	}
+
+	entries := make([]playlistEntry, 0, len(chunks))
+	offset, offsetKnown := 0.0, true
+	for _, chunk := range chunks {
+		// Only pages with a final mix can be streamed from the page audio endpoint
+		if chunk.FinalAudioPath == "" || !fileExists(chunk.FinalAudioPath) {
+			continue
+		}
+		entry := playlistEntry{
+			Page:            chunk.Index + 1,
+			AudioURL:        chunkAudioURL(book.ID, chunk.Index),
+			DurationSeconds: chunkDurationSeconds(&chunk),
+		}
+		if offsetKnown {
+			start := math.Round(offset*1000) / 1000
+			entry.StartOffset = &start
+		}
+		if entry.DurationSeconds != nil {
+			offset += *entry.DurationSeconds
+		} else {
+			offsetKnown = false
+		}
+		entries = append(entries, entry)
+	}
+
+	response := gin.H{
+		"book_id":     book.ID,
+		"status":      book.Status,
+		"total_pages": len(chunks),
+		"complete":    len(entries) == len(chunks) && len(chunks) > 0,
+		"entries":     entries,
+	}
+	if offsetKnown {
+		response["total_duration"] = math.Round(offset*1000) / 1000
+	}
+	c.JSON(http.StatusOK, response)
+}
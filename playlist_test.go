@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBookPlaylistOrderAndURLs(t *testing.T) {
+	t.Setenv("STREAM_HOST", "https://audio.example.com")
+	dir := t.TempDir()
+	final := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id","status" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusCompleted))
+	// Page 2 (index 1) has no final mix yet and is left out of the playlist
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 ORDER BY "index" ASC`).
+		WithArgs(uint(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "final_audio_path", "tts_status", "duration_seconds"}).
+			AddRow(10, 3, 0, final("p0.mp3"), "completed", 12.5).
+			AddRow(11, 3, 1, "", "processing", nil).
+			AddRow(12, 3, 2, final("p2.mp3"), "completed", 7.25))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/playlist", getBookPlaylistHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/playlist", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Complete bool            `json:"complete"`
+		Entries  []playlistEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		page  int
+		url   string
+		start float64
+	}{
+		{1, "https://audio.example.com/user/books/3/pages/0/audio", 0},
+		{3, "https://audio.example.com/user/books/3/pages/2/audio", 12.5},
+	}
+	if len(body.Entries) != len(want) || body.Complete {
+		t.Fatalf("playlist = %s, want pages 1 and 3, incomplete", w.Body)
+	}
+	for i, e := range body.Entries {
+		if e.Page != want[i].page || e.AudioURL != want[i].url || e.StartOffset == nil || *e.StartOffset != want[i].start {
+			t.Errorf("entry %d = page %d %s from %v, want page %d %s from %v", i, e.Page, e.AudioURL, e.StartOffset, want[i].page, want[i].url, want[i].start)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserPreference holds a user's defaults for new books. Empty and nil fields fall back
+// to the system defaults.
+type UserPreference struct {
+	ID                    uint      `gorm:"primaryKey" json:"-"`
+	UserID                uint      `gorm:"uniqueIndex" json:"-"`
+	Voice                 string    `gorm:"size:32" json:"voice"`
+	Speed                 *float64  `json:"speed"`
+	OutputFormat          string    `gorm:"size:8" json:"output_format"`
+	EnableSoundEffects    *bool     `json:"enable_sound_effects"`
+	EnableBackgroundMusic *bool     `json:"enable_background_music"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// UserPreferenceRequest is the body of PUT /user/preferences. It replaces all stored
+// defaults; omitted fields go back to the system defaults.
+type UserPreferenceRequest struct {
+	Voice                 string   `json:"voice"`
+	Speed                 *float64 `json:"speed" binding:"omitempty,gte=0.25,lte=4"`
+	OutputFormat          string   `json:"output_format"`
+	EnableSoundEffects    *bool    `json:"enable_sound_effects"`
+	EnableBackgroundMusic *bool    `json:"enable_background_music"`
+}
+
+// loadUserPreference returns the stored defaults of a user, or none.
+func loadUserPreference(userID uint) UserPreference {
+	var pref UserPreference
+	if userID == 0 {
+		return pref
+	}
+	db.Where("user_id = ?", userID).First(&pref)
+	return pref
+}
+
+// applyUserPreferences fills the fields a book request leaves out from the user's
+// defaults. Whatever is still empty gets the system default when the book is created.
+func applyUserPreferences(req *BookRequest, pref UserPreference) {
+	if req.Voice == "" {
+		req.Voice = pref.Voice
+	}
+	if req.Speed == nil {
+		req.Speed = pref.Speed
+	}
+	if req.OutputFormat == "" {
+		req.OutputFormat = pref.OutputFormat
+	}
+	if req.EnableSoundEffects == nil {
+		req.EnableSoundEffects = pref.EnableSoundEffects
+	}
+	if req.EnableBackgroundMusic == nil {
+		req.EnableBackgroundMusic = pref.EnableBackgroundMusic
+	}
+}
+
+// systemPreferenceDefaults describes what books get when neither the request nor the
+// user's preferences set a value.
+func systemPreferenceDefaults() gin.H {
+	return gin.H{
+		"voice":                   narratorVoice(),
+		"speed":                   defaultSpeechSpeed,
+		"output_format":           defaultOutputFormat,
+		"enable_sound_effects":    true,
+		"enable_background_music": true,
+	}
+}
+
+// getUserPreferencesHandler returns the caller's defaults for new books alongside the
+// system defaults they override.
+func getUserPreferencesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"preferences": loadUserPreference(getUserIDFromContext(c)),
+		"defaults":    systemPreferenceDefaults(),
+	})
+}
+
+// updateUserPreferencesHandler replaces the caller's defaults for new books. Existing
+// books keep their settings.
+func updateUserPreferencesHandler(c *gin.Context) {
+	var req UserPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid preferences", err.Error())
+		return
+	}
+	if !isValidVoice(req.Voice) {
+		respondError(c, http.StatusBadRequest, codeInvalidVoice, "Invalid voice", gin.H{"allowed_voices": allowedVoices})
+		return
+	}
+	outputFormat := strings.ToLower(req.OutputFormat)
+	if outputFormat != "" && !isValidOutputFormat(outputFormat) {
+		respondError(c, http.StatusBadRequest, codeInvalidOutputFormat, "Invalid output_format", gin.H{"allowed_output_formats": []string{"mp3", "opus", "aac"}})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	var pref UserPreference
+	if err := db.Where("user_id = ?", userID).First(&pref).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load preferences", err.Error())
+		return
+	}
+	pref.UserID = userID
+	pref.Voice = strings.ToLower(req.Voice)
+	pref.Speed = req.Speed
+	pref.OutputFormat = outputFormat
+	pref.EnableSoundEffects = req.EnableSoundEffects
+	pref.EnableBackgroundMusic = req.EnableBackgroundMusic
+	if err := db.Save(&pref).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save preferences", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preferences": pref, "defaults": systemPreferenceDefaults()})
+}
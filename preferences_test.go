@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestApplyUserPreferences(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	b := func(v bool) *bool { return &v }
+	pref := UserPreference{Voice: "nova", Speed: f(1.25), OutputFormat: "opus", EnableSoundEffects: b(false), EnableBackgroundMusic: b(false)}
+
+	tests := []struct {
+		name string
+		req  BookRequest
+		pref UserPreference
+		want BookRequest
+	}{
+		{
+			"request wins over preference",
+			BookRequest{Voice: "echo", Speed: f(0.75), OutputFormat: "aac", EnableSoundEffects: b(true), EnableBackgroundMusic: b(true)},
+			pref,
+			BookRequest{Voice: "echo", Speed: f(0.75), OutputFormat: "aac", EnableSoundEffects: b(true), EnableBackgroundMusic: b(true)},
+		},
+		{
+			"preference fills what the request leaves out",
+			BookRequest{},
+			pref,
+			BookRequest{Voice: "nova", Speed: f(1.25), OutputFormat: "opus", EnableSoundEffects: b(false), EnableBackgroundMusic: b(false)},
+		},
+		{
+			"explicit false in the request is kept",
+			BookRequest{EnableSoundEffects: b(false)},
+			UserPreference{EnableSoundEffects: b(true)},
+			BookRequest{EnableSoundEffects: b(false)},
+		},
+		{
+			"mixed",
+			BookRequest{Voice: "echo", EnableBackgroundMusic: b(true)},
+			pref,
+			BookRequest{Voice: "echo", Speed: f(1.25), OutputFormat: "opus", EnableSoundEffects: b(false), EnableBackgroundMusic: b(true)},
+		},
+		{
+			// Left empty so book creation applies the system defaults
+			"no preference",
+			BookRequest{OutputFormat: "mp3"},
+			UserPreference{},
+			BookRequest{OutputFormat: "mp3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			applyUserPreferences(&req, tt.pref)
+			if req.Voice != tt.want.Voice || req.OutputFormat != tt.want.OutputFormat {
+				t.Errorf("voice, format = %q, %q; want %q, %q", req.Voice, req.OutputFormat, tt.want.Voice, tt.want.OutputFormat)
+			}
+			if !equalPtr(req.Speed, tt.want.Speed) {
+				t.Errorf("speed = %v, want %v", deref(req.Speed), deref(tt.want.Speed))
+			}
+			if !equalPtr(req.EnableSoundEffects, tt.want.EnableSoundEffects) {
+				t.Errorf("enable_sound_effects = %v, want %v", deref(req.EnableSoundEffects), deref(tt.want.EnableSoundEffects))
+			}
+			if !equalPtr(req.EnableBackgroundMusic, tt.want.EnableBackgroundMusic) {
+				t.Errorf("enable_background_music = %v, want %v", deref(req.EnableBackgroundMusic), deref(tt.want.EnableBackgroundMusic))
+			}
+		})
+	}
+}
+
+// equalPtr reports whether two optional values are both unset or hold the same value.
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// deref formats an optional value for failure messages.
+func deref[T any](p *T) interface{} {
+	if p == nil {
+		return "<nil>"
+	}
+	return *p
+}
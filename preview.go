@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewMaxChars is roughly how much text a preview narrates.
+const previewMaxChars = 300
+
+// previewDir holds cached preview clips, named by content and voice hash.
+const previewDir = "./audio/previews"
+
+// previewText returns the start of text cut to at most limit characters, ending on a
+// word boundary where possible.
+func previewText(text string, limit int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= limit {
+		return string(runes)
+	}
+	cut := limit
+	for cut > limit/2 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut <= limit/2 {
+		cut = limit
+	}
+	return strings.TrimSpace(string(runes[:cut]))
+}
+
+// previewVoice identifies the voice a book's preview is narrated with.
+func previewVoice(provider string, book Book) string {
+	if provider == ttsProviderElevenLabs {
+		return os.Getenv("ELEVENLABS_VOICE_ID")
+	}
+	return voiceOrDefault(book.Voice)
+}
+
+// previewBookHandler narrates the first ~300 characters of a book with its provider and
+// voice and streams the clip. Clips are cached by content and voice, and the book's
+// status and audio are never touched.
+func previewBookHandler(c *gin.Context) {
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to preview this book", nil)
+		return
+	}
+
+	source := book.Content
+	var first BookChunk
+	if err := db.Where("book_id = ?", book.ID).Order("\"index\" ASC").First(&first).Error; err == nil && loadChunkContent(&first) == nil {
+		source = first.Content
+	}
+	text := previewText(source, previewMaxChars)
+	if text == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book has no text to preview yet", nil)
+		return
+	}
+
+	provider := narratorFor(book.TTSProvider).Name()
+	voice := previewVoice(provider, book)
+	speed := floatOrDefault(book.Speed, defaultSpeechSpeed)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%g\x00%s", provider, voice, speed, text)))
+	path := fmt.Sprintf("%s/preview_%s.mp3", previewDir, hex.EncodeToString(sum[:])[:32])
+
+	cached := fileExists(path)
+	if !cached {
+		if err := synthesizePreview(provider, text, voice, speed, path, book.ID); err != nil {
+			respondError(c, http.StatusBadGateway, codeUpstreamError, "Failed to synthesize preview", err.Error())
+			return
+		}
+	}
+
+	c.Header("X-Preview-Cached", fmt.Sprintf("%t", cached))
+	c.Header("Content-Type", "audio/mpeg")
+	serveAudioFile(c, path)
+}
+
+// synthesizePreview narrates a preview clip into a temp file and renames it to path, so a
+// concurrent request never serves a clip that is still being written.
+func synthesizePreview(provider, text, voice string, speed float64, path string, bookID uint) error {
+	if err := os.MkdirAll(previewDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(previewDir, "preview_*.partial.mp3")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if provider == ttsProviderElevenLabs {
+		_, err = synthesizeSpeechElevenLabs(text, tmp.Name(), bookID)
+	} else {
+		err = synthesizeSpeech(text, voice, "Read this as the audiobook narrator.", tmp.Name(), speed, bookID)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
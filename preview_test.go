@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestPreviewText(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"  short text \n", 300, "short text"},
+		{"hello world foo", 12, "hello world"},
+		{"hello world", 11, "hello world"},
+		{"abcdefghij", 4, "abcd"},
+		{"a bcdefghij", 6, "a bcde"},
+		{"héllo wörld", 8, "héllo"},
+	}
+	for _, tt := range tests {
+		if got := previewText(tt.text, tt.limit); got != tt.want {
+			t.Errorf("previewText(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
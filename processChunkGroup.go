@@ -9,9 +9,9 @@ import (
 // ProcessedChunkGroup maps a user-submitted group of TTS chunks to a reusable audio file.
 type ProcessedChunkGroup struct {
 	ID        uint   `gorm:"primaryKey"`
-	BookID    uint   `gorm:"index"`
-	StartIdx  int    `gorm:"not null"` // Inclusive
-	EndIdx    int    `gorm:"not null"` // Inclusive
+	BookID    uint   `gorm:"index;index:idx_chunk_groups_range,priority:1"`
+	StartIdx  int    `gorm:"not null;index:idx_chunk_groups_range,priority:2"` // Inclusive
+	EndIdx    int    `gorm:"not null;index:idx_chunk_groups_range,priority:3"` // Inclusive
 	AudioPath string `gorm:"not null"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -38,5 +38,3 @@ func saveProcessedChunkGroup(bookID uint, start, end int, path string) error {
 	}
 	return db.Create(&group).Error
 }
-
-
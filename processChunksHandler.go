@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,14 +16,14 @@ func ProcessChunksTTSHandler(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 	token, err := extractToken(authHeader)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Missing or invalid token", nil)
 		return
 	}
 
 	accountType, err := getUserAccountType(token)
 	if err != nil {
 		log.Printf("Error checking account type: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify account type"})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to verify account type", nil)
 		return
 	}
 
@@ -34,7 +36,7 @@ func ProcessChunksTTSHandler(c *gin.Context) {
 			Count(&completedChunks)
 
 		if completedChunks >= 1 {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Free trial limit reached. Upgrade your plan to continue transcribing."})
+			respondError(c, http.StatusForbidden, codeTrialLimitReached, "Free trial limit reached. Upgrade your plan to continue transcribing.", nil)
 			return
 		}
 	}
@@ -44,23 +46,42 @@ func ProcessChunksTTSHandler(c *gin.Context) {
 		Pages  []int `json:"pages"` // 1-based page numbers
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || len(req.Pages) == 0 || len(req.Pages) > 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "You must provide 1 or 2 pages to process"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "You must provide 1 or 2 pages to process", nil)
+		return
+	}
+
+	var book Book
+	if err := db.Select("id", "user_id").First(&book, req.BookID).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to process this book", nil)
+		return
+	}
+	if !enforceBookModeration(c, book.ID) {
 		return
 	}
 
 	// Convert pages (index + 1) to chunk indices for the specific book
 	var chunks []BookChunk
-	if err := db.Where("book_id = ? AND index IN ?", req.BookID, toZeroBasedIndexes(req.Pages)).
-		Order("index ASC").
-		Find(&chunks).Error; err != nil || len(chunks) != len(req.Pages) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page numbers for the given book_id"})
+	if err := db.Where("book_id = ? AND \"index\" IN ?", req.BookID, toZeroBasedIndexes(req.Pages)).
+		Order("\"index\" ASC").
+		Find(&chunks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load pages", err.Error())
+		return
+	}
+	if missing := missingPages(req.Pages, chunks); len(missing) > 0 {
+		first, last := bookPageRange(req.BookID)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Some pages do not exist in this book",
+			gin.H{"missing_pages": missing, "first_page": first, "last_page": last})
 		return
 	}
 
 	// Ensure no chunk has been processed yet
 	for _, ch := range chunks {
 		if ch.TTSStatus == "completed" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "One or more pages already processed"})
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "One or more pages already processed", nil)
 			return
 		}
 	}
@@ -70,13 +91,25 @@ func ProcessChunksTTSHandler(c *gin.Context) {
 	for _, chunk := range chunks {
 		pageIndex := chunk.Index + 1 // Convert to 1-based index for user-friendly messages
 		db.Model(&chunk).Update("TTSStatus", "processing")
-		audioPath, err := convertTextToAudio(chunk.Content, chunk.ID)
+		text, err := prepareChunkText(&chunk)
+		if err != nil {
+			log.Printf("translation failed for chunk %d: %v", chunk.ID, err)
+			db.Model(&chunk).Update("TTSStatus", "failed")
+			continue
+		}
+		started := time.Now()
+		narration, err := narrateWithFallback(bookTTSProvider(chunk.BookID), text, chunkNarrationName(chunk.ID), chunk.BookID)
 		if err != nil {
 			db.Model(&chunk).Update("TTSStatus", "failed")
 			continue
 		}
+		recordProcessingSample(chunk.BookID, text, 1, time.Since(started))
+		audioPath := narration.Path
 		chunk.AudioPath = audioPath
+		chunk.NarratedBy = narration.Provider
+		chunk.WordTimings = encodeWordTimings(narration.Timings)
 		chunk.TTSStatus = "completed"
+		chunk.DurationSeconds = measureDuration(audioPath)
 		db.Save(&chunk)
 		audioPaths = append(audioPaths, audioPath)
 
@@ -92,10 +125,15 @@ func ProcessChunksTTSHandler(c *gin.Context) {
 		}
 	}
 
-	// Attempt to merge (optional)
-	errs := processMergedChunks(req.BookID)
-	if err != nil {
-		log.Printf("merge processing failed: %v", errs)
+	// Attempt to merge (optional), but never build it with pages missing
+	if err := processMergedChunks(c.Request.Context(), req.BookID); err != nil {
+		log.Printf("merge processing failed: %v", err)
+		var unusable *unusableChunkAudioError
+		if errors.As(err, &unusable) {
+			respondError(c, http.StatusConflict, codeConflict, "Some completed pages have no usable audio to merge",
+				gin.H{"chunk_ids": unusable.ChunkIDs, "audio_paths": audioPaths})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -120,3 +158,33 @@ func extractIDs(chunks []BookChunk) []uint {
 	}
 	return ids
 }
+
+// missingPages returns the 1-based pages that have no chunk among found.
+func missingPages(pages []int, found []BookChunk) []int {
+	have := map[int]bool{}
+	for _, ch := range found {
+		have[ch.Index+1] = true
+	}
+	var missing []int
+	for _, p := range pages {
+		if !have[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// bookPageRange returns the first and last 1-based page of a book, or 0, 0 when it has
+// no pages.
+func bookPageRange(bookID uint) (int, int) {
+	var r struct {
+		First *int
+		Last  *int
+	}
+	db.Model(&BookChunk{}).Select("MIN(\"index\") + 1 AS first, MAX(\"index\") + 1 AS last").
+		Where("book_id = ?", bookID).Scan(&r)
+	if r.First == nil || r.Last == nil {
+		return 0, 0
+	}
+	return *r.First, *r.Last
+}
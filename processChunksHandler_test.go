@@ -0,0 +1,27 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMissingPages(t *testing.T) {
+	found := []BookChunk{{Index: 0}, {Index: 2}, {Index: 3}}
+	tests := []struct {
+		name  string
+		pages []int
+		want  []int
+	}{
+		{"all found", []int{1, 3, 4}, nil},
+		{"one missing", []int{1, 2, 3}, []int{2}},
+		{"past the last page", []int{4, 5, 9}, []int{5, 9}},
+		{"no pages", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingPages(tt.pages, found); !slices.Equal(got, tt.want) {
+				t.Errorf("missingPages(%v) = %v, want %v", tt.pages, got, tt.want)
+			}
+		})
+	}
+}
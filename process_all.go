@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// processAllChunksPerJob caps how many pages one queued job narrates, matching the default
+// limit of POST /chunks/audio-by-id. The worker narrates and completes each page of a job
+// (see processChunkIDsJob), so the book's progress moves as jobs finish.
+const processAllChunksPerJob = 10
+
+// processAllChunksHandler queues every unfinished page of a book as TTS jobs of up to
+// processAllChunksPerJob consecutive pages. Pages already in a queued or processing job
+// are skipped, so calling it again only queues what is missing.
+func processAllChunksHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if book.UserID != userID {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to process this book", nil)
+		return
+	}
+	if !enforceBookModeration(c, book.ID) {
+		return
+	}
+
+	var chunks []BookChunk
+	if err := db.Select("id", "index").
+		Where("book_id = ? AND (tts_status IS NULL OR tts_status <> ?)", book.ID, "completed").
+		Order("\"index\" ASC").
+		Find(&chunks).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch pages", err.Error())
+		return
+	}
+	if len(chunks) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "All pages are already processed", "jobs_created": 0})
+		return
+	}
+
+	var pending []TTSQueueJob
+	if err := db.Select("chunk_ids").Where("book_id = ? AND status IN ?", book.ID, []string{"queued", "processing"}).Find(&pending).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to check queued jobs", err.Error())
+		return
+	}
+	queued := map[uint]bool{}
+	for _, job := range pending {
+		for _, id := range parseChunkIDs(job.ChunkIDs) {
+			queued[id] = true
+		}
+	}
+
+	// Group the remaining pages into runs of consecutive indexes so each job's merged
+	// audio covers a contiguous page range
+	var groups [][]uint
+	var current []uint
+	lastIndex := -2
+	for _, chunk := range chunks {
+		if queued[chunk.ID] {
+			lastIndex = -2
+			continue
+		}
+		if chunk.Index != lastIndex+1 || len(current) == processAllChunksPerJob {
+			if len(current) > 0 {
+				groups = append(groups, current)
+			}
+			current = nil
+		}
+		current = append(current, chunk.ID)
+		lastIndex = chunk.Index
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	if len(groups) == 0 {
+		respondError(c, http.StatusConflict, codeConflict, "All remaining pages are already queued", gin.H{"queued_jobs": len(pending)})
+		return
+	}
+
+	if !enforceUserQuota(c, userID, book.ID) {
+		return
+	}
+
+	jobIDs := make([]uint, 0, len(groups))
+	pages := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, ids := range groups {
+			pages += len(ids)
+			job := TTSQueueJob{BookID: book.ID, ChunkIDs: normalizeChunkIDs(ids), Status: "queued", Priority: jobPriorityBulk, UserID: userID}
+			if err := tx.Create(&job).Error; err != nil {
+				return err
+			}
+			jobIDs = append(jobIDs, job.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to queue pages", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Remaining pages have been queued.",
+		"jobs_created": len(jobIDs),
+		"job_ids":      jobIDs,
+		"pages_queued": pages,
+	})
+}
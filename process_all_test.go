@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectUnfinishedPages expects processAllChunksHandler to load book 3 and its unfinished
+// pages, given as id/index pairs, and the chunk IDs of its queued or processing jobs.
+func expectUnfinishedPages(mock sqlmock.Sqlmock, pages [][2]int, pending ...string) {
+	mock.ExpectQuery(`SELECT "id","user_id" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+	rows := sqlmock.NewRows([]string{"id", "index"})
+	for _, p := range pages {
+		rows.AddRow(p[0], p[1])
+	}
+	mock.ExpectQuery(`SELECT "id","index" FROM "book_chunks" WHERE book_id = \$1 AND \(tts_status IS NULL OR tts_status <> \$2\) ORDER BY "index" ASC`).
+		WithArgs(uint(3), "completed").
+		WillReturnRows(rows)
+	if len(pages) == 0 {
+		return
+	}
+	jobs := sqlmock.NewRows([]string{"chunk_ids"})
+	for _, ids := range pending {
+		jobs.AddRow(ids)
+	}
+	mock.ExpectQuery(`SELECT "chunk_ids" FROM "tts_queue_jobs" WHERE book_id = \$1 AND status IN \(\$2,\$3\)`).
+		WithArgs(uint(3), "queued", "processing").
+		WillReturnRows(jobs)
+}
+
+func processAll() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/process-all", processAllChunksHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/process-all", nil))
+	return w
+}
+
+func TestProcessAllQueuesUnfinishedPages(t *testing.T) {
+	mock := mockDB(t)
+	// Pages 10-13 at indexes 0-3, page 14 after a gap at 5 (index 4 is narrated), then
+	// 15-25 at 6-16. Pages 12 and 13 are already in a queued job.
+	pages := [][2]int{{10, 0}, {11, 1}, {12, 2}, {13, 3}, {14, 5}}
+	for id := 15; id <= 25; id++ {
+		pages = append(pages, [2]int{id, id - 9})
+	}
+	expectUnfinishedPages(mock, pages, "12,13")
+	expectWithinQuota(mock, 7, 3)
+	mock.ExpectBegin()
+	queued := make([]driver.Value, 3)
+	for i := range queued {
+		mock.ExpectQuery(`INSERT INTO "tts_queue_jobs"`).
+			WithArgs(uint(3), recordArg{&queued[i]}, "queued", jobPriorityBulk, 0, "", sqlmock.AnyArg(), sqlmock.AnyArg(), uint(7), nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(40 + i))
+	}
+	mock.ExpectCommit()
+
+	w := processAll()
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	// Runs stop at gaps, at already queued pages and at processAllChunksPerJob pages
+	want := []driver.Value{"10,11", "14,15,16,17,18,19,20,21,22,23", "24,25"}
+	if !slices.Equal(queued, want) {
+		t.Fatalf("queued jobs = %q, want %q", queued, want)
+	}
+	var body struct {
+		JobsCreated int    `json:"jobs_created"`
+		JobIDs      []uint `json:"job_ids"`
+		PagesQueued int    `json:"pages_queued"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.JobsCreated != 3 || !slices.Equal(body.JobIDs, []uint{40, 41, 42}) || body.PagesQueued != 14 {
+		t.Fatalf("response = %+v, want 3 jobs 40-42 covering 14 pages", body)
+	}
+}
+
+func TestProcessAllNothingLeftToQueue(t *testing.T) {
+	mock := mockDB(t)
+	expectUnfinishedPages(mock, [][2]int{{10, 0}, {11, 1}}, "10", "11")
+
+	// Calling it again while the jobs are pending must not queue the pages twice
+	if w := processAll(); w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+}
+
+func TestProcessAllFinishedBook(t *testing.T) {
+	mock := mockDB(t)
+	expectUnfinishedPages(mock, nil)
+
+	w := processAll()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		JobsCreated int `json:"jobs_created"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.JobsCreated != 0 {
+		t.Fatalf("body = %s, want no jobs created", w.Body)
+	}
+}
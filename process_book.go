@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProcessBookRequest is the optional body of POST /user/books/:book_id/process. Voice
+// and speed, when set, replace the book's before narration starts.
+type ProcessBookRequest struct {
+	Voice string   `json:"voice"`
+	Speed *float64 `json:"speed" binding:"omitempty,gte=0.25,lte=4"`
+}
+
+// processBookHandler starts whole-book narration of an uploaded book, typically after
+// the user has picked a voice. Books already processing or finished are rejected; use
+// the reprocess endpoint to narrate a finished book again.
+func processBookHandler(c *gin.Context) {
+	var req ProcessBookRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid process request", err.Error())
+		return
+	}
+	if !isValidVoice(req.Voice) {
+		respondError(c, http.StatusBadRequest, codeInvalidVoice, "Invalid voice", gin.H{"allowed_voices": allowedVoices})
+		return
+	}
+
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if book.UserID != userID {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to process this book", nil)
+		return
+	}
+	if book.FilePath == "" {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Upload a file before processing the book", nil)
+		return
+	}
+	var pages int64
+	if err := db.Model(&BookChunk{}).Where("book_id = ?", book.ID).Count(&pages).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count pages", err.Error())
+		return
+	}
+	if pages == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book has no pages to process", nil)
+		return
+	}
+	if !enforceUserQuota(c, userID, book.ID) {
+		return
+	}
+
+	// Claim the book so a concurrent call sees it as processing; the effects stage still
+	// running (tts_completed) counts as processing
+	updates := map[string]interface{}{"status": bookStatusProcessing}
+	if req.Voice != "" {
+		updates["voice"] = strings.ToLower(req.Voice)
+	}
+	if req.Speed != nil {
+		updates["speed"] = *req.Speed
+	}
+	res := db.Model(&Book{}).
+		Where("id = ? AND status NOT IN ?", book.ID, append([]BookStatus{bookStatusProcessing, bookStatusTTSCompleted}, finishedBookStatuses...)).
+		Updates(updates)
+	if res.Error != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update book", res.Error.Error())
+		return
+	}
+	if res.RowsAffected == 0 {
+		if book.Status == bookStatusProcessing || book.Status == bookStatusTTSCompleted {
+			respondError(c, http.StatusConflict, codeBookProcessing, "Book is already processing", nil)
+		} else {
+			respondError(c, http.StatusConflict, codeConflict, "Book is already processed; reprocess it to narrate it again", gin.H{"status": book.Status})
+		}
+		return
+	}
+
+	book.Status = bookStatusProcessing
+	requestID := requestIDFromContext(c)
+	logWithRequestID(requestID, "▶️ Processing book %d (%d pages)", book.ID, pages)
+	go processBookConversion(book, requestID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     "Book processing started",
+		"book_id":     book.ID,
+		"status":      book.Status,
+		"total_pages": pages,
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectProcessBook expects processBookHandler to load book 3 of user 7 in status, find
+// its pages and try to claim it, matching claimed rows.
+func expectProcessBook(mock sqlmock.Sqlmock, status BookStatus, claimed int64) {
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "file_path"}).AddRow(3, 7, status, "uploads/book.txt"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "book_chunks" WHERE book_id = \$1`).
+		WithArgs(uint(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	expectWithinQuota(mock, 7, 3)
+	expectWrite(mock, `UPDATE "books" SET "status"=\$1,"voice"=\$2,"updated_at"=\$3 WHERE \(id = \$4 AND status NOT IN \(\$5,\$6,\$7,\$8\)\)`).
+		WithArgs(bookStatusProcessing, "nova", sqlmock.AnyArg(), uint(3), bookStatusProcessing, bookStatusTTSCompleted, bookStatusCompleted, bookStatusReused).
+		WillReturnResult(sqlmock.NewResult(0, claimed))
+}
+
+func TestProcessPendingBook(t *testing.T) {
+	mock := mockDB(t)
+	expectProcessBook(mock, bookStatusPending, 1)
+	// The narration started in the background; stop it at its first lookup
+	mock.ExpectQuery(`SELECT \* FROM "book_files" WHERE book_id = \$1`).WillReturnError(errors.New("stop"))
+	expectWrite(mock, `UPDATE "books" SET "status"=\$1`).WithArgs(bookStatusFailed, sqlmock.AnyArg(), uint(3), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/process", processBookHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/process", strings.NewReader(`{"voice": "Nova"}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	waitForExpectations(t, mock)
+}
+
+func TestProcessBookAlreadyProcessing(t *testing.T) {
+	mock := mockDB(t)
+	// Another request claimed the book first, so the claim matches no row
+	expectProcessBook(mock, bookStatusProcessing, 0)
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/process", processBookHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/process", strings.NewReader(`{"voice": "Nova"}`)))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), codeBookProcessing) {
+		t.Fatalf("status = %d, want 409 %s: %s", w.Code, codeBookProcessing, w.Body)
+	}
+}
+
+func TestProcessBookOfAnotherUser(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "file_path"}).AddRow(3, 8, bookStatusPending, "uploads/book.txt"))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/process", processBookHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/process", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BookProgress summarises how far chunk-by-chunk processing of a book has got.
+type BookProgress struct {
+	BookID          uint                      `json:"book_id"`
+	Status          BookStatus                `json:"status"`
+	Progress        float64                   `json:"progress"` // 0–100
+	TotalChunks     int64                     `json:"total_chunks"`
+	CompletedChunks int64                     `json:"completed_chunks"`
+	Counts          map[string]int64          `json:"counts"`            // chunks per TTS status
+	Merging         map[int]PageMergeProgress `json:"merging,omitempty"` // pages being mixed, by page number
+}
+
+// chunkStatusCounts counts a book's chunks by TTS status with one grouped query. Chunks
+// that never started have an empty status and are counted as pending.
+func chunkStatusCounts(bookID uint) (map[string]int64, int64, error) {
+	var rows []struct {
+		TTSStatus string
+		Count     int64
+	}
+	if err := db.Model(&BookChunk{}).
+		Select("tts_status, COUNT(*) AS count").
+		Where("book_id = ?", bookID).
+		Group("tts_status").
+		Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	counts := map[string]int64{"pending": 0, "processing": 0, "completed": 0, "failed": 0}
+	var total int64
+	for _, r := range rows {
+		status := r.TTSStatus
+		if status == "" {
+			status = "pending"
+		}
+		counts[status] += r.Count
+		total += r.Count
+	}
+	return counts, total, nil
+}
+
+// computeBookProgress summarises the chunk statuses of a book.
+func computeBookProgress(book Book) (BookProgress, error) {
+	counts, total, err := chunkStatusCounts(book.ID)
+	if err != nil {
+		return BookProgress{}, err
+	}
+
+	p := BookProgress{
+		BookID:      book.ID,
+		Status:      book.Status,
+		Counts:      counts,
+		TotalChunks: total,
+	}
+	p.CompletedChunks = p.Counts["completed"]
+	p.Merging = mergeProgressFor(book.ID)
+
+	switch {
+	case p.TotalChunks > 0:
+		p.Progress = math.Round(float64(p.CompletedChunks)/float64(p.TotalChunks)*1000) / 10
+	case isBookFinished(book.Status):
+		// Whole-book conversions have no chunks to count
+		p.Progress = 100
+	}
+	return p, nil
+}
+
+// getBookProgressHandler returns the processing progress of one of the caller's books.
+func getBookProgressHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "status").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	progress, err := computeBookProgress(book)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to compute progress", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
+
+// getChunkStatsHandler returns how many pages a book has per TTS status, without their
+// content.
+func getChunkStatsHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	counts, total, err := chunkStatusCounts(book.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count pages", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "total_chunks": total, "counts": counts})
+}
+
+// isBookTerminal reports whether a book's status ends a progress stream.
+func isBookTerminal(status BookStatus) bool {
+	return isBookFinished(status) || status == bookStatusFailed || status == bookStatusRejected
+}
+
+// streamBookProgressHandler pushes the book's progress as Server-Sent Events whenever it
+// changes. It re-checks on every book_status notification and, as a fallback, every
+// PROGRESS_STREAM_INTERVAL (default 2s). The stream ends when the book reaches a
+// terminal status or the client disconnects.
+func streamBookProgressHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "status").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	interval, err := time.ParseDuration(getEnv("PROGRESS_STREAM_INTERVAL", "2s"))
+	if err != nil || interval < 200*time.Millisecond {
+		interval = 2 * time.Second
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changed, unsubscribe := subscribeBookStatus(book.ID)
+	defer unsubscribe()
+	ctx := c.Request.Context()
+	lastSent := ""
+	lastWrite := time.Now()
+
+	for {
+		if err := db.Select("id", "user_id", "status").First(&book, book.ID).Error; err != nil {
+			c.SSEvent("error", APIError{Code: codeBookNotFound, Message: "Book not found"})
+			c.Writer.Flush()
+			return
+		}
+		progress, err := computeBookProgress(book)
+		if err != nil {
+			c.SSEvent("error", APIError{Code: codeInternalError, Message: "Failed to compute progress"})
+			c.Writer.Flush()
+			return
+		}
+
+		if key := fmt.Sprint(progress.Status, progress.Counts, progress.Merging); key != lastSent {
+			c.SSEvent("progress", progress)
+			c.Writer.Flush()
+			lastSent, lastWrite = key, time.Now()
+		} else if time.Since(lastWrite) >= 15*time.Second {
+			// Comment line so proxies don't drop an idle connection
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+			lastWrite = time.Now()
+		}
+
+		if isBookTerminal(progress.Status) {
+			c.SSEvent("done", progress)
+			c.Writer.Flush()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-serverShutdown:
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectChunkStatusCounts expects the grouped count of book 3's pages by TTS status.
+func expectChunkStatusCounts(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT tts_status, COUNT\(\*\) AS count FROM "book_chunks" WHERE book_id = \$1 GROUP BY "tts_status"`).
+		WithArgs(uint(3)).
+		WillReturnRows(rows)
+}
+
+func TestChunkStatsHandler(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+	// Pages that never started have no status and count as pending
+	expectChunkStatusCounts(mock, sqlmock.NewRows([]string{"tts_status", "count"}).
+		AddRow("completed", 5).
+		AddRow("", 2).
+		AddRow("pending", 1).
+		AddRow("failed", 1))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/chunks/stats", getChunkStatsHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/chunks/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		TotalChunks int64            `json:"total_chunks"`
+		Counts      map[string]int64 `json:"counts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"pending": 3, "processing": 0, "completed": 5, "failed": 1}
+	if body.TotalChunks != 9 || !maps.Equal(body.Counts, want) {
+		t.Fatalf("stats = %d pages %v, want 9 pages %v", body.TotalChunks, body.Counts, want)
+	}
+}
+
+func TestChunkStatsOfAnotherUsersBook(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id" FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 8))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/chunks/stats", getChunkStatsHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/chunks/stats", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+func TestBookProgressHandler(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id","status" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusPending))
+	expectChunkStatusCounts(mock, sqlmock.NewRows([]string{"tts_status", "count"}).
+		AddRow("completed", 3).
+		AddRow("processing", 1).
+		AddRow("", 1).
+		AddRow("failed", 1))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/progress", getBookProgressHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/progress", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var p BookProgress
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"pending": 1, "processing": 1, "completed": 3, "failed": 1}
+	if p.TotalChunks != 6 || p.CompletedChunks != 3 || !maps.Equal(p.Counts, want) {
+		t.Fatalf("progress = %d/%d pages %v, want 3/6 %v", p.CompletedChunks, p.TotalChunks, p.Counts, want)
+	}
+	if p.Progress != 50 {
+		t.Fatalf("progress = %v%%, want 50%%", p.Progress)
+	}
+}
+
+func TestBookProgressRoundsToOneDecimal(t *testing.T) {
+	mock := mockDB(t)
+	expectChunkStatusCounts(mock, sqlmock.NewRows([]string{"tts_status", "count"}).
+		AddRow("completed", 1).
+		AddRow("pending", 2))
+
+	p, err := computeBookProgress(Book{ID: 3, Status: bookStatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Progress != 33.3 {
+		t.Fatalf("progress = %v%%, want 33.3%%", p.Progress)
+	}
+}
+
+func TestBookProgressWithoutPages(t *testing.T) {
+	for _, tc := range []struct {
+		status BookStatus
+		want   float64
+	}{
+		{bookStatusProcessing, 0},
+		{bookStatusCompleted, 100},
+		{bookStatusReused, 100},
+	} {
+		mock := mockDB(t)
+		expectChunkStatusCounts(mock, sqlmock.NewRows([]string{"tts_status", "count"}))
+		p, err := computeBookProgress(Book{ID: 3, Status: tc.status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Progress != tc.want {
+			t.Errorf("%s book without pages: progress = %v%%, want %v%%", tc.status, p.Progress, tc.want)
+		}
+	}
+}
+
+func TestBookProgressOfAnotherUsersBook(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id","status" FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 8, bookStatusPending))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/progress", getBookProgressHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/progress", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+// expectStreamedBook expects the progress stream to re-read book 3 with status and then
+// count its pages.
+func expectStreamedBook(mock sqlmock.Sqlmock, status BookStatus, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`SELECT "id","user_id","status" FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, status))
+	expectChunkStatusCounts(mock, rows)
+}
+
+// sseEvents splits a Server-Sent Events body into its event names and data lines.
+func sseEvents(body string) (names, data []string) {
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				names = append(names, name)
+			} else if d, ok := strings.CutPrefix(line, "data:"); ok {
+				data = append(data, d)
+			}
+		}
+	}
+	return names, data
+}
+
+func TestStreamBookProgressUntilCompleted(t *testing.T) {
+	// Only a notification can wake the stream before the test ends
+	t.Setenv("PROGRESS_STREAM_INTERVAL", "1h")
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT "id","user_id","status" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusProcessing))
+	expectStreamedBook(mock, bookStatusProcessing, sqlmock.NewRows([]string{"tts_status", "count"}).
+		AddRow("completed", 1).
+		AddRow("processing", 1))
+	expectStreamedBook(mock, bookStatusCompleted, sqlmock.NewRows([]string{"tts_status", "count"}).
+		AddRow("completed", 2))
+
+	w := httptest.NewRecorder()
+	router := userRouter(7, http.MethodGet, "/user/books/:book_id/progress/stream", streamBookProgressHandler)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/progress/stream", nil))
+	}()
+
+	// Wait for the stream to subscribe, then announce the status change
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		bookStatusMu.Lock()
+		subscribed := len(bookStatusSubs[3]) > 0
+		bookStatusMu.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("progress stream never subscribed to book 3")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	dispatchNotification(bookStatusChannel, "3")
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("progress stream still open after the book completed")
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	names, data := sseEvents(w.Body.String())
+	if want := []string{"progress", "progress", "done"}; !slices.Equal(names, want) {
+		t.Fatalf("events = %v, want %v:\n%s", names, want, w.Body)
+	}
+	var first, last BookProgress
+	if err := json.Unmarshal([]byte(data[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(data[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != bookStatusProcessing || first.Progress != 50 {
+		t.Errorf("first event = %s at %v%%, want processing at 50%%", first.Status, first.Progress)
+	}
+	if last.Status != bookStatusCompleted || last.Progress != 100 {
+		t.Errorf("done event = %s at %v%%, want completed at 100%%", last.Status, last.Progress)
+	}
+
+	bookStatusMu.Lock()
+	defer bookStatusMu.Unlock()
+	if len(bookStatusSubs[3]) != 0 {
+		t.Error("closed progress stream is still subscribed")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listPublicBooksHandler lists public, finished books for unauthenticated clients.
+// It supports the same category/genre filters as listBooksHandler plus limit/offset pagination.
+// Only books with Public set and status "completed" or "reused" are ever returned.
+func listPublicBooksHandler(c *gin.Context) {
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsedOffset, err := strconv.Atoi(o); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	query := db.Model(&Book{}).Where("public = ? AND status IN ?", true, finishedBookStatuses)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if genre := c.Query("genre"); genre != "" {
+		query = query.Where("genre = ?", genre)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to count public books", err.Error())
+		return
+	}
+
+	var books []Book
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&books).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch public books", err.Error())
+		return
+	}
+
+	host := streamHost()
+	response := make([]BookResponse, 0, len(books))
+	for _, book := range books {
+		// Internal paths and content are deliberately left out of the public feed.
+		response = append(response, BookResponse{
+			ID:        book.ID,
+			Title:     book.Title,
+			Author:    book.Author,
+			Category:  book.Category,
+			Genre:     book.Genre,
+			Status:    string(book.Status),
+			Public:    book.Public,
+			StreamURL: fmt.Sprintf("%s/public/books/%d/stream", host, book.ID),
+			CoverURL:  book.CoverURL,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"books":  response,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// streamPublicBookAudioHandler serves the merged audio of a public, finished book.
+func streamPublicBookAudioHandler(c *gin.Context) {
+	var book Book
+	if err := db.Where("id = ? AND public = ? AND status IN ?", c.Param("book_id"), true, finishedBookStatuses).First(&book).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.AudioPath == "" {
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Audio file not available for this book", nil)
+		return
+	}
+	if _, err := os.Stat(book.AudioPath); err != nil {
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Audio file not found on server", nil)
+		return
+	}
+	audioPath := negotiateBookAudio(c, book)
+	c.Header("Content-Type", audioContentType(audioPath))
+	serveAudioFile(c, audioPath)
+}
+
+// publishBookHandler marks one of the caller's books as public.
+func publishBookHandler(c *gin.Context) {
+	setBookPublic(c, true)
+}
+
+// unpublishBookHandler removes one of the caller's books from the public feed.
+func unpublishBookHandler(c *gin.Context) {
+	setBookPublic(c, false)
+}
+
+// setBookPublic toggles the Public flag after checking the caller owns the book.
+func setBookPublic(c *gin.Context, public bool) {
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to modify this book", nil)
+		return
+	}
+
+	if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("public", public).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update book", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "public": public})
+}
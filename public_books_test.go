@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// publicRouter serves the unauthenticated public book routes.
+func publicRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/public/books", listPublicBooksHandler)
+	r.GET("/public/books/:book_id/stream", streamPublicBookAudioHandler)
+	return r
+}
+
+func TestListPublicBooksLeavesOutPrivateBooks(t *testing.T) {
+	mock := mockDB(t)
+	// Only rows matching public = true reach the feed; the private book 2 is never selected.
+	// Book 3 reused another book's audio and is as playable as a completed one.
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" WHERE \(public = \$1 AND status IN \(\$2,\$3\)\)`).
+		WithArgs(true, bookStatusCompleted, bookStatusReused).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE \(public = \$1 AND status IN \(\$2,\$3\)\) .*ORDER BY created_at DESC LIMIT \$4`).
+		WithArgs(true, bookStatusCompleted, bookStatusReused, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "public", "status", "file_path"}).
+			AddRow(1, "Shared", true, bookStatusCompleted, "/uploads/secret.txt").
+			AddRow(3, "Shared copy", true, bookStatusReused, "/uploads/copy.txt"))
+
+	w := httptest.NewRecorder()
+	publicRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/books", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Books []map[string]interface{} `json:"books"`
+		Total int                      `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Total != 2 || len(body.Books) != 2 || body.Books[0]["id"] != 1.0 || body.Books[1]["id"] != 3.0 {
+		t.Fatalf("feed = %s, want books 1 and 3", w.Body)
+	}
+	for _, book := range body.Books {
+		if path := book["file_path"]; path != "" {
+			t.Fatalf("feed exposes file_path %v", path)
+		}
+	}
+}
+
+func TestStreamPublicBookRefusesPrivateBook(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE \(id = \$1 AND public = \$2 AND status IN \(\$3,\$4\)\)`).
+		WithArgs("2", true, bookStatusCompleted, bookStatusReused, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	w := httptest.NewRecorder()
+	publicRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/books/2/stream", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != codeBookNotFound {
+		t.Fatalf("body = %s, want %s", w.Body, codeBookNotFound)
+	}
+}
+
+func TestStreamPublicBookServesReusedBook(t *testing.T) {
+	audio := filepath.Join(t.TempDir(), "book.mp3")
+	if err := os.WriteFile(audio, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE \(id = \$1 AND public = \$2 AND status IN \(\$3,\$4\)\)`).
+		WithArgs("3", true, bookStatusCompleted, bookStatusReused, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "public", "status", "audio_path"}).
+			AddRow(3, true, bookStatusReused, audio))
+
+	w := httptest.NewRecorder()
+	publicRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/books/3/stream", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "audio" {
+		t.Fatalf("status = %d body %q, want 200 with the audio", w.Code, w.Body)
+	}
+}
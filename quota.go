@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserUsage tracks how much processing a user consumed in one calendar month (UTC).
+type UserUsage struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;uniqueIndex:idx_user_usage_period"`
+	Period         string `gorm:"size:7;not null;uniqueIndex:idx_user_usage_period"` // YYYY-MM
+	BooksProcessed int
+	AudioSeconds   float64
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// BookUsage marks a book whose current narration was already added to its owner's
+// usage, so a book finished by several jobs is only counted once. The row is removed when
+// the book is narrated again from scratch (see resetBookUsage); pages narrated again in
+// a counted book add their audio to it (see recordPageUsage).
+type BookUsage struct {
+	ID           uint   `gorm:"primaryKey"`
+	BookID       uint   `gorm:"not null;uniqueIndex"`
+	UserID       uint   `gorm:"not null;index"`
+	Period       string `gorm:"size:7;not null"`
+	AudioSeconds float64
+	CreatedAt    time.Time
+}
+
+// UserQuotaOverride replaces the env-configured monthly limits for one user.
+// Rows are managed by admins; 0 means unlimited, as with the env defaults.
+type UserQuotaOverride struct {
+	ID                  uint `gorm:"primaryKey"`
+	UserID              uint `gorm:"uniqueIndex"`
+	MonthlyBooks        int
+	MonthlyAudioSeconds float64
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+// currentUsagePeriod returns the usage period key for now.
+func currentUsagePeriod() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// userQuotaLimits returns the monthly book and audio-second limits for a user.
+// Defaults come from MONTHLY_BOOK_QUOTA and MONTHLY_AUDIO_SECONDS_QUOTA; 0 disables a limit.
+func userQuotaLimits(userID uint) (int, float64, error) {
+	var override UserQuotaOverride
+	err := db.Where("user_id = ?", userID).First(&override).Error
+	if err == nil {
+		return override.MonthlyBooks, override.MonthlyAudioSeconds, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, err
+	}
+	books, _ := strconv.Atoi(getEnv("MONTHLY_BOOK_QUOTA", "0"))
+	seconds, _ := strconv.ParseFloat(getEnv("MONTHLY_AUDIO_SECONDS_QUOTA", "0"), 64)
+	return books, seconds, nil
+}
+
+// currentUserUsage returns the user's usage for this month; a user without usage yet
+// gets an empty row.
+func currentUserUsage(userID uint) (UserUsage, error) {
+	var usage UserUsage
+	err := db.Where("user_id = ? AND period = ?", userID, currentUsagePeriod()).First(&usage).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// inFlightBooks counts the user's books that are being narrated but not yet added to
+// their usage: whole-book runs and books with queued or running chunk jobs. The book the
+// caller is about to work on (0 for none) is left out so continuing it is not refused.
+func inFlightBooks(userID, exceptBookID uint) (int64, error) {
+	var count int64
+	err := db.Model(&Book{}).
+		Where("user_id = ? AND id <> ?", userID, exceptBookID).
+		Where("status IN ? OR EXISTS (SELECT 1 FROM tts_queue_jobs WHERE tts_queue_jobs.book_id = books.id AND tts_queue_jobs.status IN ?)",
+			[]BookStatus{bookStatusProcessing, bookStatusTTSCompleted}, []string{"queued", "processing"}).
+		Where("NOT EXISTS (SELECT 1 FROM book_usages WHERE book_usages.book_id = books.id)").
+		Count(&count).Error
+	return count, err
+}
+
+// checkUserQuota reports whether the user is still within their monthly quota and
+// the remaining allowance (nil for unlimited). Books still being narrated count against
+// the book limit, except bookID, the one the caller is about to work on (0 for none).
+// A lookup error is returned rather than treated as within quota.
+func checkUserQuota(userID, bookID uint) (bool, gin.H, error) {
+	bookLimit, secondsLimit, err := userQuotaLimits(userID)
+	if err != nil {
+		return false, nil, err
+	}
+	usage, err := currentUserUsage(userID)
+	if err != nil {
+		return false, nil, err
+	}
+	inFlight, err := inFlightBooks(userID, bookID)
+	if err != nil {
+		return false, nil, err
+	}
+
+	within := true
+	remaining := gin.H{"period": currentUsagePeriod(), "books": nil, "audio_seconds": nil}
+	if bookLimit > 0 {
+		left := bookLimit - usage.BooksProcessed - int(inFlight)
+		if left <= 0 {
+			within = false
+			left = 0
+		}
+		remaining["books"] = left
+	}
+	if secondsLimit > 0 {
+		left := secondsLimit - usage.AudioSeconds
+		if left <= 0 {
+			within = false
+			left = 0
+		}
+		remaining["audio_seconds"] = left
+	}
+	return within, remaining, nil
+}
+
+// enforceUserQuota aborts with 429 when the caller has used up their monthly quota, and
+// with 500 when the quota cannot be checked. bookID is the book the request works on, or
+// 0 when it starts none. It returns false if the request was rejected.
+func enforceUserQuota(c *gin.Context, userID, bookID uint) bool {
+	within, remaining, err := checkUserQuota(userID, bookID)
+	if err != nil {
+		log.Printf("⚠️ Failed to check quota for user %d: %v", userID, err)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to check processing quota", err.Error())
+		return false
+	}
+	if within {
+		return true
+	}
+	respondError(c, http.StatusTooManyRequests, codeQuotaExceeded, "Monthly processing quota exceeded", gin.H{"remaining": remaining})
+	return false
+}
+
+// recordBookUsage adds one processed book and its audio length to the owner's usage for
+// this month. The book's BookUsage row is claimed first, so a book finished by several
+// jobs at once is only counted by whichever records it first.
+func recordBookUsage(bookID, userID uint, audioSeconds float64) {
+	period := currentUsagePeriod()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		claim := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "book_id"}}, DoNothing: true}).
+			Create(&BookUsage{BookID: bookID, UserID: userID, Period: period, AudioSeconds: audioSeconds})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			return claim.Error
+		}
+		usage := UserUsage{UserID: userID, Period: period, BooksProcessed: 1, AudioSeconds: audioSeconds}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"books_processed": gorm.Expr("user_usages.books_processed + ?", 1),
+				"audio_seconds":   gorm.Expr("user_usages.audio_seconds + ?", audioSeconds),
+				"updated_at":      time.Now(),
+			}),
+		}).Create(&usage).Error
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to record usage of book %d for user %d: %v", bookID, userID, err)
+	}
+}
+
+// resetBookUsage forgets that a book's narration was counted, through tx, so the next
+// time the book completes it is added to its owner's usage again. Call it when a new
+// narration of the whole book starts or its text is replaced.
+func resetBookUsage(tx *gorm.DB, bookID uint) error {
+	return tx.Where("book_id = ?", bookID).Delete(&BookUsage{}).Error
+}
+
+// recordPageUsage adds the audio of pages narrated again to the owner's usage for this
+// month. Only books already counted are charged here; pages of a book that has not
+// completed yet are counted with it by recordBookUsage.
+func recordPageUsage(bookID, userID uint, audioSeconds float64) {
+	if audioSeconds <= 0 {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&BookUsage{}).Where("book_id = ?", bookID).
+			Update("audio_seconds", gorm.Expr("audio_seconds + ?", audioSeconds))
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		usage := UserUsage{UserID: userID, Period: currentUsagePeriod(), AudioSeconds: audioSeconds}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "period"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"audio_seconds": gorm.Expr("user_usages.audio_seconds + ?", audioSeconds),
+				"updated_at":    time.Now(),
+			}),
+		}).Create(&usage).Error
+	})
+	if err != nil {
+		log.Printf("⚠️ Failed to record page usage of book %d for user %d: %v", bookID, userID, err)
+	}
+}
+
+// bookAudioSeconds sums the durations of a book's synthesized chunk audio.
+func bookAudioSeconds(bookID uint) float64 {
+	var chunks []BookChunk
+	db.Where("book_id = ? AND tts_status = ?", bookID, "completed").Find(&chunks)
+	total := 0.0
+	for _, ch := range chunks {
+		if ch.AudioPath == "" {
+			continue
+		}
+		if d, err := getTTSDuration(ch.AudioPath); err == nil {
+			total += d
+		}
+	}
+	return total
+}
+
+// adminQuotaUserID parses the :user_id of an admin quota route.
+func adminQuotaUserID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil || userID == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid user ID", nil)
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// respondUserQuota writes a user's quota: the override if any, the limits in effect,
+// this month's usage and what is left.
+func respondUserQuota(c *gin.Context, userID uint) {
+	var override *UserQuotaOverride
+	var row UserQuotaOverride
+	if err := db.Where("user_id = ?", userID).First(&row).Error; err == nil {
+		override = &row
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load quota override", err.Error())
+		return
+	}
+	books, seconds, err := userQuotaLimits(userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load quota", err.Error())
+		return
+	}
+	usage, err := currentUserUsage(userID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load usage", err.Error())
+		return
+	}
+	within, remaining, err := checkUserQuota(userID, 0)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to check quota", err.Error())
+		return
+	}
+
+	response := gin.H{
+		"user_id":   userID,
+		"override":  nil,
+		"limits":    gin.H{"monthly_books": books, "monthly_audio_seconds": seconds},
+		"usage":     gin.H{"period": currentUsagePeriod(), "books_processed": usage.BooksProcessed, "audio_seconds": usage.AudioSeconds},
+		"remaining": remaining,
+		"within":    within,
+	}
+	if override != nil {
+		response["override"] = gin.H{
+			"monthly_books":         override.MonthlyBooks,
+			"monthly_audio_seconds": override.MonthlyAudioSeconds,
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// getUserQuotaHandler shows a user's monthly quota and usage.
+func getUserQuotaHandler(c *gin.Context) {
+	userID, ok := adminQuotaUserID(c)
+	if !ok {
+		return
+	}
+	respondUserQuota(c, userID)
+}
+
+// putUserQuotaHandler sets a user's quota override, replacing the env-configured limits
+// for that user. 0 means unlimited.
+func putUserQuotaHandler(c *gin.Context) {
+	userID, ok := adminQuotaUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		MonthlyBooks        *int     `json:"monthly_books" binding:"required,gte=0"`
+		MonthlyAudioSeconds *float64 `json:"monthly_audio_seconds" binding:"required,gte=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "monthly_books and monthly_audio_seconds (0 for unlimited) are required", err.Error())
+		return
+	}
+
+	override := UserQuotaOverride{UserID: userID, MonthlyBooks: *req.MonthlyBooks, MonthlyAudioSeconds: *req.MonthlyAudioSeconds}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"monthly_books", "monthly_audio_seconds", "updated_at"}),
+	}).Create(&override).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to save quota override", err.Error())
+		return
+	}
+	log.Printf("📏 Set quota override for user %d: %d books, %.0f audio seconds", userID, override.MonthlyBooks, override.MonthlyAudioSeconds)
+	respondUserQuota(c, userID)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectQuotaLookups expects checkUserQuota's queries for user 7 working on book 3: no
+// override, the given usage this month and the given number of in-flight books.
+func expectQuotaLookups(mock sqlmock.Sqlmock, booksProcessed int, inFlight int64) {
+	mock.ExpectQuery(`SELECT \* FROM "user_quota_overrides" WHERE user_id = \$1`).
+		WithArgs(uint(7), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "user_usages" WHERE user_id = \$1 AND period = \$2`).
+		WithArgs(uint(7), currentUsagePeriod(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "period", "books_processed"}).
+			AddRow(1, 7, currentUsagePeriod(), booksProcessed))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" WHERE \(user_id = \$1 AND id <> \$2\) AND \(status IN \(\$3,\$4\) OR EXISTS .*tts_queue_jobs.status IN \(\$5,\$6\)\)\) AND NOT EXISTS \(SELECT 1 FROM book_usages`).
+		WithArgs(uint(7), uint(3), bookStatusProcessing, bookStatusTTSCompleted, "queued", "processing").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(inFlight))
+}
+
+// expectWithinQuota expects the quota check of a handler run by userID on bookID (0
+// for none), finding no usage and no limits.
+func expectWithinQuota(mock sqlmock.Sqlmock, userID, bookID uint) {
+	mock.ExpectQuery(`SELECT \* FROM "user_quota_overrides" WHERE user_id = \$1`).
+		WithArgs(userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "user_usages" WHERE user_id = \$1 AND period = \$2`).
+		WithArgs(userID, currentUsagePeriod(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "books" WHERE \(user_id = \$1 AND id <> \$2\)`).
+		WithArgs(userID, bookID, bookStatusProcessing, bookStatusTTSCompleted, "queued", "processing").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+func TestCheckUserQuotaBookLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		processed int
+		inFlight  int64
+		within    bool
+		left      int
+	}{
+		{"under the limit", 1, 0, true, 2},
+		{"one below the limit", 1, 1, true, 1},
+		{"at the limit", 3, 0, false, 0},
+		{"in-flight books reach the limit", 1, 2, false, 0},
+		{"over the limit", 4, 1, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MONTHLY_BOOK_QUOTA", "3")
+			t.Setenv("MONTHLY_AUDIO_SECONDS_QUOTA", "0")
+			mock := mockDB(t)
+			expectQuotaLookups(mock, tt.processed, tt.inFlight)
+
+			within, remaining, err := checkUserQuota(7, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if within != tt.within {
+				t.Errorf("within = %v, want %v", within, tt.within)
+			}
+			if remaining["books"] != tt.left {
+				t.Errorf("remaining books = %v, want %d", remaining["books"], tt.left)
+			}
+			if remaining["audio_seconds"] != nil {
+				t.Errorf("remaining audio_seconds = %v, want nil for unlimited", remaining["audio_seconds"])
+			}
+		})
+	}
+}
+
+func TestRecordBookUsageCountsBookOnce(t *testing.T) {
+	mock := mockDB(t)
+	// First completion claims the book's usage row and adds to the monthly total
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "book_usages" .* ON CONFLICT \("book_id"\) DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO "user_usages" .* ON CONFLICT \("user_id","period"\) DO UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	// A second job finishing the same book finds the row taken and records nothing
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "book_usages" .* ON CONFLICT \("book_id"\) DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	recordBookUsage(3, 7, 120)
+	recordBookUsage(3, 7, 120)
+}
+
+func TestRecordBookUsageCountsNarrationAgainAfterReset(t *testing.T) {
+	mock := mockDB(t)
+	expectCounted := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO "book_usages" .* ON CONFLICT \("book_id"\) DO NOTHING`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(`INSERT INTO "user_usages" .* ON CONFLICT \("user_id","period"\) DO UPDATE`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectCommit()
+	}
+	expectCounted()
+	// Reprocessing narrates the book again, so its next completion is a second book
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "book_usages" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectCounted()
+
+	recordBookUsage(3, 7, 120)
+	if err := resetBookUsage(db, 3); err != nil {
+		t.Fatal(err)
+	}
+	recordBookUsage(3, 7, 120)
+}
+
+func TestRecordPageUsage(t *testing.T) {
+	mock := mockDB(t)
+	addSeconds := `UPDATE "book_usages" SET "audio_seconds"=audio_seconds \+ \$1 WHERE book_id = \$2`
+	// A counted book is charged for a page narrated again
+	mock.ExpectBegin()
+	mock.ExpectExec(addSeconds).WithArgs(30.0, uint(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "user_usages" .* ON CONFLICT \("user_id","period"\) DO UPDATE SET "audio_seconds"=user_usages.audio_seconds \+ \$\d+`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+	// A book still in progress is counted in full when it completes
+	mock.ExpectBegin()
+	mock.ExpectExec(addSeconds).WithArgs(30.0, uint(4)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	recordPageUsage(3, 7, 30)
+	recordPageUsage(4, 7, 30)
+	recordPageUsage(3, 7, 0)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter decides whether a caller may make another request. Allow returns how
+// long to wait when the request is refused. The in-memory limiter below is the only
+// backend today; a shared store such as Redis can implement the same interface.
+type RateLimiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// tokenBucket holds the state of one caller's bucket.
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// memoryRateLimiter is a per-key token bucket refilled at perMinute tokens a minute up
+// to burst tokens. Buckets idle for longer than idleTTL are evicted.
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	perMinute float64
+	burst     float64
+	idleTTL   time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newMemoryRateLimiter(perMinute, burst int) *memoryRateLimiter {
+	return &memoryRateLimiter{
+		buckets:   map[string]*tokenBucket{},
+		perMinute: float64(perMinute),
+		burst:     float64(burst),
+		idleTTL:   10 * time.Minute,
+		now:       time.Now,
+	}
+}
+
+func (l *memoryRateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.idleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Minutes()*l.perMinute)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+	return false, wait
+}
+
+// newRateLimiterFromEnv builds the limiter for expensive routes from RATE_LIMIT_PER_MINUTE
+// (0 disables limiting) and RATE_LIMIT_BURST (defaults to the per-minute rate).
+func newRateLimiterFromEnv() RateLimiter {
+	perMinute, err := strconv.Atoi(getEnv("RATE_LIMIT_PER_MINUTE", "20"))
+	if err != nil || perMinute <= 0 {
+		return nil
+	}
+	burst, err := strconv.Atoi(getEnv("RATE_LIMIT_BURST", strconv.Itoa(perMinute)))
+	if err != nil || burst <= 0 {
+		burst = perMinute
+	}
+	return newMemoryRateLimiter(perMinute, burst)
+}
+
+// rateLimitMiddleware limits requests per authenticated user, answering 429 with a
+// Retry-After header once the user's bucket is empty. It must run after authMiddleware;
+// a nil limiter lets everything through.
+func rateLimitMiddleware(limiter RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		key := strconv.FormatUint(uint64(getUserIDFromContext(c)), 10)
+		if ok, wait := limiter.Allow(key); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			abortWithError(c, http.StatusTooManyRequests, codeRateLimited, "Rate limit exceeded", gin.H{"retry_after": retryAfter})
+			return
+		}
+		c.Next()
+	}
+}
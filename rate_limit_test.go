@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	type step struct {
+		after   time.Duration // Clock advance before the call
+		key     string
+		allowed bool
+		wait    time.Duration
+	}
+	tests := []struct {
+		name             string
+		perMinute, burst int
+		steps            []step
+	}{
+		{
+			"burst then refused",
+			60, 2,
+			[]step{
+				{0, "a", true, 0},
+				{0, "a", true, 0},
+				{0, "a", false, time.Second},
+				{0, "b", true, 0},
+			},
+		},
+		{
+			"refills over time",
+			60, 1,
+			[]step{
+				{0, "a", true, 0},
+				{500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+				{500 * time.Millisecond, "a", true, 0},
+			},
+		},
+		{
+			"refill capped at burst",
+			60, 2,
+			[]step{
+				{0, "a", true, 0},
+				{time.Hour, "a", true, 0},
+				{0, "a", true, 0},
+				{0, "a", false, time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			l := newMemoryRateLimiter(tt.perMinute, tt.burst)
+			l.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				allowed, wait := l.Allow(s.key)
+				if allowed != s.allowed || wait.Round(time.Millisecond) != s.wait {
+					t.Fatalf("step %d: Allow(%q) = %v, %v, want %v, %v", i, s.key, allowed, wait, s.allowed, s.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimiterEvictsIdleBuckets(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newMemoryRateLimiter(60, 1)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	l.Allow("b")
+	now = now.Add(11 * time.Minute)
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 1 {
+		t.Fatalf("%d buckets left after the idle ones expired, want 1", len(l.buckets))
+	}
+}
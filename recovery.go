@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// staleThreshold returns how long a job, chunk or book may go untouched in a non-terminal
+// state before startup recovery treats it as orphaned. Configured with
+// STALE_PROCESSING_THRESHOLD (default 15m); it must exceed the longest stretch work goes
+// without an update, or other replicas' running work gets reset.
+func staleThreshold() time.Duration {
+	d, err := time.ParseDuration(getEnv("STALE_PROCESSING_THRESHOLD", "15m"))
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Invalid STALE_PROCESSING_THRESHOLD, using 15m")
+		return 15 * time.Minute
+	}
+	return d
+}
+
+// recoverOrphanedWork resets work left unfinished by a crashed run. Only rows untouched
+// for staleThreshold are recovered, so work another replica is still running is left
+// alone. Jobs are requeued, chunks go back to "pending" so they can be synthesized
+// again, and books stuck processing or mixing (tts_completed) with no page updated
+// since the cutoff are marked "pending" for reprocessing.
+func recoverOrphanedWork() {
+	cutoff := time.Now().Add(-staleThreshold())
+
+	res := db.Model(&TTSQueueJob{}).
+		Where("status = ? AND updated_at < ?", "processing", cutoff).
+		Update("status", "queued")
+	if res.Error != nil {
+		log.Printf("⚠️ Failed to requeue orphaned jobs: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("🔁 Requeued %d orphaned jobs", res.RowsAffected)
+	}
+
+	// Books first, while pages narrated or mixed since the cutoff still show they are alive
+	res = transitionBooks(db.Where("status IN ? AND updated_at < ?", []BookStatus{bookStatusProcessing, bookStatusTTSCompleted}, cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM book_chunks WHERE book_chunks.book_id = books.id AND book_chunks.updated_at >= ?)", cutoff),
+		bookStatusPending)
+	if res.Error != nil {
+		log.Printf("⚠️ Failed to reset orphaned books: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("🔁 Marked %d orphaned books for reprocessing", res.RowsAffected)
+	}
+
+	res = db.Model(&BookChunk{}).
+		Where("tts_status = ? AND updated_at < ?", "processing", cutoff).
+		Update("tts_status", "pending")
+	if res.Error != nil {
+		log.Printf("⚠️ Failed to reset orphaned chunks: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("🔁 Reset %d orphaned chunks to pending", res.RowsAffected)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// timeNear matches a time argument within a second of want.
+type timeNear struct{ want time.Time }
+
+func (m timeNear) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	d := got.Sub(m.want)
+	return ok && d > -time.Second && d < time.Second
+}
+
+func TestStaleThreshold(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 15 * time.Minute},
+		{"1h", time.Hour},
+		{"soon", 15 * time.Minute},
+		{"-5m", 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Setenv("STALE_PROCESSING_THRESHOLD", tt.env)
+		if got := staleThreshold(); got != tt.want {
+			t.Errorf("staleThreshold() with %q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestRecoverOrphanedWorkOnlyResetsStaleRows(t *testing.T) {
+	t.Setenv("STALE_PROCESSING_THRESHOLD", "1h")
+	cutoff := timeNear{time.Now().Add(-time.Hour)}
+	mock := mockDB(t)
+
+	// A job stuck in processing for over an hour is requeued
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "tts_queue_jobs" SET "status"=\$1,"updated_at"=\$2 WHERE status = \$3 AND updated_at < \$4`).
+		WithArgs("queued", sqlmock.AnyArg(), "processing", cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Processing and mixing books are recovered when neither they nor their pages moved
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "books" SET "status"=\$1,"updated_at"=\$2 WHERE \(status IN \(\$3,\$4\) AND updated_at < \$5\) AND \(NOT EXISTS \(SELECT 1 FROM book_chunks WHERE book_chunks.book_id = books.id AND book_chunks.updated_at >= \$6\)\) AND status IN \(.*\) AND "books"."deleted_at" IS NULL`).
+		WithArgs(append([]driver.Value{bookStatusPending, sqlmock.AnyArg(), bookStatusProcessing, bookStatusTTSCompleted, cutoff, cutoff},
+			statusArgs(bookStatusPredecessors(bookStatusPending))...)...).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "book_chunks" SET "tts_status"=\$1,"updated_at"=\$2 WHERE tts_status = \$3 AND updated_at < \$4`).
+		WithArgs("pending", sqlmock.AnyArg(), "processing", cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	recoverOrphanedWork()
+}
+
+// statusArgs converts statuses to query arguments.
+func statusArgs(statuses []BookStatus) []driver.Value {
+	args := make([]driver.Value, len(statuses))
+	for i, s := range statuses {
+		args[i] = string(s)
+	}
+	return args
+}
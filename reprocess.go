@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reprocessBookHandler regenerates a book from its source files: the files are re-read
+// and re-paginated in order, chunk progress and stale audio are discarded and whole-book TTS
+// is started again.
+func reprocessBookHandler(c *gin.Context) {
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if book.UserID != userID {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to reprocess this book", nil)
+		return
+	}
+	// The effects stage still running (tts_completed) counts as processing: reprocessing
+	// would delete the pages and audio it is mixing
+	if book.Status == bookStatusProcessing || book.Status == bookStatusTTSCompleted {
+		respondError(c, http.StatusConflict, codeBookProcessing, "Book is already processing", nil)
+		return
+	}
+	if !enforceUserQuota(c, userID, book.ID) {
+		return
+	}
+	files, err := bookSourceFiles(db, book)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to load book files", err.Error())
+		return
+	}
+	if len(files) == 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book has no source file to reprocess", nil)
+		return
+	}
+	for _, f := range files {
+		if !fileExists(f.FilePath) {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book source file is missing", f.OriginalFilename)
+			return
+		}
+	}
+
+	hash, err := bookFilesHash(files)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to compute file hash", err.Error())
+		return
+	}
+
+	// Claim the book first so a concurrent reprocess request sees it as processing
+	res := db.Model(&Book{}).Where("id = ? AND status NOT IN ?", book.ID, []BookStatus{bookStatusProcessing, bookStatusTTSCompleted}).Updates(map[string]interface{}{
+		"status":              bookStatusProcessing,
+		"content_hash":        hash,
+		"audio_path":          "",
+		"audio_path_mp3":      "",
+		"audio_path_opus":     "",
+		"hls_playlist_path":   "",
+		"narrated_by":         "",
+		"reused_from_book_id": nil,
+		"summary":             "",
+	})
+	if res.Error != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update book", res.Error.Error())
+		return
+	}
+	if res.RowsAffected == 0 {
+		respondError(c, http.StatusConflict, codeBookProcessing, "Book is already processing", nil)
+		return
+	}
+
+	stale := staleBookAudioFiles(book)
+	if err := db.Where("book_id = ?", book.ID).Delete(&ProcessedChunkGroup{}).Error; err != nil {
+		updateBookStatus(book.ID, bookStatusFailed)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to clear processed chunk groups", err.Error())
+		return
+	}
+	if err := db.Where("book_id = ?", book.ID).Delete(&AudioArtifact{}).Error; err != nil {
+		updateBookStatus(book.ID, bookStatusFailed)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to clear audio artifacts", err.Error())
+		return
+	}
+	if err := db.Where("book_id = ?", book.ID).Delete(&BookChunk{}).Error; err != nil {
+		updateBookStatus(book.ID, bookStatusFailed)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to reset pages", err.Error())
+		return
+	}
+	if contentStore != nil {
+		if err := contentStore.DeleteBook(book.ID); err != nil {
+			log.Printf("⚠️ Failed to clear stored text of book %d: %v", book.ID, err)
+		}
+	}
+	numPages, truncated, err := chunkBookFiles(book.ID, files)
+	if err != nil {
+		updateBookStatus(book.ID, bookStatusFailed)
+		var tooLong *contentTooLongError
+		if errors.As(err, &tooLong) {
+			respondContentTooLong(c, tooLong)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to paginate document", err.Error())
+		return
+	}
+	if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("content_truncated", truncated).Error; err != nil {
+		log.Printf("⚠️ Failed to save truncation flag of book %d: %v", book.ID, err)
+	}
+	removeStaleFiles(book.ID, stale)
+
+	book.ContentHash = hash
+	book.AudioPath = ""
+	book.NarratedBy = ""
+	book.Status = bookStatusProcessing
+	requestID := requestIDFromContext(c)
+	logWithRequestID(requestID, "🔄 Reprocessing book %d (%d pages, %d stale files removed)", book.ID, numPages, len(stale))
+	go processBookConversion(book, requestID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           "Book reprocessing started",
+		"book_id":           book.ID,
+		"status":            book.Status,
+		"total_pages":       numPages,
+		"content_truncated": truncated,
+	})
+}
+
+// staleBookAudioFiles lists the generated audio of a book that a reprocess replaces.
+// Audio still referenced by another book (reused by content hash) is left alone; a
+// soft-deleted book counts, since it can still be restored.
+func staleBookAudioFiles(book Book) []string {
+	seen := map[string]bool{}
+	var files []string
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for column, path := range map[string]string{"audio_path": book.AudioPath, "audio_path_mp3": book.AudioPathMP3, "audio_path_opus": book.AudioPathOpus} {
+		if path == "" {
+			continue
+		}
+		var shared int64
+		db.Unscoped().Model(&Book{}).Where("id <> ? AND "+column+" = ?", book.ID, path).Count(&shared)
+		if shared == 0 {
+			add(path)
+		}
+	}
+
+	var chunks []BookChunk
+	db.Select("audio_path", "final_audio_path").Where("book_id = ?", book.ID).Find(&chunks)
+	for _, ch := range chunks {
+		add(ch.AudioPath)
+		add(ch.FinalAudioPath)
+	}
+
+	var groups []ProcessedChunkGroup
+	db.Select("audio_path").Where("book_id = ?", book.ID).Find(&groups)
+	for _, g := range groups {
+		add(g.AudioPath)
+	}
+	for _, p := range audioArtifactPaths(book.ID) {
+		add(p)
+	}
+	if matches, err := filepath.Glob(waveformCacheGlob(book.ID)); err == nil {
+		for _, m := range matches {
+			add(m)
+		}
+	}
+	// Segments before their directory, so the emptied directory can be removed too
+	if matches, err := filepath.Glob(filepath.Join(hlsDir(book.ID), "*")); err == nil && len(matches) > 0 {
+		for _, m := range matches {
+			add(m)
+		}
+		add(hlsDir(book.ID))
+	}
+	return files
+}
+
+// removeStaleFiles deletes the files staleBookAudioFiles listed for a book.
+func removeStaleFiles(bookID uint, files []string) {
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ Failed to remove stale audio %s for book %d: %v", f, bookID, err)
+		}
+	}
+}
+
+// reprocessChunkHandler regenerates the narration of one chunk in the background, even
+// if it already completed. The chunk is claimed before responding so a second request
+// for it is refused; merged chunk groups that included it are dropped once the new
+// narration is saved.
+func reprocessChunkHandler(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid chunk index", nil)
+		return
+	}
+
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if book.UserID != userID {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to reprocess this book", nil)
+		return
+	}
+	if !enforceBookModeration(c, book.ID) {
+		return
+	}
+
+	var chunk BookChunk
+	if err := db.Where("book_id = ? AND \"index\" = ?", book.ID, index).First(&chunk).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeChunkNotFound, "Chunk not found", nil)
+		return
+	}
+	if !enforceUserQuota(c, userID, book.ID) {
+		return
+	}
+
+	// Claim the chunk so a concurrent reprocess or job sees it as processing
+	res := db.Model(&BookChunk{}).
+		Where("id = ? AND (tts_status IS NULL OR tts_status <> ?)", chunk.ID, "processing").
+		Update("tts_status", "processing")
+	if res.Error != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to update chunk", res.Error.Error())
+		return
+	}
+	if res.RowsAffected == 0 {
+		respondError(c, http.StatusConflict, codeConflict, "Chunk is already processing", nil)
+		return
+	}
+
+	requestID := requestIDFromContext(c)
+	logWithRequestID(requestID, "🔄 Reprocessing chunk %d (index %d) of book %d", chunk.ID, index, book.ID)
+	go regenerateChunk(book, chunk, requestID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "Chunk reprocessing started",
+		"book_id":  book.ID,
+		"index":    index,
+		"chunk_id": chunk.ID,
+		"status":   "processing",
+	})
+}
+
+// regenerateChunk narrates a claimed chunk again, replaces its audio and rebuilds the
+// page's effects mix. On failure the chunk is marked failed and keeps its old audio.
+func regenerateChunk(book Book, chunk BookChunk, requestID string) {
+	oldAudio, oldFinal := chunk.AudioPath, chunk.FinalAudioPath
+	text, err := prepareChunkText(&chunk)
+	if err != nil {
+		db.Model(&chunk).Update("tts_status", "failed")
+		logWithRequestID(requestID, "❌ Failed to translate chunk %d: %v", chunk.ID, err)
+		return
+	}
+	narration, err := narrateWithFallback(book.TTSProvider, text, chunkNarrationName(chunk.ID), book.ID)
+	if err != nil {
+		db.Model(&chunk).Update("tts_status", "failed")
+		logWithRequestID(requestID, "❌ Failed to regenerate audio of chunk %d: %v", chunk.ID, err)
+		return
+	}
+	audioPath := narration.Path
+	duration := measureDuration(audioPath)
+	if err := db.Model(&chunk).Updates(map[string]interface{}{
+		"audio_path":       audioPath,
+		"final_audio_path": "",
+		"narrated_by":      narration.Provider,
+		"tts_status":       "completed",
+		"duration_seconds": duration,
+		"word_timings":     encodeWordTimings(narration.Timings),
+	}).Error; err != nil {
+		db.Model(&chunk).Update("tts_status", "failed")
+		logWithRequestID(requestID, "❌ Failed to save audio of chunk %d: %v", chunk.ID, err)
+		return
+	}
+	for _, f := range []string{oldAudio, oldFinal} {
+		if f != "" && f != audioPath {
+			os.Remove(f)
+		}
+	}
+	if duration != nil {
+		recordPageUsage(book.ID, book.UserID, *duration)
+	}
+
+	invalidated, err := invalidateChunkGroups(book.ID, chunk.Index)
+	if err != nil {
+		logWithRequestID(requestID, "⚠️ Failed to invalidate chunk groups for book %d index %d: %v", book.ID, chunk.Index, err)
+	}
+	logWithRequestID(requestID, "✅ Reprocessed chunk %d of book %d (%d merged groups dropped)", chunk.ID, book.ID, invalidated)
+
+	// Rebuild the page's effects mix from the new narration
+	processSoundEffectsAndMerge(book, book.ContentHash, []int{chunk.Index})
+}
+
+// invalidateChunkGroups deletes the processed chunk groups of a book that cover index,
+// along with their merged audio, so the next request rebuilds them.
+func invalidateChunkGroups(bookID uint, index int) (int, error) {
+	var groups []ProcessedChunkGroup
+	if err := db.Where("book_id = ? AND start_idx <= ? AND end_idx >= ?", bookID, index, index).Find(&groups).Error; err != nil {
+		return 0, err
+	}
+	return dropChunkGroups(bookID, groups)
+}
+
+// dropChunkGroups deletes merged chunk groups along with their artifact rows and files.
+func dropChunkGroups(bookID uint, groups []ProcessedChunkGroup) (int, error) {
+	for _, g := range groups {
+		if err := db.Delete(&g).Error; err != nil {
+			return 0, err
+		}
+		if err := db.Where("book_id = ? AND path = ?", bookID, g.AudioPath).Delete(&AudioArtifact{}).Error; err != nil {
+			return 0, err
+		}
+		os.Remove(g.AudioPath)
+	}
+	return len(groups), nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReprocessCompletedBook(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "book.txt")
+	if err := os.WriteFile(source, []byte("Once upon a time."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	artifact := filepath.Join(dir, "book_3_chunks_0_0.mp3")
+	if err := os.WriteFile(artifact, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "file_path"}).AddRow(3, 7, bookStatusCompleted, source))
+	expectWithinQuota(mock, 7, 3)
+	mock.ExpectQuery(`SELECT \* FROM "book_files" WHERE book_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "file_path"}).AddRow(1, 3, source))
+	expectWrite(mock, `UPDATE "books" SET .*"status"=\$\d+.* WHERE \(id = \$\d+ AND status NOT IN \(\$\d+,\$\d+\)\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT "audio_path","final_audio_path" FROM "book_chunks"`).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "audio_path" FROM "processed_chunk_groups"`).WillReturnRows(sqlmock.NewRows([]string{"audio_path"}))
+	mock.ExpectQuery(`SELECT "path" FROM "audio_artifacts"`).WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow(artifact))
+	expectWrite(mock, `UPDATE "processed_chunk_groups" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectWrite(mock, `DELETE FROM "audio_artifacts" WHERE book_id = \$1`).WithArgs(uint(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectWrite(mock, `DELETE FROM "book_chunks"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectInsert(mock, `INSERT INTO "book_chunks"`, 20)
+	expectWrite(mock, `UPDATE "book_files" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectWrite(mock, `UPDATE "books" SET "content_truncated"=\$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+	// The narration started in the background; stop it at its first lookup
+	mock.ExpectQuery(`SELECT \* FROM "book_files" WHERE book_id = \$1`).WillReturnError(errors.New("stop"))
+	expectWrite(mock, `UPDATE "books" SET "status"=\$1`).WithArgs(bookStatusFailed, sqlmock.AnyArg(), uint(3), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/reprocess", reprocessBookHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/reprocess", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	var body struct {
+		Status     BookStatus `json:"status"`
+		TotalPages int        `json:"total_pages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != bookStatusProcessing || body.TotalPages != 1 {
+		t.Fatalf("response = %s, want processing with 1 page", w.Body)
+	}
+	// The old narration's registered audio goes with its rows
+	if _, err := os.Stat(artifact); !os.IsNotExist(err) {
+		t.Errorf("artifact of the old narration still exists (stat err = %v)", err)
+	}
+	waitForExpectations(t, mock)
+}
+
+func TestReprocessRefusesBookBeingMixed(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusTTSCompleted))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/reprocess", reprocessBookHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/reprocess", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+}
+
+func TestReprocessCompletedChunk(t *testing.T) {
+	narrationEnv(t)
+	t.Setenv("LOUDNORM_ENABLED", "false")
+	stubAPIs(t, narrationAPI)
+	if err := os.Mkdir("audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	oldAudio, oldFinal, groupAudio := "audio/old_page_1.mp3", "audio/old_page_1_final.mp3", mergedChunkAudioPath(3, 0, 2)
+	for _, p := range []string{oldAudio, oldFinal, groupAudio} {
+		if err := os.WriteFile(p, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newAudio := narrationPath(chunkNarrationName(10))
+
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "tts_provider", "content_hash"}).AddRow(3, 7, bookStatusCompleted, ttsProviderElevenLabs, "abc"))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WithArgs(uint(3), 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "content", "audio_path", "final_audio_path", "tts_status"}).
+			AddRow(10, 3, 1, "Page two.", oldAudio, oldFinal, "completed"))
+	expectWithinQuota(mock, 7, 3)
+	// The completed chunk is claimed again
+	expectWrite(mock, `UPDATE "book_chunks" SET "tts_status"=\$1,"updated_at"=\$2 WHERE id = \$3 AND \(tts_status IS NULL OR tts_status <> \$4\)`).
+		WithArgs("processing", sqlmock.AnyArg(), uint(10), "processing").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// In the background the page is narrated again and its new audio saved
+	mock.ExpectQuery(`SELECT "id","language","target_language" FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "language", "target_language"}).AddRow(3, "en", ""))
+	expectInsert(mock, `INSERT INTO "token_usages"`, 1)
+	expectWrite(mock, `UPDATE "book_chunks" SET .*"audio_path"=.* WHERE "id" = \$\d+`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "book_usages" SET "audio_seconds"=audio_seconds \+ \$1 WHERE book_id = \$2`).
+		WithArgs(4.5, uint(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// The merged group that included the page is dropped
+	mock.ExpectQuery(`SELECT \* FROM "processed_chunk_groups" WHERE \(book_id = \$1 AND start_idx <= \$2 AND end_idx >= \$3\)`).
+		WithArgs(uint(3), 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "start_idx", "end_idx", "audio_path"}).AddRow(4, 3, 0, 2, groupAudio))
+	expectWrite(mock, `UPDATE "processed_chunk_groups" SET "deleted_at"=\$1 WHERE "processed_chunk_groups"."id" = \$2`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectWrite(mock, `DELETE FROM "audio_artifacts" WHERE book_id = \$1 AND path = \$2`).
+		WithArgs(uint(3), groupAudio).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The page is mixed again from the new narration
+	expectAudioSettings(mock, false, false)
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "audio_path", "tts_status"}).AddRow(10, 3, 1, newAudio, "completed"))
+	expectWrite(mock, `UPDATE "book_chunks" SET "final_audio_path"=\$1`).
+		WithArgs(newAudio, sqlmock.AnyArg(), uint(3), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectInsert(mock, `INSERT INTO "audio_artifacts"`, 2).
+		WithArgs(uint(3), artifactPageFinal, 1, 1, newAudio, sqlmock.AnyArg())
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/chunks/:index/reprocess", reprocessChunkHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/chunks/1/reprocess", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	waitForExpectations(t, mock)
+
+	if got, err := os.ReadFile(newAudio); err != nil || string(got) != "elevenlabs mp3" {
+		t.Errorf("new narration = %q (err %v)", got, err)
+	}
+	for _, p := range []string{oldAudio, oldFinal, groupAudio} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after reprocessing (stat err = %v)", p, err)
+		}
+	}
+}
+
+func TestReprocessChunkOwnership(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 8, bookStatusCompleted))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/chunks/:index/reprocess", reprocessChunkHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/chunks/1/reprocess", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+func TestReprocessChunkAlreadyProcessing(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(3, 7, bookStatusCompleted))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "tts_status"}).AddRow(10, 3, 1, "processing"))
+	expectWithinQuota(mock, 7, 3)
+	expectWrite(mock, `UPDATE "book_chunks" SET "tts_status"=\$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodPost, "/user/books/:book_id/chunks/:index/reprocess", reprocessChunkHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/books/3/chunks/1/reprocess", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureJSONLogs switches to JSON logs written to the returned buffer for the rest of
+// the test.
+func captureJSONLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	savedJSON, savedLogger := jsonLogs, jsonLogger
+	jsonLogs, jsonLogger = true, log.New(&buf, "", 0)
+	t.Cleanup(func() { jsonLogs, jsonLogger = savedJSON, savedLogger })
+	return &buf
+}
+
+// logLines parses every line of buf as a JSON object.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	tests := []struct {
+		name      string
+		inbound   string
+		wantReuse bool
+	}{
+		{"inbound ID reused", "client-id-123", true},
+		{"missing ID generated", "", false},
+		{"oversized ID replaced", strings.Repeat("x", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureJSONLogs(t)
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(requestLoggerMiddleware())
+			r.GET("/books/:id", func(c *gin.Context) {
+				logWithRequestID(requestIDFromContext(c), "handling book %s", c.Param("id"))
+				c.Status(http.StatusTeapot)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/books/5", nil)
+			if tt.inbound != "" {
+				req.Header.Set(requestIDHeader, tt.inbound)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if tt.wantReuse && id != tt.inbound {
+				t.Fatalf("%s = %q, want %q", requestIDHeader, id, tt.inbound)
+			}
+			if !tt.wantReuse && !generated.MatchString(id) {
+				t.Fatalf("%s = %q, want a generated ID", requestIDHeader, id)
+			}
+
+			lines := logLines(t, buf)
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want 2", len(lines))
+			}
+			for _, entry := range lines {
+				if entry["request_id"] != id {
+					t.Errorf("log line %v has request_id %v, want %q", entry, entry["request_id"], id)
+				}
+			}
+			if lines[0]["message"] != "handling book 5" {
+				t.Errorf("handler log line = %v", lines[0])
+			}
+			access := lines[1]
+			if access["status"] != float64(http.StatusTeapot) || access["method"] != "GET" || access["path"] != "/books/5" {
+				t.Errorf("access log line = %v", access)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// roleAdmin grants access to the /admin routes.
+const roleAdmin = "admin"
+
+// claimRoles returns the roles in the caller's token. The auth service may send a single
+// "role" string or a "roles" list (a JSON array or a comma-separated string); both are
+// honoured.
+func claimRoles(c *gin.Context) []string {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil
+	}
+	userClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+
+	var roles []string
+	if role, ok := userClaims["role"].(string); ok {
+		roles = append(roles, role)
+	}
+	switch v := userClaims["roles"].(type) {
+	case string:
+		roles = append(roles, strings.Split(v, ",")...)
+	case []interface{}:
+		for _, r := range v {
+			if role, ok := r.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	for i, role := range roles {
+		roles[i] = strings.ToLower(strings.TrimSpace(role))
+	}
+	return roles
+}
+
+// hasRole reports whether the caller's token carries role.
+func hasRole(c *gin.Context, role string) bool {
+	for _, r := range claimRoles(c) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdmin reports whether the caller is an administrator.
+func isAdmin(c *gin.Context) bool {
+	return hasRole(c, roleAdmin)
+}
+
+// requireRole rejects callers without role with 403. It must run after authMiddleware,
+// which has already turned missing or invalid tokens into 401s.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c, role) {
+			abortWithError(c, http.StatusForbidden, codeForbidden, "Insufficient permissions", gin.H{"required_role": role})
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminAuthConfigured reports whether admin tokens can be trusted: HMAC tokens are
+// verified with a JWT_SECRET other than defaultJWTSecret, or are not accepted at all.
+func adminAuthConfigured() bool {
+	allowed := jwtAllowedAlgs()
+	hmac := allowed["HS256"] || allowed["HS384"] || allowed["HS512"]
+	return !hmac || string(jwtSecretKey) != defaultJWTSecret
+}
+
+// requireAdmin gates the /admin routes. They are refused outright while
+// adminAuthConfigured is false, since anyone could forge an admin token.
+func requireAdmin() gin.HandlerFunc {
+	requireAdminRole := requireRole(roleAdmin)
+	return func(c *gin.Context) {
+		if !adminAuthConfigured() {
+			abortWithError(c, http.StatusForbidden, codeForbidden, "Admin routes are disabled until JWT_SECRET is configured", nil)
+			return
+		}
+		requireAdminRole(c)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
@@ -11,10 +12,11 @@ import (
 	"math"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -39,7 +41,14 @@ type SoundEffectRequest struct {
 	PromptInfluence float64 `json:"prompt_influence,omitempty"`
 }
 
-var effectCache = map[string]string{}
+// effectCache maps an effect-prompt hash to its generated clip. effectCacheMu guards
+// it and effectLocks, which serialize generation per hash so concurrent merges
+// never write the same clip twice.
+var (
+	effectCache   = map[string]string{}
+	effectLocks   = map[string]*sync.Mutex{}
+	effectCacheMu sync.Mutex
+)
 var effectPrompts = map[string]string{
 	"sword_clash": "Short metallic sword clash, bright ring, about 2 seconds.",
 	"door_creak":  "Wooden door creaking open, slow, about 2 seconds.",
@@ -79,20 +88,27 @@ func generateSoundEffect(prompt string, id ...interface{}) (string, error) {
 	if len(id) > 0 {
 		out = fmt.Sprintf("./audio/sound_effect_%v.mp3", id[0])
 	} else {
-		out = "./audio/sound_effect.mp3"
+		// Unnamed clips get a unique file so concurrent merges don't overwrite each other
+		f, err := os.CreateTemp("./audio", "sound_effect_*.mp3")
+		if err != nil {
+			return "", fmt.Errorf("create sound file: %w", err)
+		}
+		f.Close()
+		out = f.Name()
 	}
 	if err := os.WriteFile(out, data, 0644); err != nil {
 		return "", fmt.Errorf("write sound file: %w", err)
 	}
+	if err := validateAudioFile(out); err != nil {
+		return "", fmt.Errorf("sound effects API returned unusable audio: %w", err)
+	}
 	return out, nil
 }
 
-// summurizedBookText returns the first 200 chars of txt (or less).
+// summurizedBookText returns the excerpt given to mood segmentation
+// (SEGMENT_EXCERPT_CHARS, default 200).
 func summurizedBookText(txt string) string {
-	if len(txt) > 200 {
-		return strings.TrimSpace(txt[:200]) + "..."
-	}
-	return txt
+	return bookExcerpt(txt, excerptChars("SEGMENT_EXCERPT_CHARS", 200))
 }
 
 // fallbackSegments chops ttsDur into equal-length "neutral" slices.
@@ -112,12 +128,12 @@ func fallbackSegments(ttsDur float64) []Segment {
 }
 
 // generateSegmentInstructions calls GPT to get emotion-based time segments.
-func generateSegmentInstructions(ttsDur float64, bookPath string) ([]Segment, error) {
+func generateSegmentInstructions(ttsDur float64, bookPath string, bookID uint) ([]Segment, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return nil, errors.New("OPENAI_API_KEY not set")
 	}
-	raw, err := os.ReadFile(bookPath)
+	raw, err := readContentFile(bookPath)
 	if err != nil {
 		return nil, fmt.Errorf("read book: %w", err)
 	}
@@ -129,7 +145,7 @@ func generateSegmentInstructions(ttsDur float64, bookPath string) ([]Segment, er
 		ONLY a JSON array of %d segments with keys "start", "end", and "mood" (one of "suspense","action","climax","sad","neutral"), no extras.`, ttsDur, summary, num)
 
 	reqBody := map[string]interface{}{
-		"model":       "gpt-4o",
+		"model":       openAIModels.Segment,
 		"messages":    []map[string]string{{"role": "system", "content": "Audio segmentation assistant."}, {"role": "user", "content": prompt}},
 		"temperature": 0.7,
 		"max_tokens":  300,
@@ -153,14 +169,13 @@ func generateSegmentInstructions(ttsDur float64, bookPath string) ([]Segment, er
 		return fallbackSegments(ttsDur), nil
 	}
 
-	var cr struct {
-		Choices []struct{ Message struct{ Content string } } `json:"choices"`
-	}
+	var cr ChatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
 		raw2, _ := io.ReadAll(resp.Body)
 		log.Printf("decode segmentation failed: %v\nraw: %s\nfalling back", err, raw2)
 		return fallbackSegments(ttsDur), nil
 	}
+	recordChatUsage(bookID, openAIModels.Segment, "segmentation", cr.Usage)
 	if len(cr.Choices) == 0 {
 		log.Print("no segmentation choices; falling back")
 		return fallbackSegments(ttsDur), nil
@@ -182,53 +197,150 @@ func generateSegmentInstructions(ttsDur float64, bookPath string) ([]Segment, er
 		log.Printf("invalid segmentation JSON: %v\nraw: %s\nfalling back", err, trimmed)
 		return fallbackSegments(ttsDur), nil
 	}
-	return segs, nil
+	normalized := normalizeSegments(segs, ttsDur)
+	if len(normalized) == 0 {
+		log.Printf("unusable segmentation %s; falling back", trimmed)
+		return fallbackSegments(ttsDur), nil
+	}
+	return normalized, nil
+}
+
+// segmentMoods are the moods the segmentation prompt allows.
+var segmentMoods = map[string]bool{"suspense": true, "action": true, "climax": true, "sad": true, "neutral": true}
+
+// normalizeSegments turns GPT segments into a clean timeline over [0, ttsDur]: times are
+// clamped, segments are ordered, overlaps are trimmed, empty segments are dropped,
+// gaps (including before the first and after the last) become neutral segments and
+// unknown moods become neutral. It returns nil when no segment survives.
+func normalizeSegments(segs []Segment, ttsDur float64) []Segment {
+	clamp := func(t float64) float64 { return math.Min(math.Max(t, 0), ttsDur) }
+	ordered := make([]Segment, 0, len(segs))
+	for _, s := range segs {
+		s.Start, s.End = clamp(s.Start), clamp(s.End)
+		if s.End <= s.Start {
+			continue
+		}
+		if s.Mood = strings.ToLower(strings.TrimSpace(s.Mood)); !segmentMoods[s.Mood] {
+			s.Mood = "neutral"
+		}
+		ordered = append(ordered, s)
+	}
+	if len(ordered) == 0 {
+		return nil
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Start < ordered[j].Start })
+
+	var out []Segment
+	cursor := 0.0
+	for _, s := range ordered {
+		if s.End <= cursor {
+			continue // Entirely covered by an earlier segment
+		}
+		if s.Start > cursor {
+			out = append(out, Segment{Start: cursor, End: s.Start, Mood: "neutral"})
+		} else {
+			s.Start = cursor
+		}
+		out = append(out, s)
+		cursor = s.End
+	}
+	if cursor < ttsDur {
+		out = append(out, Segment{Start: cursor, End: ttsDur, Mood: "neutral"})
+	}
+	return out
+}
+
+// tempRootDir is where jobs create their scratch directories (TMP_DIR, default the
+// system temp directory).
+func tempRootDir() string {
+	return getEnv("TMP_DIR", os.TempDir())
+}
+
+// newJobTempDir creates a scratch directory TMP_DIR/<bookID>-<random>/ for the
+// intermediate files of one job, so concurrent and retried jobs never share paths.
+func newJobTempDir(bookID uint) (string, error) {
+	root := tempRootDir()
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return "", fmt.Errorf("create temp root: %w", err)
+	}
+	dir, err := os.MkdirTemp(root, fmt.Sprintf("%d-*", bookID))
+	if err != nil {
+		return "", fmt.Errorf("create job temp dir: %w", err)
+	}
+	return dir, nil
 }
 
-// generateDynamicBackgroundWithSegments “stretches” the 22s clip.
-func generateDynamicBackgroundWithSegments(ttsDur float64, bgPath string, segs []Segment) (string, error) {
+// cleanupTempFiles removes a job's scratch directory and everything in it.
+func cleanupTempFiles(dir string) {
+	if dir == "" {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("⚠️ Failed to remove temp dir %s: %v", dir, err)
+	}
+}
+
+// generateDynamicBackgroundWithSegments “stretches” the 22s clip to exactly ttsDur,
+// one looped piece per segment laid end to end.
+// Every intermediate file and the result are written to workDir, the job's scratch
+// directory from newJobTempDir; the caller removes it with cleanupTempFiles.
+func generateDynamicBackgroundWithSegments(ctx context.Context, workDir string, ttsDur float64, bgPath string, segs []Segment) (string, error) {
+	// Segments are concatenated back to back, so each one covers only its own span plus
+	// any silent gap since the previous one; the concat then lines up with the narration.
+	ordered := append([]Segment(nil), segs...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Start < ordered[j].Start })
+
 	var files []string
-	for i, s := range segs {
-		segDur := s.End - s.Start
+	cursor := 0.0
+	for i, s := range ordered {
+		start := math.Max(s.Start, cursor)
+		end := math.Min(s.End, ttsDur)
+		segDur := end - start
 		if segDur <= 0 {
 			continue
 		}
-		out := fmt.Sprintf("./dyn_seg_%d.ogg", i)
-		total := s.Start + segDur
-		delay := int(s.Start * 1000)
-		delayStr := fmt.Sprintf("%d|%d", delay, delay)
+		out := filepath.Join(workDir, fmt.Sprintf("dyn_seg_%d.ogg", i))
+		// The gap is left silent; the music level is applied once, by narrationMixFilter
+		gap := start - cursor
+		delay := int(gap * 1000)
 
-		cmd := exec.Command("ffmpeg", "-y",
+		o, err := runFFmpeg(ctx, out, "-y",
 			"-stream_loop", "-1", "-i", bgPath,
-			"-t", fmt.Sprintf("%.2f", total),
-			"-af", fmt.Sprintf("adelay=%s,volume=0.30", delayStr),
+			"-t", fmt.Sprintf("%.3f", gap+segDur),
+			"-af", fmt.Sprintf("adelay=%d|%d", delay, delay),
 			out,
 		)
-		if o, err := cmd.CombinedOutput(); err != nil {
+		if err != nil {
 			return "", fmt.Errorf("segment %d fail: %v\n%s", i, err, o)
 		}
 		files = append(files, out)
+		cursor = end
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no usable background segments for %.2fs of narration", ttsDur)
 	}
 
 	// write concat list
-	list := "./dyn_list.txt"
-	f, _ := os.Create(list)
+	list := filepath.Join(workDir, "dyn_list.txt")
+	var listing strings.Builder
 	for _, fn := range files {
-		fmt.Fprintf(f, "file '%s'\n", fn)
+		fmt.Fprintf(&listing, "file '%s'\n", fn)
+	}
+	if err := os.WriteFile(list, []byte(listing.String()), 0644); err != nil {
+		return "", fmt.Errorf("write concat list: %w", err)
 	}
-	f.Close()
 
-	staged := "./audio/dynamic_bg_staged.ogg"
-	if o, err := exec.Command("ffmpeg", "-y", "-f", "concat", "-safe", "0", "-i", list, "-c", "copy", staged).CombinedOutput(); err != nil {
+	staged := filepath.Join(workDir, "dynamic_bg_staged.ogg")
+	if o, err := runFFmpeg(ctx, staged, "-y", "-f", "concat", "-safe", "0", "-i", list, "-c", "copy", staged); err != nil {
 		return "", fmt.Errorf("concat fail: %v\n%s", err, o)
 	}
 
-	finalBg := "./audio/dynamic_background_final.ogg"
-	if o, err := exec.Command("ffmpeg", "-y", "-i", staged,
+	finalBg := filepath.Join(workDir, "dynamic_background_final.ogg")
+	if o, err := runFFmpeg(ctx, finalBg, "-y", "-i", staged,
 		"-af", fmt.Sprintf("atrim=duration=%.2f", ttsDur),
 		"-c:a", "libopus", "-b:a", "64k",
 		finalBg,
-	).CombinedOutput(); err != nil {
+	); err != nil {
 		return "", fmt.Errorf("trim fail: %v\n%s", err, o)
 	}
 	return finalBg, nil
@@ -243,38 +355,58 @@ func computeContentHash(filePath string) (string, error) {
 	return fmt.Sprintf("%x", sum), nil
 }
 
+// segmentationMinDuration is the narration length below which pages skip GPT mood
+// segmentation (SEGMENTATION_MIN_SECONDS, default 30).
+func segmentationMinDuration() float64 {
+	secs, err := strconv.ParseFloat(getEnv("SEGMENTATION_MIN_SECONDS", "30"), 64)
+	if err != nil || secs < 0 {
+		return 30
+	}
+	return secs
+}
+
 // mergeAudio overlays TTS narration with the dynamic background.
 
-func mergeAudio(ttsPath, bgPath string, book Book, pageIndex int, bookPath string, hash string) (string, error) {
-	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", ttsPath).Output()
+func mergeAudio(ctx context.Context, ttsPath, bgPath string, book Book, pageIndex int, bookPath string, hash string) (string, error) {
+	out, err := runFFprobe(ctx, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", ttsPath)
 	if err != nil {
 		return "", fmt.Errorf("ffprobe: %w", err)
 	}
 	dur, _ := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
 	log.Printf("TTS duration: %.2f", dur)
 
-	segs, err := generateSegmentInstructions(dur, bookPath)
+	var segs []Segment
+	if dur < segmentationMinDuration() {
+		// Too short for mood changes to matter; loop the bed at a flat volume
+		segs = []Segment{{Start: 0, End: dur, Mood: "neutral"}}
+	} else {
+		segs, err = generateSegmentInstructions(dur, bookPath, book.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+	workDir, err := newJobTempDir(book.ID)
 	if err != nil {
 		return "", err
 	}
-	dynBg, err := generateDynamicBackgroundWithSegments(dur, bgPath, segs)
+	defer cleanupTempFiles(workDir)
+	dynBg, err := generateDynamicBackgroundWithSegments(ctx, workDir, dur, bgPath, segs)
 	if err != nil {
 		return "", err
 	}
 
-	outFile := fmt.Sprintf("./audio/book_%d_page_%d_%s.mp3", book.ID, pageIndex, hash[:8])
-	filterComplex := "[0:a]volume=1.0[a0];[1:a]volume=0.3[a1];[a0][a1]amix=inputs=2:duration=longest[aout]"
+	outFile := fmt.Sprintf("./audio/book_%d_page_%d_%s%s", book.ID, pageIndex, hash[:8], bookAudioExt(book))
+	filterComplex := narrationMixFilter(floatOrDefault(book.MusicVolume, defaultMusicVolume))
 
-	cmd := exec.Command("ffmpeg", "-y",
+	args := []string{"-y",
 		"-i", ttsPath,
 		"-i", dynBg,
 		"-filter_complex", filterComplex,
 		"-map", "[aout]",
-		"-c:a", "libmp3lame",
-		"-q:a", "2",
-		outFile,
-	)
-	if o, err := cmd.CombinedOutput(); err != nil {
+	}
+	args = append(append(args, encoderArgs(outFile)...), outFile)
+	if o, err := runFFmpegWithProgress(ctx, outFile, dur, mergeProgressReporter(book.ID, pageIndex, "music"), args...); err != nil {
+		clearMergeProgress(book.ID, pageIndex)
 		return "", fmt.Errorf("ffmpeg merge: %v\n%s", err, o)
 	}
 	log.Printf("Merged into %s", outFile)
@@ -283,10 +415,10 @@ func mergeAudio(ttsPath, bgPath string, book Book, pageIndex int, bookPath strin
 
 // getTTSDuration returns the length of an audio file in seconds.
 func getTTSDuration(path string) (float64, error) {
-	out, err := exec.Command("ffprobe", "-v", "error",
+	out, err := runFFprobe(backgroundCtx, "-v", "error",
 		"-show_entries", "format=duration",
 		"-of", "default=noprint_wrappers=1:nokey=1",
-		path).Output()
+		path)
 	if err != nil {
 		return 0, fmt.Errorf("ffprobe: %w", err)
 	}
@@ -297,28 +429,86 @@ func getTTSDuration(path string) (float64, error) {
 	return d, nil
 }
 
+// validateAudioFile checks with ffprobe that path holds a decodable audio stream with a
+// positive duration. An invalid file is removed so it is never served as audio.
+func validateAudioFile(path string) error {
+	out, err := runFFprobe(backgroundCtx, "-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_type:format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path)
+	if err == nil {
+		fields := strings.Fields(string(out))
+		if len(fields) < 2 || fields[0] != "audio" {
+			err = errors.New("no audio stream")
+		} else if d, perr := strconv.ParseFloat(fields[len(fields)-1], 64); perr != nil || d <= 0 {
+			err = errors.New("zero or unknown duration")
+		}
+	} else {
+		err = fmt.Errorf("ffprobe: %w", err)
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("invalid audio file %s: %w", path, err)
+	}
+	return nil
+}
+
+// measureDuration returns the length of an audio file, or nil if it cannot be probed.
+func measureDuration(path string) *float64 {
+	if path == "" {
+		return nil
+	}
+	d, err := getTTSDuration(path)
+	if err != nil {
+		log.Printf("⚠️ Could not measure duration of %s: %v", path, err)
+		return nil
+	}
+	return &d
+}
+
+// chunkDurationSeconds returns the stored duration of a completed page, measuring and
+// saving it on first use for pages generated before durations were recorded.
+// Pages without generated audio return nil.
+func chunkDurationSeconds(chunk *BookChunk) *float64 {
+	if chunk.TTSStatus != "completed" {
+		return nil
+	}
+	if chunk.DurationSeconds != nil {
+		return chunk.DurationSeconds
+	}
+	path := chunk.FinalAudioPath
+	if path == "" || !fileExists(path) {
+		path = chunk.AudioPath
+	}
+	if path == "" || !fileExists(path) {
+		return nil
+	}
+	if chunk.DurationSeconds = measureDuration(path); chunk.DurationSeconds != nil {
+		db.Model(&BookChunk{}).Where("id = ?", chunk.ID).Update("duration_seconds", *chunk.DurationSeconds)
+	}
+	return chunk.DurationSeconds
+}
+
 // -------------------- NEW: sound-event extraction & Foley overlay --------------------
 
 // extractSoundEvents asks GPT to identify event types & timestamps.
-func extractSoundEvents(bookPath string, ttsDur float64) (EventMap, error) {
+func extractSoundEvents(bookPath string, ttsDur float64, bookID uint) (EventMap, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return nil, errors.New("OPENAI_API_KEY not set")
 	}
 
-	raw, err := os.ReadFile(bookPath)
+	raw, err := readContentFile(bookPath)
 	if err != nil {
 		return nil, err
 	}
-	sn := string(raw)
-	if len(sn) > 500 {
-		sn = sn[:500]
-	}
+	sn := bookExcerpt(string(raw), excerptChars("EVENT_EXCERPT_CHARS", 500))
 
 	prompt := fmt.Sprintf(`You are an audio event assistant.Given TTS duration of %.2f seconds and this excerpt:%sIdentify distinct event types (e.g. "sword_clash","door_creak") and output ONLY a JSON object mapping each event to an array of timestamps.`, ttsDur, sn)
 
 	reqBody := map[string]interface{}{
-		"model": "gpt-4o",
+		"model": openAIModels.Segment,
 		"messages": []map[string]string{
 			{"role": "system", "content": "Audio event assistant."},
 			{"role": "user", "content": prompt},
@@ -343,12 +533,11 @@ func extractSoundEvents(bookPath string, ttsDur float64) (EventMap, error) {
 		return nil, fmt.Errorf("event API %d: %s", resp.StatusCode, b)
 	}
 
-	var ch struct {
-		Choices []struct{ Message struct{ Content string } } `json:"choices"`
-	}
+	var ch ChatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&ch); err != nil {
 		return nil, err
 	}
+	recordChatUsage(bookID, openAIModels.Segment, "sound_events", ch.Usage)
 	if len(ch.Choices) == 0 {
 		return nil, errors.New("no event choices")
 	}
@@ -362,75 +551,198 @@ func extractSoundEvents(bookPath string, ttsDur float64) (EventMap, error) {
 	if err := json.Unmarshal([]byte(rawC), &ev); err != nil {
 		return nil, fmt.Errorf("unmarshal events: %w\nraw: %s", err, rawC)
 	}
-	return ev, nil
+	return normalizeSoundEvents(ev, ttsDur, maxSoundEvents()), nil
+}
+
+// maxSoundEvents caps how many effects are overlaid on one page so the ffmpeg filter
+// graph stays small (MAX_SOUND_EVENTS, default 20).
+func maxSoundEvents() int {
+	n, err := strconv.Atoi(getEnv("MAX_SOUND_EVENTS", "20"))
+	if err != nil || n < 0 {
+		return 20
+	}
+	return n
 }
 
-// getOrGenerateEffect returns (and caches) one short clip per eventType.
-func getOrGenerateEffect(eventType string) (string, error) {
-	if p, ok := effectCache[eventType]; ok {
+// normalizeSoundEvents keeps the event timestamps that fall inside the narration
+// (a negative time within a second of the start is clamped to 0), drops duplicates and
+// keeps at most limit events overall, earliest first. A ttsDur of 0 means the length
+// is unknown and only the lower bound is checked.
+func normalizeSoundEvents(events EventMap, ttsDur float64, limit int) EventMap {
+	type event struct {
+		name string
+		at   float64
+	}
+	var all []event
+	for name, times := range events {
+		seen := map[float64]bool{}
+		for _, t := range times {
+			if math.IsNaN(t) || math.IsInf(t, 0) || t <= -1 || (ttsDur > 0 && t >= ttsDur) {
+				continue
+			}
+			t = math.Max(t, 0)
+			if !seen[t] {
+				seen[t] = true
+				all = append(all, event{name, t})
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].at != all[j].at {
+			return all[i].at < all[j].at
+		}
+		return all[i].name < all[j].name
+	})
+	if len(all) > limit {
+		log.Printf("⚠️ %d sound events extracted, keeping the first %d", len(all), limit)
+		all = all[:limit]
+	}
+
+	out := EventMap{}
+	for _, e := range all {
+		out[e.name] = append(out[e.name], e.at)
+	}
+	return out
+}
+
+// effectPromptKey returns the cache key and file-name suffix for an effect prompt.
+func effectPromptKey(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// getOrGenerateEffect returns (and caches) one short clip per effective prompt. Both
+// the cache and the file name are keyed by the prompt hash, so books whose prompts
+// differ never share a clip while identical prompts reuse it, even across restarts.
+func getOrGenerateEffect(userID uint, eventType string) (string, error) {
+	prompt := resolveEffectPrompt(userID, eventType)
+	key := effectPromptKey(prompt)
+
+	effectCacheMu.Lock()
+	if p, ok := effectCache[key]; ok && fileExists(p) {
+		effectCacheMu.Unlock()
 		return p, nil
 	}
-	prompt, ok := effectPrompts[eventType]
+	lock, ok := effectLocks[key]
 	if !ok {
-		prompt = fmt.Sprintf("Sound effect for event: %s, about 2 seconds.", eventType)
+		lock = &sync.Mutex{}
+		effectLocks[key] = lock
 	}
-	path, err := generateSoundEffect(prompt, eventType)
-	if err != nil {
-		return "", err
+	effectCacheMu.Unlock()
+
+	// Only one goroutine generates a given clip; the others wait and reuse it
+	lock.Lock()
+	defer lock.Unlock()
+
+	path := fmt.Sprintf("./audio/sound_effect_fx_%s.mp3", key)
+	if !fileExists(path) {
+		generated, err := generateSoundEffect(prompt, "fx_"+key)
+		if err != nil {
+			return "", err
+		}
+		path = generated
 	}
-	effectCache[eventType] = path
+
+	effectCacheMu.Lock()
+	effectCache[key] = path
+	effectCacheMu.Unlock()
 	return path, nil
 }
 
 // -------------------- orchestration --------------------
 
 // processSoundEffectsAndMerge now also injects background Foley.
+// Background music and sound effects each follow the book's Enable* flags; with
+// both disabled the raw TTS audio is used as the final audio without any ffmpeg work.
+// Without pageIndexes (whole-book narration) the book is completed as narrated.
 func processSoundEffectsAndMerge(book Book, hash string, pageIndexes []int) {
 	if book.ContentHash == "" && hash != "" {
 		book.ContentHash = hash
 		db.Model(&Book{}).Where("id = ?", book.ID).Update("content_hash", hash)
 	}
 
-	for _, idx := range pageIndexes {
-		var chunk BookChunk
-		if err := db.Where("book_id = ? AND \"index\" = ?", book.ID, idx).First(&chunk).Error; err != nil {
-			log.Printf("❌ Failed to load chunk index %d: %v", idx, err)
-			continue
-		}
-
-		// Ensure TTS audio file exists
-		if chunk.AudioPath == "" || !fileExists(chunk.AudioPath) {
-			log.Printf("🚫 No TTS audio found for chunk index %d: %s", idx, chunk.AudioPath)
-			continue
+	// Callers may pass a partial Book, so read the audio settings from the stored row
+	settings := loadBookAudioSettings(book.ID)
+	music := boolOrDefault(settings.EnableBackgroundMusic, true)
+	effects := boolOrDefault(settings.EnableSoundEffects, true)
+	book.MusicVolume, book.EffectsVolume = settings.MusicVolume, settings.EffectsVolume
+	book.Genre, book.UniqueMusic = settings.Genre, settings.UniqueMusic
+	book.OutputFormat = settings.OutputFormat
+	if book.UserID == 0 {
+		book.UserID = settings.UserID
+	}
+	if len(pageIndexes) == 0 {
+		// Effects are mixed per page, so whole-book narration is finished as narrated
+		if !music && !effects {
+			log.Printf("⏭️ Sound effects and music disabled for book %d; using raw TTS audio", book.ID)
+		} else {
+			log.Printf("🎙️ No pages to mix for book %d; finishing with plain narration", book.ID)
 		}
+		updateBookStatus(book.ID, bookStatusCompleted)
+		return
+	}
+	plainFallback := boolOrDefault(settings.PlainNarration, plainNarrationFallbackEnabled())
 
-		// Generate background music prompt
-		prompt, err := generateOverallSoundPrompt(book.FilePath)
+	for _, idx := range pageIndexes {
+		// Mixes of the same book take turns page by page
+		unlock, err := lockBookMerge(backgroundCtx, book.ID)
 		if err != nil {
-			log.Printf("prompt err for chunk index %d: %v", idx, err)
-			continue
+			log.Printf("🛑 Stopped mixing book %d: %v", book.ID, err)
+			return
 		}
+		mixBookPage(book, settings, hash, idx, music, effects, plainFallback)
+		unlock()
+	}
+}
 
-		bg, err := generateSoundEffect(prompt)
-		if err != nil {
-			log.Printf("music err for chunk index %d: %v", idx, err)
-			continue
-		}
+// mixBookPage mixes music and effects into one narrated page and saves the result as its
+// final_audio_path. Settings come from loadBookAudioSettings.
+func mixBookPage(book Book, settings Book, hash string, idx int, music, effects, plainFallback bool) {
+	var chunk BookChunk
+	if err := db.Where("book_id = ? AND \"index\" = ?", book.ID, idx).First(&chunk).Error; err != nil {
+		log.Printf("❌ Failed to load chunk index %d: %v", idx, err)
+		return
+	}
 
-		log.Printf("🎶 Background music generated: %s", bg)
+	// Ensure TTS audio file exists
+	if chunk.AudioPath == "" || !fileExists(chunk.AudioPath) {
+		log.Printf("🚫 No TTS audio found for chunk index %d: %s", idx, chunk.AudioPath)
+		return
+	}
 
-		// Mix audio
-		mixedPath, err := mergeAudio(chunk.AudioPath, bg, book, idx, book.FilePath, hash)
+	mixedPath := chunk.AudioPath
+	plain := false // Set when the page falls back to plain narration
+	if music {
+		bg, shared, err := backgroundMusicFor(book)
+		if err == nil {
+			log.Printf("🎶 Background music ready: %s", bg)
+
+			// Mix audio
+			var mixed string
+			mixed, err = mergeAudio(backgroundCtx, chunk.AudioPath, bg, book, idx, book.FilePath, hash)
+			if !shared {
+				os.Remove(bg)
+			}
+			if err == nil {
+				mixedPath = mixed
+			}
+		}
 		if err != nil {
-			log.Printf("mergeAudio err for page index %d: %v", idx, err)
-			continue
+			log.Printf("music err for page index %d: %v", idx, err)
+			if !plainFallback {
+				return
+			}
+			log.Printf("🎙️ Finishing page %d of book %d with plain narration", idx, book.ID)
+			plain = true
 		}
+	}
 
-		// Extract & overlay sound effects
+	// Extract & overlay sound effects
+	if effects && !plain {
 		ttsDur, _ := getTTSDuration(chunk.AudioPath)
-		events, err := extractSoundEvents(book.FilePath, ttsDur)
+		events, err := extractSoundEvents(book.FilePath, ttsDur, book.ID)
 		if err == nil {
-			fxPath, err := overlaySoundEvents(mixedPath, events, book, idx)
+			fxPath, err := overlaySoundEvents(backgroundCtx, mixedPath, events, book, idx)
 			if err != nil {
 				log.Printf("⚠️ overlaySoundEvents failed for index %d: %v", idx, err)
 			} else {
@@ -438,34 +750,115 @@ func processSoundEffectsAndMerge(book Book, hash string, pageIndexes []int) {
 				mixedPath = fxPath // Use the new path with effects
 			}
 		}
+	}
 
-		// ✅ Update the final_audio_path for this chunk only
-		err = db.Model(&BookChunk{}).
-			Where("book_id = ? AND \"index\" = ?", book.ID, idx).
-			Update("final_audio_path", mixedPath).Error
+	// Bring every page to the same loudness
+	if loudnormEnabled() {
+		normalized, err := normalizeLoudness(backgroundCtx, mixedPath, bookAudioExt(book))
 		if err != nil {
-			log.Printf("❌ Failed to update final_audio_path for book_id=%d page=%d: %v", book.ID, idx, err)
+			log.Printf("⚠️ Loudness normalization failed for index %d: %v", idx, err)
 		} else {
-			log.Printf("✅ Updated final_audio_path for book_id=%d page=%d → %s", book.ID, idx, mixedPath)
+			if mixedPath != chunk.AudioPath {
+				os.Remove(mixedPath)
+			}
+			mixedPath = normalized
 		}
+	}
+
+	// Mix steps already write the book's format; only untouched narration needs encoding
+	if format := outputFormatOrDefault(settings.OutputFormat); filepath.Ext(mixedPath) != bookAudioExt(book) {
+		encoded, err := transcodeAudio(backgroundCtx, mixedPath, format)
+		if err != nil {
+			log.Printf("⚠️ Encoding page %d as %s failed, keeping MP3: %v", idx, format, err)
+		} else {
+			if mixedPath != chunk.AudioPath {
+				os.Remove(mixedPath)
+			}
+			mixedPath = encoded
+		}
+	}
+
+	// ✅ Update the final_audio_path for this chunk only
+	err := db.Model(&BookChunk{}).
+		Where("book_id = ? AND \"index\" = ?", book.ID, idx).
+		Update("final_audio_path", mixedPath).Error
+	clearMergeProgress(book.ID, idx)
+	if err != nil {
+		log.Printf("❌ Failed to update final_audio_path for book_id=%d page=%d: %v", book.ID, idx, err)
+	} else {
+		log.Printf("✅ Updated final_audio_path for book_id=%d page=%d → %s", book.ID, idx, mixedPath)
+		if err := recordAudioArtifact(book.ID, artifactPageFinal, idx, idx, mixedPath); err != nil {
+			log.Printf("⚠️ Failed to record final audio of book_id=%d page=%d: %v", book.ID, idx, err)
+		}
+		publishChunkCompleted(book.UserID, BookChunk{BookID: book.ID, Index: idx})
+	}
+}
 
-		// Optional: delete temporary audio files here if needed
-		cleanupTempFiles(uint(book.ID))
+// loadBookAudioSettings loads only the owner, genre, music/effects and output format settings of a book. A book that
+// cannot be loaded yields nil settings, i.e. the defaults.
+func loadBookAudioSettings(bookID uint) Book {
+	var book Book
+	if err := db.Select("id", "user_id", "enable_background_music", "enable_sound_effects", "music_volume", "effects_volume", "output_format", "genre", "unique_music", "plain_narration").
+		First(&book, bookID).Error; err != nil {
+		log.Printf("⚠️ Could not load audio settings for book %d, using defaults: %v", bookID, err)
+		return Book{}
 	}
+	return book
+}
+
+// Default mix levels used when a book has no MusicVolume/EffectsVolume set.
+const (
+	defaultMusicVolume   = 0.30
+	defaultEffectsVolume = 0.45
+)
+
+// floatOrDefault dereferences f, returning def when it is nil.
+func floatOrDefault(f *float64, def float64) float64 {
+	if f == nil {
+		return def
+	}
+	return *f
+}
+
+// narrationMixFilter builds the filter_complex that mixes narration with background
+// music at the given music volume.
+func narrationMixFilter(musicVolume float64) string {
+	return fmt.Sprintf("[0:a]volume=1.0[a0];[1:a]volume=%.2f[a1];[a0][a1]amix=inputs=2:duration=longest[aout]", musicVolume)
+}
+
+// effectDelayFilter builds the filter for one sound-effect occurrence delayed by delayMs.
+func effectDelayFilter(inLbl string, delayMs int, effectsVolume float64, outLbl string) string {
+	return fmt.Sprintf("%sadelay=%d|%d,volume=%.2f%s", inLbl, delayMs, delayMs, effectsVolume, outLbl)
+}
+
+// plainNarrationFallbackEnabled reports whether pages whose music or effects fail are
+// finished with their plain narration instead of being left unfinished
+// (PLAIN_NARRATION_FALLBACK, default false). Book.PlainNarration overrides it.
+func plainNarrationFallbackEnabled() bool {
+	return getEnv("PLAIN_NARRATION_FALLBACK", "false") == "true"
+}
+
+// boolOrDefault dereferences b, returning def when it is nil.
+func boolOrDefault(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
 }
 
 // overlaySoundEvents updated to accept book
-func overlaySoundEvents(baseMix string, events EventMap, book Book, pageIndex int) (string, error) {
+func overlaySoundEvents(ctx context.Context, baseMix string, events EventMap, book Book, pageIndex int) (string, error) {
 	safeTitle := strings.ReplaceAll(strings.ToLower(book.Title), " ", "_")
 	hashSuffix := book.ContentHash[:8]
-	outFile := fmt.Sprintf("./audio/final_with_fx_%s_%d_page_%d_%s.ogg", safeTitle, book.ID, pageIndex, hashSuffix)
+	outFile := fmt.Sprintf("./audio/final_with_fx_%s_%d_page_%d_%s%s", safeTitle, book.ID, pageIndex, hashSuffix, bookAudioExt(book))
 
 	args := []string{"-y", "-i", baseMix}
 	var filters, labels []string
 	inputIdx := 1
+	effectsVolume := floatOrDefault(book.EffectsVolume, defaultEffectsVolume)
 
 	for evt, times := range events {
-		clip, err := getOrGenerateEffect(evt)
+		clip, err := getOrGenerateEffect(book.UserID, evt)
 		if err != nil {
 			log.Printf("warning: %s clip error: %v", evt, err)
 			continue
@@ -475,7 +868,7 @@ func overlaySoundEvents(baseMix string, events EventMap, book Book, pageIndex in
 			d := int(t * 1000)
 			inLbl := fmt.Sprintf("[%d:a]", inputIdx)
 			outLbl := fmt.Sprintf("[e%d_%d]", inputIdx, j)
-			filters = append(filters, fmt.Sprintf("%sadelay=%d|%d,volume=0.45%s", inLbl, d, d, outLbl))
+			filters = append(filters, effectDelayFilter(inLbl, d, effectsVolume, outLbl))
 			labels = append(labels, outLbl)
 		}
 		inputIdx++
@@ -484,24 +877,17 @@ func overlaySoundEvents(baseMix string, events EventMap, book Book, pageIndex in
 	totalIn := 1 + len(labels)
 	filters = append(filters, fmt.Sprintf("%samix=inputs=%d:duration=first:dropout_transition=0", amixIn, totalIn))
 
-	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-c:a", "libopus", "-b:a", "64k", outFile)
+	args = append(args, "-filter_complex", strings.Join(filters, ";"))
+	args = append(append(args, encoderArgs(outFile)...), outFile)
 
-	if o, err := exec.Command("ffmpeg", args...).CombinedOutput(); err != nil {
+	dur, _ := getTTSDuration(baseMix)
+	if o, err := runFFmpegWithProgress(ctx, outFile, dur, mergeProgressReporter(book.ID, pageIndex, "effects"), args...); err != nil {
+		clearMergeProgress(book.ID, pageIndex)
 		return "", fmt.Errorf("overlaySoundEvents FFmpeg fail: %v\n%s", err, o)
 	}
 	return outFile, nil
 }
 
-// cleanupTempFiles removes dynamic segments and lists
-func cleanupTempFiles(_ uint) {
-	pattern := "dyn_seg_*.ogg"
-	matches, _ := filepath.Glob(pattern)
-	for _, file := range matches {
-		os.Remove(file)
-	}
-	os.Remove("dyn_list.txt")
-}
-
 // adding helper function for file existence check
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNormalizeSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		segs []Segment
+		want []Segment
+	}{
+		{"none", nil, nil},
+		{"only empty segments", []Segment{{5, 5, "sad"}, {7, 3, "action"}}, nil},
+		{
+			"gaps become neutral",
+			[]Segment{{2, 5, "Action"}},
+			[]Segment{{0, 2, "neutral"}, {2, 5, "action"}, {5, 10, "neutral"}},
+		},
+		{
+			"clamped with unknown mood",
+			[]Segment{{-3, 12, "happy"}},
+			[]Segment{{0, 10, "neutral"}},
+		},
+		{
+			"overlap trimmed",
+			[]Segment{{0, 6, "sad"}, {4, 8, "suspense"}},
+			[]Segment{{0, 6, "sad"}, {6, 8, "suspense"}, {8, 10, "neutral"}},
+		},
+		{
+			"covered segment dropped",
+			[]Segment{{0, 10, "climax"}, {2, 3, "sad"}},
+			[]Segment{{0, 10, "climax"}},
+		},
+		{
+			"ordered by start",
+			[]Segment{{6, 10, " SAD "}, {0, 3, "action"}},
+			[]Segment{{0, 3, "action"}, {3, 6, "neutral"}, {6, 10, "sad"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeSegments(tt.segs, 10); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("normalizeSegments(%v, 10) = %v, want %v", tt.segs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeSoundEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events EventMap
+		ttsDur float64
+		limit  int
+		want   EventMap
+	}{
+		{"none", EventMap{}, 10, 20, EventMap{}},
+		{
+			"out of range and duplicates dropped",
+			EventMap{"door": {1, 1, -0.5, -2, 12, 10}, "rain": {0.5, math.NaN(), math.Inf(1)}},
+			10, 20,
+			EventMap{"door": {0, 1}, "rain": {0.5}},
+		},
+		{
+			"earliest kept over the limit",
+			EventMap{"door": {9, 1}, "rain": {0.5, 4}},
+			10, 2,
+			EventMap{"door": {1}, "rain": {0.5}},
+		},
+		{
+			"unknown length only checks the start",
+			EventMap{"thunder": {100, -5}},
+			0, 20,
+			EventMap{"thunder": {100}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeSoundEvents(tt.events, tt.ttsDur, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("normalizeSoundEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrationMixFilter(t *testing.T) {
+	tests := []struct {
+		volume float64
+		want   string
+	}{
+		{defaultMusicVolume, "[0:a]volume=1.0[a0];[1:a]volume=0.30[a1];[a0][a1]amix=inputs=2:duration=longest[aout]"},
+		{0, "[0:a]volume=1.0[a0];[1:a]volume=0.00[a1];[a0][a1]amix=inputs=2:duration=longest[aout]"},
+		{0.5, "[0:a]volume=1.0[a0];[1:a]volume=0.50[a1];[a0][a1]amix=inputs=2:duration=longest[aout]"},
+	}
+	for _, tt := range tests {
+		if got := narrationMixFilter(tt.volume); got != tt.want {
+			t.Errorf("narrationMixFilter(%v) = %q, want %q", tt.volume, got, tt.want)
+		}
+	}
+}
+
+func TestEffectDelayFilter(t *testing.T) {
+	got := effectDelayFilter("[1:a]", 1500, 0.45, "[e1_0]")
+	if want := "[1:a]adelay=1500|1500,volume=0.45[e1_0]"; got != want {
+		t.Fatalf("effectDelayFilter() = %q, want %q", got, want)
+	}
+}
+
+func TestNewJobTempDir(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "scratch")
+	t.Setenv("TMP_DIR", root)
+
+	first, err := newJobTempDir(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newJobTempDir(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("two jobs of one book share %s", first)
+	}
+	for _, dir := range []string{first, second} {
+		if filepath.Dir(dir) != root || !strings.HasPrefix(filepath.Base(dir), "42-") {
+			t.Errorf("job dir %s, want %s/42-<random>", dir, root)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(first, "bg.mp3"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cleanupTempFiles(first)
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after cleanup (err = %v)", first, err)
+	}
+	if _, err := os.Stat(second); err != nil {
+		t.Errorf("cleanup of one job removed another: %v", err)
+	}
+}
+
+// catFFmpeg is a fake ffmpeg that writes its -i input to the output file, or the files
+// listed in it when the input is a concat list.
+const catFFmpeg = `eval out=\${$#}
+while [ $# -gt 0 ]; do [ "$1" = -i ] && in=$2; shift; done
+case "$in" in
+*.txt) sed -n "s/^file '\(.*\)'\$/\1/p" "$in" | while read -r f; do cat "$f"; done ;;
+*) cat "$in" ;;
+esac > "$out"`
+
+func TestConcurrentMergesUseOwnScratchFiles(t *testing.T) {
+	t.Setenv("TMP_DIR", filepath.Join(t.TempDir(), "scratch"))
+	fakeFFmpeg(t, catFFmpeg)
+	segs := []Segment{{Start: 0, End: 5, Mood: "calm"}, {Start: 5, End: 10, Mood: "action"}}
+
+	// Pages of one book are mixed at the same time, each with its own music
+	const merges = 4
+	results := make([]string, merges)
+	var wg sync.WaitGroup
+	for i := range merges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bg := filepath.Join(t.TempDir(), "bg.mp3")
+			if err := os.WriteFile(bg, []byte(fmt.Sprintf("[music %d]", i)), 0o644); err != nil {
+				t.Error(err)
+				return
+			}
+			workDir, err := newJobTempDir(3)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer cleanupTempFiles(workDir)
+			out, err := generateDynamicBackgroundWithSegments(context.Background(), workDir, 10, bg, segs)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = string(got)
+		}()
+	}
+	wg.Wait()
+
+	for i, got := range results {
+		if want := fmt.Sprintf("[music %d][music %d]", i, i); got != want {
+			t.Errorf("merge %d background = %q, want %q; another merge wrote over its files", i, got, want)
+		}
+	}
+}
+
+func TestUnnamedSoundEffectsGetOwnFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XI_API_KEY", "xi-test")
+	fakeValidAudio(t)
+	soundEffectsAPI(t, nil)
+
+	const clips = 4
+	paths := make([]string, clips)
+	var wg sync.WaitGroup
+	for i := range clips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path, err := generateSoundEffect(fmt.Sprintf("background %d", i))
+			if err != nil {
+				t.Error(err)
+			}
+			paths[i] = path
+		}()
+	}
+	wg.Wait()
+
+	for i, path := range paths {
+		if got, err := os.ReadFile(path); err != nil || string(got) != fmt.Sprintf("background %d", i) {
+			t.Errorf("clip %d at %s = %q (err %v); another clip wrote over it", i, path, got, err)
+		}
+	}
+}
+
+func TestValidateAudioFile(t *testing.T) {
+	// The fake ffprobe answers from the probed file's content: "mp3" is decodable audio,
+	// "silent" has no duration, "image" has no audio stream, anything else is unreadable
+	fakeCommand(t, "ffprobe", `eval f=\${$#}
+case "$(cat "$f")" in
+mp3) printf 'audio\n3.250000\n' ;;
+silent) printf 'audio\nN/A\n' ;;
+image) printf '2.000000\n' ;;
+*) echo "$f: Invalid data found when processing input" >&2; exit 1 ;;
+esac`)
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{"mp3", true},
+		{"silent", false},
+		{"image", false},
+		{`{"error": "quota exceeded"}`, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "out.mp3")
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := validateAudioFile(path)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateAudioFile(%q) = %v, want valid %v", tt.content, err, tt.valid)
+		}
+		// A rejected file is removed so it is never served
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) == tt.valid {
+			t.Errorf("validateAudioFile(%q): file exists = %v, want %v", tt.content, statErr == nil, tt.valid)
+		}
+	}
+}
+
+func TestMixBookPagePlainNarrationFallback(t *testing.T) {
+	t.Setenv("LOUDNORM_ENABLED", "false")
+	narration := filepath.Join(t.TempDir(), "page_0.mp3")
+	if err := os.WriteFile(narration, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The book's source file is gone, so the music stage fails before calling any API
+	book := Book{ID: 3, UserID: 7, FilePath: filepath.Join(t.TempDir(), "missing.txt")}
+
+	for _, fallback := range []bool{true, false} {
+		mock := mockDB(t)
+		mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "audio_path", "tts_status"}).AddRow(10, 3, 0, narration, "completed"))
+		if fallback {
+			// The page is finished with its narration as the final audio
+			expectWrite(mock, `UPDATE "book_chunks" SET "final_audio_path"=\$1`).
+				WithArgs(narration, sqlmock.AnyArg(), uint(3), 0).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			expectInsert(mock, `INSERT INTO "audio_artifacts"`, 1).
+				WithArgs(uint(3), artifactPageFinal, 0, 0, narration, sqlmock.AnyArg())
+		}
+
+		mixBookPage(book, Book{}, "abc", 0, true, true, fallback)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("fallback %v: %v", fallback, err)
+		}
+	}
+}
+
+// expectAudioSettings expects loadBookAudioSettings for book 3 with music and effects
+// switched on or off.
+func expectAudioSettings(mock sqlmock.Sqlmock, music, effects bool) {
+	mock.ExpectQuery(`SELECT "id","user_id","enable_background_music","enable_sound_effects",.* FROM "books"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "enable_background_music", "enable_sound_effects"}).AddRow(3, 7, music, effects))
+}
+
+func TestDisabledEffectsAndMusicSkipMixing(t *testing.T) {
+	t.Setenv("LOUDNORM_ENABLED", "false")
+	// Any ffmpeg or ffprobe run leaves a marker behind
+	dir := fakeFFmpeg(t, `touch "$(dirname "$0")/ran"; exit 1`)
+	fakeCommand(t, "ffprobe", `touch "`+dir+`/ran"; exit 1`)
+	narration := filepath.Join(t.TempDir(), "page_0.mp3")
+	if err := os.WriteFile(narration, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := mockDB(t)
+	expectAudioSettings(mock, false, false)
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE book_id = \$1 AND "index" = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index", "audio_path", "tts_status"}).AddRow(10, 3, 0, narration, "completed"))
+	// The raw narration becomes the page's final audio
+	expectWrite(mock, `UPDATE "book_chunks" SET "final_audio_path"=\$1`).
+		WithArgs(narration, sqlmock.AnyArg(), uint(3), 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectInsert(mock, `INSERT INTO "audio_artifacts"`, 1).
+		WithArgs(uint(3), artifactPageFinal, 0, 0, narration, sqlmock.AnyArg())
+
+	processSoundEffectsAndMerge(Book{ID: 3, ContentHash: "abc"}, "abc", []int{0})
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Error("ffmpeg ran for a book with sound effects and music disabled")
+	}
+}
+
+func TestDisabledEffectsAndMusicCompleteWholeBook(t *testing.T) {
+	dir := fakeFFmpeg(t, `touch "$(dirname "$0")/ran"; exit 1`)
+	mock := mockDB(t)
+	expectAudioSettings(mock, false, false)
+	// Whole-book narration is completed as narrated
+	args := append([]driver.Value{bookStatusCompleted, sqlmock.AnyArg(), uint(3)}, anyArgs(len(bookStatusPredecessors(bookStatusCompleted)))...)
+	expectWrite(mock, `UPDATE "books" SET "status"=\$1`).WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	processSoundEffectsAndMerge(Book{ID: 3, ContentHash: "abc"}, "abc", nil)
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Error("ffmpeg ran for a book with sound effects and music disabled")
+	}
+}
+
+func TestGetOrGenerateEffectConcurrent(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("XI_API_KEY", "xi-test")
+	fakeValidAudio(t)
+	freshEffectCache(t)
+	var calls atomic.Int32
+	soundEffectsAPI(t, &calls)
+
+	// Merges of several books need the same thunder clip at once
+	const callers = 8
+	paths := make([]string, callers)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			path, err := getOrGenerateEffect(0, "thunder")
+			if err != nil {
+				t.Error(err)
+			}
+			paths[i] = path
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("clip generated %d times, want once", n)
+	}
+	want := fmt.Sprintf("./audio/sound_effect_fx_%s.mp3", effectPromptKey(effectPrompts["thunder"]))
+	for i, path := range paths {
+		if path != want {
+			t.Errorf("caller %d got %q, want %q", i, path, want)
+		}
+	}
+}
+
+func TestGetOrGenerateEffectReusesClipOnDisk(t *testing.T) {
+	t.Chdir(t.TempDir())
+	freshEffectCache(t)
+	var calls atomic.Int32
+	soundEffectsAPI(t, &calls)
+	// A clip generated before a restart is found by its prompt hash
+	path := fmt.Sprintf("./audio/sound_effect_fx_%s.mp3", effectPromptKey(effectPrompts["door_creak"]))
+	if err := os.MkdirAll("./audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("creak"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := getOrGenerateEffect(0, "door_creak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path || calls.Load() != 0 {
+		t.Errorf("got %q after %d API calls, want the existing %q without a call", got, calls.Load(), path)
+	}
+}
+
+// segmentRenders returns the -t and -af values of each looped background segment in the
+// ffmpeg calls logged to log, in call order.
+func segmentRenders(t *testing.T, log string) [][2]string {
+	t.Helper()
+	raw, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var renders [][2]string
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		args := strings.Fields(line)
+		if !slices.Contains(args, "-stream_loop") {
+			continue
+		}
+		var r [2]string
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "-t":
+				r[0] = args[i+1]
+			case "-af":
+				r[1] = args[i+1]
+			}
+		}
+		renders = append(renders, r)
+	}
+	return renders
+}
+
+func TestBackgroundSegmentsFollowMoodDurations(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "ffmpeg.log")
+	t.Setenv("FFMPEG_LOG", log)
+	fakeFFmpeg(t, `echo "$*" >> "$FFMPEG_LOG"`+"\n"+catFFmpeg)
+	bg := filepath.Join(t.TempDir(), "bg.mp3")
+	if err := os.WriteFile(bg, []byte("[music]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Out of order, overlapping, with a gap before the last mood and running past the
+	// 35s of narration
+	segs := []Segment{
+		{Start: 20, End: 50, Mood: "action"},
+		{Start: 0, End: 12, Mood: "calm"},
+		{Start: 10, End: 18, Mood: "sad"},
+		{Start: 40, End: 45, Mood: "after the end"},
+	}
+
+	out, err := generateDynamicBackgroundWithSegments(context.Background(), t.TempDir(), 35, bg, segs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each piece covers its own span, so laid end to end they add up to the narration:
+	// calm 0-12, sad 12-18 (after calm), 2s of silence then action 20-35
+	want := [][2]string{{"12.000", "adelay=0|0"}, {"6.000", "adelay=0|0"}, {"17.000", "adelay=2000|2000"}}
+	if got := segmentRenders(t, log); !slices.Equal(got, want) {
+		t.Fatalf("segments rendered as %q, want %q", got, want)
+	}
+	if got, err := os.ReadFile(out); err != nil || string(got) != "[music][music][music]" {
+		t.Fatalf("background = %q (%v), want the three segments concatenated", got, err)
+	}
+}
+
+func TestBackgroundWithoutUsableSegments(t *testing.T) {
+	fakeFFmpeg(t, catFFmpeg)
+	segs := []Segment{{Start: 40, End: 45, Mood: "after the end"}, {Start: 5, End: 5, Mood: "empty"}}
+
+	if _, err := generateDynamicBackgroundWithSegments(context.Background(), t.TempDir(), 35, "bg.mp3", segs); err == nil {
+		t.Fatal("no error for segments that cover none of the narration")
+	}
+}
+
+func TestSegmentationMinDuration(t *testing.T) {
+	tests := []struct {
+		env  string
+		want float64
+	}{
+		{"", 30},
+		{"45", 45},
+		{"0", 0},
+		{"-5", 30},
+		{"soon", 30},
+	}
+	for _, tt := range tests {
+		t.Setenv("SEGMENTATION_MIN_SECONDS", tt.env)
+		if got := segmentationMinDuration(); got != tt.want {
+			t.Errorf("SEGMENTATION_MIN_SECONDS=%q: %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+// mergePage mixes a page whose narration ffprobe reports as seconds long and returns
+// how many segmentation requests reached GPT and the background segments rendered.
+func mergePage(t *testing.T, seconds string) (int32, [][2]string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("TMP_DIR", filepath.Join(t.TempDir(), "scratch"))
+	log := filepath.Join(t.TempDir(), "ffmpeg.log")
+	t.Setenv("FFMPEG_LOG", log)
+	fakeCommand(t, "ffprobe", "echo "+seconds)
+	fakeFFmpeg(t, `echo "$*" >> "$FFMPEG_LOG"`+"\n"+catFFmpeg)
+	var calls atomic.Int32
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// Fails, so segmentation falls back without recording token usage
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	for name, content := range map[string]string{"page.txt": "It was a dark night.", "page.mp3": "[narration]", "bg.mp3": "[music]"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll("audio", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mergeAudio(context.Background(), "page.mp3", "bg.mp3", Book{ID: 3}, 0, "page.txt", "abcdef0123"); err != nil {
+		t.Fatal(err)
+	}
+	return calls.Load(), segmentRenders(t, log)
+}
+
+func TestShortPageSkipsMoodSegmentation(t *testing.T) {
+	calls, renders := mergePage(t, "29.5")
+	if calls != 0 {
+		t.Fatalf("%d segmentation requests for a 29.5s page, want none under the 30s default", calls)
+	}
+	if want := [][2]string{{"29.500", "adelay=0|0"}}; !slices.Equal(renders, want) {
+		t.Fatalf("segments rendered as %q, want one flat segment %q", renders, want)
+	}
+}
+
+func TestLongPageGetsMoodSegmentation(t *testing.T) {
+	calls, renders := mergePage(t, "44.0")
+	if calls != 1 {
+		t.Fatalf("%d segmentation requests for a 44s page, want 1", calls)
+	}
+	// The fallback splits the page into 22s moods
+	if want := [][2]string{{"22.000", "adelay=0|0"}, {"22.000", "adelay=0|0"}}; !slices.Equal(renders, want) {
+		t.Fatalf("segments rendered as %q, want %q", renders, want)
+	}
+}
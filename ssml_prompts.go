@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// ssmlPromptData is what SSML prompt templates can refer to: {{.Language}} is the
+// language name, {{.Code}} its ISO 639-1 code.
+type ssmlPromptData struct {
+	Language string
+	Code     string
+}
+
+// defaultSSMLPrompt is used for English and for languages without their own template.
+const defaultSSMLPrompt = `You are an expressive audiobook narrator.
+Convert this into SSML:
+- Use <break time="500ms"/> at natural pauses
+- Wrap key phrases in <emphasis>
+- Use <prosody rate="80%">…</prosody> for sad passages
+- Use <prosody rate="110%">…</prosody> for action passages
+Output only the SSML wrapped in one <speak>…</speak> block.{{if and .Code (ne .Code "en")}}
+The text is in {{.Language}}. Keep every word in {{.Language}}; never translate it.{{end}}`
+
+// builtinSSMLPrompts holds SSML prompt templates tuned to the punctuation and rhythm of
+// a language, keyed by ISO 639-1 code.
+var builtinSSMLPrompts = map[string]string{
+	"fr": `You are an expressive French audiobook narrator.
+Convert this French text into SSML:
+- Use <break time="400ms"/> after sentences and before « and after » in dialogue; never break inside a liaison
+- Wrap key phrases in <emphasis level="moderate">; French stresses the last syllable of a phrase, so keep emphasis sparing
+- Use <prosody rate="85%">…</prosody> for sad passages
+- Use <prosody rate="108%">…</prosody> for action passages
+Keep every word in French; never translate it.
+Output only the SSML wrapped in one <speak>…</speak> block.`,
+	"es": `You are an expressive Spanish audiobook narrator.
+Convert this Spanish text into SSML:
+- Use <break time="450ms"/> at natural pauses and after each closing ? or !; questions and exclamations open with ¿ and ¡, so start their intonation there
+- Use <break time="300ms"/> before a dialogue line introduced with a dash (—)
+- Wrap key phrases in <emphasis>
+- Use <prosody rate="82%">…</prosody> for sad passages
+- Use <prosody rate="110%">…</prosody> for action passages
+Keep every word in Spanish; never translate it.
+Output only the SSML wrapped in one <speak>…</speak> block.`,
+	"de": `You are an expressive German audiobook narrator.
+Convert this German text into SSML:
+- Use <break time="500ms"/> at natural pauses and <break time="250ms"/> before subordinate clauses introduced by a comma
+- Never insert breaks inside compound words
+- Wrap key phrases in <emphasis>; emphasise the word carrying the meaning, often the verb at the end of the clause
+- Use <prosody rate="80%">…</prosody> for sad passages
+- Use <prosody rate="105%">…</prosody> for action passages
+Keep every word in German; never translate it.
+Output only the SSML wrapped in one <speak>…</speak> block.`,
+	"ja": `You are an expressive Japanese audiobook narrator.
+Convert this Japanese text into SSML:
+- Use <break time="400ms"/> after 。 and <break time="200ms"/> after 、 where a pause sounds natural
+- Do not add spaces between words
+- Wrap key phrases in <emphasis level="reduced"> sparingly; Japanese narration relies on pauses more than stress
+- Use <prosody rate="85%">…</prosody> for sad passages
+- Use <prosody rate="105%">…</prosody> for action passages
+Keep every word in Japanese; never translate it.
+Output only the SSML wrapped in one <speak>…</speak> block.`,
+}
+
+// ssmlPromptDir is where operators put their own templates as <code>.tmpl, plus an
+// optional default.tmpl for other languages (SSML_PROMPT_DIR, unset by default).
+func ssmlPromptDir() string {
+	return getEnv("SSML_PROMPT_DIR", "")
+}
+
+// ssmlPromptTemplate returns the template for a language and where it came from: an
+// operator template for the language, the built-in one, the operator default, then
+// the built-in default.
+func ssmlPromptTemplate(code string) (source, text string) {
+	dir := ssmlPromptDir()
+	if dir != "" && code != "" {
+		if data, err := os.ReadFile(filepath.Join(dir, code+".tmpl")); err == nil {
+			return filepath.Join(dir, code+".tmpl"), string(data)
+		}
+	}
+	if text, ok := builtinSSMLPrompts[code]; ok {
+		return "builtin:" + code, text
+	}
+	if dir != "" {
+		if data, err := os.ReadFile(filepath.Join(dir, "default.tmpl")); err == nil {
+			return filepath.Join(dir, "default.tmpl"), string(data)
+		}
+	}
+	return "builtin:default", defaultSSMLPrompt
+}
+
+// ssmlSystemPrompt renders the SSML system prompt for a language. A template that fails
+// to render is logged and replaced by the built-in default.
+func ssmlSystemPrompt(code string) string {
+	data := ssmlPromptData{Language: languageName(code), Code: code}
+	source, text := ssmlPromptTemplate(code)
+	prompt, err := renderSSMLPrompt(text, data)
+	if err != nil {
+		log.Printf("⚠️ SSML prompt template %s is invalid, using the default: %v", source, err)
+		prompt, _ = renderSSMLPrompt(defaultSSMLPrompt, data)
+	}
+	return prompt
+}
+
+// renderSSMLPrompt executes one prompt template.
+func renderSSMLPrompt(text string, data ssmlPromptData) (string, error) {
+	tmpl, err := template.New("ssml").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSMLPromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{"fr.tmpl": "operator fr", "default.tmpl": "operator default"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		dir        string
+		code       string
+		wantSource string
+	}{
+		{"built-in language", "", "es", "builtin:es"},
+		{"built-in default", "", "nl", "builtin:default"},
+		{"no language", "", "", "builtin:default"},
+		{"operator language beats built-in", dir, "fr", filepath.Join(dir, "fr.tmpl")},
+		{"built-in language beats operator default", dir, "es", "builtin:es"},
+		{"operator default", dir, "nl", filepath.Join(dir, "default.tmpl")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SSML_PROMPT_DIR", tt.dir)
+			if tt.dir == "" {
+				os.Unsetenv("SSML_PROMPT_DIR")
+			}
+			if source, _ := ssmlPromptTemplate(tt.code); source != tt.wantSource {
+				t.Fatalf("ssmlPromptTemplate(%q) source = %q, want %q", tt.code, source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestSSMLSystemPrompt(t *testing.T) {
+	t.Setenv("SSML_PROMPT_DIR", "")
+	os.Unsetenv("SSML_PROMPT_DIR")
+
+	if got := ssmlSystemPrompt("en"); strings.Contains(got, "never translate") {
+		t.Errorf("English prompt asks to keep the language:\n%s", got)
+	}
+	if got := ssmlSystemPrompt("nl"); !strings.Contains(got, "Keep every word in Dutch") {
+		t.Errorf("default prompt for nl does not name the language:\n%s", got)
+	}
+
+	// A broken operator template falls back to the built-in default
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nl.tmpl"), []byte("{{.Nope"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSML_PROMPT_DIR", dir)
+	if got := ssmlSystemPrompt("nl"); !strings.Contains(got, "Keep every word in Dutch") {
+		t.Errorf("broken template did not fall back to the default:\n%s", got)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// allowedSSMLTags are the elements kept in generated SSML; anything else GPT invents is
+// stripped during repair.
+var allowedSSMLTags = map[string]bool{
+	"speak": true, "break": true, "emphasis": true, "prosody": true, "p": true, "s": true,
+	"say-as": true, "sub": true, "phoneme": true, "lang": true,
+}
+
+var (
+	ssmlTagPattern    = regexp.MustCompile(`</?([A-Za-z][\w:.-]*)[^<>]*>`)
+	xmlEntityPattern  = regexp.MustCompile(`^&(amp|lt|gt|quot|apos|#[0-9]+|#x[0-9a-fA-F]+);`)
+	strayAnglePattern = regexp.MustCompile(`<([^A-Za-z/])`)
+)
+
+// checkSSML reports why s is not a single well-formed <speak> document.
+func checkSSML(s string) error {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	depth, root := 0, ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if root != "" {
+					return errors.New("more than one root element")
+				}
+				root = t.Name.Local
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && strings.TrimSpace(string(t)) != "" {
+				return errors.New("text outside <speak>")
+			}
+		}
+	}
+	if root != "speak" {
+		return fmt.Errorf("root element is %q, not speak", root)
+	}
+	return nil
+}
+
+// repairSSML escapes stray ampersands and angle brackets and strips elements that are
+// not SSML. It cannot fix mismatched tags; checkSSML decides whether it worked.
+func repairSSML(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '&' && !xmlEntityPattern.MatchString(s[i:]) {
+			b.WriteString("&amp;")
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	s = strayAnglePattern.ReplaceAllString(b.String(), "&lt;$1")
+	return ssmlTagPattern.ReplaceAllStringFunc(s, func(tag string) string {
+		name := strings.ToLower(ssmlTagPattern.FindStringSubmatch(tag)[1])
+		if allowedSSMLTags[name] {
+			return tag
+		}
+		return ""
+	})
+}
+
+// plainSSML wraps text as SSML without any markup.
+func plainSSML(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(strings.TrimSpace(text)))
+	return "<speak>\n" + b.String() + "\n</speak>"
+}
+
+// safeSSML returns ssml if it is well formed, a repaired copy if repair fixes it, and
+// plainText wrapped without markup otherwise, so one bad tag never fails a whole page.
+func safeSSML(ssml, plainText string, bookID uint) string {
+	err := checkSSML(ssml)
+	if err == nil {
+		return ssml
+	}
+	repaired := repairSSML(ssml)
+	if rerr := checkSSML(repaired); rerr == nil {
+		log.Printf("🩹 Repaired malformed SSML for book %d: %v", bookID, err)
+		return repaired
+	}
+	log.Printf("🩹 Malformed SSML for book %d could not be repaired, narrating plain text: %v", bookID, err)
+	return plainSSML(plainText)
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestCheckSSML(t *testing.T) {
+	tests := []struct {
+		ssml  string
+		valid bool
+	}{
+		{"<speak>Hello</speak>", true},
+		{"<speak><p>Hi <break time=\"1s\"/> there</p></speak>\n", true},
+		{"<speak>a</speak><speak>b</speak>", false},
+		{"hello <speak>x</speak>", false},
+		{"<p>x</p>", false},
+		{"<speak>Tom & Jerry</speak>", false},
+		{"<speak><emphasis>x</speak>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := checkSSML(tt.ssml); (err == nil) != tt.valid {
+			t.Errorf("checkSSML(%q) = %v, want valid=%v", tt.ssml, err, tt.valid)
+		}
+	}
+}
+
+func TestRepairSSML(t *testing.T) {
+	tests := []struct {
+		ssml, want string
+	}{
+		{"<speak>Tom & Jerry</speak>", "<speak>Tom &amp; Jerry</speak>"},
+		{"<speak>a &amp; b &#39; &#x27;</speak>", "<speak>a &amp; b &#39; &#x27;</speak>"},
+		{"<speak>1 < 2</speak>", "<speak>1 &lt; 2</speak>"},
+		{"<speak><voice name=\"x\">Hi</voice></speak>", "<speak>Hi</speak>"},
+		{"<speak><Prosody rate=\"slow\">Hi</Prosody></speak>", "<speak><Prosody rate=\"slow\">Hi</Prosody></speak>"},
+		{"<speak><say-as interpret-as=\"date\">1/2</say-as></speak>", "<speak><say-as interpret-as=\"date\">1/2</say-as></speak>"},
+	}
+	for _, tt := range tests {
+		got := repairSSML(tt.ssml)
+		if got != tt.want {
+			t.Errorf("repairSSML(%q) = %q, want %q", tt.ssml, got, tt.want)
+		}
+	}
+}
+
+func TestSafeSSML(t *testing.T) {
+	tests := []struct {
+		name, ssml, want string
+	}{
+		{"valid kept", "<speak>Hi</speak>", "<speak>Hi</speak>"},
+		{"repaired", "<speak>Q&A <foo>now</foo></speak>", "<speak>Q&amp;A now</speak>"},
+		{"falls back to plain text", "<speak><p>unclosed</speak>", "<speak>\nR&amp;D &lt;1&gt;\n</speak>"},
+	}
+	for _, tt := range tests {
+		if got := safeSSML(tt.ssml, " R&D <1> ", 1); got != tt.want {
+			t.Errorf("%s: safeSSML(%q) = %q, want %q", tt.name, tt.ssml, got, tt.want)
+		}
+	}
+}
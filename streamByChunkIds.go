@@ -1,46 +1,127 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-	
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
 	"gorm.io/gorm"
 )
 
-// StreamByChunkIDsRequest is the request payload for streaming by chunk IDs.
+// StreamByChunkIDsRequest is the request payload for streaming by chunk IDs. At most
+// maxChunkIDsPerRequest IDs are accepted.
 type StreamByChunkIDsRequest struct {
-	ChunkIDs []uint `json:"chunk_ids" binding:"required,min=1,max=10"`
+	ChunkIDs []uint `json:"chunk_ids" binding:"required,min=1"`
 	BookID   uint   `json:"book_id" binding:"required"`
 }
 
+// maxChunkIDsPerRequest caps the chunk IDs of one audio-by-id request
+// (MAX_CHUNK_IDS_PER_REQUEST, default 10).
+func maxChunkIDsPerRequest() int {
+	n, err := strconv.Atoi(getEnv("MAX_CHUNK_IDS_PER_REQUEST", "10"))
+	if err != nil || n < 1 {
+		return 10
+	}
+	return n
+}
+
+// uniqueChunkIDs drops repeated IDs, keeping the first occurrence.
+func uniqueChunkIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// missingChunkIDs returns the requested IDs that are not among found, in request order.
+func missingChunkIDs(requested []uint, found []BookChunk) []uint {
+	have := make(map[uint]bool, len(found))
+	for _, ch := range found {
+		have[ch.ID] = true
+	}
+	missing := []uint{}
+	for _, id := range requested {
+		if !have[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
 var once sync.Once
 
+// Job priorities: a listener waiting on a few pages goes ahead of whole-book batches.
+const (
+	jobPriorityBulk        = 0
+	jobPriorityInteractive = 10
+)
+
 // streamAudioByChunkIDsHandler streams audio by matching chunk IDs.
 func streamAudioByChunkIDsHandler(c *gin.Context) {
 	var req StreamByChunkIDsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	req.ChunkIDs = uniqueChunkIDs(req.ChunkIDs)
+	if limit := maxChunkIDsPerRequest(); len(req.ChunkIDs) > limit {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("At most %d chunk IDs per request", limit), gin.H{"max_chunk_ids": limit, "requested": len(req.ChunkIDs)})
 		return
 	}
 
 	claims, _ := c.Get("claims")
 	userID := extractUserIDFromClaims(claims)
 
+	var book Book
+	if err := db.Select("id", "user_id").First(&book, req.BookID).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != userID {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+	if !enforceBookModeration(c, book.ID) {
+		return
+	}
+
+	// A retried request carrying the same Idempotency-Key gets the original job back
+	var idemKey *string
+	if key := strings.TrimSpace(c.GetHeader("Idempotency-Key")); key != "" {
+		if len(key) > 255 {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key must be at most 255 characters", nil)
+			return
+		}
+		idemKey = &key
+		if job, found := findJobByIdempotencyKey(userID, key); found {
+			c.JSON(http.StatusAccepted, gin.H{"message": "Your request has been queued.", "job_id": job.ID, "status": job.Status})
+			return
+		}
+	}
+
 	var chunks []BookChunk
 	if err := db.Where("id IN ? AND book_id = ?", req.ChunkIDs, req.BookID).Find(&chunks).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chunks", "details": err.Error()})
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch chunks", err.Error())
 		return
 	}
-	if len(chunks) != len(req.ChunkIDs) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Some chunks not found"})
+	// IDs of another book's chunks are reported as missing from this one
+	if missing := missingChunkIDs(req.ChunkIDs, chunks); len(missing) > 0 {
+		respondError(c, http.StatusNotFound, codeChunkNotFound, "Some chunks not found in this book", gin.H{"missing_chunk_ids": missing})
 		return
 	}
 	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
@@ -48,28 +129,60 @@ func streamAudioByChunkIDsHandler(c *gin.Context) {
 	endIdx := chunks[len(chunks)-1].Index
 
 	if audioPath, found := checkIfChunkGroupProcessed(req.BookID, startIdx, endIdx); found {
-		c.File(audioPath)
+		serveAudioFile(c, audioPath)
 		return
 	}
 
-	var combined strings.Builder
-	for _, chunk := range chunks {
-		combined.WriteString(chunk.Content)
+	// Text over the TTS limit is split into batches by the worker (see processChunkIDsJob).
+
+	chunkIDs := normalizeChunkIDs(req.ChunkIDs)
+
+	// Reuse a pending job for the same chunk set instead of queueing duplicate work
+	var existing TTSQueueJob
+	err := db.Where("book_id = ? AND chunk_ids = ? AND status IN ?", req.BookID, chunkIDs, []string{"queued", "processing"}).
+		Order("id").
+		First(&existing).Error
+	if err == nil {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Your request is already queued.", "job_id": existing.ID, "status": existing.Status})
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to check queued jobs", err.Error())
+		return
 	}
-	if len(combined.String()) > 2000 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Combined text exceeds TTS limit (2000 bytes)"})
+
+	if !enforceUserQuota(c, userID, req.BookID) {
 		return
 	}
 
 	// Save job to DB
 	job := TTSQueueJob{
-		BookID:   req.BookID,
-		ChunkIDs: joinUintSlice(req.ChunkIDs),
-		Status:   "queued",
-		UserID:   userID,
+		BookID:         req.BookID,
+		ChunkIDs:       chunkIDs,
+		Status:         "queued",
+		Priority:       jobPriorityInteractive,
+		UserID:         userID,
+		IdempotencyKey: idemKey,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		// A concurrent request with the same key may have won the unique index
+		if idemKey != nil {
+			if existing, found := findJobByIdempotencyKey(userID, *idemKey); found {
+				c.JSON(http.StatusAccepted, gin.H{"message": "Your request has been queued.", "job_id": existing.ID, "status": existing.Status})
+				return
+			}
+		}
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to queue request", err.Error())
+		return
 	}
-	db.Create(&job)
-	c.JSON(http.StatusAccepted, gin.H{"message": "Your request has been queued."})
+	c.JSON(http.StatusAccepted, gin.H{"message": "Your request has been queued.", "job_id": job.ID, "status": job.Status})
+}
+
+// normalizeChunkIDs returns the chunk IDs sorted and comma-joined so that the same
+// set always produces the same TTSQueueJob.ChunkIDs value.
+func normalizeChunkIDs(ids []uint) string {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return joinUintSlice(sorted)
 }
 
 func joinUintSlice(nums []uint) string {
@@ -81,48 +194,116 @@ func joinUintSlice(nums []uint) string {
 }
 
 func extractUserIDFromClaims(claims any) uint {
-	if m, ok := claims.(map[string]any); ok {
-		if uid, ok := m["user_id"].(float64); ok {
-			return uint(uid)
-		}
+	var m map[string]any
+	switch v := claims.(type) {
+	case jwt.MapClaims:
+		m = v
+	case map[string]any:
+		m = v
+	}
+	if uid, ok := m["user_id"].(float64); ok {
+		return uint(uid)
 	}
 	return 0
 }
 
+// findJobByIdempotencyKey looks up a job previously created by userID with the given key.
+func findJobByIdempotencyKey(userID uint, key string) (TTSQueueJob, bool) {
+	var job TTSQueueJob
+	if err := db.Where("user_id = ? AND idempotency_key = ?", userID, key).First(&job).Error; err != nil {
+		return job, false
+	}
+	return job, true
+}
+
+// workerStop is closed by stopTTSWorker to stop the worker from claiming new jobs.
+var workerStop = make(chan struct{})
+
+// workerDone is closed when the worker loop has exited.
+var workerDone = make(chan struct{})
+
+// inFlightJobID holds the ID of the job the worker is running, or 0 when idle.
+var inFlightJobID atomic.Uint64
+
+// sleepOrStop waits for d, or until a job is queued, and reports false if the worker
+// was asked to stop meanwhile. The timeout keeps polling as a fallback when
+// notifications are unavailable.
+func sleepOrStop(d time.Duration) bool {
+	select {
+	case <-workerStop:
+		return false
+	case <-jobQueued:
+		return true
+	case <-time.After(d):
+		return true
+	}
+}
+
+// nextQueuedJob returns the job the worker should run next: the highest priority first,
+// oldest first within a priority, skipping jobs still waiting out a retry delay.
+func nextQueuedJob() (TTSQueueJob, error) {
+	var job TTSQueueJob
+	err := db.
+		Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", "queued", time.Now()).
+		Order("priority DESC, created_at, id").
+		First(&job).Error
+	return job, err
+}
+
 func startTTSWorker() {
 	once.Do(func() {
 		go func() {
+			defer close(workerDone)
 			for {
-				var job TTSQueueJob
-				res := db.
-					Where("status = ?", "queued").
-					Order("created_at, id").
-					First(&job)
+				// Stop claiming new work once shutdown has begun
+				select {
+				case <-workerStop:
+					log.Println("🛑 TTS worker stopped")
+					return
+				default:
+				}
+
+				job, err := nextQueuedJob()
 
 				// No work to do right now
-				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-					time.Sleep(5 * time.Second)
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					sleepOrStop(5 * time.Second)
 					continue
 				}
 				// Something went wrong talking to the DB
-				if res.Error != nil {
-					log.Printf("❌ error fetching queued TTS job: %v", res.Error)
-					time.Sleep(10 * time.Second)
+				if err != nil {
+					log.Printf("❌ error fetching queued TTS job: %v", err)
+					sleepOrStop(10 * time.Second)
 					continue
 				}
 
 				// Mark it in-flight
-				if err := db.Model(&job).Update("status", "processing").Error; err != nil {
+				claimed, err := claimTTSJob(&job)
+				if err != nil {
 					log.Printf("❌ failed to mark job #%d processing: %v", job.ID, err)
 					// skip processing this one for now
-					time.Sleep(5 * time.Second)
+					sleepOrStop(5 * time.Second)
+					continue
+				}
+				if !claimed {
+					// Another worker got there first
 					continue
 				}
 
 				// Do the work
-				if err := processMergedChunks(job.BookID); err != nil {
-					log.Printf("❌ processing job #%d failed: %v", job.ID, err)
-					db.Model(&job).Update("status", "failed")
+				inFlightJobID.Store(uint64(job.ID))
+				err = processChunkIDsJob(backgroundCtx, job)
+				inFlightJobID.Store(0)
+				if err != nil && backgroundCtx.Err() != nil {
+					// Cut off by shutdown; leave it for the next start
+					log.Printf("🔁 Job #%d interrupted by shutdown, requeueing", job.ID)
+					if err := requeueInterruptedJob(job.ID); err != nil {
+						log.Printf("⚠️ Failed to requeue job #%d: %v", job.ID, err)
+					}
+					continue
+				}
+				if err != nil {
+					failJob(job, err)
 					continue
 				}
 
@@ -135,6 +316,61 @@ func startTTSWorker() {
 	})
 }
 
+// stopTTSWorker stops the worker from claiming new jobs and waits for the in-flight
+// job to finish or ctx to expire. A job cut off by the deadline is put back in the queue.
+func stopTTSWorker(ctx context.Context) error {
+	select {
+	case <-workerStop:
+	default:
+		close(workerStop)
+	}
+	select {
+	case <-workerDone:
+		return nil
+	case <-ctx.Done():
+		requeueInFlightJob()
+		return ctx.Err()
+	}
+}
+
+// claimTTSJob moves a queued job to processing and counts the attempt. The update only
+// matches while the job is still queued and not waiting out a retry delay, so it reports
+// false when another worker claimed the job first.
+func claimTTSJob(job *TTSQueueJob) (bool, error) {
+	res := db.Model(&TTSQueueJob{}).
+		Where("id = ? AND status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", job.ID, "queued", time.Now()).
+		Updates(map[string]interface{}{"status": "processing", "attempts": gorm.Expr("attempts + 1")})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	job.Status = "processing"
+	job.Attempts++
+	return true, nil
+}
+
+// requeueInterruptedJob puts a processing job cut off by shutdown back in the queue.
+// Shutdown isn't the job's fault, so the attempt doesn't count. Only a job still marked
+// processing is touched, so requeueing it twice gives back one attempt.
+func requeueInterruptedJob(jobID uint) error {
+	return db.Model(&TTSQueueJob{}).
+		Where("id = ? AND status = ?", jobID, "processing").
+		Updates(map[string]interface{}{"status": "queued", "attempts": gorm.Expr("attempts - 1")}).Error
+}
+
+// requeueInFlightJob puts the job the worker is still running back in the queue.
+// It is called when the shutdown deadline expires before the job finishes.
+func requeueInFlightJob() {
+	jobID := inFlightJobID.Load()
+	if jobID == 0 {
+		return
+	}
+	if err := requeueInterruptedJob(uint(jobID)); err != nil {
+		log.Printf("⚠️ Failed to requeue in-flight job #%d: %v", jobID, err)
+		return
+	}
+	log.Printf("🔁 Requeued in-flight job #%d", jobID)
+}
+
 func parseChunkIDs(s string) []uint {
 	parts := strings.Split(s, ",")
 	var ids []uint
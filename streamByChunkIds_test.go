@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNormalizeChunkIDs(t *testing.T) {
+	tests := []struct {
+		ids  []uint
+		want string
+	}{
+		{nil, ""},
+		{[]uint{5}, "5"},
+		{[]uint{3, 1, 2}, "1,2,3"},
+		{[]uint{10, 9, 100}, "9,10,100"},
+	}
+	for _, tt := range tests {
+		in := slices.Clone(tt.ids)
+		if got := normalizeChunkIDs(tt.ids); got != tt.want {
+			t.Errorf("normalizeChunkIDs(%v) = %q, want %q", tt.ids, got, tt.want)
+		}
+		if !slices.Equal(tt.ids, in) {
+			t.Errorf("normalizeChunkIDs reordered its input to %v", tt.ids)
+		}
+	}
+}
+
+func TestUniqueChunkIDs(t *testing.T) {
+	got := uniqueChunkIDs([]uint{4, 2, 4, 7, 2})
+	if want := []uint{4, 2, 7}; !slices.Equal(got, want) {
+		t.Fatalf("uniqueChunkIDs() = %v, want %v", got, want)
+	}
+}
+
+func TestMissingChunkIDs(t *testing.T) {
+	found := []BookChunk{{ID: 2}, {ID: 9}}
+	if got, want := missingChunkIDs([]uint{9, 3, 2, 5}, found), []uint{3, 5}; !slices.Equal(got, want) {
+		t.Fatalf("missingChunkIDs() = %v, want %v", got, want)
+	}
+	if got := missingChunkIDs([]uint{2, 9}, found); got == nil || len(got) != 0 {
+		t.Fatalf("missingChunkIDs() with all found = %#v, want an empty list", got)
+	}
+}
+
+func TestMaxChunkIDsPerRequest(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 10},
+		{"25", 25},
+		{"0", 10},
+		{"lots", 10},
+	}
+	for _, tt := range tests {
+		t.Setenv("MAX_CHUNK_IDS_PER_REQUEST", tt.env)
+		if tt.env == "" {
+			os.Unsetenv("MAX_CHUNK_IDS_PER_REQUEST")
+		}
+		if got := maxChunkIDsPerRequest(); got != tt.want {
+			t.Errorf("MAX_CHUNK_IDS_PER_REQUEST=%q: got %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestClaimTTSJob(t *testing.T) {
+	mock := mockDB(t)
+	// A job waiting out its retry delay is not claimed early
+	claim := `UPDATE "tts_queue_jobs" SET "attempts"=attempts \+ 1,"status"=\$1,"updated_at"=\$2 WHERE id = \$3 AND status = \$4 AND \(next_attempt_at IS NULL OR next_attempt_at <= \$5\)`
+	mock.ExpectBegin()
+	mock.ExpectExec(claim).WithArgs("processing", sqlmock.AnyArg(), uint(4), "queued", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// A second worker racing for the same job matches no queued row
+	mock.ExpectBegin()
+	mock.ExpectExec(claim).WithArgs("processing", sqlmock.AnyArg(), uint(4), "queued", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	job := TTSQueueJob{ID: 4, Status: "queued", Attempts: 1}
+	if claimed, err := claimTTSJob(&job); err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v; want claimed", claimed, err)
+	}
+	if job.Status != "processing" || job.Attempts != 2 {
+		t.Errorf("claimed job = %s with %d attempts, want processing with 2", job.Status, job.Attempts)
+	}
+	other := TTSQueueJob{ID: 4, Status: "queued", Attempts: 1}
+	if claimed, err := claimTTSJob(&other); err != nil || claimed {
+		t.Fatalf("second claim = %v, %v; want not claimed", claimed, err)
+	}
+}
+
+func TestRequeueInterruptedJob(t *testing.T) {
+	mock := mockDB(t)
+	// Both the worker and the shutdown deadline may requeue the same job; only the
+	// update that still finds it processing gives the attempt back
+	requeue := `UPDATE "tts_queue_jobs" SET "attempts"=attempts - 1,"status"=\$1,"updated_at"=\$2 WHERE id = \$3 AND status = \$4`
+	mock.ExpectBegin()
+	mock.ExpectExec(requeue).WithArgs("queued", sqlmock.AnyArg(), uint(4), "processing").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(requeue).WithArgs("queued", sqlmock.AnyArg(), uint(4), "processing").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	inFlightJobID.Store(4)
+	t.Cleanup(func() { inFlightJobID.Store(0) })
+	requeueInFlightJob()
+	if err := requeueInterruptedJob(4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamByChunkIDsIdempotencyKey(t *testing.T) {
+	mock := mockDB(t)
+	expectBook := func() {
+		mock.ExpectQuery(`SELECT "id","user_id" FROM "books" WHERE "books"."id" = \$1`).
+			WithArgs(uint(3), 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+	}
+	findByKey := `SELECT \* FROM "tts_queue_jobs" WHERE user_id = \$1 AND idempotency_key = \$2`
+
+	// The first request finds no job for the key and queues one
+	expectBook()
+	mock.ExpectQuery(findByKey).WithArgs(uint(7), "retry-1", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "book_chunks" WHERE id IN \(\$1,\$2\) AND book_id = \$3`).
+		WithArgs(uint(12), uint(11), uint(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "index"}).AddRow(11, 3, 0).AddRow(12, 3, 1))
+	mock.ExpectQuery(`SELECT \* FROM "processed_chunk_groups" WHERE \(book_id = \$1 AND start_idx = \$2 AND end_idx = \$3\) AND "processed_chunk_groups"."deleted_at" IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT \* FROM "tts_queue_jobs" WHERE book_id = \$1 AND chunk_ids = \$2`).
+		WithArgs(uint(3), "11,12", "queued", "processing", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	expectWithinQuota(mock, 7, 3)
+	expectInsert(mock, `INSERT INTO "tts_queue_jobs"`, 42)
+
+	// The retry gets the same job back without creating another row
+	expectBook()
+	mock.ExpectQuery(findByKey).WithArgs(uint(7), "retry-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "book_id", "status", "user_id"}).AddRow(42, 3, "queued", 7))
+
+	router := userRouter(7, http.MethodPost, "/user/chunks/audio-by-id", streamAudioByChunkIDsHandler)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/user/chunks/audio-by-id", strings.NewReader(`{"book_id": 3, "chunk_ids": [12, 11]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", " retry-1 ")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("request %d: status = %d, want 202: %s", i+1, w.Code, w.Body)
+		}
+		var body struct {
+			JobID uint `json:"job_id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.JobID != 42 {
+			t.Errorf("request %d: job_id = %d, want 42", i+1, body.JobID)
+		}
+	}
+}
+
+func TestNextQueuedJobPriorityOrder(t *testing.T) {
+	mock := mockDB(t)
+	// Interactive jobs go ahead of bulk ones; within a priority the oldest runs first
+	mock.ExpectQuery(`SELECT \* FROM "tts_queue_jobs" WHERE status = \$1 AND \(next_attempt_at IS NULL OR next_attempt_at <= \$2\) ORDER BY priority DESC, created_at, id,"tts_queue_jobs"."id" LIMIT \$3`).
+		WithArgs("queued", sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "priority"}).AddRow(9, jobPriorityInteractive))
+
+	job, err := nextQueuedJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != 9 || job.Priority != jobPriorityInteractive {
+		t.Fatalf("next job = #%d at priority %d, want #9 at %d", job.ID, job.Priority, jobPriorityInteractive)
+	}
+}
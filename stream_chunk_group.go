@@ -11,22 +11,22 @@ import (
 // streamChunkGroupAudioHandler returns the merged audio for a specific chunk group if it exists.
 func streamChunkGroupAudioHandler(c *gin.Context) {
 	bookIDStr := c.Param("book_id")
-	startStr := c.Param("start")
+	startStr := c.Param("index") // first page; shares the :index segment of the page routes
 	endStr := c.Param("end")
 
 	bookID, err1 := strconv.Atoi(bookIDStr)
 	startIdx, err2 := strconv.Atoi(startStr)
 	endIdx, err3 := strconv.Atoi(endStr)
 	if err1 != nil || err2 != nil || err3 != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parameters"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid parameters", nil)
 		return
 	}
 
 	audioPath, found := checkIfChunkGroupProcessed(uint(bookID), startIdx, endIdx)
 	if !found {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No audio found for chunks %d-%d", startIdx, endIdx)})
+		respondError(c, http.StatusNotFound, codeAudioNotFound, fmt.Sprintf("No audio found for chunks %d-%d", startIdx, endIdx), nil)
 		return
 	}
 
-	c.File(audioPath)
+	serveAudioFile(c, audioPath)
 }
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"log"
 	"net/http"
 	"os"
 
@@ -14,72 +14,74 @@ func proxyBookAudioHandler(c *gin.Context) {
 	tokenString := c.Query("token")
 
 	if tokenString == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Token is required", nil)
 		return
 	}
 
-	fmt.Println("🎫 Token received:", tokenString)
-
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecretKey, nil
-	})
+	token, err := jwt.Parse(tokenString, jwtKeyFunc)
 	if err != nil || !token.Valid {
-		fmt.Println("❌ Invalid or expired token:", err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		log.Printf("❌ Invalid or expired token: %v", err)
+		respondError(c, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token", nil)
 		return
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		fmt.Println("❌ Failed to extract claims from token")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid token claims"})
+		log.Println("❌ Failed to extract claims from token")
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Invalid token claims", nil)
+		return
+	}
+	if msg := checkIssuerAudience(claims); msg != "" {
+		log.Printf("❌ %s", msg)
+		respondError(c, http.StatusUnauthorized, codeInvalidToken, msg, nil)
 		return
 	}
 
 	userIDFloat, ok := claims["user_id"].(float64)
 	if !ok {
-		fmt.Println("❌ User ID not found in token claims:", claims)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found in token"})
+		log.Println("❌ User ID not found in token claims")
+		respondError(c, http.StatusInternalServerError, codeInternalError, "User ID not found in token", nil)
 		return
 	}
 	userID := uint(userIDFloat)
-	fmt.Printf("✅ Token user ID: %d\n", userID)
+	log.Printf("✅ Token user ID: %d", userID)
 
 	if bookID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book ID is required"})
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Book ID is required", nil)
 		return
 	}
 
-	fmt.Println("🔍 Looking up book with ID:", bookID)
+	log.Printf("🔍 Looking up book with ID: %s", bookID)
 
 	var book Book
 	if err := db.First(&book, bookID).Error; err != nil {
-		fmt.Println("❌ Book not found:", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "details": err.Error()})
+		log.Printf("❌ Book not found: %v", err)
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", err.Error())
 		return
 	}
 
-	fmt.Printf("📘 Book found: ID=%d, Title=%s, UserID=%d\n", book.ID, book.Title, book.UserID)
+	log.Printf("📘 Book found: ID=%d, Title=%s, UserID=%d", book.ID, book.Title, book.UserID)
 
 	if book.UserID != userID {
-		fmt.Printf("🚫 Unauthorized access attempt. Token UserID=%d, Book Owner=%d\n", userID, book.UserID)
-		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to access this book"})
+		log.Printf("🚫 Unauthorized access attempt. Token UserID=%d, Book Owner=%d", userID, book.UserID)
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
 		return
 	}
 
 	if book.AudioPath == "" {
-		fmt.Println("❌ Audio path is empty for this book")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Audio file not available for this book"})
+		log.Println("❌ Audio path is empty for this book")
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Audio file not available for this book", nil)
 		return
 	}
 
 	if _, err := os.Stat(book.AudioPath); os.IsNotExist(err) {
-		fmt.Println("❌ Audio file not found on disk:", book.AudioPath)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Audio file not found on server", "details": err.Error()})
+		log.Printf("❌ Audio file not found on disk: %s", book.AudioPath)
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Audio file not found on server", err.Error())
 		return
 	}
 
-	fmt.Println("🎧 Serving audio file:", book.AudioPath)
-	c.Header("Content-Type", "audio/mpeg")
-	c.File(book.AudioPath)
+	audioPath := negotiateBookAudio(c, book)
+	log.Printf("🎧 Serving audio file: %s", audioPath)
+	c.Header("Content-Type", audioContentType(audioPath))
+	serveAudioFile(c, audioPath)
 }
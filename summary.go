@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// summaryPieceBytes is how much text one GPT summary call receives. Longer books are
+// summarised piece by piece and the partial summaries are summarised again.
+const summaryPieceBytes = 12000
+
+// summarizeText asks GPT for a summary of text with the given instruction.
+func summarizeText(text, instruction string, bookID uint) (string, error) {
+	return chatCompletion(ChatRequest{
+		Model: openAIModels.Light,
+		Messages: []ChatMessage{
+			{Role: "system", Content: instruction},
+			{Role: "user", Content: text},
+		},
+		MaxTokens:   500,
+		Temperature: 0.3,
+	}, bookID, "summary")
+}
+
+// generateBookSummary summarises a book's pages, map-reducing over pieces of
+// summaryPieceBytes so very long books fit the model.
+func generateBookSummary(bookID uint) (string, error) {
+	contents, err := loadChunkTexts(db.Where("book_id = ?", bookID).Order("\"index\" ASC"))
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(strings.Join(contents, "\n"))
+	if text == "" {
+		return "", fmt.Errorf("book %d has no text", bookID)
+	}
+
+	const final = "Write a concise synopsis (at most 150 words) of this book for a reader deciding whether to listen. Do not reveal the ending."
+	for len(text) > summaryPieceBytes {
+		pieces := splitTextIntoBatches(text, summaryPieceBytes)
+		partials := make([]string, 0, len(pieces))
+		for i, piece := range pieces {
+			partial, err := summarizeText(piece, "Summarise this part of a book in a short paragraph, keeping the main characters and events.", bookID)
+			if err != nil {
+				return "", fmt.Errorf("summarise part %d/%d: %w", i+1, len(pieces), err)
+			}
+			partials = append(partials, partial)
+		}
+		text = strings.Join(partials, "\n\n")
+	}
+	return summarizeText(text, final, bookID)
+}
+
+// summariesInProgress holds the books whose summary is being generated, so repeated
+// requests don't start more GPT runs for the same book.
+var (
+	summariesInProgress   = map[uint]bool{}
+	summariesInProgressMu sync.Mutex
+)
+
+// startBookSummary generates a book's summary in the background unless that is already
+// running, and reports whether it started. The summary is saved only if the book's
+// content hash is still hash, so an edit made meanwhile is not summarised stale.
+func startBookSummary(bookID uint, hash string) bool {
+	summariesInProgressMu.Lock()
+	defer summariesInProgressMu.Unlock()
+	if summariesInProgress[bookID] {
+		return false
+	}
+	summariesInProgress[bookID] = true
+
+	go func() {
+		defer func() {
+			summariesInProgressMu.Lock()
+			delete(summariesInProgress, bookID)
+			summariesInProgressMu.Unlock()
+		}()
+		summary, err := generateBookSummary(bookID)
+		if err != nil {
+			log.Printf("⚠️ Failed to generate summary of book %d: %v", bookID, err)
+			return
+		}
+		if err := db.Model(&Book{}).Where("id = ? AND content_hash = ?", bookID, hash).Update("summary", summary).Error; err != nil {
+			log.Printf("⚠️ Failed to save summary of book %d: %v", bookID, err)
+		}
+	}()
+	return true
+}
+
+// getBookSummaryHandler returns the cached synopsis of a book. On first use, or when
+// ?regenerate=true is passed, it starts generating one in the background and responds
+// 202; the client asks again later.
+func getBookSummaryHandler(c *gin.Context) {
+	var book Book
+	if err := db.Select("id", "user_id", "summary", "content_hash").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	if book.Summary != "" && c.Query("regenerate") != "true" {
+		c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "summary": book.Summary, "cached": true})
+		return
+	}
+
+	message := "Summary generation started; request it again shortly"
+	if !startBookSummary(book.ID, book.ContentHash) {
+		message = "Summary is already being generated; request it again shortly"
+	}
+	c.JSON(http.StatusAccepted, gin.H{"book_id": book.ID, "status": "generating", "message": message})
+}
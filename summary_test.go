@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// summaryAPI answers chat completions with a fixed synopsis and counts the calls.
+func summaryAPI(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	var calls atomic.Int32
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "A girl finds a door."}}},
+		})
+	})
+	return &calls
+}
+
+// expectSummaryBook expects the handler's lookup of book 3 with the given cached summary.
+func expectSummaryBook(mock sqlmock.Sqlmock, summary string) {
+	mock.ExpectQuery(`SELECT "id","user_id","summary","content_hash" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs("3", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "summary", "content_hash"}).AddRow(3, 7, summary, "abc"))
+}
+
+// waitForSummary waits until no summary of bookID is being generated any more.
+func waitForSummary(t *testing.T, bookID uint) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		summariesInProgressMu.Lock()
+		running := summariesInProgress[bookID]
+		summariesInProgressMu.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("summary of book %d still generating", bookID)
+}
+
+// getSummary requests the summary of book 3 as user 7.
+func getSummary(query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/summary", getBookSummaryHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/summary"+query, nil))
+	return w
+}
+
+func TestBookSummaryGeneratedOnceThenCached(t *testing.T) {
+	calls := summaryAPI(t)
+	mock := mockDB(t)
+	expectSummaryBook(mock, "")
+	mock.ExpectQuery(`SELECT "id","content","content_key" FROM "book_chunks" WHERE book_id = \$1 ORDER BY "index" ASC`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "content_key"}).AddRow(10, "Once upon a time a girl found a door.", ""))
+	// The summary is saved only if the book's text has not changed meanwhile
+	expectWrite(mock, `UPDATE "books" SET "summary"=\$1,"updated_at"=\$2 WHERE \(id = \$3 AND content_hash = \$4\)`).
+		WithArgs("A girl finds a door.", sqlmock.AnyArg(), uint(3), "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if w := getSummary(""); w.Code != http.StatusAccepted {
+		t.Fatalf("first request = %d, want 202: %s", w.Code, w.Body)
+	}
+	waitForSummary(t, 3)
+
+	// Later requests are answered from the book without calling GPT
+	expectSummaryBook(mock, "A girl finds a door.")
+	w := getSummary("")
+	var body struct {
+		Summary string `json:"summary"`
+		Cached  bool   `json:"cached"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || body.Summary != "A girl finds a door." || !body.Cached {
+		t.Errorf("second request = %d %s, want the cached summary", w.Code, w.Body)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d GPT calls, want 1", n)
+	}
+}
+
+func TestBookSummaryRegenerate(t *testing.T) {
+	calls := summaryAPI(t)
+	mock := mockDB(t)
+	expectSummaryBook(mock, "An old summary.")
+	mock.ExpectQuery(`SELECT "id","content","content_key" FROM "book_chunks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "content_key"}).AddRow(10, "Once upon a time.", ""))
+	expectWrite(mock, `UPDATE "books" SET "summary"=\$1`).
+		WithArgs("A girl finds a door.", sqlmock.AnyArg(), uint(3), "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if w := getSummary("?regenerate=true"); w.Code != http.StatusAccepted {
+		t.Fatalf("regenerate = %d, want 202: %s", w.Code, w.Body)
+	}
+	waitForSummary(t, 3)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d GPT calls, want 1", n)
+	}
+}
+
+func TestGenerateBookSummaryMapReduce(t *testing.T) {
+	calls := summaryAPI(t)
+	mock := mockDB(t)
+	// Two pages too long for one call are summarised separately, then together
+	page := strings.Repeat("The girl walked on. ", summaryPieceBytes/20/2+100)
+	mock.ExpectQuery(`SELECT "id","content","content_key" FROM "book_chunks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "content_key"}).AddRow(10, page, "").AddRow(11, page, ""))
+
+	summary, err := generateBookSummary(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != "A girl finds a door." || calls.Load() != 3 {
+		t.Errorf("summary = %q after %d calls, want 2 partial summaries and a final one", summary, calls.Load())
+	}
+}
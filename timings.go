@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WordTiming is when one word is spoken, in seconds from the start of the chunk audio.
+type WordTiming struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// elevenLabsAlignment is the per-character timing returned by ElevenLabs.
+type elevenLabsAlignment struct {
+	Characters []string  `json:"characters"`
+	Starts     []float64 `json:"character_start_times_seconds"`
+	Ends       []float64 `json:"character_end_times_seconds"`
+}
+
+// elevenLabsTimedResponse is the body of the ElevenLabs with-timestamps endpoint.
+type elevenLabsTimedResponse struct {
+	AudioBase64 string               `json:"audio_base64"`
+	Alignment   *elevenLabsAlignment `json:"alignment"`
+}
+
+// wordTimingsFromAlignment groups character timings into words split on whitespace.
+// A malformed alignment (mismatched lengths) yields no timings.
+func wordTimingsFromAlignment(a elevenLabsAlignment) []WordTiming {
+	if len(a.Characters) != len(a.Starts) || len(a.Characters) != len(a.Ends) {
+		return nil
+	}
+	var words []WordTiming
+	var cur *WordTiming
+	for i, ch := range a.Characters {
+		if ch == "" || unicode.IsSpace([]rune(ch)[0]) {
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			words = append(words, WordTiming{Start: a.Starts[i]})
+			cur = &words[len(words)-1]
+		}
+		cur.Word += ch
+		cur.End = a.Ends[i]
+	}
+	return words
+}
+
+// encodeWordTimings serialises timings for BookChunk.WordTimings; nil stays empty.
+func encodeWordTimings(timings []WordTiming) string {
+	if len(timings) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(timings)
+	if err != nil {
+		log.Printf("⚠️ Failed to encode word timings: %v", err)
+		return ""
+	}
+	return string(b)
+}
+
+// getChunkTimingsHandler returns the word timings of one page (0-based chunk index) for
+// word-by-word highlighting. Pages narrated by a provider without timings report available=false.
+func getChunkTimingsHandler(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid chunk index", nil)
+		return
+	}
+
+	var book Book
+	if err := db.Select("id", "user_id").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	var chunk BookChunk
+	if err := db.Where("book_id = ? AND \"index\" = ?", book.ID, index).First(&chunk).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeChunkNotFound, "Chunk not found", nil)
+		return
+	}
+
+	timings := []WordTiming{}
+	if chunk.WordTimings != "" {
+		if err := json.Unmarshal([]byte(chunk.WordTimings), &timings); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Stored timings are invalid", err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":     book.ID,
+		"index":       index,
+		"narrated_by": chunk.NarratedBy,
+		"available":   len(timings) > 0,
+		"timings":     timings,
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWordTimingsFromAlignment(t *testing.T) {
+	tests := []struct {
+		name string
+		a    elevenLabsAlignment
+		want []WordTiming
+	}{
+		{"empty", elevenLabsAlignment{}, nil},
+		{
+			"mismatched lengths",
+			elevenLabsAlignment{Characters: []string{"a", "b"}, Starts: []float64{0}, Ends: []float64{0.1, 0.2}},
+			nil,
+		},
+		{
+			"words split on whitespace",
+			elevenLabsAlignment{
+				Characters: []string{" ", "H", "i", " ", "y", "o", "u", "\n"},
+				Starts:     []float64{0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7},
+				Ends:       []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8},
+			},
+			[]WordTiming{{Word: "Hi", Start: 0.1, End: 0.3}, {Word: "you", Start: 0.4, End: 0.7}},
+		},
+		{
+			"empty character ends a word",
+			elevenLabsAlignment{
+				Characters: []string{"a", "", "é"},
+				Starts:     []float64{0, 0.1, 0.2},
+				Ends:       []float64{0.1, 0.2, 0.3},
+			},
+			[]WordTiming{{Word: "a", Start: 0, End: 0.1}, {Word: "é", Start: 0.2, End: 0.3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wordTimingsFromAlignment(tt.a); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("wordTimingsFromAlignment() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChatUsage is the token accounting returned by the chat/completions API.
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// TokenUsage records the OpenAI usage of one API call made while processing a book.
+type TokenUsage struct {
+	ID               uint   `gorm:"primaryKey"`
+	BookID           uint   `gorm:"index"`
+	Model            string `gorm:"index"`
+	Purpose          string // ssml, segmentation, sound_events, music_prompt, tts
+	PromptTokens     int
+	CompletionTokens int
+	Characters       int // TTS input characters; the speech endpoint reports no token usage
+	CreatedAt        time.Time
+}
+
+// ModelRate is the price in USD per million prompt tokens, completion tokens and TTS characters.
+type ModelRate struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	Characters float64 `json:"characters"`
+}
+
+// defaultModelRates are used when OPENAI_MODEL_RATES does not override a model.
+var defaultModelRates = map[string]ModelRate{
+	"gpt-4o":          {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":     {Prompt: 0.15, Completion: 0.60},
+	"gpt-4o-mini-tts": {Characters: 15.00},
+}
+
+// modelRates merges OPENAI_MODEL_RATES (a JSON object of model -> ModelRate) over the defaults.
+func modelRates() map[string]ModelRate {
+	rates := make(map[string]ModelRate, len(defaultModelRates))
+	for k, v := range defaultModelRates {
+		rates[k] = v
+	}
+	if raw := getEnv("OPENAI_MODEL_RATES", ""); raw != "" {
+		var custom map[string]ModelRate
+		if err := json.Unmarshal([]byte(raw), &custom); err != nil {
+			log.Printf("⚠️ Invalid OPENAI_MODEL_RATES, using defaults: %v", err)
+		} else {
+			for k, v := range custom {
+				rates[k] = v
+			}
+		}
+	}
+	return rates
+}
+
+// recordChatUsage stores the usage of a chat completion made for bookID.
+// Calls not tied to a book (bookID 0) are not recorded.
+func recordChatUsage(bookID uint, model, purpose string, usage ChatUsage) {
+	if bookID == 0 || (usage.PromptTokens == 0 && usage.CompletionTokens == 0) {
+		return
+	}
+	row := TokenUsage{
+		BookID:           bookID,
+		Model:            model,
+		Purpose:          purpose,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+	if err := db.Create(&row).Error; err != nil {
+		log.Printf("⚠️ Failed to record token usage for book %d: %v", bookID, err)
+	}
+}
+
+// recordTTSUsage stores the number of characters sent to the speech endpoint for bookID.
+func recordTTSUsage(bookID uint, model string, characters int) {
+	if bookID == 0 || characters == 0 {
+		return
+	}
+	row := TokenUsage{BookID: bookID, Model: model, Purpose: "tts", Characters: characters}
+	if err := db.Create(&row).Error; err != nil {
+		log.Printf("⚠️ Failed to record TTS usage for book %d: %v", bookID, err)
+	}
+}
+
+// estimateCost returns the USD cost of the given usage at rate.
+func estimateCost(rate ModelRate, prompt, completion, characters int) float64 {
+	return (float64(prompt)*rate.Prompt + float64(completion)*rate.Completion + float64(characters)*rate.Characters) / 1_000_000
+}
+
+// getBookUsageHandler returns token usage and estimated cost per model for one of the caller's books.
+func getBookUsageHandler(c *gin.Context) {
+	var book Book
+	if err := db.First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+
+	var rows []struct {
+		Model            string
+		PromptTokens     int
+		CompletionTokens int
+		Characters       int
+	}
+	if err := db.Model(&TokenUsage{}).
+		Select("model, SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, SUM(characters) AS characters").
+		Where("book_id = ?", book.ID).
+		Group("model").
+		Scan(&rows).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to fetch usage", err.Error())
+		return
+	}
+
+	rates := modelRates()
+	models := make([]gin.H, 0, len(rows))
+	var totalPrompt, totalCompletion, totalChars int
+	totalCost := 0.0
+	for _, r := range rows {
+		cost := estimateCost(rates[r.Model], r.PromptTokens, r.CompletionTokens, r.Characters)
+		totalPrompt += r.PromptTokens
+		totalCompletion += r.CompletionTokens
+		totalChars += r.Characters
+		totalCost += cost
+		models = append(models, gin.H{
+			"model":              r.Model,
+			"prompt_tokens":      r.PromptTokens,
+			"completion_tokens":  r.CompletionTokens,
+			"tts_characters":     r.Characters,
+			"estimated_cost_usd": cost,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":            book.ID,
+		"prompt_tokens":      totalPrompt,
+		"completion_tokens":  totalCompletion,
+		"tts_characters":     totalChars,
+		"estimated_cost_usd": totalCost,
+		"models":             models,
+	})
+}
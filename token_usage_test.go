@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		name                           string
+		rate                           ModelRate
+		prompt, completion, characters int
+		want                           float64
+	}{
+		{"chat", defaultModelRates["gpt-4o"], 1_000_000, 500_000, 0, 7.50},
+		{"small chat", defaultModelRates["gpt-4o-mini"], 2000, 1000, 0, 0.0009},
+		{"speech", defaultModelRates["gpt-4o-mini-tts"], 0, 0, 10_000, 0.15},
+		{"unknown model", ModelRate{}, 1000, 1000, 1000, 0},
+	}
+	for _, tt := range tests {
+		if got := estimateCost(tt.rate, tt.prompt, tt.completion, tt.characters); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: estimateCost = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestModelRatesOverride(t *testing.T) {
+	t.Setenv("OPENAI_MODEL_RATES", `{"gpt-4o": {"prompt": 1, "completion": 2}, "custom": {"characters": 3}}`)
+	rates := modelRates()
+	if rates["gpt-4o"] != (ModelRate{Prompt: 1, Completion: 2}) || rates["custom"] != (ModelRate{Characters: 3}) {
+		t.Errorf("overridden rates = %+v, %+v", rates["gpt-4o"], rates["custom"])
+	}
+	if rates["gpt-4o-mini"] != defaultModelRates["gpt-4o-mini"] {
+		t.Errorf("gpt-4o-mini = %+v, want the default", rates["gpt-4o-mini"])
+	}
+
+	t.Setenv("OPENAI_MODEL_RATES", "not json")
+	if rates := modelRates(); rates["gpt-4o"] != defaultModelRates["gpt-4o"] {
+		t.Errorf("invalid override: gpt-4o = %+v, want the default", rates["gpt-4o"])
+	}
+}
+
+func TestRecordUsageSkipsEmptyCalls(t *testing.T) {
+	mock := mockDB(t)
+	// Calls without a book or without usage write nothing, so the only insert is the
+	// last one
+	expectInsert(mock, `INSERT INTO "token_usages"`, 1).
+		WithArgs(uint(3), "gpt-4o", "ssml", 120, 30, 0, sqlmock.AnyArg())
+	recordChatUsage(0, "gpt-4o", "ssml", ChatUsage{PromptTokens: 10})
+	recordChatUsage(3, "gpt-4o", "ssml", ChatUsage{})
+	recordTTSUsage(3, "gpt-4o-mini-tts", 0)
+	recordChatUsage(3, "gpt-4o", "ssml", ChatUsage{PromptTokens: 120, CompletionTokens: 30})
+}
+
+func TestBookUsageHandler(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(`SELECT \* FROM "books" WHERE "books"."id" = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(3, 7))
+	mock.ExpectQuery(`SELECT model, SUM\(prompt_tokens\) AS prompt_tokens, SUM\(completion_tokens\) AS completion_tokens, SUM\(characters\) AS characters FROM "token_usages" WHERE book_id = \$1 GROUP BY "model"`).
+		WithArgs(uint(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"model", "prompt_tokens", "completion_tokens", "characters"}).
+			AddRow("gpt-4o", 400_000, 100_000, 0).
+			AddRow("gpt-4o-mini-tts", 0, 0, 200_000))
+
+	w := httptest.NewRecorder()
+	userRouter(7, http.MethodGet, "/user/books/:book_id/usage", getBookUsageHandler).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/books/3/usage", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var body struct {
+		PromptTokens     int     `json:"prompt_tokens"`
+		CompletionTokens int     `json:"completion_tokens"`
+		TTSCharacters    int     `json:"tts_characters"`
+		Cost             float64 `json:"estimated_cost_usd"`
+		Models           []struct {
+			Model string  `json:"model"`
+			Cost  float64 `json:"estimated_cost_usd"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	// gpt-4o: 0.4M prompt at $2.50 + 0.1M completion at $10; speech: 0.2M characters at $15
+	if body.PromptTokens != 400_000 || body.CompletionTokens != 100_000 || body.TTSCharacters != 200_000 {
+		t.Errorf("totals = %d/%d/%d", body.PromptTokens, body.CompletionTokens, body.TTSCharacters)
+	}
+	if len(body.Models) != 2 || math.Abs(body.Models[0].Cost-2.0) > 1e-9 || math.Abs(body.Models[1].Cost-3.0) > 1e-9 {
+		t.Errorf("models = %+v, want gpt-4o $2 and speech $3", body.Models)
+	}
+	if math.Abs(body.Cost-5.0) > 1e-9 {
+		t.Errorf("total cost = %v, want 5", body.Cost)
+	}
+}
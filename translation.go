@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// translationInputBytes bounds the text sent to GPT in one translation call.
+const translationInputBytes = 3000
+
+// needsTranslation reports whether a book narrated in its target language must be
+// translated first: a target is set and differs from the (detected) source language.
+func needsTranslation(book Book) bool {
+	return book.TargetLanguage != "" && book.TargetLanguage != book.Language
+}
+
+// translateText translates text into target with GPT, piece by piece so long text stays
+// within the model's limits.
+func translateText(text, target string, bookID uint) (string, error) {
+	pieces := splitTextIntoBatches(text, translationInputBytes)
+	translated := make([]string, 0, len(pieces))
+	for i, piece := range pieces {
+		out, err := chatCompletion(ChatRequest{
+			Model: openAIModels.Chat,
+			Messages: []ChatMessage{
+				{Role: "system", Content: fmt.Sprintf("Translate the user's text into %s for an audiobook. Keep the meaning, tone and paragraphing. Output only the translation.", languageName(target))},
+				{Role: "user", Content: piece},
+			},
+			MaxTokens:   4000,
+			Temperature: 0.3,
+		}, bookID, "translation")
+		if err != nil {
+			return "", fmt.Errorf("translate piece %d/%d: %w", i+1, len(pieces), err)
+		}
+		translated = append(translated, out)
+	}
+	return strings.Join(translated, " "), nil
+}
+
+// prepareChunkText returns the text to narrate for a chunk. For books with a target
+// language the chunk is translated once: the translation replaces Content and the
+// source text is kept in OriginalContent.
+func prepareChunkText(chunk *BookChunk) (string, error) {
+	if err := loadChunkContent(chunk); err != nil {
+		return "", err
+	}
+	if chunk.OriginalContent != "" {
+		return chunk.Content, nil
+	}
+	var book Book
+	if err := db.Select("id", "language", "target_language").First(&book, chunk.BookID).Error; err != nil || !needsTranslation(book) {
+		return chunk.Content, nil
+	}
+
+	translated, err := translateText(chunk.Content, book.TargetLanguage, book.ID)
+	if err != nil {
+		return "", err
+	}
+	sealedOriginal, err := encryptContent(chunk.Content)
+	if err != nil {
+		return "", err
+	}
+	updates, err := chunkContentColumns(chunk.BookID, chunk.Index, translated)
+	if err != nil {
+		return "", err
+	}
+	updates["original_content"] = sealedOriginal
+	if err := db.Model(&BookChunk{}).Where("id = ?", chunk.ID).Updates(updates).Error; err != nil {
+		log.Printf("⚠️ Failed to save translation of chunk %d: %v", chunk.ID, err)
+	} else {
+		dropUnusedContent(chunk.ContentKey)
+	}
+	chunk.OriginalContent, chunk.Content = chunk.Content, translated
+	return translated, nil
+}
+
+// narrationLanguage is the language a book is spoken in: its target language when
+// translating, otherwise its own language.
+func narrationLanguage(bookID uint) string {
+	if bookID == 0 {
+		return ""
+	}
+	var book Book
+	if err := db.Select("id", "language", "target_language").First(&book, bookID).Error; err != nil {
+		return ""
+	}
+	if book.TargetLanguage != "" {
+		return book.TargetLanguage
+	}
+	return book.Language
+}
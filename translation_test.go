@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNeedsTranslation(t *testing.T) {
+	tests := []struct {
+		language, target string
+		want             bool
+	}{
+		{"en", "", false},
+		{"en", "en", false},
+		{"en", "es", true},
+		{"", "fr", true},
+	}
+	for _, tt := range tests {
+		if got := needsTranslation(Book{Language: tt.language, TargetLanguage: tt.target}); got != tt.want {
+			t.Errorf("needsTranslation(%q -> %q) = %v, want %v", tt.language, tt.target, got, tt.want)
+		}
+	}
+}
+
+// translationAPI answers chat completions with a Spanish translation and counts the
+// calls in *calls.
+func translationAPI(t *testing.T, calls *int) {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	stubAPIs(t, func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !strings.Contains(req.Messages[0].Content, "into Spanish") {
+			t.Errorf("system prompt = %q, want a translation into Spanish", req.Messages[0].Content)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": "Había una vez."}}},
+		})
+	})
+}
+
+// expectChunkLanguages expects prepareChunkText's lookup of book 3's languages.
+func expectChunkLanguages(mock sqlmock.Sqlmock, language, target string) {
+	mock.ExpectQuery(`SELECT "id","language","target_language" FROM "books" WHERE "books"."id" = \$1`).
+		WithArgs(uint(3), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "language", "target_language"}).AddRow(3, language, target))
+}
+
+func TestPrepareChunkTextTranslatesToTarget(t *testing.T) {
+	var calls int
+	translationAPI(t, &calls)
+	mock := mockDB(t)
+	expectChunkLanguages(mock, "en", "es")
+	// The translation is narrated and stored; the source text is kept as the original
+	expectWrite(mock, `UPDATE "book_chunks" SET "content"=\$1,"content_key"=\$2,"original_content"=\$3,"updated_at"=\$4 WHERE id = \$5`).
+		WithArgs("Había una vez.", "", "Once upon a time.", sqlmock.AnyArg(), uint(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	chunk := BookChunk{ID: 10, BookID: 3, Content: "Once upon a time."}
+	text, err := prepareChunkText(&chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Había una vez." || chunk.Content != text || chunk.OriginalContent != "Once upon a time." {
+		t.Errorf("text = %q, chunk = %q (original %q)", text, chunk.Content, chunk.OriginalContent)
+	}
+	if calls != 1 {
+		t.Errorf("%d translation calls, want 1", calls)
+	}
+}
+
+func TestPrepareChunkTextSkipsTranslation(t *testing.T) {
+	var calls int
+	translationAPI(t, &calls)
+	tests := []struct {
+		name     string
+		target   string
+		original string
+	}{
+		{"target matches source", "en", ""},
+		{"no target", "", ""},
+		{"already translated", "es", "Once upon a time."},
+	}
+	for _, tt := range tests {
+		mock := mockDB(t)
+		if tt.original == "" {
+			expectChunkLanguages(mock, "en", tt.target)
+		}
+		chunk := BookChunk{ID: 10, BookID: 3, Content: "Page text.", OriginalContent: tt.original}
+		text, err := prepareChunkText(&chunk)
+		if err != nil || text != "Page text." {
+			t.Errorf("%s: text = %q, %v, want the stored content", tt.name, text, err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("%d translation calls, want none", calls)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -42,17 +43,59 @@ type TTSPayload struct {
 	Speed          float64 `json:"speed,omitempty"`
 }
 
-func generateSSML(rawText string) (string, error) {
-	systemContent := `You are an expressive audiobook narrator.
-Convert this into SSML:
-- Use <break time="500ms"/> at natural pauses
-- Wrap key phrases in <emphasis>
-- Use <prosody rate="80%">…</prosody> for sad passages
-- Use <prosody rate="110%">…</prosody> for action passages
-Output only the SSML wrapped in one <speak>…</speak> block.`
+// allowedVoices lists the OpenAI voices a book or user preference may select.
+var allowedVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+// defaultSpeechSpeed is the OpenAI speech speed of books without a Speed.
+const defaultSpeechSpeed = 1.0
+
+// isValidVoice reports whether v is a supported OpenAI voice ("" means the default).
+func isValidVoice(v string) bool {
+	if v == "" {
+		return true
+	}
+	for _, allowed := range allowedVoices {
+		if strings.EqualFold(v, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// voiceOrDefault returns v, or narratorVoice when v is empty.
+func voiceOrDefault(v string) string {
+	if v == "" {
+		return narratorVoice()
+	}
+	return v
+}
+
+// sameNarration narrows q to books narrated like book: same provider, voice, speed,
+// multi-voice setting and target language. Audio is only reused between such books,
+// since identical text narrated differently is not the same audio.
+func sameNarration(q *gorm.DB, book Book) *gorm.DB {
+	return q.Where("COALESCE(NULLIF(tts_provider, ''), ?) = ?", ttsProviderOpenAI, narratorFor(book.TTSProvider).Name()).
+		Where("multi_voice = ? AND COALESCE(target_language, '') = ?", book.MultiVoice, book.TargetLanguage).
+		Where("COALESCE(NULLIF(voice, ''), ?) = ?", narratorVoice(), voiceOrDefault(book.Voice)).
+		Where("COALESCE(speed, ?) = ?", defaultSpeechSpeed, floatOrDefault(book.Speed, defaultSpeechSpeed))
+}
+
+// bookVoice returns the OpenAI voice and speed a book is narrated with.
+func bookVoice(bookID uint) (string, float64) {
+	var book Book
+	if err := db.Select("id", "voice", "speed").First(&book, bookID).Error; err != nil {
+		log.Printf("⚠️ Could not load voice for book %d, using default: %v", bookID, err)
+	}
+	return voiceOrDefault(book.Voice), floatOrDefault(book.Speed, defaultSpeechSpeed)
+}
+
+// generateSSML asks GPT to mark up rawText as SSML, with the prompt template for the
+// language the book is narrated in.
+func generateSSML(rawText string, bookID uint) (string, error) {
+	systemContent := ssmlSystemPrompt(narrationLanguage(bookID))
 
 	reqBody := ChatRequest{
-		Model: "gpt-4o",
+		Model: openAIModels.Chat,
 		Messages: []ChatMessage{
 			{Role: "system", Content: systemContent},
 			{Role: "user", Content: rawText},
@@ -87,6 +130,7 @@ Output only the SSML wrapped in one <speak>…</speak> block.`
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
 		return "", fmt.Errorf("decode SSML JSON: %w", err)
 	}
+	recordChatUsage(bookID, reqBody.Model, "ssml", chatResp.Usage)
 	if len(chatResp.Choices) == 0 {
 		return "", errors.New("no SSML choices returned")
 	}
@@ -99,149 +143,263 @@ Output only the SSML wrapped in one <speak>…</speak> block.`
 	raw = strings.ReplaceAll(raw, "```xml ssml", "")
 	raw = strings.TrimPrefix(raw, "```")
 	raw = strings.TrimSuffix(raw, "```")
-	ssml := wrapSSML(raw)
+	ssml := safeSSML(wrapSSML(raw), rawText, bookID)
 	log.Printf("SSML: %s", ssml)
 	return ssml, nil
 }
 
-func convertTextToAudio(text string, bookID uint) (string, error) {
-	ssml, err := generateSSML(text)
+// convertTextToAudio narrates text with OpenAI TTS into narrationPath(name).
+// Token and character usage is recorded against bookID.
+func convertTextToAudio(text string, name string, bookID uint) (string, error) {
+	ssml, err := generateSSML(text, bookID)
 	if err != nil {
 		return "", fmt.Errorf("SSML generation failed: %w", err)
 	}
 	ssml = wrapSSML(ssml)
 
+	path := narrationPath(name)
+	voice, speed := bookVoice(bookID)
+	if err := synthesizeSpeech(ssml, voice, "Interpret SSML with breaks, prosody, emphasis. Do not speak tags.", path, speed, bookID); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ttsTimeout is the request timeout for narrating chars characters: TTS_TIMEOUT_PER_1K_CHARS
+// (default 20s) per thousand characters on top of TTS_TIMEOUT_MIN (default 30s), capped
+// at TTS_TIMEOUT_MAX (default 5m). Big pages get time to finish; tiny ones fail fast.
+func ttsTimeout(chars int) time.Duration {
+	minimum, err := time.ParseDuration(getEnv("TTS_TIMEOUT_MIN", "30s"))
+	if err != nil || minimum <= 0 {
+		minimum = 30 * time.Second
+	}
+	maximum, err := time.ParseDuration(getEnv("TTS_TIMEOUT_MAX", "5m"))
+	if err != nil || maximum < minimum {
+		maximum = max(5*time.Minute, minimum)
+	}
+	perK, err := time.ParseDuration(getEnv("TTS_TIMEOUT_PER_1K_CHARS", "20s"))
+	if err != nil || perK < 0 {
+		perK = 20 * time.Second
+	}
+	return min(minimum+perK*time.Duration(chars)/1000, maximum)
+}
+
+// synthesizeSpeech sends input to the OpenAI speech endpoint with the given voice and
+// speed and writes the MP3 to path. Character usage is recorded against bookID.
+func synthesizeSpeech(input, voice, instructions, path string, speed float64, bookID uint) error {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		return "", errors.New("OPENAI_API_KEY not set")
+		return errors.New("OPENAI_API_KEY not set")
 	}
 
 	payload := TTSPayload{
-		Input:          ssml,
-		Model:          "gpt-4o-mini-tts",
-		Voice:          "alloy",
-		Instructions:   "Interpret SSML with breaks, prosody, emphasis. Do not speak tags.",
+		Input:          input,
+		Model:          openAIModels.TTS,
+		Voice:          voice,
+		Instructions:   instructions + languageInstruction(narrationLanguage(bookID)),
 		ResponseFormat: "mp3",
-		Speed:          1.0,
+		Speed:          speed,
 	}
 	reqBody, _ := json.Marshal(payload)
 
 	req, err := http.NewRequest("POST", openaiTTSEndpoint, bytes.NewReader(reqBody))
 	if err != nil {
-		return "", fmt.Errorf("create TTS request: %w", err)
+		return fmt.Errorf("create TTS request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 120 * time.Second}
+	client := &http.Client{Timeout: ttsTimeout(len([]rune(input)))}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("TTS API request error: %w", err)
+		return fmt.Errorf("TTS API request error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return "", fmt.Errorf("TTS API returned %d: %s", resp.StatusCode, body)
+		return fmt.Errorf("TTS API returned %d: %s", resp.StatusCode, body)
 	}
 
-	if err := os.MkdirAll("./audio", 0755); err != nil {
-		return "", err
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
 	}
 
-	filename := fmt.Sprintf("audio_%d.mp3", bookID)
-	path := "./audio/" + filename
-
 	outFile, err := os.Create(path)
 	if err != nil {
-		return "", fmt.Errorf("create audio file: %w", err)
+		return fmt.Errorf("create audio file: %w", err)
 	}
-	defer outFile.Close()
-
-	if _, err := io.Copy(outFile, resp.Body); err != nil {
-		return "", fmt.Errorf("write audio: %w", err)
+	_, err = io.Copy(outFile, resp.Body)
+	outFile.Close()
+	if err != nil {
+		return fmt.Errorf("write audio: %w", err)
 	}
-	return path, nil
+	if err := validateAudioFile(path); err != nil {
+		return fmt.Errorf("TTS returned unusable audio: %w", err)
+	}
+	recordTTSUsage(bookID, payload.Model, len([]rune(payload.Input)))
+	return nil
 }
 
-func processBookConversion(book Book) {
-	// 0) Ensure file exists
-	if _, err := os.Stat(book.FilePath); os.IsNotExist(err) {
-		log.Printf("🚫 File does not exist for book ID %d: %s", book.ID, book.FilePath)
-		updateBookStatus(book.ID, "failed")
+// processBookConversion runs whole-book TTS. requestID is the ID of the request that
+// started the conversion and is attached to every log line.
+func processBookConversion(book Book, requestID string) {
+	// 0) Ensure the files exist
+	files, err := bookSourceFiles(db, book)
+	if err != nil || len(files) == 0 {
+		logWithRequestID(requestID, "🚫 No source files for book ID %d: %v", book.ID, err)
+		updateBookStatus(book.ID, bookStatusFailed)
 		return
 	}
+	for _, f := range files {
+		if _, err := os.Stat(f.FilePath); os.IsNotExist(err) {
+			logWithRequestID(requestID, "🚫 File does not exist for book ID %d: %s", book.ID, f.FilePath)
+			updateBookStatus(book.ID, bookStatusFailed)
+			return
+		}
+	}
 
 	// 1) Compute content hash if not already stored
 	if book.ContentHash == "" {
-		hash, err := computeFileHash(book.FilePath)
+		hash, err := bookFilesHash(files)
 		if err != nil {
-			log.Printf("❌ Failed to compute content hash for book ID %d: %v", book.ID, err)
-			updateBookStatus(book.ID, "failed")
+			logWithRequestID(requestID, "❌ Failed to compute content hash for book ID %d: %v", book.ID, err)
+			updateBookStatus(book.ID, bookStatusFailed)
 			return
 		}
 		book.ContentHash = hash
 		if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("content_hash", hash).Error; err != nil {
-			log.Printf("⚠️ Failed to save content hash: %v", err)
+			logWithRequestID(requestID, "⚠️ Failed to save content hash: %v", err)
 		}
 	}
 
-	// 2) Check if audio already exists for this content hash
+	// 2) Check if audio already exists for this content hash and narration. The lock makes a
+	// concurrent book with identical content wait here until this one has saved its
+	// audio, so it reuses it instead of narrating the same text again.
+	unlock, err := lockContentHash(book.ContentHash)
+	if err != nil {
+		logWithRequestID(requestID, "⚠️ Could not lock content hash for book ID %d, continuing unlocked: %v", book.ID, err)
+	} else {
+		defer unlock()
+	}
+
 	var dup Book
-	err := db.Where("content_hash = ? AND audio_path IS NOT NULL AND audio_path <> ''", book.ContentHash).First(&dup).Error
+	err = sameNarration(db, book).
+		Where("id <> ? AND content_hash = ? AND audio_path IS NOT NULL AND audio_path <> ''", book.ID, book.ContentHash).
+		First(&dup).Error
 	if err == nil {
-		log.Printf("🔁 Reusing audio from book ID %d for book ID %d", dup.ID, book.ID)
-		if err := db.Model(&Book{}).Where("id = ?", book.ID).Updates(Book{
-			AudioPath: dup.AudioPath,
-			Status:    "TTS reused",
+		logWithRequestID(requestID, "🔁 Reusing audio from book ID %d for book ID %d", dup.ID, book.ID)
+		if err := db.Model(&Book{}).Where("id = ? AND status IN ?", book.ID, bookStatusPredecessors(bookStatusReused)).Updates(Book{
+			AudioPath:        dup.AudioPath,
+			AudioPathMP3:     dup.AudioPathMP3,
+			AudioPathOpus:    dup.AudioPathOpus,
+			Status:           bookStatusReused,
+			ReusedFromBookID: &dup.ID,
 		}).Error; err != nil {
-			log.Printf("⚠️ Error saving reused audio for book ID %d: %v", book.ID, err)
+			logWithRequestID(requestID, "⚠️ Error saving reused audio for book ID %d: %v", book.ID, err)
 		}
 		return
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		log.Printf("⚠️ Error checking for existing audio: %v", err)
+		logWithRequestID(requestID, "⚠️ Error checking for existing audio: %v", err)
 	}
 
-	// 3) Read file content
-	contentBytes, err := os.ReadFile(book.FilePath)
+	// 3) Read the content of every file, in order
+	text, err := readBookText(files)
 	if err != nil {
-		log.Printf("📛 Error reading file for book ID %d: %v", book.ID, err)
-		updateBookStatus(book.ID, "failed")
+		logWithRequestID(requestID, "📛 Error reading file for book ID %d: %v", book.ID, err)
+		updateBookStatus(book.ID, bookStatusFailed)
 		return
 	}
+	text, truncated, err := limitContent(text, 0)
+	if err != nil {
+		logWithRequestID(requestID, "🚫 Book ID %d is too long to narrate: %v", book.ID, err)
+		updateBookStatus(book.ID, bookStatusFailed)
+		return
+	}
+	if truncated {
+		logWithRequestID(requestID, "✂️ Narrating only the first %d characters of book ID %d", maxContentChars(), book.ID)
+		db.Model(&Book{}).Where("id = ?", book.ID).Update("content_truncated", true)
+	}
 
-	// 4) Convert to TTS
-	ttsPath, err := convertTextToAudio(string(contentBytes), book.ID)
+	// 3b) Refuse to narrate content the moderation policy blocks
+	if moderationEnabled() {
+		rejected, categories, err := moderateBook(book.ID, text)
+		if err != nil {
+			logWithRequestID(requestID, "⚠️ Moderation failed for book ID %d: %v", book.ID, err)
+			updateBookStatus(book.ID, bookStatusFailed)
+			return
+		}
+		saveBookModeration(book.ID, book.ContentHash, rejected, categories)
+		if rejected {
+			logWithRequestID(requestID, "🚫 Book ID %d rejected by moderation: %s", book.ID, strings.Join(categories, ", "))
+			return
+		}
+	}
+
+	// 3c) Translate into the book's target language
+	if needsTranslation(book) {
+		translated, err := translateText(text, book.TargetLanguage, book.ID)
+		if err != nil {
+			logWithRequestID(requestID, "🌐 Translation failed for book ID %d: %v", book.ID, err)
+			updateBookStatus(book.ID, bookStatusFailed)
+			return
+		}
+		text = translated
+	}
+
+	// 4) Convert to TTS with the book's selected provider, falling back if it keeps failing.
+	// This is a new narration of the whole book, counted again once it completes.
+	if err := resetBookUsage(db, book.ID); err != nil {
+		logWithRequestID(requestID, "⚠️ Failed to reset usage of book ID %d: %v", book.ID, err)
+	}
+	narration, err := narrateWithFallback(book.TTSProvider, text, bookNarrationName(book.ID), book.ID)
 	if err != nil {
-		log.Printf("🎙️ Error converting text to audio for book ID %d: %v", book.ID, err)
-		updateBookStatus(book.ID, "failed")
+		logWithRequestID(requestID, "🎙️ Error converting text to audio for book ID %d: %v", book.ID, err)
+		updateBookStatus(book.ID, bookStatusFailed)
 		return
 	}
-	log.Printf("✅ TTS audio file generated: %s for book ID %d", ttsPath, book.ID)
+	ttsPath, narratedBy := narration.Path, narration.Provider
+	logWithRequestID(requestID, "✅ TTS audio file generated: %s for book ID %d by %s", ttsPath, book.ID, narratedBy)
+
+	// 4b) Mark where each source file starts so players can jump between chapters
+	if chapters, err := bookChapters(Book{ID: book.ID, AudioPath: ttsPath}); err != nil {
+		logWithRequestID(requestID, "⚠️ Failed to load chapters for book ID %d: %v", book.ID, err)
+	} else if err := embedChapters(backgroundCtx, ttsPath, chapters); err != nil {
+		logWithRequestID(requestID, "⚠️ Failed to embed chapters for book ID %d: %v", book.ID, err)
+	}
 
 	// 5) Save TTS result before adding effects
-	if err := db.Model(&Book{}).Where("id = ?", book.ID).Updates(map[string]interface{}{
-		"audio_path": ttsPath,
-		"status":     "TTS completed",
+	if err := db.Model(&Book{}).Where("id = ? AND status IN ?", book.ID, bookStatusPredecessors(bookStatusTTSCompleted)).Updates(map[string]interface{}{
+		"audio_path":  ttsPath,
+		"narrated_by": narratedBy,
+		"status":      bookStatusTTSCompleted,
 	}).Error; err != nil {
-		log.Printf("⚠️ Error updating TTS result for book ID %d: %v", book.ID, err)
+		logWithRequestID(requestID, "⚠️ Error updating TTS result for book ID %d: %v", book.ID, err)
 		return
 	}
 
+	if dur, err := getTTSDuration(ttsPath); err == nil {
+		recordBookUsage(book.ID, book.UserID, dur)
+	}
+	storeBookAudioVariants(backgroundCtx, book.ID, ttsPath)
+	generateBookHLS(backgroundCtx, book.ID, ttsPath)
+
 	// 6) Launch sound effects and merging in the background
-	log.Printf("🚀 Launching effects merge with hash: %s for book ID %d", book.ContentHash, book.ID)
+	logWithRequestID(requestID, "🚀 Launching effects merge with hash: %s for book ID %d", book.ContentHash, book.ID)
 	go processSoundEffectsAndMerge(book, book.ContentHash, nil)
 }
 
-// updateBookStatus updates the status of a book in the database.
-func updateBookStatus(bookID uint, status string) {
-	var book Book
-	if err := db.First(&book, bookID).Error; err != nil {
-		log.Printf("Error finding book with ID %d: %v", bookID, err)
-		return
+// updateBookStatus updates the status of a book in the database and reports whether it
+// moved. Transitions that canTransitionBook forbids are logged and skipped.
+func updateBookStatus(bookID uint, status BookStatus) bool {
+	res := transitionBooks(db.Where("id = ?", bookID), status)
+	if res.Error != nil {
+		log.Printf("Error updating status for book ID %d: %v", bookID, res.Error)
+		return false
 	}
-
-	if err := db.Model(&Book{}).Where("id = ?", book.ID).Update("status", status).Error; err != nil {
-		log.Printf("Error updating status for book ID %d: %v", book.ID, err)
+	if res.RowsAffected == 0 {
+		log.Printf("⚠️ Refusing to move book ID %d to %q: missing, or its status cannot move there", bookID, status)
+		return false
 	}
+	return true
 }
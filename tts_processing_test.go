@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTTSTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		chars int
+		want  time.Duration
+	}{
+		{"defaults, empty page", nil, 0, 30 * time.Second},
+		{"defaults, 1k characters", nil, 1000, 50 * time.Second},
+		{"defaults, capped", nil, 100000, 5 * time.Minute},
+		{"custom rate", map[string]string{"TTS_TIMEOUT_MIN": "10s", "TTS_TIMEOUT_PER_1K_CHARS": "1m"}, 500, 40 * time.Second},
+		{"custom cap", map[string]string{"TTS_TIMEOUT_MAX": "45s"}, 2000, 45 * time.Second},
+		{"cap below minimum", map[string]string{"TTS_TIMEOUT_MIN": "10m", "TTS_TIMEOUT_MAX": "1m"}, 0, 10 * time.Minute},
+		{"invalid values", map[string]string{"TTS_TIMEOUT_MIN": "soon", "TTS_TIMEOUT_MAX": "-1s", "TTS_TIMEOUT_PER_1K_CHARS": "-5s"}, 1000, 50 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TTS_TIMEOUT_MIN", "TTS_TIMEOUT_MAX", "TTS_TIMEOUT_PER_1K_CHARS"} {
+				t.Setenv(key, "")
+				if v, ok := tt.env[key]; ok {
+					os.Setenv(key, v)
+				} else {
+					os.Unsetenv(key)
+				}
+			}
+			if got := ttsTimeout(tt.chars); got != tt.want {
+				t.Fatalf("ttsTimeout(%d) = %v, want %v", tt.chars, got, tt.want)
+			}
+		})
+	}
+}
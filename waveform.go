@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	waveformDir = "./audio/waveforms"
+	// waveformSampleRate is the rate audio is decoded at for peak detection; plenty for
+	// a few thousand bars and keeps the PCM small (about 14 MB per hour)
+	waveformSampleRate = 2000
+	// waveformCachedSamples is the resolution cached per book; requests are downsampled
+	// from it, so it is also the most a request may ask for
+	waveformCachedSamples = 5000
+)
+
+// waveformCachePath is where the high-resolution peaks of a book are cached.
+func waveformCachePath(bookID uint) string {
+	return fmt.Sprintf("%s/book_%d_peaks.json", waveformDir, bookID)
+}
+
+// waveformCacheGlob matches every cached waveform file of a book.
+func waveformCacheGlob(bookID uint) string {
+	return fmt.Sprintf("%s/book_%d_*.json", waveformDir, bookID)
+}
+
+// computeWaveform decodes path to mono PCM and returns samples peak amplitudes, each the
+// loudest sample of its slice of the audio, scaled so the loudest peak is 1.
+func computeWaveform(path string, samples int) ([]float64, error) {
+	if err := os.MkdirAll(waveformDir, 0755); err != nil {
+		return nil, err
+	}
+	pcm, err := os.CreateTemp(waveformDir, "decode_*.pcm")
+	if err != nil {
+		return nil, err
+	}
+	pcm.Close()
+	defer os.Remove(pcm.Name())
+
+	if o, err := runFFmpeg(backgroundCtx, pcm.Name(), "-y", "-i", path, "-vn", "-ac", "1",
+		"-ar", strconv.Itoa(waveformSampleRate), "-f", "s16le", "-acodec", "pcm_s16le", pcm.Name()); err != nil {
+		return nil, fmt.Errorf("decode audio: %v\n%s", err, o)
+	}
+	raw, err := os.ReadFile(pcm.Name())
+	if err != nil {
+		return nil, err
+	}
+	total := len(raw) / 2
+	if total == 0 {
+		return nil, fmt.Errorf("no audio samples in %s", path)
+	}
+
+	peaks := make([]float64, samples)
+	loudest := 0.0
+	for i := range peaks {
+		start, end := i*total/samples, (i+1)*total/samples
+		if end == start && start < total {
+			end = start + 1
+		}
+		peak := 0.0
+		for j := start; j < end; j++ {
+			v := math.Abs(float64(int16(binary.LittleEndian.Uint16(raw[2*j:]))))
+			if v > peak {
+				peak = v
+			}
+		}
+		peaks[i] = peak
+		loudest = math.Max(loudest, peak)
+	}
+	for i := range peaks {
+		if loudest > 0 {
+			peaks[i] = math.Round(peaks[i]/loudest*1000) / 1000
+		}
+	}
+	return peaks, nil
+}
+
+// downsamplePeaks reduces peaks to samples bars, each the loudest peak of its slice.
+// Inputs already at or below samples are returned as-is.
+func downsamplePeaks(peaks []float64, samples int) []float64 {
+	if len(peaks) <= samples {
+		return peaks
+	}
+	out := make([]float64, samples)
+	for i := range out {
+		start, end := i*len(peaks)/samples, (i+1)*len(peaks)/samples
+		for _, p := range peaks[start:end] {
+			out[i] = math.Max(out[i], p)
+		}
+	}
+	return out
+}
+
+// loadCachedWaveform returns the cached peaks of a book unless the audio changed after
+// they were written.
+func loadCachedWaveform(bookID uint, audioInfo os.FileInfo) ([]float64, bool) {
+	cache := waveformCachePath(bookID)
+	info, err := os.Stat(cache)
+	if err != nil || info.ModTime().Before(audioInfo.ModTime()) {
+		return nil, false
+	}
+	data, err := os.ReadFile(cache)
+	if err != nil {
+		return nil, false
+	}
+	var peaks []float64
+	if json.Unmarshal(data, &peaks) != nil || len(peaks) != waveformCachedSamples {
+		return nil, false
+	}
+	return peaks, true
+}
+
+// saveCachedWaveform writes a book's peaks to a temp file and renames it over the cache,
+// so concurrent readers never see a partial file.
+func saveCachedWaveform(bookID uint, peaks []float64) error {
+	data, err := json.Marshal(peaks)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(waveformDir, "peaks_*.partial.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), waveformCachePath(bookID))
+}
+
+// getBookWaveformHandler returns ?samples= (default 200, 10–5000) normalized peaks of
+// the book's audio for drawing a scrubber. One high-resolution set of peaks is cached
+// per book, recomputed when the audio is newer, and downsampled for each request.
+func getBookWaveformHandler(c *gin.Context) {
+	samples, err := strconv.Atoi(c.DefaultQuery("samples", "200"))
+	if err != nil || samples < 10 || samples > waveformCachedSamples {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("samples must be between 10 and %d", waveformCachedSamples), nil)
+		return
+	}
+
+	var book Book
+	if err := db.Select("id", "user_id", "audio_path").First(&book, c.Param("book_id")).Error; err != nil {
+		respondError(c, http.StatusNotFound, codeBookNotFound, "Book not found", nil)
+		return
+	}
+	if book.UserID != getUserIDFromContext(c) {
+		respondError(c, http.StatusForbidden, codeForbidden, "You do not have permission to access this book", nil)
+		return
+	}
+	audioInfo, err := os.Stat(book.AudioPath)
+	if book.AudioPath == "" || err != nil {
+		respondError(c, http.StatusNotFound, codeAudioNotFound, "Audio file not available for this book", nil)
+		return
+	}
+
+	peaks, ok := loadCachedWaveform(book.ID, audioInfo)
+	if !ok {
+		if peaks, err = computeWaveform(book.AudioPath, waveformCachedSamples); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternalError, "Failed to compute waveform", err.Error())
+			return
+		}
+		if err := saveCachedWaveform(book.ID, peaks); err != nil {
+			log.Printf("⚠️ Failed to cache waveform of book %d: %v", book.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"book_id": book.ID, "samples": samples, "peaks": downsamplePeaks(peaks, samples)})
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDownsamplePeaks(t *testing.T) {
+	tests := []struct {
+		peaks   []float64
+		samples int
+		want    []float64
+	}{
+		{[]float64{0.1, 0.5, 0.2, 0.9, 0.3, 0.4}, 3, []float64{0.5, 0.9, 0.4}},
+		{[]float64{0.1, 0.5, 0.2, 0.9, 1}, 2, []float64{0.5, 1}},
+		{[]float64{0.2, 0.4}, 2, []float64{0.2, 0.4}},
+		{[]float64{0.2, 0.4}, 10, []float64{0.2, 0.4}},
+		{[]float64{0, 0, 0, 0}, 2, []float64{0, 0}},
+	}
+	for _, tt := range tests {
+		if got := downsamplePeaks(tt.peaks, tt.samples); !slices.Equal(got, tt.want) {
+			t.Errorf("downsamplePeaks(%v, %d) = %v, want %v", tt.peaks, tt.samples, got, tt.want)
+		}
+	}
+}